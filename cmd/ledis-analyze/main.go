@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/r0123r/vredis/ledis"
+	"github.com/r0123r/vredis/store"
+)
+
+var configFile = flag.String("config", "", "ledisdb config file")
+var dataDir = flag.String("data_dir", "", "data dir, overrides the config")
+var dbName = flag.String("db_name", "", "store name, overrides the config")
+var format = flag.String("format", "text", "output format, text or json")
+var top = flag.Int("top", 10, "largest keys reported per type")
+var prefixSep = flag.String("prefix_sep", ":", "key prefix separator")
+var prefixDepth = flag.Int("prefix_depth", 1, "number of separated parts in a key prefix")
+var maxPrefixes = flag.Int("max_prefixes", 50, "max key prefixes reported")
+
+var typeNames = []string{"string", "list", "hash", "set", "zset"}
+
+// the data type of each store type
+var storeTypeNames = map[byte]string{
+	ledis.KVType:     "string",
+	ledis.ListType:   "list",
+	ledis.LMetaType:  "list",
+	ledis.HashType:   "hash",
+	ledis.HSizeType:  "hash",
+	ledis.SetType:    "set",
+	ledis.SSizeType:  "set",
+	ledis.ZSetType:   "zset",
+	ledis.ZSizeType:  "zset",
+	ledis.ZScoreType: "zset",
+}
+
+// the store types holding one entry per key
+var metaTypes = map[byte]bool{
+	ledis.KVType:    true,
+	ledis.LMetaType: true,
+	ledis.HSizeType: true,
+	ledis.SSizeType: true,
+	ledis.ZSizeType: true,
+}
+
+// the store types holding one entry per member
+var memberTypes = map[byte]bool{
+	ledis.KVType:   true,
+	ledis.ListType: true,
+	ledis.HashType: true,
+	ledis.SetType:  true,
+	ledis.ZSetType: true,
+}
+
+type ttlBucket struct {
+	Name  string `json:"name"`
+	Limit int64  `json:"-"`
+	Keys  int64  `json:"keys"`
+}
+
+func newTTLBuckets() []*ttlBucket {
+	return []*ttlBucket{
+		{"expired", 0, 0},
+		{"<1m", 60, 0},
+		{"<1h", 3600, 0},
+		{"<1d", 86400, 0},
+		{"<7d", 7 * 86400, 0},
+		{"<30d", 30 * 86400, 0},
+		{">=30d", -1, 0},
+	}
+}
+
+type keyStat struct {
+	DB   int    `json:"db"`
+	Type string `json:"type"`
+	Key  string `json:"key"`
+	// the bytes of the values of the key, without its size and TTL entries
+	Bytes   int64 `json:"bytes"`
+	Members int64 `json:"members"`
+	// expire unix time, 0 if no ttl
+	ExpireAt int64 `json:"expire_at,omitempty"`
+}
+
+type typeStat struct {
+	Keys    int64 `json:"keys"`
+	Bytes   int64 `json:"bytes"`
+	Members int64 `json:"members"`
+}
+
+type prefixStat struct {
+	Prefix string `json:"prefix"`
+	Keys   int64  `json:"keys"`
+	Bytes  int64  `json:"bytes"`
+}
+
+type dbStat struct {
+	Index int   `json:"index"`
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+type report struct {
+	Path       string                `json:"path"`
+	Keys       int64                 `json:"keys"`
+	Bytes      int64                 `json:"bytes"`
+	OtherBytes int64                 `json:"other_bytes"`
+	DBs        []*dbStat             `json:"dbs"`
+	Types      map[string]*typeStat  `json:"types"`
+	Prefixes   []*prefixStat         `json:"prefixes"`
+	TTL        []*ttlBucket          `json:"ttl"`
+	NoTTL      int64                 `json:"no_ttl"`
+	Largest    map[string][]*keyStat `json:"largest"`
+}
+
+// keyHeap is a min heap, the root is the smallest of the largest keys.
+type keyHeap []*keyStat
+
+func (h keyHeap) Len() int            { return len(h) }
+func (h keyHeap) Less(i, j int) bool  { return h[i].Bytes < h[j].Bytes }
+func (h keyHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keyHeap) Push(x interface{}) { *h = append(*h, x.(*keyStat)) }
+func (h *keyHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+type keyID struct {
+	db  int
+	tp  string
+	key string
+}
+
+// keyRun is the entries of a key in one store type, they are next to each
+// other in the store, sorted by the db index, the store type and the key.
+type keyRun struct {
+	storeType byte
+	tp        string
+	key       []byte
+
+	bytes    int64
+	members  int64
+	expireAt int64
+}
+
+// analyzer sums the entries of the store as they are read, it only keeps
+// the current key and the largest keys.
+type analyzer struct {
+	r   *report
+	now int64
+
+	db  *dbStat
+	run *keyRun
+
+	// the keys with a TTL, the others are counted in NoTTL
+	ttlKeys int64
+
+	largest map[string]*keyHeap
+	// the keys in the heaps, for their TTL which comes after them
+	tops     map[keyID]*keyStat
+	prefixes map[string]*prefixStat
+}
+
+func newAnalyzer(path string) *analyzer {
+	a := new(analyzer)
+	a.now = time.Now().Unix()
+
+	a.r = &report{
+		Path:    path,
+		Types:   make(map[string]*typeStat),
+		TTL:     newTTLBuckets(),
+		Largest: make(map[string][]*keyStat),
+	}
+	a.largest = make(map[string]*keyHeap)
+	a.tops = make(map[keyID]*keyStat)
+	a.prefixes = make(map[string]*prefixStat)
+
+	for _, tp := range typeNames {
+		a.r.Types[tp] = &typeStat{}
+		a.largest[tp] = &keyHeap{}
+	}
+
+	return a
+}
+
+func (a *analyzer) add(rawKey []byte, value []byte) {
+	size := int64(len(rawKey) + len(value))
+
+	rk, err := ledis.DecodeRawKey(rawKey)
+	if err != nil {
+		a.r.OtherBytes += size
+		return
+	}
+
+	var tp string
+	if rk.Type == ledis.ExpMetaType || rk.Type == ledis.ExpTimeType {
+		tp = storeTypeNames[rk.DataType]
+	} else {
+		tp = storeTypeNames[rk.Type]
+	}
+
+	if len(tp) == 0 {
+		a.r.OtherBytes += size
+		return
+	}
+
+	if a.db == nil || a.db.Index != rk.Index {
+		a.flushRun()
+		a.flushDB()
+		a.db = &dbStat{Index: rk.Index}
+	}
+
+	r := a.run
+	if r == nil || r.storeType != rk.Type || r.tp != tp || !bytes.Equal(r.key, rk.Key) {
+		a.flushRun()
+		r = &keyRun{storeType: rk.Type, tp: tp, key: append([]byte(nil), rk.Key...)}
+		a.run = r
+	}
+
+	r.bytes += size
+	if memberTypes[rk.Type] {
+		r.members++
+	}
+
+	if rk.Type == ledis.ExpMetaType {
+		if when, err := ledis.Int64(value, nil); err == nil {
+			r.expireAt = when
+		}
+	}
+}
+
+func (a *analyzer) keyPrefix(key string) string {
+	if len(*prefixSep) == 0 {
+		return key
+	}
+
+	parts := strings.SplitN(key, *prefixSep, *prefixDepth+1)
+	if len(parts) <= *prefixDepth {
+		// no separator, the key has no prefix
+		return ""
+	}
+
+	return strings.Join(parts[:*prefixDepth], *prefixSep) + *prefixSep
+}
+
+// flushRun adds the entries of the current key to the stats.
+func (a *analyzer) flushRun() {
+	r := a.run
+	if r == nil {
+		return
+	}
+	a.run = nil
+
+	key := string(r.key)
+	meta := metaTypes[r.storeType]
+
+	st := a.r.Types[r.tp]
+	st.Bytes += r.bytes
+	st.Members += r.members
+
+	p := a.keyPrefix(key)
+	ps, ok := a.prefixes[p]
+	if !ok {
+		ps = &prefixStat{Prefix: p}
+		a.prefixes[p] = ps
+	}
+	ps.Bytes += r.bytes
+
+	a.db.Bytes += r.bytes
+	if meta {
+		st.Keys++
+		ps.Keys++
+		a.db.Keys++
+	}
+
+	id := keyID{a.db.Index, r.tp, key}
+
+	if memberTypes[r.storeType] {
+		a.addLargest(&keyStat{DB: id.db, Type: id.tp, Key: id.key, Bytes: r.bytes, Members: r.members}, id)
+	}
+
+	if r.storeType == ledis.ExpMetaType {
+		a.ttlKeys++
+
+		left := r.expireAt - a.now
+		for _, b := range a.r.TTL {
+			if b.Limit < 0 || left < b.Limit || (b.Limit == 0 && left <= 0) {
+				b.Keys++
+				break
+			}
+		}
+
+		if k, ok := a.tops[id]; ok {
+			k.ExpireAt = r.expireAt
+		}
+	}
+}
+
+// addLargest keeps the key if it is one of the top largest of its type.
+func (a *analyzer) addLargest(k *keyStat, id keyID) {
+	h := a.largest[k.Type]
+	if h.Len() < *top {
+		heap.Push(h, k)
+	} else if *top > 0 && (*h)[0].Bytes < k.Bytes {
+		old := (*h)[0]
+		delete(a.tops, keyID{old.DB, old.Type, old.Key})
+
+		(*h)[0] = k
+		heap.Fix(h, 0)
+	} else {
+		return
+	}
+	a.tops[id] = k
+}
+
+func (a *analyzer) flushDB() {
+	if a.db == nil {
+		return
+	}
+
+	a.r.DBs = append(a.r.DBs, a.db)
+	a.r.Keys += a.db.Keys
+	a.r.Bytes += a.db.Bytes
+
+	a.db = nil
+}
+
+func (a *analyzer) finish() *report {
+	a.flushRun()
+	a.flushDB()
+
+	r := a.r
+
+	if r.NoTTL = r.Keys - a.ttlKeys; r.NoTTL < 0 {
+		r.NoTTL = 0
+	}
+
+	sort.Slice(r.DBs, func(i, j int) bool { return r.DBs[i].Index < r.DBs[j].Index })
+
+	for tp, h := range a.largest {
+		ks := []*keyStat(*h)
+		sort.Slice(ks, func(i, j int) bool { return ks[i].Bytes > ks[j].Bytes })
+		r.Largest[tp] = ks
+	}
+
+	r.Prefixes = make([]*prefixStat, 0, len(a.prefixes))
+	for _, p := range a.prefixes {
+		r.Prefixes = append(r.Prefixes, p)
+	}
+	sort.Slice(r.Prefixes, func(i, j int) bool { return r.Prefixes[i].Bytes > r.Prefixes[j].Bytes })
+	if len(r.Prefixes) > *maxPrefixes {
+		r.Prefixes = r.Prefixes[:*maxPrefixes]
+	}
+
+	return r
+}
+
+// analyze reads the store of the config.
+func analyze(cfg *config.Config) (*report, error) {
+	cfg.DBReadOnly = true
+
+	db, err := store.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	a := newAnalyzer(cfg.DataDir)
+
+	it := db.NewIterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		a.add(it.RawKey(), it.RawValue())
+	}
+	it.Close()
+
+	return a.finish(), nil
+}
+
+func writeText(w io.Writer, r *report) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "# Store %s\n", r.Path)
+	fmt.Fprintf(tw, "keys:\t%d\n", r.Keys)
+	fmt.Fprintf(tw, "bytes:\t%d\n", r.Bytes)
+	fmt.Fprintf(tw, "other_bytes:\t%d\n", r.OtherBytes)
+
+	fmt.Fprintf(tw, "\n# DB\ndb\tkeys\tbytes\n")
+	for _, d := range r.DBs {
+		fmt.Fprintf(tw, "%d\t%d\t%d\n", d.Index, d.Keys, d.Bytes)
+	}
+
+	fmt.Fprintf(tw, "\n# Type\ntype\tkeys\tmembers\tbytes\n")
+	for _, tp := range typeNames {
+		st := r.Types[tp]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", tp, st.Keys, st.Members, st.Bytes)
+	}
+
+	fmt.Fprintf(tw, "\n# Prefix\nprefix\tkeys\tbytes\n")
+	for _, p := range r.Prefixes {
+		fmt.Fprintf(tw, "%q\t%d\t%d\n", p.Prefix, p.Keys, p.Bytes)
+	}
+
+	fmt.Fprintf(tw, "\n# TTL\nttl\tkeys\n")
+	fmt.Fprintf(tw, "none\t%d\n", r.NoTTL)
+	for _, b := range r.TTL {
+		fmt.Fprintf(tw, "%s\t%d\n", b.Name, b.Keys)
+	}
+
+	for _, tp := range typeNames {
+		fmt.Fprintf(tw, "\n# Largest %s\ndb\tkey\tmembers\tbytes\n", tp)
+		for _, k := range r.Largest[tp] {
+			fmt.Fprintf(tw, "%d\t%q\t%d\t%d\n", k.DB, k.Key, k.Members, k.Bytes)
+		}
+	}
+
+	tw.Flush()
+}
+
+func main() {
+	flag.Parse()
+
+	var cfg *config.Config
+	var err error
+
+	if len(*configFile) > 0 {
+		if cfg, err = config.NewConfigWithFile(*configFile); err != nil {
+			println(err.Error())
+			return
+		}
+	} else {
+		cfg = config.NewConfigDefault()
+	}
+
+	if len(*dataDir) > 0 {
+		cfg.DataDir = *dataDir
+	}
+
+	if len(*dbName) > 0 {
+		cfg.DBName = *dbName
+	}
+
+	if len(cfg.DataDir) == 0 {
+		println("must set data dir")
+		return
+	}
+
+	if *format != "text" && *format != "json" {
+		println("format must be text or json")
+		return
+	}
+
+	r, err := analyze(cfg)
+	if err != nil {
+		println("open store error ", err.Error())
+		return
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(r); err != nil {
+			println(err.Error())
+		}
+	} else {
+		writeText(os.Stdout, r)
+	}
+}
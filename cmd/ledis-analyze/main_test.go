@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/r0123r/vredis/ledis"
+)
+
+func TestAnalyze(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_ledis_analyze"
+	os.RemoveAll(cfg.DataDir)
+	defer os.RemoveAll(cfg.DataDir)
+
+	l, err := ledis.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := l.Select(0)
+	for i := 0; i < 5; i++ {
+		db.Set([]byte(fmt.Sprintf("user:%d", i)), make([]byte, 10*(i+1)))
+	}
+	db.Expire([]byte("user:0"), 3600)
+	db.Expire([]byte("user:1"), 10)
+
+	for i := 0; i < 3; i++ {
+		db.HSet([]byte("hash:big"), []byte(fmt.Sprintf("f%d", i)), []byte("value"))
+	}
+	db.HSet([]byte("hash:small"), []byte("f"), []byte("v"))
+	db.RPush([]byte("list"), []byte("a"), []byte("b"))
+	db.SAdd([]byte("set"), []byte("a"))
+	db.ZAdd([]byte("zset"), ledis.ScorePair{Score: 1, Member: []byte("a")}, ledis.ScorePair{Score: 2, Member: []byte("b")})
+
+	db, _ = l.Select(1)
+	db.Set([]byte("user:9"), []byte("v"))
+	db.Expire([]byte("user:9"), 86400*10)
+
+	l.Close()
+
+	*top = 2
+	defer func() { *top = 10 }()
+
+	r, err := analyze(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Keys != 11 || len(r.DBs) != 2 || r.DBs[0].Keys != 10 || r.DBs[1].Keys != 1 {
+		t.Fatal(r.Keys, r.DBs)
+	} else if r.NoTTL != 8 {
+		t.Fatal(r.NoTTL)
+	}
+
+	for tp, want := range map[string][2]int64{
+		"string": {6, 6},
+		"hash":   {2, 4},
+		"list":   {1, 2},
+		"set":    {1, 1},
+		"zset":   {1, 2},
+	} {
+		if st := r.Types[tp]; st.Keys != want[0] || st.Members != want[1] || st.Bytes == 0 {
+			t.Fatal(tp, st)
+		}
+	}
+
+	ttl := make(map[string]int64)
+	for _, b := range r.TTL {
+		ttl[b.Name] = b.Keys
+	}
+	if ttl["<1m"] != 1 || ttl["<1d"] != 1 || ttl["<30d"] != 1 {
+		t.Fatal(ttl)
+	}
+
+	// only the top 2 of each type are kept
+	if ks := r.Largest["string"]; len(ks) != 2 || ks[0].Key != "user:4" || ks[1].Key != "user:3" {
+		t.Fatal(ks)
+	} else if ks := r.Largest["hash"]; len(ks) != 2 || ks[0].Key != "hash:big" || ks[0].Members != 3 {
+		t.Fatal(ks)
+	}
+
+	prefixes := make(map[string]int64)
+	for _, p := range r.Prefixes {
+		prefixes[p.Prefix] = p.Keys
+	}
+	if prefixes["user:"] != 6 || prefixes["hash:"] != 2 || prefixes[""] != 3 {
+		t.Fatal(prefixes)
+	}
+
+	// the TTL of the largest keys, which comes after them in the store
+	*top = 5
+	if r, err = analyze(cfg); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range r.Largest["string"] {
+		if (k.Key == "user:0" || k.Key == "user:1") != (k.ExpireAt > 0) {
+			t.Fatal(k)
+		}
+	}
+}
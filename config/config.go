@@ -20,6 +20,8 @@ var (
 const (
 	DefaultAddr string = "0.0.0.0:6380"
 
+	DefaultFTPAddr string = "0.0.0.0:3001"
+
 	DefaultDBName string = "goleveldb"
 
 	DefaultDataDir string = "./var"
@@ -84,6 +86,9 @@ type ReplicationConfig struct {
 	Compression      bool   `toml:"compression"`
 	UseMmap          bool   `toml:"use_mmap"`
 	MasterPassword   string `toml:"master_password"`
+
+	// a slave more than ReadyMaxLag logs behind its master is not ready
+	ReadyMaxLag int `toml:"ready_max_lag"`
 }
 
 type SnapshotConfig struct {
@@ -95,6 +100,54 @@ type TLS struct {
 	Enabled     bool   `toml:"enabled"`
 	Certificate string `toml:"certificate"`
 	Key         string `toml:"key"`
+
+	// ClientCA verifies the client certificates of http_addr, which
+	// authenticate the HTTP users
+	ClientCA string `toml:"client_ca"`
+	// ClientCertRequired refuses the clients without a certificate
+	ClientCertRequired bool `toml:"client_cert_required"`
+}
+
+type HTTPConfig struct {
+	// the bearer tokens of the users, each one is "user token"
+	Tokens []string `toml:"tokens"`
+	// the commands of the endpoints, each one is "endpoint rule ..."
+	Commands []string `toml:"commands"`
+
+	// the bytes of the messages kept for a slow /subscribe connection,
+	// which is closed past them
+	SubscribeBufferSize int `toml:"subscribe_buffer_size"`
+	// the seconds between the heartbeats of the /subscribe connections
+	SubscribeHeartbeat int `toml:"subscribe_heartbeat"`
+
+	// serve the admin console under /ui
+	UI bool `toml:"ui"`
+}
+
+type FTPConfig struct {
+	Enabled bool   `toml:"enabled"`
+	Addr    string `toml:"addr"`
+
+	// the data ports of the passive mode, "start-end", empty for any port
+	PassivePorts string `toml:"passive_ports"`
+	// the seconds a connection may be idle
+	IdleTimeout int `toml:"idle_timeout"`
+	MaxClients  int `toml:"max_clients"`
+
+	// FTPS with AUTH TLS, with the certificate and key of [tls]
+	TLS bool `toml:"tls"`
+
+	// each user is "name password_hash db [readonly]", the hash is the
+	// SHA-256 hex of the password, the ACL users log in if it is empty
+	Users []string `toml:"users"`
+
+	LogLevel string `toml:"log_level"`
+}
+
+type ACLConfig struct {
+	// each user is "name rule ...", the rules are the same as ACL SETUSER
+	Users     []string `toml:"users"`
+	LogMaxLen int      `toml:"log_max_len"`
 }
 
 type AuthMethod func(c *Config, password string) bool
@@ -107,6 +160,8 @@ type Config struct {
 	//AuthMethod custom authentication method
 	AuthMethod AuthMethod `toml:"-"`
 
+	ACL ACLConfig `toml:"acl"`
+
 	FileName string `toml:"-"`
 
 	// Addr can be empty to assign a local address dynamically
@@ -116,6 +171,13 @@ type Config struct {
 
 	HttpAddr string `toml:"http_addr"`
 
+	HTTP HTTPConfig `toml:"http"`
+
+	FTP FTPConfig `toml:"ftp"`
+
+	// MetricsAddr serves /metrics on its own listener, empty to serve it on HttpAddr
+	MetricsAddr string `toml:"metrics_addr"`
+
 	SlaveOf string `toml:"slaveof"`
 
 	Readonly bool `toml:readonly`
@@ -128,6 +190,9 @@ type Config struct {
 	DBPath       string `toml:"db_path"`
 	DBSyncCommit int    `toml:"db_sync_commit"`
 
+	// DBReadOnly opens the store read only, for the offline tools
+	DBReadOnly bool `toml:"-"`
+
 	LevelDB LevelDBConfig `toml:"leveldb"`
 	RocksDB RocksDBConfig `toml:"rocksdb"`
 
@@ -146,6 +211,21 @@ type Config struct {
 
 	TTLCheckInterval int `toml:"ttl_check_interval"`
 
+	// track key access time and frequency for OBJECT IDLETIME and OBJECT FREQ
+	KeyAccessTracking bool `toml:"key_access_tracking"`
+	KeyAccessMaxKeys  int  `toml:"key_access_max_keys"`
+
+	// log the commands slower than the microseconds to SLOWLOG,
+	// 0 logs every command and a negative value disables it
+	SlowlogLogSlowerThan int64 `toml:"slowlog_log_slower_than"`
+	SlowlogMaxLen        int   `toml:"slowlog_max_len"`
+
+	// record the events slower than the milliseconds for LATENCY, 0 disables it
+	LatencyMonitorThreshold int64 `toml:"latency_monitor_threshold"`
+
+	// milliseconds, a longer script makes the server BUSY, 0 disables it
+	LuaTimeLimit int64 `toml:"lua_time_limit"`
+
 	//tls config
 	TLS TLS `toml:"tls"`
 }
@@ -182,6 +262,12 @@ func NewConfigDefault() *Config {
 
 	cfg.Addr = DefaultAddr
 	cfg.HttpAddr = ""
+	cfg.HTTP.Commands = []string{"* -slaveof -fullsync -sync"}
+	cfg.HTTP.UI = true
+
+	cfg.FTP.Enabled = true
+	cfg.FTP.Addr = DefaultFTPAddr
+	cfg.FTP.LogLevel = "info"
 
 	cfg.DataDir = DefaultDataDir
 
@@ -215,6 +301,9 @@ func NewConfigDefault() *Config {
 	cfg.RocksDB.DisableAutoCompactions = false
 	cfg.RocksDB.DisableWAL = false
 
+	cfg.SlowlogLogSlowerThan = 10000
+	cfg.LuaTimeLimit = 5000
+
 	cfg.adjust()
 
 	return cfg
@@ -235,10 +324,18 @@ func (cfg *Config) adjust() {
 
 	cfg.Replication.ExpiredLogDays = getDefault(7, cfg.Replication.ExpiredLogDays)
 	cfg.Replication.MaxLogFileNum = getDefault(50, cfg.Replication.MaxLogFileNum)
+	cfg.Replication.ReadyMaxLag = getDefault(1000, cfg.Replication.ReadyMaxLag)
 	cfg.ConnReadBufferSize = getDefault(4*KB, cfg.ConnReadBufferSize)
 	cfg.ConnWriteBufferSize = getDefault(4*KB, cfg.ConnWriteBufferSize)
 	cfg.TTLCheckInterval = getDefault(1, cfg.TTLCheckInterval)
 	cfg.Databases = getDefault(16, cfg.Databases)
+	cfg.KeyAccessMaxKeys = getDefault(100000, cfg.KeyAccessMaxKeys)
+	cfg.ACL.LogMaxLen = getDefault(128, cfg.ACL.LogMaxLen)
+	cfg.HTTP.SubscribeBufferSize = getDefault(MB, cfg.HTTP.SubscribeBufferSize)
+	cfg.HTTP.SubscribeHeartbeat = getDefault(30, cfg.HTTP.SubscribeHeartbeat)
+	cfg.FTP.IdleTimeout = getDefault(900, cfg.FTP.IdleTimeout)
+	cfg.FTP.MaxClients = getDefault(10, cfg.FTP.MaxClients)
+	cfg.SlowlogMaxLen = getDefault(128, cfg.SlowlogMaxLen)
 }
 
 func (cfg *LevelDBConfig) adjust() {
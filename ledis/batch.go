@@ -2,6 +2,7 @@ package ledis
 
 import (
 	"sync"
+	"time"
 
 	"github.com/siddontang/go/log"
 	"github.com/r0123r/vredis/rpl"
@@ -15,7 +16,10 @@ type batch struct {
 
 	sync.Locker
 
-	//	tx *Tx
+	// the batch of a Tx commits into the Tx
+	tx *Tx
+	// the keys written by a batch of a Tx, for its key events
+	ops []batchOp
 }
 
 func (b *batch) Commit() error {
@@ -23,18 +27,17 @@ func (b *batch) Commit() error {
 		return ErrWriteInROnly
 	}
 
-	return b.l.handleCommit(b.WriteBatch, b.WriteBatch)
-
-	// if b.tx == nil {
-	// 	return b.l.handleCommit(b.WriteBatch, b.WriteBatch)
-	// } else {
-	// 	if b.l.r != nil {
-	// 		if err := b.tx.data.Append(b.WriteBatch.BatchData()); err != nil {
-	// 			return err
-	// 		}
-	// 	}
-	// 	return b.WriteBatch.Commit()
-	// }
+	if b.tx == nil {
+		return b.l.handleCommit(b.WriteBatch, b.WriteBatch)
+	}
+
+	if err := b.WriteBatch.Commit(); err != nil {
+		return err
+	}
+
+	b.tx.addKeyEvents(b.ops)
+	b.ops = b.ops[0:0]
+	return nil
 }
 
 func (b *batch) Lock() {
@@ -43,14 +46,21 @@ func (b *batch) Lock() {
 
 func (b *batch) Unlock() {
 	b.WriteBatch.Rollback()
+	b.ops = b.ops[0:0]
 	b.Locker.Unlock()
 }
 
 func (b *batch) Put(key []byte, value []byte) {
+	if b.tx != nil {
+		b.ops = append(b.ops, batchOp{append([]byte{}, key...), false})
+	}
 	b.WriteBatch.Put(key, value)
 }
 
 func (b *batch) Delete(key []byte) {
+	if b.tx != nil {
+		b.ops = append(b.ops, batchOp{append([]byte{}, key...), true})
+	}
 	b.WriteBatch.Delete(key)
 }
 
@@ -69,11 +79,12 @@ func (l *dbBatchLocker) Unlock() {
 	l.wrLock.RUnlock()
 }
 
-// type txBatchLocker struct {
-// }
+// the Tx holds the write lock, and is used by one goroutine
+type txBatchLocker struct {
+}
 
-// func (l *txBatchLocker) Lock()   {}
-// func (l *txBatchLocker) Unlock() {}
+func (l *txBatchLocker) Lock()   {}
+func (l *txBatchLocker) Unlock() {}
 
 // type multiBatchLocker struct {
 // }
@@ -81,12 +92,13 @@ func (l *dbBatchLocker) Unlock() {
 // func (l *multiBatchLocker) Lock()   {}
 // func (l *multiBatchLocker) Unlock() {}
 
-func (l *Ledis) newBatch(wb *store.WriteBatch, locker sync.Locker) *batch {
+func (l *Ledis) newBatch(wb *store.WriteBatch, locker sync.Locker, tx *Tx) *batch {
 	b := new(batch)
 	b.l = l
 	b.WriteBatch = wb
 
 	b.Locker = locker
+	b.tx = tx
 
 	return b
 }
@@ -100,6 +112,9 @@ type commitDataGetter interface {
 }
 
 func (l *Ledis) handleCommit(g commitDataGetter, c commiter) error {
+	start := time.Now()
+	defer l.observeLatency(LatencyBatchCommit, start)
+
 	l.commitLock.Lock()
 
 	var err error
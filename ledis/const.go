@@ -133,6 +133,7 @@ var (
 	ErrWriteInROnly  = errors.New("write not support in readonly mode")
 	ErrRplInRDWR     = errors.New("replication not support in read write mode")
 	ErrRplNotSupport = errors.New("replication not support")
+	ErrTxDone        = errors.New("transaction has already been committed or rolled back")
 )
 
 // const (
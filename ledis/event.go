@@ -10,6 +10,77 @@ import (
 
 var errInvalidEvent = errors.New("invalid event")
 
+// RawKey is a decoded key of the backend store.
+type RawKey struct {
+	// DB index
+	Index int
+	// store type, KVType, HashType, HSizeType...
+	Type byte
+
+	Key []byte
+	// hash field, set or zset member
+	Field []byte
+	// list item sequence
+	Seq int32
+	// zset score
+	Score int64
+
+	// for ExpTimeType and ExpMetaType, the store type of the expired data
+	DataType byte
+	// for ExpTimeType, the expire unix time
+	When int64
+}
+
+// DecodeRawKey decodes a key of the backend store.
+func DecodeRawKey(k []byte) (*RawKey, error) {
+	index, n, err := decodeDBIndex(k)
+	if err != nil {
+		return nil, err
+	} else if len(k) < n+1 {
+		return nil, errInvalidEvent
+	}
+
+	db := new(DB)
+	db.setIndex(index)
+
+	rk := &RawKey{Index: index, Type: k[n]}
+
+	switch rk.Type {
+	case KVType:
+		rk.Key, err = db.decodeKVKey(k)
+	case HashType:
+		rk.Key, rk.Field, err = db.hDecodeHashKey(k)
+	case HSizeType:
+		rk.Key, err = db.hDecodeSizeKey(k)
+	case ListType:
+		rk.Key, rk.Seq, err = db.lDecodeListKey(k)
+	case LMetaType:
+		rk.Key, err = db.lDecodeMetaKey(k)
+	case ZSetType:
+		rk.Key, rk.Field, err = db.zDecodeSetKey(k)
+	case ZSizeType:
+		rk.Key, err = db.zDecodeSizeKey(k)
+	case ZScoreType:
+		rk.Key, rk.Field, rk.Score, err = db.zDecodeScoreKey(k)
+	case SetType:
+		rk.Key, rk.Field, err = db.sDecodeSetKey(k)
+	case SSizeType:
+		rk.Key, err = db.sDecodeSizeKey(k)
+	case ExpTimeType:
+		rk.DataType, rk.Key, rk.When, err = db.expDecodeTimeKey(k)
+	case ExpMetaType:
+		rk.DataType, rk.Key, err = db.expDecodeMetaKey(k)
+	default:
+		return nil, errInvalidEvent
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rk, nil
+}
+
 func formatEventKey(buf []byte, k []byte) ([]byte, error) {
 	if len(k) < 2 {
 		return nil, errInvalidEvent
@@ -18,119 +89,128 @@ func formatEventKey(buf []byte, k []byte) ([]byte, error) {
 	buf = append(buf, fmt.Sprintf("DB:%2d ", k[0])...)
 	buf = append(buf, fmt.Sprintf("%s ", TypeName[k[1]])...)
 
-	db := new(DB)
-	index, _, err := decodeDBIndex(k)
+	rk, err := DecodeRawKey(k)
 	if err != nil {
 		return nil, err
 	}
-	db.setIndex(index)
 
 	//to do format at respective place
 
-	switch k[1] {
-	case KVType:
-		key, err := db.decodeKVKey(k)
-		if err != nil {
-			return nil, err
-		}
-		buf = strconv.AppendQuote(buf, hack.String(key))
-	case HashType:
-		key, field, err := db.hDecodeHashKey(k)
-		if err != nil {
-			return nil, err
-		}
-
-		buf = strconv.AppendQuote(buf, hack.String(key))
+	switch rk.Type {
+	case KVType, HSizeType, LMetaType, ZSizeType, SSizeType:
+		buf = strconv.AppendQuote(buf, hack.String(rk.Key))
+	case HashType, ZSetType, SetType:
+		buf = strconv.AppendQuote(buf, hack.String(rk.Key))
 		buf = append(buf, ' ')
-		buf = strconv.AppendQuote(buf, hack.String(field))
-	case HSizeType:
-		key, err := db.hDecodeSizeKey(k)
-		if err != nil {
-			return nil, err
-		}
-
-		buf = strconv.AppendQuote(buf, hack.String(key))
+		buf = strconv.AppendQuote(buf, hack.String(rk.Field))
 	case ListType:
-		key, seq, err := db.lDecodeListKey(k)
-		if err != nil {
-			return nil, err
-		}
-
-		buf = strconv.AppendQuote(buf, hack.String(key))
+		buf = strconv.AppendQuote(buf, hack.String(rk.Key))
 		buf = append(buf, ' ')
-		buf = strconv.AppendInt(buf, int64(seq), 10)
-	case LMetaType:
-		key, err := db.lDecodeMetaKey(k)
-		if err != nil {
-			return nil, err
-		}
+		buf = strconv.AppendInt(buf, int64(rk.Seq), 10)
+	case ZScoreType:
+		buf = strconv.AppendQuote(buf, hack.String(rk.Key))
+		buf = append(buf, ' ')
+		buf = strconv.AppendQuote(buf, hack.String(rk.Field))
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, rk.Score, 10)
+	case ExpTimeType:
+		buf = append(buf, TypeName[rk.DataType]...)
+		buf = append(buf, ' ')
+		buf = strconv.AppendQuote(buf, hack.String(rk.Key))
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, rk.When, 10)
+	case ExpMetaType:
+		buf = append(buf, TypeName[rk.DataType]...)
+		buf = append(buf, ' ')
+		buf = strconv.AppendQuote(buf, hack.String(rk.Key))
+	default:
+		return nil, errInvalidEvent
+	}
 
-		buf = strconv.AppendQuote(buf, hack.String(key))
-	case ZSetType:
-		key, m, err := db.zDecodeSetKey(k)
-		if err != nil {
-			return nil, err
-		}
+	return buf, nil
+}
 
-		buf = strconv.AppendQuote(buf, hack.String(key))
-		buf = append(buf, ' ')
-		buf = strconv.AppendQuote(buf, hack.String(m))
-	case ZSizeType:
-		key, err := db.zDecodeSizeKey(k)
-		if err != nil {
-			return nil, err
-		}
+// The events of the keys written by a Tx.
+const (
+	KeyWrite   = "write"
+	KeyDel     = "del"
+	KeyExpired = "expired"
+)
 
-		buf = strconv.AppendQuote(buf, hack.String(key))
-	case ZScoreType:
-		key, m, score, err := db.zDecodeScoreKey(k)
+// KeyEvent is a key written, deleted or expired.
+type KeyEvent struct {
+	Index int
+	Type  DataType
+	Key   []byte
+	// KeyWrite, KeyDel or KeyExpired
+	Event string
+}
+
+// batchOp is a key put or deleted by a batch.
+type batchOp struct {
+	key []byte
+	del bool
+}
+
+// keyEvents returns one event per key of the ops, in the order of the keys.
+// A key is deleted if its last meta key op, the size of a collection or the
+// value of a KV, is a delete.
+func keyEvents(ops []batchOp) []KeyEvent {
+	var events []KeyEvent
+	index := make(map[string]int)
+
+	for _, op := range ops {
+		rk, err := DecodeRawKey(op.key)
 		if err != nil {
-			return nil, err
+			continue
 		}
-		buf = strconv.AppendQuote(buf, hack.String(key))
-		buf = append(buf, ' ')
-		buf = strconv.AppendQuote(buf, hack.String(m))
-		buf = append(buf, ' ')
-		buf = strconv.AppendInt(buf, score, 10)
-	case SetType:
-		key, member, err := db.sDecodeSetKey(k)
-		if err != nil {
-			return nil, err
+
+		dataType, ok := dataTypeOf(rk.Type)
+		if !ok {
+			// the expirations
+			continue
 		}
 
-		buf = strconv.AppendQuote(buf, hack.String(key))
-		buf = append(buf, ' ')
-		buf = strconv.AppendQuote(buf, hack.String(member))
-	case SSizeType:
-		key, err := db.sDecodeSizeKey(k)
-		if err != nil {
-			return nil, err
+		meta := false
+		switch rk.Type {
+		case KVType, HSizeType, LMetaType, SSizeType, ZSizeType:
+			meta = true
 		}
 
-		buf = strconv.AppendQuote(buf, hack.String(key))
-	case ExpTimeType:
-		tp, key, t, err := db.expDecodeTimeKey(k)
-		if err != nil {
-			return nil, err
+		id := fmt.Sprintf("%d:%d:%s", rk.Index, dataType, rk.Key)
+		i, ok := index[id]
+		if !ok {
+			i = len(events)
+			index[id] = i
+			events = append(events, KeyEvent{rk.Index, dataType, rk.Key, KeyWrite})
 		}
 
-		buf = append(buf, TypeName[tp]...)
-		buf = append(buf, ' ')
-		buf = strconv.AppendQuote(buf, hack.String(key))
-		buf = append(buf, ' ')
-		buf = strconv.AppendInt(buf, t, 10)
-	case ExpMetaType:
-		tp, key, err := db.expDecodeMetaKey(k)
-		if err != nil {
-			return nil, err
+		if meta {
+			if op.del {
+				events[i].Event = KeyDel
+			} else {
+				events[i].Event = KeyWrite
+			}
 		}
+	}
 
-		buf = append(buf, TypeName[tp]...)
-		buf = append(buf, ' ')
-		buf = strconv.AppendQuote(buf, hack.String(key))
+	return events
+}
+
+// dataTypeOf returns the data type of the store type of the data or meta keys.
+func dataTypeOf(storeType byte) (DataType, bool) {
+	switch storeType {
+	case KVType:
+		return KV, true
+	case HashType, HSizeType:
+		return HASH, true
+	case ListType, LMetaType:
+		return LIST, true
+	case SetType, SSizeType:
+		return SET, true
+	case ZSetType, ZSizeType, ZScoreType:
+		return ZSET, true
 	default:
-		return nil, errInvalidEvent
+		return 0, false
 	}
-
-	return buf, nil
 }
@@ -0,0 +1,33 @@
+package ledis
+
+import (
+	"testing"
+)
+
+func TestDecodeRawKey(t *testing.T) {
+	db := getTestDB()
+
+	rk, err := DecodeRawKey(db.hEncodeHashKey([]byte("k"), []byte("f")))
+	if err != nil {
+		t.Fatal(err)
+	} else if rk.Index != db.Index() || rk.Type != HashType || string(rk.Key) != "k" || string(rk.Field) != "f" {
+		t.Fatalf("%+v", rk)
+	}
+
+	rk, err = DecodeRawKey(db.expEncodeTimeKey(ZSetType, []byte("z"), 100))
+	if err != nil {
+		t.Fatal(err)
+	} else if rk.Type != ExpTimeType || rk.DataType != ZSetType || string(rk.Key) != "z" || rk.When != 100 {
+		t.Fatalf("%+v", rk)
+	}
+
+	if _, err = DecodeRawKey([]byte{0, MetaType}); err == nil {
+		t.Fatal("must error")
+	}
+
+	if buf, err := formatEventKey(nil, db.zEncodeScoreKey([]byte("z"), []byte("m"), 3)); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != `DB: 0 zscore "z" "m" 3` {
+		t.Fatal(string(buf))
+	}
+}
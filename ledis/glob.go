@@ -0,0 +1,192 @@
+package ledis
+
+// Glob is a compiled redis style glob pattern.
+//
+// It supports the same syntax as the redis MATCH option, '*' matches any
+// sequence of bytes, '?' any single byte, "[abc]" one byte of the class,
+// "[^abc]" one byte not in the class, "[a-z]" one byte of the range, and
+// '\\' makes the next byte literal.
+type Glob struct {
+	pattern string
+	tokens  []globToken
+
+	// the literal bytes every matched key starts with
+	prefix []byte
+	// the pattern has no wildcard, only the prefix matches
+	literal bool
+	// the pattern matches everything
+	all bool
+}
+
+const (
+	globLiteral = iota
+	globAny
+	globStar
+	globClass
+)
+
+type globToken struct {
+	kind  int
+	c     byte
+	class *[256]bool
+}
+
+// CompileGlob compiles the pattern. Malformed patterns are handled as redis
+// does, an unclosed class ends at the pattern end and a trailing \ is literal.
+func CompileGlob(pattern string) *Glob {
+	g := &Glob{pattern: pattern}
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			// consecutive stars are the same as one
+			if n := len(g.tokens); n == 0 || g.tokens[n-1].kind != globStar {
+				g.tokens = append(g.tokens, globToken{kind: globStar})
+			}
+		case '?':
+			g.tokens = append(g.tokens, globToken{kind: globAny})
+		case '[':
+			var t globToken
+			t.kind = globClass
+			i, t.class = compileGlobClass(pattern, i+1)
+			g.tokens = append(g.tokens, t)
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			g.tokens = append(g.tokens, globToken{kind: globLiteral, c: pattern[i]})
+		default:
+			g.tokens = append(g.tokens, globToken{kind: globLiteral, c: c})
+		}
+	}
+
+	n := 0
+	for ; n < len(g.tokens) && g.tokens[n].kind == globLiteral; n++ {
+		g.prefix = append(g.prefix, g.tokens[n].c)
+	}
+
+	g.literal = n == len(g.tokens)
+	g.all = len(g.tokens) == 1 && g.tokens[0].kind == globStar
+
+	return g
+}
+
+// compileGlobClass compiles the class starting at i, after the '[',
+// and returns the position of the closing ']'.
+func compileGlobClass(pattern string, i int) (int, *[256]bool) {
+	class := new([256]bool)
+
+	not := false
+	if i < len(pattern) && pattern[i] == '^' {
+		not = true
+		i++
+	}
+
+	for ; i < len(pattern) && pattern[i] != ']'; i++ {
+		c := pattern[i]
+		if c == '\\' && i+1 < len(pattern) {
+			i++
+			c = pattern[i]
+		} else if i+2 < len(pattern) && pattern[i+1] == '-' {
+			start, end := c, pattern[i+2]
+			if start > end {
+				start, end = end, start
+			}
+			for b := int(start); b <= int(end); b++ {
+				class[b] = true
+			}
+			i += 2
+			continue
+		}
+		class[c] = true
+	}
+
+	if not {
+		for b := range class {
+			class[b] = !class[b]
+		}
+	}
+
+	return i, class
+}
+
+// String returns the source pattern.
+func (g *Glob) String() string {
+	return g.pattern
+}
+
+// Prefix returns the literal prefix of the pattern, every matched key starts with it.
+func (g *Glob) Prefix() []byte {
+	return g.prefix
+}
+
+// Match reports whether b matches the whole pattern.
+func (g *Glob) Match(b []byte) bool {
+	if g.all {
+		return true
+	} else if g.literal {
+		return string(b) == string(g.prefix)
+	}
+
+	// greedy matching, backtrack to the last star on mismatch
+	t, i := 0, 0
+	star, starI := -1, 0
+
+	for i < len(b) {
+		if t < len(g.tokens) {
+			tk := &g.tokens[t]
+			switch tk.kind {
+			case globStar:
+				star, starI = t, i
+				t++
+				continue
+			case globAny:
+				t++
+				i++
+				continue
+			case globLiteral:
+				if tk.c == b[i] {
+					t++
+					i++
+					continue
+				}
+			case globClass:
+				if tk.class[b[i]] {
+					t++
+					i++
+					continue
+				}
+			}
+		}
+
+		if star < 0 {
+			return false
+		}
+
+		// let the star take one more byte
+		starI++
+		t, i = star+1, starI
+	}
+
+	for ; t < len(g.tokens); t++ {
+		if g.tokens[t].kind != globStar {
+			return false
+		}
+	}
+
+	return true
+}
+
+// prefixSuccessor returns the smallest key greater than all keys starting
+// with prefix, or nil if there is none.
+func prefixSuccessor(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			end := make([]byte, i+1)
+			copy(end, prefix)
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package ledis
+
+import (
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tbl := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "abc", true},
+		{"abc", "abc", true},
+		{"abc", "abcd", false},
+		{"a*", "abc", true},
+		{"a*", "bac", false},
+		{"*c", "abc", true},
+		{"a*c", "ac", true},
+		{"a*c", "abcbc", true},
+		{"a*c", "abcb", false},
+		{"a**b*c", "axxbyyc", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[c-a]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{"h[]llo", "hllo", false},
+		{`a\*c`, "a*c", true},
+		{`a\*c`, "abc", false},
+		{`a[\]]c`, "a]c", true},
+		{`abc\`, `abc\`, true},
+		{"a[bc", "ab", true},
+		{"user:*:name", "user:123:name", true},
+		{"user:*:name", "user:123:age", false},
+	}
+
+	for _, v := range tbl {
+		if m := CompileGlob(v.pattern).Match([]byte(v.key)); m != v.match {
+			t.Fatalf("%q match %q, got %v", v.pattern, v.key, m)
+		}
+	}
+}
+
+func TestGlobPrefix(t *testing.T) {
+	tbl := []struct {
+		pattern string
+		prefix  string
+	}{
+		{"*", ""},
+		{"?abc", ""},
+		{"abc", "abc"},
+		{"user:123:*", "user:123:"},
+		{`a\*b*`, "a*b"},
+		{"ab[cd]", "ab"},
+	}
+
+	for _, v := range tbl {
+		if p := string(CompileGlob(v.pattern).Prefix()); p != v.prefix {
+			t.Fatalf("%q prefix %q != %q", v.pattern, p, v.prefix)
+		}
+	}
+
+	if k := prefixSuccessor([]byte("ab\xff")); string(k) != "ac" {
+		t.Fatal(k)
+	}
+
+	if k := prefixSuccessor([]byte("\xff\xff")); k != nil {
+		t.Fatal(k)
+	}
+}
+
+func TestDBScanGlob(t *testing.T) {
+	db := getTestDB()
+	db.FlushAll()
+
+	for _, k := range []string{"a", "user", "user:1", "user:2", "user:3", "userx", "z"} {
+		db.Set([]byte(k), []byte("v"))
+	}
+
+	g := CompileGlob("user:*")
+
+	if v, err := db.ScanGlob(KV, nil, 10, true, g); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "user:1", "user:2", "user:3")
+	}
+
+	if v, err := db.ScanGlob(KV, []byte("user:1"), 10, false, g); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "user:2", "user:3")
+	}
+
+	if v, err := db.ScanGlob(KV, []byte("a"), 1, false, g); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "user:1")
+	}
+
+	if v, err := db.ScanGlob(KV, []byte("user:9"), 10, false, g); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v)
+	}
+
+	if v, err := db.RevScanGlob(KV, nil, 10, true, g); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "user:3", "user:2", "user:1")
+	}
+
+	if v, err := db.RevScanGlob(KV, []byte("user:3"), 10, false, g); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "user:2", "user:1")
+	}
+
+	if v, err := db.RevScanGlob(KV, []byte("z"), 10, true, g); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "user:3", "user:2", "user:1")
+	}
+
+	if v, err := db.RevScanGlob(KV, []byte("a"), 10, true, g); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v)
+	}
+
+	if v, err := db.ScanGlob(KV, nil, 10, true, CompileGlob("user")); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "user")
+	}
+
+	if v, err := db.ScanGlob(KV, nil, 10, true, CompileGlob("*:2")); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "user:2")
+	}
+
+	key := []byte("scan_glob_hash")
+	for _, f := range []string{"a1", "b1", "b2", "c1"} {
+		db.HSet(key, []byte(f), []byte("v"))
+	}
+
+	if v, err := db.HScanGlob(key, nil, 10, true, CompileGlob("b*")); err != nil {
+		t.Fatal(err)
+	} else if len(v) != 2 || string(v[0].Field) != "b1" || string(v[1].Field) != "b2" {
+		t.Fatal(v)
+	}
+
+	if v, err := db.HRevScanGlob(key, nil, 10, true, CompileGlob("b*")); err != nil {
+		t.Fatal(err)
+	} else if len(v) != 2 || string(v[0].Field) != "b2" || string(v[1].Field) != "b1" {
+		t.Fatal(v)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/siddontang/go/filelock"
@@ -24,6 +25,8 @@ type Ledis struct {
 	dbLock sync.Mutex
 	dbs    map[int]*DB
 
+	metaBatch *batch
+
 	quit chan struct{}
 	wg   sync.WaitGroup
 
@@ -41,6 +44,76 @@ type Ledis struct {
 
 	ttlCheckers  []*ttlChecker
 	ttlCheckerCh chan *ttlChecker
+
+	// a LatencyObserver
+	latencyObserver atomic.Value
+
+	// an ExpireHandler
+	expireHandler atomic.Value
+
+	// keys deleted by the TTL checkers
+	expiredKeys int64
+	// TTL check cycles and their total time in nanoseconds
+	ttlCycles    int64
+	ttlCycleTime int64
+}
+
+// ExpiredKeys returns the number of keys deleted by the TTL checkers
+// since the Ledis was opened.
+func (l *Ledis) ExpiredKeys() int64 {
+	return atomic.LoadInt64(&l.expiredKeys)
+}
+
+// TTLCheckStat returns the number of TTL check cycles and their total time.
+func (l *Ledis) TTLCheckStat() (int64, time.Duration) {
+	return atomic.LoadInt64(&l.ttlCycles), time.Duration(atomic.LoadInt64(&l.ttlCycleTime))
+}
+
+// Latency events reported to the LatencyObserver.
+const (
+	LatencyBatchCommit = "batch-commit"
+	LatencyFsync       = "fsync"
+	LatencyTTLCheck    = "ttl-check"
+)
+
+// LatencyObserver is called with the duration of an internal event,
+// it must be fast and safe for concurrent use.
+type LatencyObserver func(event string, d time.Duration)
+
+// SetLatencyObserver sets the observer of the batch commits, the
+// replication log fsyncs and the TTL check cycles.
+func (l *Ledis) SetLatencyObserver(f LatencyObserver) {
+	l.latencyObserver.Store(f)
+
+	if l.r != nil {
+		l.r.SetSyncObserver(func(d time.Duration) {
+			f(LatencyFsync, d)
+		})
+	}
+}
+
+// ExpireHandler is called in the Tx deleting an expired key, before its
+// commit, the KeyExpired event of the key is in the Tx events. The writes
+// of the handler are committed with the deletion, the key is deleted
+// without it if it returns an error.
+type ExpireHandler func(tx *Tx) error
+
+// SetExpireHandler sets the handler of the expired keys, nil to remove it.
+func (l *Ledis) SetExpireHandler(h ExpireHandler) {
+	l.expireHandler.Store(h)
+}
+
+func (l *Ledis) getExpireHandler() ExpireHandler {
+	if h, ok := l.expireHandler.Load().(ExpireHandler); ok && h != nil && !l.cfg.GetReadonly() {
+		return h
+	}
+	return nil
+}
+
+func (l *Ledis) observeLatency(event string, start time.Time) {
+	if f, ok := l.latencyObserver.Load().(LatencyObserver); ok && f != nil {
+		f(event, time.Since(start))
+	}
 }
 
 // Open opens the Ledis with a config.
@@ -93,6 +166,8 @@ func Open(cfg *config.Config) (*Ledis, error) {
 
 	l.dbs = make(map[int]*DB, 16)
 
+	l.metaBatch = l.newBatch(l.ldb.NewWriteBatch(), &dbBatchLocker{l: &sync.Mutex{}, wrLock: &l.wLock}, nil)
+
 	l.checkTTL()
 
 	return l, nil
@@ -219,9 +294,14 @@ func (l *Ledis) checkTTL() {
 					break
 				}
 
+				start := time.Now()
 				for _, c := range l.ttlCheckers {
 					c.check()
 				}
+				l.observeLatency(LatencyTTLCheck, start)
+
+				atomic.AddInt64(&l.ttlCycles, 1)
+				atomic.AddInt64(&l.ttlCycleTime, int64(time.Since(start)))
 			case c := <-l.ttlCheckerCh:
 				l.ttlCheckers = append(l.ttlCheckers, c)
 				c.check()
@@ -117,18 +117,35 @@ func (db *DB) newTTLChecker() *ttlChecker {
 	c.cbs = make([]onExpired, maxDataType)
 	c.nc = 0
 
-	c.register(KVType, db.kvBatch, db.delete)
-	c.register(ListType, db.listBatch, db.lDelete)
-	c.register(HashType, db.hashBatch, db.hDelete)
-	c.register(ZSetType, db.zsetBatch, db.zDelete)
-	//		c.register(BitType, db.binBatch, db.bDelete)
-	c.register(SetType, db.setBatch, db.sDelete)
+	for _, dataType := range []byte{KVType, ListType, HashType, ZSetType, SetType} {
+		t, f := db.expireFunc(dataType)
+		c.register(dataType, t, f)
+	}
 
 	return c
 }
 
+// expireFunc returns the batch and the delete function of the expired
+// keys of the data type.
+func (db *DB) expireFunc(dataType byte) (*batch, onExpired) {
+	switch dataType {
+	case KVType:
+		return db.kvBatch, db.delete
+	case ListType:
+		return db.listBatch, db.lDelete
+	case HashType:
+		return db.hashBatch, db.hDelete
+	case ZSetType:
+		return db.zsetBatch, db.zDelete
+	case SetType:
+		return db.setBatch, db.sDelete
+	default:
+		return nil, nil
+	}
+}
+
 func (db *DB) newBatch() *batch {
-	return db.l.newBatch(db.bucket.NewWriteBatch(), &dbBatchLocker{l: &sync.Mutex{}, wrLock: &db.l.wLock})
+	return db.l.newBatch(db.bucket.NewWriteBatch(), &dbBatchLocker{l: &sync.Mutex{}, wrLock: &db.l.wLock}, nil)
 }
 
 // Index gets the index of database.
@@ -189,7 +206,7 @@ func (db *DB) flushType(t *batch, dataType byte) (drop int64, err error) {
 	}
 
 	var keys [][]byte
-	keys, err = db.scanGeneric(metaDataType, nil, 1024, false, "", false)
+	keys, err = db.scanGeneric(metaDataType, nil, 1024, false, nil, nil, false)
 	for len(keys) != 0 || err != nil {
 		for _, key := range keys {
 			deleteFunc(t, key)
@@ -202,7 +219,7 @@ func (db *DB) flushType(t *batch, dataType byte) (drop int64, err error) {
 		}
 
 		drop += int64(len(keys))
-		keys, err = db.scanGeneric(metaDataType, nil, 1024, false, "", false)
+		keys, err = db.scanGeneric(metaDataType, nil, 1024, false, nil, nil, false)
 	}
 	return
 }
@@ -0,0 +1,81 @@
+package ledis
+
+import (
+	"bytes"
+
+	"github.com/r0123r/vredis/store"
+)
+
+// The meta space keeps the server data which doesn't belong to a database,
+// like the function libraries. Its keys are in the database 0 with the
+// MetaType, the data commands never see them, but they are dumped and
+// replicated like the data.
+
+// MetaItem is a key and its value in the meta space.
+type MetaItem struct {
+	Key   []byte
+	Value []byte
+}
+
+func metaEncodeKey(key []byte) []byte {
+	ek := make([]byte, 2+len(key))
+	// the varint of the database 0
+	ek[0] = 0
+	ek[1] = MetaType
+	copy(ek[2:], key)
+	return ek
+}
+
+func metaDecodeKey(ek []byte) ([]byte, error) {
+	if len(ek) < 2 || ek[0] != 0 || ek[1] != MetaType {
+		return nil, errMetaKey
+	}
+	return ek[2:], nil
+}
+
+// MetaGet gets the value of the meta key, nil if not exists.
+func (l *Ledis) MetaGet(key []byte) ([]byte, error) {
+	return l.ldb.Get(metaEncodeKey(key))
+}
+
+// MetaScan returns the meta items whose key starts with prefix.
+func (l *Ledis) MetaScan(prefix []byte) ([]MetaItem, error) {
+	min := metaEncodeKey(prefix)
+
+	it := l.ldb.RangeLimitIterator(min, nil, store.RangeClose, 0, -1)
+	defer it.Close()
+
+	var items []MetaItem
+	for ; it.Valid(); it.Next() {
+		if !bytes.HasPrefix(it.RawKey(), min) {
+			break
+		}
+
+		key, err := metaDecodeKey(it.Key())
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, MetaItem{key, it.Value()})
+	}
+
+	return items, nil
+}
+
+// MetaUpdate writes the items in one batch, an item with a nil value
+// deletes the key.
+func (l *Ledis) MetaUpdate(items ...MetaItem) error {
+	t := l.metaBatch
+
+	t.Lock()
+	defer t.Unlock()
+
+	for _, item := range items {
+		if item.Value == nil {
+			t.Delete(metaEncodeKey(item.Key))
+		} else {
+			t.Put(metaEncodeKey(item.Key), item.Value)
+		}
+	}
+
+	return t.Commit()
+}
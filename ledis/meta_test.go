@@ -0,0 +1,68 @@
+package ledis
+
+import (
+	"os"
+	"testing"
+
+	"github.com/r0123r/vredis/config"
+)
+
+func TestMeta(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_meta"
+	cfg.UseReplication = true
+
+	os.RemoveAll(cfg.DataDir)
+
+	l, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	db, _ := l.Select(0)
+	db.Set([]byte("a"), []byte("1"))
+
+	s, _ := l.ReplicationStat()
+	lastID := s.LastID
+
+	if err := l.MetaUpdate(
+		MetaItem{[]byte("lib:a"), []byte("1")},
+		MetaItem{[]byte("lib:b"), []byte("2")},
+		MetaItem{[]byte("version"), []byte("1")},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// one log for the update
+	if s, _ := l.ReplicationStat(); s.LastID != lastID+1 {
+		t.Fatal(s.LastID, lastID)
+	}
+
+	if v, err := l.MetaGet([]byte("version")); err != nil || string(v) != "1" {
+		t.Fatal(string(v), err)
+	}
+
+	if items, err := l.MetaScan([]byte("lib:")); err != nil {
+		t.Fatal(err)
+	} else if len(items) != 2 || string(items[0].Key) != "lib:a" || string(items[1].Value) != "2" {
+		t.Fatal(items)
+	}
+
+	// the data commands don't see the meta space
+	if keys, err := db.Scan(KV, nil, 10, false, ""); err != nil || len(keys) != 1 {
+		t.Fatal(keys, err)
+	} else if _, err := db.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.MetaUpdate(MetaItem{[]byte("lib:a"), nil}); err != nil {
+		t.Fatal(err)
+	}
+
+	if items, err := l.MetaScan([]byte("lib:")); err != nil {
+		t.Fatal(err)
+	} else if len(items) != 1 || string(items[0].Key) != "lib:b" {
+		t.Fatal(items)
+	}
+}
@@ -1,8 +1,11 @@
 package ledis
 
 import (
+	"bytes"
 	"errors"
+	"math/rand"
 	"regexp"
+	"time"
 
 	"github.com/r0123r/vredis/store"
 )
@@ -17,7 +20,12 @@ func (db *DB) Scan(dataType DataType, cursor []byte, count int, inclusive bool,
 		return nil, err
 	}
 
-	return db.scanGeneric(storeDataType, cursor, count, inclusive, match, false)
+	m, err := buildMatchRegexp(match)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.scanGeneric(storeDataType, cursor, count, inclusive, m, nil, false)
 }
 
 // RevScan scans the data reversed. if inclusive is true, revscan range (-inf, cursor] else (inf, cursor)
@@ -27,7 +35,175 @@ func (db *DB) RevScan(dataType DataType, cursor []byte, count int, inclusive boo
 		return nil, err
 	}
 
-	return db.scanGeneric(storeDataType, cursor, count, inclusive, match, true)
+	m, err := buildMatchRegexp(match)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.scanGeneric(storeDataType, cursor, count, inclusive, m, nil, true)
+}
+
+// ScanGlob is like Scan but matches keys with the glob pattern, only the
+// keys starting with the literal prefix of the pattern are read.
+func (db *DB) ScanGlob(dataType DataType, cursor []byte, count int, inclusive bool, pattern *Glob) ([][]byte, error) {
+	storeDataType, err := getDataStoreType(dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	m, prefix := globMatcher(pattern)
+	return db.scanGeneric(storeDataType, cursor, count, inclusive, m, prefix, false)
+}
+
+// RevScanGlob is like RevScan but matches keys with the glob pattern.
+func (db *DB) RevScanGlob(dataType DataType, cursor []byte, count int, inclusive bool, pattern *Glob) ([][]byte, error) {
+	storeDataType, err := getDataStoreType(dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	m, prefix := globMatcher(pattern)
+	return db.scanGeneric(storeDataType, cursor, count, inclusive, m, prefix, true)
+}
+
+// RandomKey returns a random key of any type, or nil if the database is empty.
+// A type is picked at random among the non-empty ones, then the key is found by
+// seeking to a random point between the first and the last key of that type.
+// The types are not weighted by their number of keys, which would take an
+// O(N) count, so a key of a rare type is returned more often than one of a
+// common type, and a key after a large gap more often than its neighbours.
+func (db *DB) RandomKey() ([]byte, error) {
+	types := []byte{KVType, LMetaType, HSizeType, SSizeType, ZSizeType}
+
+	for _, i := range rand.Perm(len(types)) {
+		key, err := db.randomScanKey(types[i])
+		if err != nil {
+			return nil, err
+		} else if key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// KeyspaceStat returns the number of keys of all types in the database, the
+// number of keys with a TTL and their average TTL in milliseconds.
+// It iterates over the meta entries, so it is O(N) in the number of keys.
+func (db *DB) KeyspaceStat() (keys int64, expires int64, avgTTL int64, err error) {
+	for _, tp := range []byte{KVType, LMetaType, HSizeType, SSizeType, ZSizeType} {
+		minKey, maxKey, err := db.buildScanKeyRange(tp, nil, false)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		it := db.buildScanIterator(minKey, maxKey, true, false)
+		for ; it.Valid(); it.Next() {
+			if _, err := db.decodeScanKey(tp, it.RawKey()); err == nil {
+				keys++
+			}
+		}
+		it.Close()
+	}
+
+	// expire meta key -> when
+	minKey := db.expEncodeMetaKey(NoneType, nil)
+	maxKey := db.expEncodeMetaKey(maxDataType, nil)
+
+	now := time.Now().Unix()
+
+	var ttl int64
+	it := db.bucket.RangeIterator(minKey, maxKey, store.RangeROpen)
+	for ; it.Valid(); it.Next() {
+		when, err := Int64(it.RawValue(), nil)
+		if err != nil {
+			continue
+		}
+
+		expires++
+		if when > now {
+			ttl += when - now
+		}
+	}
+	it.Close()
+
+	if expires > 0 {
+		avgTTL = ttl * 1000 / expires
+	}
+
+	return keys, expires, avgTTL, nil
+}
+
+func (db *DB) randomScanKey(storeDataType byte) ([]byte, error) {
+	minKey, maxKey, err := db.buildScanKeyRange(storeDataType, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	first, err := db.firstScanKey(storeDataType, minKey, maxKey, false)
+	if err != nil || first == nil {
+		return nil, err
+	}
+
+	last, err := db.firstScanKey(storeDataType, minKey, maxKey, true)
+	if err != nil || last == nil {
+		return nil, err
+	}
+
+	seekKey, err := db.encodeScanKey(storeDataType, randomKeyBetween(first, last))
+	if err != nil {
+		return nil, err
+	}
+
+	return db.firstScanKey(storeDataType, seekKey, maxKey, false)
+}
+
+func (db *DB) firstScanKey(storeDataType byte, minKey []byte, maxKey []byte, reverse bool) ([]byte, error) {
+	it := db.buildScanIterator(minKey, maxKey, true, reverse)
+	defer it.Close()
+
+	for ; it.Valid(); it.Next() {
+		if k, err := db.decodeScanKey(storeDataType, it.Key()); err == nil {
+			return k, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// randomKeyBetween returns a random key k with min <= k <= max.
+func randomKeyBetween(min []byte, max []byte) []byte {
+	n := 0
+	for n < len(min) && n < len(max) && min[n] == max[n] {
+		n++
+	}
+
+	if n == len(max) {
+		return min
+	}
+
+	lo := 0
+	if n < len(min) {
+		lo = int(min[n])
+	}
+	hi := int(max[n])
+
+	b := lo + rand.Intn(hi-lo+1)
+
+	k := make([]byte, n, n+5)
+	copy(k, max[:n])
+	k = append(k, byte(b))
+
+	if b == hi {
+		return k
+	} else if b == lo && n < len(min) {
+		return append(k, min[n+1:]...)
+	}
+
+	for i := 0; i < 4; i++ {
+		k = append(k, byte(rand.Intn(256)))
+	}
+	return k
 }
 
 func getDataStoreType(dataType DataType) (byte, error) {
@@ -49,19 +225,31 @@ func getDataStoreType(dataType DataType) (byte, error) {
 	return storeDataType, nil
 }
 
-func buildMatchRegexp(match string) (*regexp.Regexp, error) {
-	var err error
-	var r *regexp.Regexp
+type matcher interface {
+	Match(b []byte) bool
+}
 
-	if len(match) > 0 {
-		if r, err = regexp.Compile(match); err != nil {
-			return nil, err
-		}
+func buildMatchRegexp(match string) (matcher, error) {
+	if len(match) == 0 {
+		return nil, nil
+	}
+
+	r, err := regexp.Compile(match)
+	if err != nil {
+		return nil, err
 	}
 
 	return r, nil
 }
 
+func globMatcher(g *Glob) (matcher, []byte) {
+	if g == nil || g.all {
+		return nil, nil
+	}
+
+	return g, g.prefix
+}
+
 func (db *DB) buildScanIterator(minKey []byte, maxKey []byte, inclusive bool, reverse bool) *store.RangeLimitIterator {
 	tp := store.RangeOpen
 
@@ -85,6 +273,53 @@ func (db *DB) buildScanIterator(minKey []byte, maxKey []byte, inclusive bool, re
 	return it
 }
 
+// buildPrefixScanRange narrows the scan range to the keys starting with prefix.
+// encode encodes a key in the scanned namespace, and end is the encoded end of the namespace.
+func buildPrefixScanRange(encode func([]byte) ([]byte, error), end []byte, cursor []byte, prefix []byte,
+	inclusive bool, reverse bool) (minKey []byte, maxKey []byte, rangeType uint8, err error) {
+
+	if minKey, err = encode(prefix); err != nil {
+		return
+	}
+
+	maxKey = end
+	if prefixEnd := prefixSuccessor(prefix); prefixEnd != nil {
+		if maxKey, err = encode(prefixEnd); err != nil {
+			return
+		}
+	}
+
+	if !reverse {
+		rangeType = store.RangeROpen
+		if len(cursor) > 0 && bytes.Compare(cursor, prefix) >= 0 {
+			if minKey, err = encode(cursor); err != nil {
+				return
+			}
+			if !inclusive {
+				rangeType = store.RangeOpen
+			}
+		}
+	} else {
+		rangeType = store.RangeROpen
+		if len(cursor) > 0 && bytes.Compare(cursor, prefix) >= 0 {
+			if k, e := encode(cursor); e != nil {
+				err = e
+				return
+			} else if bytes.Compare(k, maxKey) < 0 {
+				maxKey = k
+				if inclusive {
+					rangeType = store.RangeClose
+				}
+			}
+		} else if len(cursor) > 0 {
+			// the cursor is before every key with the prefix
+			maxKey = minKey
+		}
+	}
+
+	return
+}
+
 func (db *DB) buildScanKeyRange(storeDataType byte, key []byte, reverse bool) (minKey []byte, maxKey []byte, err error) {
 	if !reverse {
 		if minKey, err = db.encodeScanMinKey(storeDataType, key); err != nil {
@@ -113,21 +348,36 @@ func checkScanCount(count int) int {
 }
 
 func (db *DB) scanGeneric(storeDataType byte, key []byte, count int,
-	inclusive bool, match string, reverse bool) ([][]byte, error) {
+	inclusive bool, r matcher, prefix []byte, reverse bool) ([][]byte, error) {
 
-	r, err := buildMatchRegexp(match)
-	if err != nil {
-		return nil, err
-	}
+	count = checkScanCount(count)
 
-	minKey, maxKey, err := db.buildScanKeyRange(storeDataType, key, reverse)
-	if err != nil {
-		return nil, err
-	}
+	var it *store.RangeLimitIterator
+	if len(prefix) > 0 {
+		end, err := db.encodeScanMaxKey(storeDataType, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	count = checkScanCount(count)
+		encode := func(k []byte) ([]byte, error) { return db.encodeScanKey(storeDataType, k) }
+		minKey, maxKey, tp, err := buildPrefixScanRange(encode, end, key, prefix, inclusive, reverse)
+		if err != nil {
+			return nil, err
+		}
 
-	it := db.buildScanIterator(minKey, maxKey, inclusive, reverse)
+		if !reverse {
+			it = db.bucket.RangeIterator(minKey, maxKey, tp)
+		} else {
+			it = db.bucket.RevRangeIterator(minKey, maxKey, tp)
+		}
+	} else {
+		minKey, maxKey, err := db.buildScanKeyRange(storeDataType, key, reverse)
+		if err != nil {
+			return nil, err
+		}
+
+		it = db.buildScanIterator(minKey, maxKey, inclusive, reverse)
+	}
 
 	v := make([][]byte, 0, count)
 
@@ -251,12 +501,30 @@ func (db *DB) encodeDataScanKey(storeDataType byte, key []byte, cursor []byte) (
 }
 
 func (db *DB) buildDataScanIterator(storeDataType byte, key []byte, cursor []byte, count int,
-	inclusive bool, reverse bool) (*store.RangeLimitIterator, error) {
+	inclusive bool, prefix []byte, reverse bool) (*store.RangeLimitIterator, error) {
 
 	if err := checkKeySize(key); err != nil {
 		return nil, err
 	}
 
+	if len(prefix) > 0 {
+		end, err := db.encodeDataScanMaxKey(storeDataType, key, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		encode := func(k []byte) ([]byte, error) { return db.encodeDataScanKey(storeDataType, key, k) }
+		minKey, maxKey, tp, err := buildPrefixScanRange(encode, end, cursor, prefix, inclusive, reverse)
+		if err != nil {
+			return nil, err
+		}
+
+		if !reverse {
+			return db.bucket.RangeIterator(minKey, maxKey, tp), nil
+		}
+		return db.bucket.RevRangeIterator(minKey, maxKey, tp), nil
+	}
+
 	minKey, maxKey, err := db.buildDataScanKeyRange(storeDataType, key, cursor, reverse)
 	if err != nil {
 		return nil, err
@@ -267,17 +535,12 @@ func (db *DB) buildDataScanIterator(storeDataType byte, key []byte, cursor []byt
 	return it, nil
 }
 
-func (db *DB) hScanGeneric(key []byte, cursor []byte, count int, inclusive bool, match string, reverse bool) ([]FVPair, error) {
+func (db *DB) hScanGeneric(key []byte, cursor []byte, count int, inclusive bool, r matcher, prefix []byte, reverse bool) ([]FVPair, error) {
 	count = checkScanCount(count)
 
-	r, err := buildMatchRegexp(match)
-	if err != nil {
-		return nil, err
-	}
-
 	v := make([]FVPair, 0, count)
 
-	it, err := db.buildDataScanIterator(HashType, key, cursor, count, inclusive, reverse)
+	it, err := db.buildDataScanIterator(HashType, key, cursor, count, inclusive, prefix, reverse)
 	if err != nil {
 		return nil, err
 	}
@@ -302,25 +565,42 @@ func (db *DB) hScanGeneric(key []byte, cursor []byte, count int, inclusive bool,
 
 // HScan scans data for hash.
 func (db *DB) HScan(key []byte, cursor []byte, count int, inclusive bool, match string) ([]FVPair, error) {
-	return db.hScanGeneric(key, cursor, count, inclusive, match, false)
+	r, err := buildMatchRegexp(match)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.hScanGeneric(key, cursor, count, inclusive, r, nil, false)
 }
 
 // HRevScan reversed scans data for hash.
 func (db *DB) HRevScan(key []byte, cursor []byte, count int, inclusive bool, match string) ([]FVPair, error) {
-	return db.hScanGeneric(key, cursor, count, inclusive, match, true)
-}
-
-func (db *DB) sScanGeneric(key []byte, cursor []byte, count int, inclusive bool, match string, reverse bool) ([][]byte, error) {
-	count = checkScanCount(count)
-
 	r, err := buildMatchRegexp(match)
 	if err != nil {
 		return nil, err
 	}
 
+	return db.hScanGeneric(key, cursor, count, inclusive, r, nil, true)
+}
+
+// HScanGlob is like HScan but matches hash members with the glob pattern.
+func (db *DB) HScanGlob(key []byte, cursor []byte, count int, inclusive bool, pattern *Glob) ([]FVPair, error) {
+	r, prefix := globMatcher(pattern)
+	return db.hScanGeneric(key, cursor, count, inclusive, r, prefix, false)
+}
+
+// HRevScanGlob is like HRevScan but matches hash members with the glob pattern.
+func (db *DB) HRevScanGlob(key []byte, cursor []byte, count int, inclusive bool, pattern *Glob) ([]FVPair, error) {
+	r, prefix := globMatcher(pattern)
+	return db.hScanGeneric(key, cursor, count, inclusive, r, prefix, true)
+}
+
+func (db *DB) sScanGeneric(key []byte, cursor []byte, count int, inclusive bool, r matcher, prefix []byte, reverse bool) ([][]byte, error) {
+	count = checkScanCount(count)
+
 	v := make([][]byte, 0, count)
 
-	it, err := db.buildDataScanIterator(SetType, key, cursor, count, inclusive, reverse)
+	it, err := db.buildDataScanIterator(SetType, key, cursor, count, inclusive, prefix, reverse)
 	if err != nil {
 		return nil, err
 	}
@@ -345,25 +625,42 @@ func (db *DB) sScanGeneric(key []byte, cursor []byte, count int, inclusive bool,
 
 // SScan scans data for set.
 func (db *DB) SScan(key []byte, cursor []byte, count int, inclusive bool, match string) ([][]byte, error) {
-	return db.sScanGeneric(key, cursor, count, inclusive, match, false)
+	r, err := buildMatchRegexp(match)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.sScanGeneric(key, cursor, count, inclusive, r, nil, false)
 }
 
 // SRevScan scans data reversed for set.
 func (db *DB) SRevScan(key []byte, cursor []byte, count int, inclusive bool, match string) ([][]byte, error) {
-	return db.sScanGeneric(key, cursor, count, inclusive, match, true)
-}
-
-func (db *DB) zScanGeneric(key []byte, cursor []byte, count int, inclusive bool, match string, reverse bool) ([]ScorePair, error) {
-	count = checkScanCount(count)
-
 	r, err := buildMatchRegexp(match)
 	if err != nil {
 		return nil, err
 	}
 
+	return db.sScanGeneric(key, cursor, count, inclusive, r, nil, true)
+}
+
+// SScanGlob is like SScan but matches set members with the glob pattern.
+func (db *DB) SScanGlob(key []byte, cursor []byte, count int, inclusive bool, pattern *Glob) ([][]byte, error) {
+	r, prefix := globMatcher(pattern)
+	return db.sScanGeneric(key, cursor, count, inclusive, r, prefix, false)
+}
+
+// SRevScanGlob is like SRevScan but matches set members with the glob pattern.
+func (db *DB) SRevScanGlob(key []byte, cursor []byte, count int, inclusive bool, pattern *Glob) ([][]byte, error) {
+	r, prefix := globMatcher(pattern)
+	return db.sScanGeneric(key, cursor, count, inclusive, r, prefix, true)
+}
+
+func (db *DB) zScanGeneric(key []byte, cursor []byte, count int, inclusive bool, r matcher, prefix []byte, reverse bool) ([]ScorePair, error) {
+	count = checkScanCount(count)
+
 	v := make([]ScorePair, 0, count)
 
-	it, err := db.buildDataScanIterator(ZSetType, key, cursor, count, inclusive, reverse)
+	it, err := db.buildDataScanIterator(ZSetType, key, cursor, count, inclusive, prefix, reverse)
 	if err != nil {
 		return nil, err
 	}
@@ -393,10 +690,32 @@ func (db *DB) zScanGeneric(key []byte, cursor []byte, count int, inclusive bool,
 
 // ZScan scans data for zset.
 func (db *DB) ZScan(key []byte, cursor []byte, count int, inclusive bool, match string) ([]ScorePair, error) {
-	return db.zScanGeneric(key, cursor, count, inclusive, match, false)
+	r, err := buildMatchRegexp(match)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.zScanGeneric(key, cursor, count, inclusive, r, nil, false)
 }
 
 // ZRevScan scans data reversed for zset.
 func (db *DB) ZRevScan(key []byte, cursor []byte, count int, inclusive bool, match string) ([]ScorePair, error) {
-	return db.zScanGeneric(key, cursor, count, inclusive, match, true)
+	r, err := buildMatchRegexp(match)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.zScanGeneric(key, cursor, count, inclusive, r, nil, true)
+}
+
+// ZScanGlob is like ZScan but matches zset members with the glob pattern.
+func (db *DB) ZScanGlob(key []byte, cursor []byte, count int, inclusive bool, pattern *Glob) ([]ScorePair, error) {
+	r, prefix := globMatcher(pattern)
+	return db.zScanGeneric(key, cursor, count, inclusive, r, prefix, false)
+}
+
+// ZRevScanGlob is like ZRevScan but matches zset members with the glob pattern.
+func (db *DB) ZRevScanGlob(key []byte, cursor []byte, count int, inclusive bool, pattern *Glob) ([]ScorePair, error) {
+	r, prefix := globMatcher(pattern)
+	return db.zScanGeneric(key, cursor, count, inclusive, r, prefix, true)
 }
@@ -400,3 +400,77 @@ func TestDBZScan(t *testing.T) {
 	}
 
 }
+
+func TestDBRandomKey(t *testing.T) {
+	db := getTestDB()
+
+	db.FlushAll()
+
+	if k, err := db.RandomKey(); err != nil {
+		t.Fatal(err)
+	} else if k != nil {
+		t.Fatal(string(k))
+	}
+
+	db.Set([]byte("random_a"), []byte("1"))
+	db.HSet([]byte("random_b"), []byte("f"), []byte("1"))
+	db.LPush([]byte("random_c"), []byte("1"))
+	db.SAdd([]byte("random_d"), []byte("1"))
+	db.ZAdd([]byte("random_e"), ScorePair{1, []byte("1")})
+
+	seen := make(map[string]struct{})
+	for i := 0; i < 200; i++ {
+		k, err := db.RandomKey()
+		if err != nil {
+			t.Fatal(err)
+		} else if k == nil {
+			t.Fatal("must not nil")
+		}
+		seen[string(k)] = struct{}{}
+	}
+
+	for _, k := range []string{"random_a", "random_b", "random_c", "random_d", "random_e"} {
+		if _, ok := seen[k]; !ok {
+			t.Fatal(k, "never returned")
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		min := []byte{byte(i), 'a', 'b'}
+		max := []byte{byte(i), 'z'}
+		if k := randomKeyBetween(min, max); string(k) < string(min) || string(k) > string(max) {
+			t.Fatalf("%q not in [%q, %q]", k, min, max)
+		}
+	}
+}
+
+func TestDBKeyspaceStat(t *testing.T) {
+	getTestDB()
+	db, _ := testLedis.Select(9)
+
+	db.FlushAll()
+
+	if keys, expires, avgTTL, err := db.KeyspaceStat(); err != nil {
+		t.Fatal(err)
+	} else if keys != 0 || expires != 0 || avgTTL != 0 {
+		t.Fatal(keys, expires, avgTTL)
+	}
+
+	db.Set([]byte("a"), []byte("1"))
+	db.HSet([]byte("b"), []byte("f"), []byte("1"))
+	db.HSet([]byte("b"), []byte("g"), []byte("1"))
+	db.LPush([]byte("c"), []byte("1"), []byte("2"))
+	db.SAdd([]byte("d"), []byte("1"))
+	db.ZAdd([]byte("e"), ScorePair{1, []byte("1")})
+
+	db.Expire([]byte("a"), 100)
+	db.HExpire([]byte("b"), 200)
+
+	if keys, expires, avgTTL, err := db.KeyspaceStat(); err != nil {
+		t.Fatal(err)
+	} else if keys != 5 || expires != 2 {
+		t.Fatal(keys, expires)
+	} else if avgTTL < 148000 || avgTTL > 150000 {
+		t.Fatal(avgTTL)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"encoding/binary"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/r0123r/vredis/store"
+	"github.com/siddontang/go/log"
 )
 
 var (
@@ -193,6 +195,10 @@ func (c *ttlChecker) check() {
 			continue
 		}
 
+		if h := db.l.getExpireHandler(); h != nil && c.expireInTx(h, dt, k, tk, mk, now) {
+			continue
+		}
+
 		t.Lock()
 
 		if exp, err := Int64(dbGet(mk)); err == nil {
@@ -202,7 +208,9 @@ func (c *ttlChecker) check() {
 				t.Delete(tk)
 				t.Delete(mk)
 
-				t.Commit()
+				if err := t.Commit(); err == nil {
+					atomic.AddInt64(&db.l.expiredKeys, 1)
+				}
 			}
 
 		}
@@ -215,3 +223,52 @@ func (c *ttlChecker) check() {
 
 	return
 }
+
+// expireInTx deletes the expired key in a Tx, and calls the handler before
+// the commit. It returns false if the key must be deleted without the handler.
+func (c *ttlChecker) expireInTx(h ExpireHandler, dataType byte, key []byte, tk []byte, mk []byte, now int64) bool {
+	db := c.db
+
+	tx := db.l.Begin()
+	defer tx.Rollback()
+
+	txdb, err := tx.Select(db.index)
+	if err != nil {
+		return false
+	}
+
+	if exp, err := Int64(txdb.bucket.Get(mk)); err != nil || exp > now {
+		// not expired anymore
+		return true
+	}
+
+	t, cb := txdb.expireFunc(dataType)
+
+	t.Lock()
+	cb(t, key)
+	t.Delete(tk)
+	t.Delete(mk)
+	err = t.Commit()
+	t.Unlock()
+
+	if err != nil {
+		return false
+	}
+
+	// the handler sees the expiration, not the deletion
+	tx.Events()
+	dt, _ := dataTypeOf(dataType)
+	tx.events = append(tx.events, KeyEvent{db.index, dt, append([]byte{}, key...), KeyExpired})
+
+	if err := h(tx); err != nil {
+		log.Errorf("expire handler of %q error %s", key, err.Error())
+		return false
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false
+	}
+
+	atomic.AddInt64(&db.l.expiredKeys, 1)
+	return true
+}
@@ -0,0 +1,127 @@
+package ledis
+
+import (
+	"github.com/r0123r/vredis/store"
+)
+
+// Tx runs the writes of several commands as one unit.
+//
+// It blocks the other writers until it is committed or rolled back, the DBs of
+// the Tx read their own writes, and all the writes are committed to the store,
+// and logged for the replication, in one batch by Commit. The other clients
+// never see a part of the writes.
+//
+// A Tx must be used by one goroutine only.
+type Tx struct {
+	l *Ledis
+
+	tx *store.Tx
+
+	dbs map[int]*DB
+
+	// the key events not returned by Events yet
+	events []KeyEvent
+
+	done bool
+}
+
+// Begin starts a Tx, Commit or Rollback must be called to release the write lock.
+func (l *Ledis) Begin() *Tx {
+	l.wLock.Lock()
+
+	tx := new(Tx)
+	tx.l = l
+	tx.tx = l.ldb.NewTx()
+	tx.dbs = make(map[int]*DB)
+
+	return tx
+}
+
+// Select chooses a database of the Tx.
+func (tx *Tx) Select(index int) (*DB, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	if db, ok := tx.dbs[index]; ok {
+		return db, nil
+	}
+
+	db, err := tx.l.Select(index)
+	if err != nil {
+		return nil, err
+	}
+
+	d := new(DB)
+	d.l = tx.l
+	d.sdb = db.sdb
+	d.bucket = tx.tx
+	d.setIndex(index)
+
+	d.kvBatch = d.newTxBatch(tx)
+	d.listBatch = d.newTxBatch(tx)
+	d.hashBatch = d.newTxBatch(tx)
+	d.zsetBatch = d.newTxBatch(tx)
+	d.setBatch = d.newTxBatch(tx)
+
+	// the blocked clients wait for the committed data, and the
+	// expirations are checked on the DB
+	d.lbkeys = db.lbkeys
+	d.ttlChecker = db.ttlChecker
+
+	tx.dbs[index] = d
+	return d, nil
+}
+
+func (db *DB) newTxBatch(tx *Tx) *batch {
+	return db.l.newBatch(db.bucket.NewWriteBatch(), &txBatchLocker{}, tx)
+}
+
+// Commit writes all the writes of the Tx in one batch.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	defer tx.close()
+
+	if tx.tx.Len() == 0 {
+		return nil
+	} else if tx.l.cfg.GetReadonly() {
+		return ErrWriteInROnly
+	}
+
+	wb := tx.tx.WriteBatch()
+	defer wb.Close()
+
+	return tx.l.handleCommit(wb, wb)
+}
+
+// Rollback drops all the writes of the Tx.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.close()
+	return nil
+}
+
+// Events returns the key events of the writes since the last call, in order.
+func (tx *Tx) Events() []KeyEvent {
+	events := tx.events
+	tx.events = nil
+	return events
+}
+
+func (tx *Tx) addKeyEvents(ops []batchOp) {
+	tx.events = append(tx.events, keyEvents(ops)...)
+}
+
+func (tx *Tx) close() {
+	tx.tx.Rollback()
+	tx.dbs = nil
+	tx.events = nil
+	tx.done = true
+
+	tx.l.wLock.Unlock()
+}
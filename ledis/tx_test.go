@@ -0,0 +1,198 @@
+package ledis
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+)
+
+func TestTx(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_tx"
+	cfg.UseReplication = true
+
+	os.RemoveAll(cfg.DataDir)
+
+	l, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	db, _ := l.Select(0)
+	db.Set([]byte("a"), []byte("1"))
+	db.RPush([]byte("l"), []byte("1"), []byte("2"))
+
+	s, _ := l.ReplicationStat()
+	lastID := s.LastID
+
+	tx := l.Begin()
+	txdb, err := tx.Select(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := txdb.Incr([]byte("a")); err != nil {
+		t.Fatal(err)
+	} else if _, err := txdb.LClear([]byte("l")); err != nil {
+		t.Fatal(err)
+	} else if _, err := txdb.ZAdd([]byte("z"), ScorePair{1, []byte("m")}); err != nil {
+		t.Fatal(err)
+	} else if _, err := txdb.ZExpire([]byte("z"), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	txdb1, _ := tx.Select(1)
+	txdb1.Set([]byte("b"), []byte("1"))
+
+	// the Tx sees its writes
+	if v, _ := txdb.Get([]byte("a")); string(v) != "2" {
+		t.Fatal(string(v))
+	} else if n, _ := txdb.LLen([]byte("l")); n != 0 {
+		t.Fatal(n)
+	} else if n, _ := txdb.ZCard([]byte("z")); n != 1 {
+		t.Fatal(n)
+	} else if n, _ := txdb.ZTTL([]byte("z")); n <= 0 {
+		t.Fatal(n)
+	} else if keys, _ := txdb.Scan(KV, nil, 10, false, ""); len(keys) != 1 || string(keys[0]) != "a" {
+		t.Fatal(keys)
+	}
+
+	// the others don't see them, and wait for the commit to write
+	if v, _ := db.Get([]byte("a")); string(v) != "1" {
+		t.Fatal(string(v))
+	} else if n, _ := db.LLen([]byte("l")); n != 2 {
+		t.Fatal(n)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		db.Set([]byte("c"), []byte("1"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("write must wait for the Tx")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	} else if err := tx.Commit(); err != ErrTxDone {
+		t.Fatal(err)
+	}
+	<-done
+
+	if v, _ := db.Get([]byte("a")); string(v) != "2" {
+		t.Fatal(string(v))
+	} else if n, _ := db.LLen([]byte("l")); n != 0 {
+		t.Fatal(n)
+	} else if n, _ := db.ZTTL([]byte("z")); n <= 0 {
+		t.Fatal(n)
+	}
+
+	db1, _ := l.Select(1)
+	if v, _ := db1.Get([]byte("b")); string(v) != "1" {
+		t.Fatal(string(v))
+	}
+
+	// one log for the Tx, and one for the set of c
+	if s, _ := l.ReplicationStat(); s.LastID != lastID+2 {
+		t.Fatal(s.LastID, lastID)
+	}
+
+	// rollback
+	tx = l.Begin()
+	txdb, _ = tx.Select(0)
+	txdb.Set([]byte("a"), []byte("3"))
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := db.Get([]byte("a")); string(v) != "2" {
+		t.Fatal(string(v))
+	} else if s, _ := l.ReplicationStat(); s.LastID != lastID+2 {
+		t.Fatal(s.LastID, lastID)
+	}
+
+	// nothing is logged without writes
+	tx = l.Begin()
+	txdb, _ = tx.Select(0)
+	txdb.Get([]byte("a"))
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	} else if s, _ := l.ReplicationStat(); s.LastID != lastID+2 {
+		t.Fatal(s.LastID, lastID)
+	}
+}
+
+func TestTxEvents(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_tx_events"
+
+	os.RemoveAll(cfg.DataDir)
+
+	l, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	db, _ := l.Select(0)
+	db.HSet([]byte("h"), []byte("f1"), []byte("1"))
+	db.HSet([]byte("h"), []byte("f2"), []byte("1"))
+
+	tx := l.Begin()
+	txdb, _ := tx.Select(0)
+	txdb.Set([]byte("a"), []byte("1"))
+	txdb.HDel([]byte("h"), []byte("f1"))
+	txdb.ZAdd([]byte("z"), ScorePair{1, []byte("m")}, ScorePair{2, []byte("n")})
+	txdb.Expire([]byte("a"), 100)
+
+	events := tx.Events()
+	expected := []KeyEvent{
+		{0, KV, []byte("a"), KeyWrite},
+		{0, HASH, []byte("h"), KeyWrite},
+		{0, ZSET, []byte("z"), KeyWrite},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatal(events)
+	} else if events := tx.Events(); len(events) != 0 {
+		t.Fatal(events)
+	}
+
+	txdb.HDel([]byte("h"), []byte("f2"))
+	txdb.Del([]byte("a"))
+	if events := tx.Events(); !reflect.DeepEqual(events, []KeyEvent{{0, HASH, []byte("h"), KeyDel}, {0, KV, []byte("a"), KeyDel}}) {
+		t.Fatal(events)
+	}
+	tx.Rollback()
+
+	// the writes of the handler are committed with the expiration
+	var expired []KeyEvent
+	l.SetExpireHandler(func(tx *Tx) error {
+		expired = append(expired, tx.Events()...)
+		txdb, _ := tx.Select(0)
+		_, err := txdb.Incr([]byte("expired"))
+		return err
+	})
+	defer l.SetExpireHandler(nil)
+
+	db.Set([]byte("b"), []byte("1"))
+	db.Expire([]byte("b"), 1)
+
+	time.Sleep(2 * time.Second)
+	db.ttlChecker.check()
+
+	if !reflect.DeepEqual(expired, []KeyEvent{{0, KV, []byte("b"), KeyExpired}}) {
+		t.Fatal(expired)
+	} else if v, _ := db.Get([]byte("b")); v != nil {
+		t.Fatal(string(v))
+	} else if v, _ := db.Get([]byte("expired")); string(v) != "1" {
+		t.Fatal(string(v))
+	}
+}
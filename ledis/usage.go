@@ -0,0 +1,164 @@
+package ledis
+
+import (
+	"github.com/r0123r/vredis/store"
+)
+
+// KeyUsage returns the encoded bytes the key takes in the store, including its
+// meta entry, member entries and expire entries.
+// If the key has more members than samples, the member size is taken from the
+// backend's approximate range size when the driver supports it, otherwise it is
+// estimated from the average size of the first samples members.
+// samples <= 0 means every member is counted.
+func (db *DB) KeyUsage(dataType DataType, key []byte, samples int) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+
+	var size int64
+	var err error
+	var expType byte
+
+	switch dataType {
+	case KV:
+		expType = KVType
+		size, err = db.entryUsage(db.encodeKVKey(key))
+	case LIST:
+		expType = ListType
+		size, err = db.lUsage(key, samples)
+	case HASH:
+		expType = HashType
+		size, err = db.hUsage(key, samples)
+	case SET:
+		expType = SetType
+		size, err = db.sUsage(key, samples)
+	case ZSET:
+		expType = ZSetType
+		size, err = db.zUsage(key, samples)
+	default:
+		return 0, errDataType
+	}
+
+	if err != nil || size == 0 {
+		return size, err
+	}
+
+	n, err := db.expireUsage(expType, key)
+	return size + n, err
+}
+
+func (db *DB) entryUsage(ek []byte) (int64, error) {
+	v, err := db.bucket.Get(ek)
+	if err != nil || v == nil {
+		return 0, err
+	}
+
+	return int64(len(ek) + len(v)), nil
+}
+
+// expire meta key -> when, expire time key -> meta key
+func (db *DB) expireUsage(dataType byte, key []byte) (int64, error) {
+	mk := db.expEncodeMetaKey(dataType, key)
+	v, err := db.bucket.Get(mk)
+	if err != nil || v == nil {
+		return 0, err
+	}
+
+	tk := db.expEncodeTimeKey(dataType, key, 0)
+	return int64(len(mk) + len(v) + len(tk) + len(mk)), nil
+}
+
+// rangeUsage returns the size of the count entries in [minKey, maxKey).
+func (db *DB) rangeUsage(minKey []byte, maxKey []byte, count int64, samples int) (int64, error) {
+	it := db.bucket.RangeLimitIterator(minKey, maxKey, store.RangeROpen, 0, -1)
+	defer it.Close()
+
+	var size int64
+	var n int64
+	for ; it.Valid(); it.Next() {
+		if samples > 0 && n == int64(samples) {
+			break
+		}
+
+		size += int64(len(it.RawKey()) + len(it.RawValue()))
+		n++
+	}
+
+	if !it.Valid() || n == 0 || count <= n {
+		return size, nil
+	}
+
+	if approx, ok, err := db.sdb.ApproximateSize(minKey, maxKey); err != nil {
+		return 0, err
+	} else if ok && approx > 0 {
+		return approx, nil
+	}
+
+	return size / n * count, nil
+}
+
+func (db *DB) lUsage(key []byte, samples int) (int64, error) {
+	mk := db.lEncodeMetaKey(key)
+	headSeq, tailSeq, size, err := db.lGetMeta(nil, mk)
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
+	n, err := db.entryUsage(mk)
+	if err != nil {
+		return 0, err
+	}
+
+	m, err := db.rangeUsage(db.lEncodeListKey(key, headSeq), db.lEncodeListKey(key, tailSeq+1), int64(size), samples)
+	return n + m, err
+}
+
+func (db *DB) hUsage(key []byte, samples int) (int64, error) {
+	size, err := db.HLen(key)
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
+	n, err := db.entryUsage(db.hEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	}
+
+	m, err := db.rangeUsage(db.hEncodeStartKey(key), db.hEncodeStopKey(key), size, samples)
+	return n + m, err
+}
+
+func (db *DB) sUsage(key []byte, samples int) (int64, error) {
+	size, err := db.SCard(key)
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
+	n, err := db.entryUsage(db.sEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	}
+
+	m, err := db.rangeUsage(db.sEncodeStartKey(key), db.sEncodeStopKey(key), size, samples)
+	return n + m, err
+}
+
+func (db *DB) zUsage(key []byte, samples int) (int64, error) {
+	size, err := db.ZCard(key)
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
+	n, err := db.entryUsage(db.zEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	}
+
+	m, err := db.rangeUsage(db.zEncodeStartSetKey(key), db.zEncodeStopSetKey(key), size, samples)
+	if err != nil {
+		return 0, err
+	}
+
+	s, err := db.rangeUsage(db.zEncodeStartScoreKey(key, MinScore), db.zEncodeStopScoreKey(key, MaxScore), size, samples)
+	return n + m + s, err
+}
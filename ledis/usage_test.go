@@ -0,0 +1,74 @@
+package ledis
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDBKeyUsage(t *testing.T) {
+	db := getTestDB()
+
+	key := []byte("usage_kv")
+	db.Set(key, []byte("12345"))
+
+	if n, err := db.KeyUsage(KV, key, 0); err != nil {
+		t.Fatal(err)
+	} else if n != int64(len(db.encodeKVKey(key))+5) {
+		t.Fatal(n)
+	}
+
+	if n, err := db.KeyUsage(KV, []byte("usage_kv_none"), 0); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	db.Expire(key, 100)
+	if n, err := db.KeyUsage(KV, key, 0); err != nil {
+		t.Fatal(err)
+	} else if n <= int64(len(db.encodeKVKey(key))+5) {
+		t.Fatal(n)
+	}
+
+	key = []byte("usage_hash")
+	db.HClear(key)
+	for i := 0; i < 100; i++ {
+		db.HSet(key, []byte(fmt.Sprintf("f%03d", i)), []byte("value"))
+	}
+
+	all, err := db.KeyUsage(HASH, key, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sk := db.hEncodeSizeKey(key)
+	ek := db.hEncodeHashKey(key, []byte("f000"))
+	if all != int64(len(sk)+8+100*(len(ek)+5)) {
+		t.Fatal(all)
+	}
+
+	// all fields have the same size, so sampling must be exact
+	if n, err := db.KeyUsage(HASH, key, 5); err != nil {
+		t.Fatal(err)
+	} else if n != all {
+		t.Fatal(n, all)
+	}
+
+	key = []byte("usage_zset")
+	db.ZClear(key)
+	db.ZAdd(key, ScorePair{1, []byte("a")}, ScorePair{2, []byte("b")})
+	if n, err := db.KeyUsage(ZSET, key, 0); err != nil {
+		t.Fatal(err)
+	} else if n == 0 {
+		t.Fatal(n)
+	}
+
+	key = []byte("usage_list")
+	db.LClear(key)
+	db.RPush(key, []byte("1"), []byte("2"), []byte("3"))
+	if n, err := db.KeyUsage(LIST, key, 0); err != nil {
+		t.Fatal(err)
+	} else if n != int64(len(db.lEncodeMetaKey(key))+8+3*(len(db.lEncodeListKey(key, 0))+1)) {
+		t.Fatal(n)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/siddontang/go/log"
@@ -35,6 +36,21 @@ type Replication struct {
 	nc chan struct{}
 
 	ncm sync.Mutex
+
+	// func(time.Duration) called with the duration of each fsync
+	syncObserver atomic.Value
+}
+
+// SetSyncObserver sets the function called with the duration of each log
+// fsync, every second with sync_log = 1, or every log with sync_log = 2.
+func (r *Replication) SetSyncObserver(f func(d time.Duration)) {
+	r.syncObserver.Store(f)
+}
+
+func (r *Replication) observeSync(start time.Time) {
+	if f, ok := r.syncObserver.Load().(func(time.Duration)); ok && f != nil {
+		f(time.Since(start))
+	}
 }
 
 func NewReplication(cfg *config.Config) (*Replication, error) {
@@ -146,11 +162,17 @@ func (r *Replication) Log(data []byte) (*Log, error) {
 
 	l.Data = data
 
+	start := time.Now()
 	if err = r.s.StoreLog(l); err != nil {
 		r.m.Unlock()
 		return nil, err
 	}
 
+	if r.cfg.Replication.SyncLog == 2 {
+		// the log is synced when stored
+		r.observeSync(start)
+	}
+
 	r.m.Unlock()
 
 	r.ncm.Lock()
@@ -311,7 +333,9 @@ func (r *Replication) run() {
 		case <-syncTc.C:
 			if r.cfg.Replication.SyncLog == 1 {
 				r.m.Lock()
+				start := time.Now()
 				err := r.s.Sync()
+				r.observeSync(start)
 				r.m.Unlock()
 				if err != nil {
 					log.Errorf("sync store error %s", err.Error())
@@ -0,0 +1,1019 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/hack"
+)
+
+const aclDefaultUser = "default"
+
+var (
+	errACLDeleteDefault = errors.New("the 'default' user cannot be removed")
+	errACLNoSuchUser    = errors.New("no such user")
+)
+
+// ACL LOG reasons
+const (
+	aclDenyCommand = "command"
+	aclDenyKey     = "key"
+	aclDenyDB      = "db"
+	aclDenyAuth    = "auth"
+)
+
+type aclDenyError struct {
+	reason string
+	object string
+}
+
+func (e *aclDenyError) Error() string {
+	switch e.reason {
+	case aclDenyKey:
+		return "NOPERM No permissions to access a key"
+	case aclDenyDB:
+		return fmt.Sprintf("NOPERM No permissions to access database %s", e.object)
+	default:
+		return fmt.Sprintf("NOPERM this user has no permissions to run the '%s' command", e.object)
+	}
+}
+
+type aclCmdRule struct {
+	allow bool
+	// @all or a category like @read, empty for a command rule
+	category string
+	command  string
+	// first argument for a command|subcommand rule
+	sub string
+}
+
+func (r aclCmdRule) String() string {
+	s := "-"
+	if r.allow {
+		s = "+"
+	}
+
+	if len(r.category) > 0 {
+		return s + r.category
+	} else if len(r.sub) > 0 {
+		return s + r.command + "|" + r.sub
+	}
+	return s + r.command
+}
+
+func (r aclCmdRule) match(cmd *command, args [][]byte) bool {
+	if r.category == "@all" {
+		return true
+	} else if len(r.category) > 0 {
+		for _, c := range cmd.categoriesOf(args) {
+			if c == r.category {
+				return true
+			}
+		}
+		return false
+	}
+
+	if r.command != cmd.name {
+		return false
+	} else if len(r.sub) > 0 {
+		return len(args) > 0 && strings.EqualFold(r.sub, hack.String(args[0]))
+	}
+	return true
+}
+
+type aclUser struct {
+	name    string
+	enabled bool
+
+	nopass bool
+	// sha256 hex of the passwords
+	passwords []string
+
+	// command rules applied in order, the last matched one wins
+	cmdRules []aclCmdRule
+
+	allKeys bool
+	keys    []*ledis.Glob
+
+	allDBs bool
+	dbs    []int
+
+	deleted bool
+}
+
+func newACLUser(name string) *aclUser {
+	return &aclUser{name: name}
+}
+
+func (u *aclUser) clone() *aclUser {
+	n := *u
+	n.passwords = append([]string(nil), u.passwords...)
+	n.cmdRules = append([]aclCmdRule(nil), u.cmdRules...)
+	n.keys = append([]*ledis.Glob(nil), u.keys...)
+	n.dbs = append([]int(nil), u.dbs...)
+	return &n
+}
+
+func aclHashPassword(pass string) string {
+	h := sha256.Sum256([]byte(pass))
+	return hex.EncodeToString(h[:])
+}
+
+func (u *aclUser) addPassword(hash string) {
+	u.nopass = false
+	for _, p := range u.passwords {
+		if p == hash {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, hash)
+}
+
+func (u *aclUser) removePassword(hash string) {
+	for i, p := range u.passwords {
+		if p == hash {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return
+		}
+	}
+}
+
+func (u *aclUser) checkPassword(pass string) bool {
+	if !u.enabled {
+		return false
+	} else if u.nopass {
+		return true
+	}
+
+	hash := aclHashPassword(pass)
+	ok := false
+	for _, p := range u.passwords {
+		if subtle.ConstantTimeCompare([]byte(p), []byte(hash)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// applyRule applies one ACL SETUSER rule.
+func (u *aclUser) applyRule(rule string) error {
+	lower := strings.ToLower(rule)
+
+	switch lower {
+	case "on":
+		u.enabled = true
+		return nil
+	case "off":
+		u.enabled = false
+		return nil
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+		return nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+		return nil
+	case "allkeys":
+		u.allKeys = true
+		u.keys = nil
+		return nil
+	case "resetkeys":
+		u.allKeys = false
+		u.keys = nil
+		return nil
+	case "alldbs":
+		u.allDBs = true
+		u.dbs = nil
+		return nil
+	case "resetdbs":
+		u.allDBs = false
+		u.dbs = nil
+		return nil
+	case "allcommands":
+		return u.applyRule("+@all")
+	case "nocommands":
+		return u.applyRule("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetdbs", "nocommands", "off"} {
+			u.applyRule(r)
+		}
+		return nil
+	}
+
+	if len(rule) == 0 {
+		return fmt.Errorf("empty ACL rule")
+	}
+
+	switch rule[0] {
+	case '>':
+		u.addPassword(aclHashPassword(rule[1:]))
+	case '<':
+		u.removePassword(aclHashPassword(rule[1:]))
+	case '#', '!':
+		hash := strings.ToLower(rule[1:])
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("the password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		if rule[0] == '#' {
+			u.addPassword(hash)
+		} else {
+			u.removePassword(hash)
+		}
+	case '~':
+		if rule == "~*" {
+			u.allKeys = true
+			u.keys = nil
+		} else if !u.allKeys {
+			u.keys = append(u.keys, ledis.CompileGlob(rule[1:]))
+		}
+	case '+', '-':
+		return u.applyCommandRule(rule[0] == '+', lower[1:])
+	default:
+		if strings.HasPrefix(lower, "db:") {
+			index, err := strconv.Atoi(rule[3:])
+			if err != nil || index < 0 {
+				return fmt.Errorf("invalid ACL db rule '%s'", rule)
+			}
+			if !u.allDBs {
+				u.dbs = append(u.dbs, index)
+			}
+			return nil
+		}
+		return fmt.Errorf("unrecognized ACL rule '%s'", rule)
+	}
+
+	return nil
+}
+
+func (u *aclUser) applyCommandRule(allow bool, name string) error {
+	r := aclCmdRule{allow: allow}
+
+	if strings.HasPrefix(name, "@") {
+		if !aclCategoryExists(name) {
+			return fmt.Errorf("unknown command category '%s'", name)
+		}
+		r.category = name
+	} else {
+		if i := strings.IndexByte(name, '|'); i >= 0 {
+			r.command, r.sub = name[:i], name[i+1:]
+		} else {
+			r.command = name
+		}
+
+		if _, ok := regCmds[r.command]; !ok {
+			return fmt.Errorf("unknown command '%s'", r.command)
+		}
+	}
+
+	if r.category == "@all" {
+		// everything before is overridden
+		u.cmdRules = u.cmdRules[:0]
+		if !allow {
+			return nil
+		}
+	}
+
+	u.cmdRules = append(u.cmdRules, r)
+	return nil
+}
+
+func aclCategoryExists(name string) bool {
+	if name == "@all" {
+		return true
+	}
+
+	for _, cmd := range regCmds {
+		for _, c := range cmd.categories {
+			if c == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (u *aclUser) canRun(cmd *command, args [][]byte) bool {
+	allow := false
+	for _, r := range u.cmdRules {
+		if r.match(cmd, args) {
+			allow = r.allow
+		}
+	}
+	return allow
+}
+
+func (u *aclUser) canAccessKey(key []byte) bool {
+	if u.allKeys {
+		return true
+	}
+
+	for _, g := range u.keys {
+		if g.Match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) canAccessDB(index int) bool {
+	if u.allDBs {
+		return true
+	}
+
+	for _, i := range u.dbs {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	if u.allKeys {
+		flags = append(flags, "allkeys")
+	}
+	if u.allDBs {
+		flags = append(flags, "alldbs")
+	}
+	return flags
+}
+
+func (u *aclUser) commandRules() string {
+	rules := []string{"-@all"}
+	if len(u.cmdRules) > 0 && u.cmdRules[0].category == "@all" {
+		rules = rules[:0]
+	}
+
+	for _, r := range u.cmdRules {
+		rules = append(rules, r.String())
+	}
+	return strings.Join(rules, " ")
+}
+
+func (u *aclUser) keyRules() string {
+	if u.allKeys {
+		return "~*"
+	}
+
+	rules := make([]string, len(u.keys))
+	for i, g := range u.keys {
+		rules[i] = "~" + g.String()
+	}
+	return strings.Join(rules, " ")
+}
+
+func (u *aclUser) dbRules() string {
+	if u.allDBs {
+		return "alldbs"
+	}
+
+	rules := make([]string, len(u.dbs))
+	for i, index := range u.dbs {
+		rules[i] = "db:" + strconv.Itoa(index)
+	}
+	return strings.Join(rules, " ")
+}
+
+// rules returns the rules creating the same user, as ACL LIST.
+func (u *aclUser) rules() string {
+	rules := []string{"off"}
+	if u.enabled {
+		rules[0] = "on"
+	}
+
+	if u.nopass {
+		rules = append(rules, "nopass")
+	}
+	for _, p := range u.passwords {
+		rules = append(rules, "#"+p)
+	}
+
+	for _, s := range []string{u.keyRules(), u.dbRules(), u.commandRules()} {
+		if len(s) > 0 {
+			rules = append(rules, s)
+		}
+	}
+
+	return strings.Join(rules, " ")
+}
+
+type aclLogEntry struct {
+	count    int64
+	reason   string
+	context  string
+	object   string
+	username string
+	client   string
+	created  time.Time
+	updated  time.Time
+}
+
+type aclStore struct {
+	sync.RWMutex
+
+	users map[string]*aclUser
+
+	logMaxLen int
+	// newest first
+	log []*aclLogEntry
+}
+
+// newACLStore creates the default user from auth_password and the users of the
+// acl config section, each one is "name rule ...".
+func newACLStore(cfg *config.Config) (*aclStore, error) {
+	a := new(aclStore)
+	a.logMaxLen = cfg.ACL.LogMaxLen
+
+	if err := a.load(cfg); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *aclStore) load(cfg *config.Config) error {
+	users := make(map[string]*aclUser)
+
+	u := newACLUser(aclDefaultUser)
+	u.enabled = true
+	u.allKeys = true
+	u.allDBs = true
+	u.cmdRules = []aclCmdRule{{allow: true, category: "@all"}}
+	if len(cfg.AuthPassword) > 0 {
+		u.passwords = []string{aclHashPassword(cfg.AuthPassword)}
+	} else if cfg.AuthMethod == nil {
+		u.nopass = true
+	}
+	users[u.name] = u
+
+	for _, line := range cfg.ACL.Users {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		name := fields[0]
+		u, ok := users[name]
+		if !ok {
+			u = newACLUser(name)
+			users[name] = u
+		}
+
+		for _, rule := range fields[1:] {
+			if err := u.applyRule(rule); err != nil {
+				return fmt.Errorf("acl user %s: %v", name, err)
+			}
+		}
+	}
+
+	a.Lock()
+	for name, old := range a.users {
+		if u, ok := users[name]; ok {
+			// clients authenticated as the user hold the pointer
+			*old = *u
+			users[name] = old
+		} else {
+			old.deleted = true
+		}
+	}
+	a.users = users
+	a.Unlock()
+
+	return nil
+}
+
+// lines returns the users as the acl config section.
+func (a *aclStore) lines() []string {
+	a.RLock()
+	defer a.RUnlock()
+
+	lines := make([]string, 0, len(a.users))
+	for _, name := range a.userNames() {
+		lines = append(lines, name+" "+a.users[name].rules())
+	}
+	return lines
+}
+
+func (a *aclStore) userNames() []string {
+	names := make([]string, 0, len(a.users))
+	for name := range a.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultUser returns the default user if it needs no password.
+func (a *aclStore) defaultUser() *aclUser {
+	a.RLock()
+	defer a.RUnlock()
+
+	if u := a.users[aclDefaultUser]; u.enabled && u.nopass {
+		return u
+	}
+	return nil
+}
+
+func (a *aclStore) authenticate(name string, pass string) *aclUser {
+	a.RLock()
+	defer a.RUnlock()
+
+	if u, ok := a.users[name]; ok && u.checkPassword(pass) {
+		return u
+	}
+	return nil
+}
+
+// authenticate returns the user of the password, by the custom method of
+// the config for the default user, nil if the password is wrong.
+func (app *App) authenticate(name string, pass string) *aclUser {
+	a := app.acl
+	if name != aclDefaultUser || app.cfg.AuthMethod == nil {
+		return a.authenticate(name, pass)
+	}
+
+	// the custom method replaces the default user password
+	if !app.cfg.AuthMethod(app.cfg, pass) {
+		return nil
+	}
+
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.users[aclDefaultUser]
+}
+
+// user returns the enabled user, nil if it doesn't exist.
+func (a *aclStore) user(name string) *aclUser {
+	a.RLock()
+	defer a.RUnlock()
+
+	if u, ok := a.users[name]; ok && u.enabled {
+		return u
+	}
+	return nil
+}
+
+// active reports whether the authenticated user still exists and is enabled.
+func (a *aclStore) active(u *aclUser) bool {
+	a.RLock()
+	defer a.RUnlock()
+
+	return u != nil && u.enabled && !u.deleted
+}
+
+// permit checks whether the user can run the command with args in the db,
+// and logs the denial to ACL LOG.
+func (a *aclStore) permit(u *aclUser, cmd *command, args [][]byte, db int, context string, client string) error {
+	a.RLock()
+	err := a.check(u, cmd, args, db)
+	a.RUnlock()
+
+	if err != nil {
+		a.addLog(err.reason, context, err.object, u.name, client)
+		return err
+	}
+	return nil
+}
+
+func (a *aclStore) check(u *aclUser, cmd *command, args [][]byte, db int) *aclDenyError {
+	if cmd.name == "acl" && len(args) > 0 && strings.EqualFold(hack.String(args[0]), "whoami") {
+		return nil
+	}
+
+	if !u.canRun(cmd, args) {
+		return &aclDenyError{aclDenyCommand, cmd.name}
+	}
+
+	if cmd.flags&(cmdWrite|cmdReadOnly) != 0 || cmd.firstKey > 0 {
+		if !u.canAccessDB(db) {
+			return &aclDenyError{aclDenyDB, strconv.Itoa(db)}
+		}
+	}
+
+	if i, ok := crossDBCommands[cmd.name]; ok {
+		if i < 0 {
+			if !u.allDBs {
+				return &aclDenyError{aclDenyDB, "*"}
+			}
+		} else if i < len(args) {
+			// an invalid index fails the command itself
+			if index, err := strconv.Atoi(string(args[i])); err == nil && !u.canAccessDB(index) {
+				return &aclDenyError{aclDenyDB, strconv.Itoa(index)}
+			}
+		}
+	}
+
+	for _, key := range cmd.keys(args) {
+		if !u.canAccessKey(key) {
+			return &aclDenyError{aclDenyKey, string(key)}
+		}
+	}
+
+	return nil
+}
+
+// permitDB checks whether the user can select the db.
+func (a *aclStore) permitDB(u *aclUser, db int, context string, client string) error {
+	a.RLock()
+	ok := u.canAccessDB(db)
+	a.RUnlock()
+
+	if !ok {
+		err := &aclDenyError{aclDenyDB, strconv.Itoa(db)}
+		a.addLog(err.reason, context, err.object, u.name, client)
+		return err
+	}
+	return nil
+}
+
+func (a *aclStore) addLog(reason string, context string, object string, username string, client string) {
+	if a.logMaxLen <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	a.Lock()
+	defer a.Unlock()
+
+	for i, e := range a.log {
+		if e.reason == reason && e.context == context && e.object == object &&
+			e.username == username && e.client == client {
+			e.count++
+			e.updated = now
+			copy(a.log[1:i+1], a.log[:i])
+			a.log[0] = e
+			return
+		}
+	}
+
+	e := &aclLogEntry{
+		count:    1,
+		reason:   reason,
+		context:  context,
+		object:   object,
+		username: username,
+		client:   client,
+		created:  now,
+		updated:  now,
+	}
+
+	a.log = append([]*aclLogEntry{e}, a.log...)
+	if len(a.log) > a.logMaxLen {
+		a.log = a.log[:a.logMaxLen]
+	}
+}
+
+// setUser creates or modifies the user, no rule is applied if one is invalid.
+func (a *aclStore) setUser(name string, rules []string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	old, ok := a.users[name]
+
+	var u *aclUser
+	if ok {
+		u = old.clone()
+	} else {
+		u = newACLUser(name)
+	}
+
+	for _, rule := range rules {
+		if err := u.applyRule(rule); err != nil {
+			return err
+		}
+	}
+
+	if ok {
+		// clients authenticated as the user hold the pointer
+		*old = *u
+	} else {
+		a.users[name] = u
+	}
+	return nil
+}
+
+func (a *aclStore) delUser(names [][]byte) (int64, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	for _, name := range names {
+		if string(name) == aclDefaultUser {
+			return 0, errACLDeleteDefault
+		}
+	}
+
+	var n int64
+	for _, name := range names {
+		if u, ok := a.users[string(name)]; ok {
+			u.deleted = true
+			delete(a.users, string(name))
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (c *client) aclContext() string {
+	switch c.resp.(type) {
+	case *luaWriter:
+		return "lua"
+	case *httpWriter:
+		return "http"
+	default:
+		return "toplevel"
+	}
+}
+
+func (c *client) userName() string {
+	if c.user == nil {
+		return ""
+	}
+	return c.user.name
+}
+
+// ACL SETUSER|GETUSER|DELUSER|USERS|LIST|WHOAMI|CAT|LOG|DRYRUN|SAVE|LOAD
+func aclCommand(c *client) error {
+	a := c.app.acl
+	args := c.args[1:]
+
+	switch strings.ToLower(hack.String(c.args[0])) {
+	case "whoami":
+		c.resp.writeBulk([]byte(c.userName()))
+	case "users":
+		a.RLock()
+		names := a.userNames()
+		a.RUnlock()
+
+		ay := make([][]byte, len(names))
+		for i, name := range names {
+			ay[i] = []byte(name)
+		}
+		c.resp.writeSliceArray(ay)
+	case "list":
+		lines := a.lines()
+		ay := make([][]byte, len(lines))
+		for i, line := range lines {
+			ay[i] = []byte("user " + line)
+		}
+		c.resp.writeSliceArray(ay)
+	case "setuser":
+		if len(args) == 0 {
+			return ErrCmdParams
+		}
+
+		rules := make([]string, len(args)-1)
+		for i, r := range args[1:] {
+			rules[i] = string(r)
+		}
+
+		if err := a.setUser(string(args[0]), rules); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier: %v", err)
+		}
+		c.resp.writeStatus(OK)
+	case "getuser":
+		if len(args) != 1 {
+			return ErrCmdParams
+		}
+		return aclGetUser(c, string(args[0]))
+	case "deluser":
+		if len(args) == 0 {
+			return ErrCmdParams
+		}
+
+		n, err := a.delUser(args)
+		if err != nil {
+			return err
+		}
+		c.resp.writeInteger(n)
+	case "cat":
+		return aclCat(c, args)
+	case "log":
+		return aclLog(c, args)
+	case "dryrun":
+		if len(args) < 2 {
+			return ErrCmdParams
+		}
+		return aclDryRun(c, string(args[0]), strings.ToLower(hack.String(args[1])), args[2:])
+	case "save":
+		c.app.cfg.ACL.Users = a.lines()
+		if err := c.app.cfg.Rewrite(); err != nil {
+			return err
+		}
+		c.resp.writeStatus(OK)
+	case "load":
+		if len(c.app.cfg.FileName) == 0 {
+			return errors.New("no config file to load the ACL users from")
+		}
+
+		cfg, err := config.NewConfigWithFile(c.app.cfg.FileName)
+		if err != nil {
+			return err
+		}
+
+		// not in the file, the default user keeps its password check
+		cfg.AuthMethod = c.app.cfg.AuthMethod
+
+		if err = a.load(cfg); err != nil {
+			return err
+		}
+		c.app.cfg.ACL.Users = cfg.ACL.Users
+		c.resp.writeStatus(OK)
+	case "help":
+		c.resp.writeSliceArray([][]byte{
+			[]byte("ACL SETUSER <username> [<rule> ...]"),
+			[]byte("ACL GETUSER <username>"),
+			[]byte("ACL DELUSER <username> [<username> ...]"),
+			[]byte("ACL USERS"),
+			[]byte("ACL LIST"),
+			[]byte("ACL WHOAMI"),
+			[]byte("ACL CAT [<category>]"),
+			[]byte("ACL LOG [<count> | RESET]"),
+			[]byte("ACL DRYRUN <username> <command> [<arg> ...]"),
+			[]byte("ACL SAVE"),
+			[]byte("ACL LOAD"),
+		})
+	default:
+		return ErrSyntax
+	}
+
+	return nil
+}
+
+func aclGetUser(c *client, name string) error {
+	a := c.app.acl
+	a.RLock()
+	defer a.RUnlock()
+
+	u, ok := a.users[name]
+	if !ok {
+		c.resp.writeArray(nil)
+		return nil
+	}
+
+	flags := make([][]byte, 0, 4)
+	for _, f := range u.flags() {
+		flags = append(flags, []byte(f))
+	}
+
+	passwords := make([][]byte, len(u.passwords))
+	for i, p := range u.passwords {
+		passwords[i] = []byte(p)
+	}
+
+	c.resp.writeArray([]interface{}{
+		[]byte("flags"), flags,
+		[]byte("passwords"), passwords,
+		[]byte("commands"), []byte(u.commandRules()),
+		[]byte("keys"), []byte(u.keyRules()),
+		[]byte("dbs"), []byte(u.dbRules()),
+	})
+	return nil
+}
+
+func aclCat(c *client, args [][]byte) error {
+	if len(args) > 1 {
+		return ErrCmdParams
+	}
+
+	if len(args) == 0 {
+		set := make(map[string]struct{})
+		for _, cmd := range regCmds {
+			for _, cat := range cmd.categories {
+				set[cat[1:]] = struct{}{}
+			}
+		}
+
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		ay := make([][]byte, len(names))
+		for i, name := range names {
+			ay[i] = []byte(name)
+		}
+		c.resp.writeSliceArray(ay)
+		return nil
+	}
+
+	cat := "@" + strings.TrimPrefix(strings.ToLower(hack.String(args[0])), "@")
+	if !aclCategoryExists(cat) {
+		return fmt.Errorf("Unknown category '%s'", args[0])
+	}
+
+	ay := [][]byte{}
+	for _, cmd := range sortedCommands() {
+		if (aclCmdRule{category: cat}).match(cmd, nil) {
+			ay = append(ay, []byte(cmd.name))
+			continue
+		}
+
+		for _, sub := range adminSubcommands[cmd.name] {
+			if (aclCmdRule{category: cat}).match(cmd, [][]byte{[]byte(sub)}) {
+				ay = append(ay, []byte(cmd.name+"|"+sub))
+			}
+		}
+	}
+	c.resp.writeSliceArray(ay)
+	return nil
+}
+
+func aclLog(c *client, args [][]byte) error {
+	a := c.app.acl
+
+	count := 10
+	if len(args) == 1 {
+		if strings.EqualFold(hack.String(args[0]), "reset") {
+			a.Lock()
+			a.log = nil
+			a.Unlock()
+			c.resp.writeStatus(OK)
+			return nil
+		}
+
+		n, err := strconv.Atoi(hack.String(args[0]))
+		if err != nil || n < 0 {
+			return ErrValue
+		}
+		count = n
+	} else if len(args) > 1 {
+		return ErrCmdParams
+	}
+
+	now := time.Now()
+
+	a.RLock()
+	defer a.RUnlock()
+
+	if count > len(a.log) {
+		count = len(a.log)
+	}
+
+	ay := make([]interface{}, count)
+	for i, e := range a.log[:count] {
+		ay[i] = []interface{}{
+			[]byte("count"), e.count,
+			[]byte("reason"), []byte(e.reason),
+			[]byte("context"), []byte(e.context),
+			[]byte("object"), []byte(e.object),
+			[]byte("username"), []byte(e.username),
+			[]byte("age-seconds"), []byte(strconv.FormatFloat(now.Sub(e.created).Seconds(), 'f', 3, 64)),
+			[]byte("client-info"), []byte("addr=" + e.client),
+			[]byte("timestamp-created"), e.created.UnixNano() / int64(time.Millisecond),
+			[]byte("timestamp-last-updated"), e.updated.UnixNano() / int64(time.Millisecond),
+		}
+	}
+	c.resp.writeArray(ay)
+	return nil
+}
+
+func aclDryRun(c *client, name string, cmdName string, args [][]byte) error {
+	cmd, ok := regCmds[cmdName]
+	if !ok {
+		return ErrNotFound
+	} else if !cmd.checkArity(args) {
+		return fmt.Errorf("wrong number of arguments for '%s' command", cmdName)
+	}
+
+	a := c.app.acl
+	a.RLock()
+	defer a.RUnlock()
+
+	u, ok := a.users[name]
+	if !ok {
+		return errACLNoSuchUser
+	}
+
+	if err := a.check(u, cmd, args, c.db.Index()); err != nil {
+		c.resp.writeBulk([]byte(strings.TrimPrefix(err.Error(), "NOPERM ")))
+		return nil
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+func init() {
+	register("acl", aclCommand)
+}
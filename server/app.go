@@ -1,7 +1,9 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
@@ -11,9 +13,12 @@ import (
 	"sync"
 
 	"crypto/tls"
+	"crypto/x509"
 
+	"github.com/r0123r/ftpserver/server"
 	"github.com/r0123r/vredis/config"
 	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/sync2"
 	"github.com/siddontang/goredis"
 )
 
@@ -23,6 +28,12 @@ type App struct {
 	listener     net.Listener
 	httpListener net.Listener
 
+	// serves /metrics when metrics_addr is set
+	metricsListener net.Listener
+
+	// the listeners which stopped accepting, with their error
+	listenerErrs sync.Map
+
 	ldb *ledis.Ledis
 
 	closed bool
@@ -38,6 +49,23 @@ type App struct {
 
 	script *script
 
+	triggers *triggerSet
+
+	sched *scheduler
+
+	keyAccess *keyAccessTracker
+
+	acl *aclStore
+
+	httpAuth *httpAuth
+
+	ftp *server.FtpServer
+
+	slowlog *slowlog
+	latency *latencyMonitor
+
+	monitors *monitorSet
+
 	// handle slaves
 	slock        sync.Mutex
 	slaves       map[string]*client
@@ -49,6 +77,12 @@ type App struct {
 
 	rcm sync.Mutex
 	rcs map[*respClient]struct{}
+	// the /subscribe connections, with the rcm lock
+	hss map[*httpSubscriber]struct{}
+
+	lastClientID sync2.AtomicUint64
+
+	pause clientPause
 
 	migrateM          sync.Mutex
 	migrateClients    map[string]*goredis.Client
@@ -69,11 +103,39 @@ func tlsConfig(c *config.TLS) (*tls.Config, error) {
 		return nil, err
 	}
 
-	return &tls.Config{
+	cfg := &tls.Config{
 		Certificates: []tls.Certificate{
 			crt,
 		},
-	}, nil
+	}
+
+	return cfg, nil
+}
+
+// httpTLSConfig adds the verification of the client certificates to the TLS
+// config of the HTTP listener, they authenticate the HTTP users only.
+func httpTLSConfig(base *tls.Config, c *config.TLS) (*tls.Config, error) {
+	if len(c.ClientCA) == 0 {
+		return base, nil
+	}
+
+	pem, err := ioutil.ReadFile(c.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := base.Clone()
+	cfg.ClientCAs = x509.NewCertPool()
+	if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("app: no certificate in client_ca %s", c.ClientCA)
+	}
+
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if c.ClientCertRequired {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
 }
 
 func listen(netType, laddr string, tlsCfg *tls.Config) (net.Listener, error) {
@@ -102,6 +164,8 @@ func NewApp(cfg *config.Config, build string) (*App, error) {
 	app.slaveSyncAck = make(chan uint64)
 
 	app.rcs = make(map[*respClient]struct{})
+	app.hss = make(map[*httpSubscriber]struct{})
+	app.monitors = newMonitorSet()
 
 	app.migrateClients = make(map[string]*goredis.Client)
 	app.newMigrateKeyLockers()
@@ -112,6 +176,14 @@ func NewApp(cfg *config.Config, build string) (*App, error) {
 		return nil, err
 	}
 
+	if app.acl, err = newACLStore(cfg); err != nil {
+		return nil, err
+	}
+
+	if app.httpAuth, err = newHTTPAuth(&cfg.HTTP); err != nil {
+		return nil, err
+	}
+
 	var tlsCfg *tls.Config
 	if cfg.TLS.Enabled {
 		tlsCfg, err = tlsConfig(&cfg.TLS)
@@ -146,7 +218,20 @@ func NewApp(cfg *config.Config, build string) (*App, error) {
 	}
 
 	if len(cfg.HttpAddr) > 0 {
-		if app.httpListener, err = listen(netType(cfg.HttpAddr), cfg.HttpAddr, tlsCfg); err != nil {
+		httpTLS := tlsCfg
+		if tlsCfg != nil {
+			if httpTLS, err = httpTLSConfig(tlsCfg, &cfg.TLS); err != nil {
+				return nil, err
+			}
+		}
+
+		if app.httpListener, err = listen(netType(cfg.HttpAddr), cfg.HttpAddr, httpTLS); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.MetricsAddr) > 0 {
+		if app.metricsListener, err = listen(netType(cfg.MetricsAddr), cfg.MetricsAddr, tlsCfg); err != nil {
 			return nil, err
 		}
 	}
@@ -178,10 +263,33 @@ func NewApp(cfg *config.Config, build string) (*App, error) {
 
 	app.m = newMaster(app)
 
+	app.slowlog = newSlowlog(cfg.SlowlogLogSlowerThan, cfg.SlowlogMaxLen)
+	app.latency = newLatencyMonitor(cfg.LatencyMonitorThreshold)
+	app.ldb.SetLatencyObserver(app.latency.observe)
+
+	if cfg.KeyAccessTracking {
+		app.keyAccess = newKeyAccessTracker(cfg.KeyAccessMaxKeys)
+	}
+
 	app.openScript()
 
+	if err = app.openTriggers(); err != nil {
+		return nil, err
+	}
+	app.ldb.SetExpireHandler(app.expired)
+
+	if err = app.openScheduler(); err != nil {
+		return nil, err
+	}
+
 	app.ldb.AddNewLogEventHandler(app.publishNewLog)
 
+	if cfg.FTP.Enabled {
+		if err = app.openFTP(); err != nil {
+			return nil, err
+		}
+	}
+
 	return app, nil
 }
 
@@ -208,11 +316,22 @@ func (app *App) Close() {
 		app.httpListener.Close()
 	}
 
+	if app.metricsListener != nil {
+		app.metricsListener.Close()
+	}
+
+	if app.ftp != nil {
+		app.ftp.Stop()
+	}
+
 	app.closeAllRespClients()
+	app.closeAllHTTPSubscribers()
 
 	//wait all connection closed
 	app.connWait.Wait()
 
+	app.sched.close()
+
 	app.closeScript()
 
 	app.m.Lock()
@@ -221,6 +340,8 @@ func (app *App) Close() {
 
 	app.snap.Close()
 
+	app.info.Close()
+
 	if app.access != nil {
 		app.access.Close()
 	}
@@ -229,12 +350,17 @@ func (app *App) Close() {
 }
 
 func (app *App) Run() {
+	freezeCommands()
+
 	if len(app.cfg.SlaveOf) > 0 {
 		app.slaveof(app.cfg.SlaveOf, false, app.cfg.Readonly)
 	}
 
+	app.sched.start()
+
 	go app.httpServe()
-	go app.serv_ftp("/", "admin", "admin", 3001)
+	go app.metricsServe()
+	go app.ftpServe()
 	for {
 		select {
 		case <-app.quit:
@@ -242,9 +368,22 @@ func (app *App) Run() {
 		default:
 			conn, err := app.listener.Accept()
 			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					app.listenerFailed(app.listener, err)
+				}
+				continue
+			}
+
+			select {
+			case <-app.quit:
+				// accepted while closing
+				app.info.Stats.RejectedConnections.Add(1)
+				conn.Close()
 				continue
+			default:
 			}
 
+			app.info.Stats.TotalConnections.Add(1)
 			newClientRESP(conn, app)
 		}
 	}
@@ -257,18 +396,51 @@ func (app *App) httpServe() {
 
 	mux := http.NewServeMux()
 
+	if len(app.cfg.MetricsAddr) == 0 {
+		// a command named metrics is still served as /0/metrics
+		mux.HandleFunc("/metrics", app.httpMetricsHandler)
+	}
+	mux.HandleFunc("/healthz", app.healthzHandler)
+	mux.HandleFunc("/readyz", app.readyzHandler)
+	mux.HandleFunc(restPrefix, app.restHandler)
+	mux.HandleFunc(subscribePath, app.subscribeHandler)
+	if app.cfg.HTTP.UI {
+		mux.HandleFunc(strings.TrimSuffix(uiPath, "/"), app.uiHandler)
+		mux.HandleFunc(uiPath, app.uiHandler)
+	}
+
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		newClientHTTP(app, w, r)
 	})
 
 	svr := http.Server{Handler: mux}
-	svr.Serve(app.httpListener)
+	app.listenerFailed(app.httpListener, svr.Serve(app.httpListener))
 }
 
+// Ledis returns the ledis instance of the app, its writes don't fire the
+// triggers, use Update for them.
 func (app *App) Ledis() *ledis.Ledis {
 	return app.ldb
 }
 
+// Update calls f in a Tx on the database of the index, and fires the
+// triggers of its writes before the commit, like the write commands. The
+// other writers wait for it, and nothing is written if f or a trigger fails.
+func (app *App) Update(index int, f func(db *ledis.DB) error) error {
+	tx := app.ldb.Begin()
+	defer tx.Rollback()
+
+	db, err := tx.Select(index)
+	if err != nil {
+		return err
+	} else if err := f(db); err != nil {
+		return err
+	} else if err := app.triggers.fire(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (app *App) Address() string {
 	return app.listener.Addr().String()
 }
@@ -1,33 +1,135 @@
 package server
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
 
 	"github.com/r0123r/ftpserver/server"
+	"github.com/r0123r/vredis/config"
 	"github.com/r0123r/vredis/ledis"
 )
 
+var errFTPNoTLS = errors.New("TLS is not enabled for FTP")
+
+// ftpUser is a user of the [ftp] config, its ACL user has all the
+// permissions in its DB, and no write commands if it is read only.
+type ftpUser struct {
+	user *aclUser
+	db   int
+}
+
 type LedisDriver struct {
 	server.MainDriver
 	Ldb       *ledis.Ledis
+	app       *App
 	BaseDir   string // Base directory from which to serve file
 	nbClients int32  // Number of clients
+
+	cfg   *config.FTPConfig
+	ports *server.PortRange
+	tls   *tls.Config
+	users map[string]*ftpUser
+}
+
+func newLedisDriver(app *App) (*LedisDriver, error) {
+	cfg := &app.cfg.FTP
+	driver := &LedisDriver{BaseDir: "/", Ldb: app.ldb, app: app, cfg: cfg}
+
+	var err error
+	if driver.ports, err = parseFTPPortRange(cfg.PassivePorts); err != nil {
+		return nil, err
+	}
+
+	if driver.users, err = newFTPUsers(cfg.Users, app.cfg.Databases); err != nil {
+		return nil, err
+	}
+
+	if cfg.TLS {
+		if driver.tls, err = tlsConfig(&app.cfg.TLS); err != nil {
+			return nil, fmt.Errorf("ftp tls: %v", err)
+		}
+	}
+	return driver, nil
+}
+
+// parseFTPPortRange parses "start-end", nil for any port if s is empty.
+func parseFTPPortRange(s string) (*server.PortRange, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var r server.PortRange
+	var err1, err2 error
+	if i := strings.IndexByte(s, '-'); i > 0 {
+		r.Start, err1 = strconv.Atoi(strings.TrimSpace(s[:i]))
+		r.End, err2 = strconv.Atoi(strings.TrimSpace(s[i+1:]))
+	} else {
+		err1 = errors.New("no range")
+	}
+
+	if err1 != nil || err2 != nil || r.Start <= 0 || r.Start > r.End || r.End > 65535 {
+		return nil, fmt.Errorf("ftp passive ports must be \"start-end\": %q", s)
+	}
+	return &r, nil
+}
+
+func newFTPUsers(lines []string, databases int) (map[string]*ftpUser, error) {
+	users := make(map[string]*ftpUser, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		} else if len(fields) < 3 || len(fields) > 4 || (len(fields) == 4 && fields[3] != "readonly") {
+			return nil, fmt.Errorf("ftp user must be \"name password_hash db [readonly]\": %q", line)
+		}
+
+		db, err := strconv.Atoi(fields[2])
+		if err != nil || db < 0 || db >= databases {
+			return nil, fmt.Errorf("ftp user %s: invalid DB index '%s'", fields[0], fields[2])
+		}
+
+		rules := []string{"on", "#" + fields[1], "allkeys", "allcommands", "db:" + fields[2]}
+		if len(fields) == 4 {
+			rules = append(rules, "-@write")
+		}
+
+		u := newACLUser(fields[0])
+		for _, rule := range rules {
+			if err := u.applyRule(rule); err != nil {
+				return nil, fmt.Errorf("ftp user %s: %v", fields[0], err)
+			}
+		}
+		users[fields[0]] = &ftpUser{user: u, db: db}
+	}
+	return users, nil
 }
 
 func (driver *LedisDriver) GetSettings() (*server.Settings, error) {
 	return &server.Settings{
-		ListenAddr:  "0.0.0.0:3001",
-		IdleTimeout: 900,
-		Async:       true,
+		ListenAddr:    driver.cfg.Addr,
+		DataPortRange: driver.ports,
+		IdleTimeout:   driver.cfg.IdleTimeout,
+		Async:         true,
 	}, nil
 }
 
+// GetTLSConfig returns the TLS config of AUTH TLS.
+func (driver *LedisDriver) GetTLSConfig() (*tls.Config, error) {
+	if driver.tls == nil {
+		return nil, errFTPNoTLS
+	}
+	return driver.tls, nil
+}
+
 func (driver *LedisDriver) WelcomeUser(cc server.ClientContext) (string, error) {
 	nbClients := atomic.AddInt32(&driver.nbClients, 1)
-	if nbClients > 10 {
-		return "Cannot accept any additional client", fmt.Errorf("too many clients: %d > % d", driver.nbClients, 10)
+	if max := int32(driver.cfg.MaxClients); nbClients > max {
+		driver.app.info.Stats.RejectedConnections.Add(1)
+		return "Cannot accept any additional client", fmt.Errorf("too many clients: %d > %d", nbClients, max)
 	}
 
 	// This will remain the official name for now
@@ -40,18 +142,32 @@ func (driver *LedisDriver) WelcomeUser(cc server.ClientContext) (string, error)
 		nil
 }
 
+// authenticate returns the user of the password and its DB, the users of the
+// config if there are any, or the ACL users in DB 0.
+func (driver *LedisDriver) authenticate(name string, pass string) (*aclUser, int) {
+	if len(driver.users) == 0 {
+		return driver.app.authenticate(name, pass), 0
+	}
+
+	if u, ok := driver.users[name]; ok && u.user.checkPassword(pass) {
+		return u.user, u.db
+	}
+	return nil, 0
+}
+
 // AuthUser authenticates the user and selects an handling driver
 func (driver *LedisDriver) AuthUser(cc server.ClientContext, user, pass string) (server.ClientHandlingDriver, error) {
-
-	if user == "admin" && pass == "admin" {
-		db, err := driver.Ldb.Select(0)
+	u, index := driver.authenticate(user, pass)
+	if u != nil {
+		db, err := driver.Ldb.Select(index)
 		if err != nil {
 			return nil, err
 		}
 
-		return &LedisClientDriver{RootPath: driver.BaseDir, db: db}, nil
+		return &LedisClientDriver{RootPath: driver.BaseDir, db: db, user: u, app: driver.app, remoteAddr: cc.RemoteAddr().String()}, nil
 	}
 
+	driver.app.acl.addLog(aclDenyAuth, "ftp", "USER", user, cc.RemoteAddr().String())
 	return nil, fmt.Errorf("could not authenticate you")
 }
 
@@ -60,38 +176,28 @@ func (driver *LedisDriver) UserLeft(cc server.ClientContext) {
 	atomic.AddInt32(&driver.nbClients, -1)
 }
 
-func (app *App) serv_ftp(rootPath, User, Pass string, Port int) {
-	if _, err := os.Lstat(rootPath); err != nil {
-		if app.access != nil {
-			app.access.l.Error("Start ftp:", err)
-		}
-		return
+// openFTP listens on the address of the [ftp] config.
+func (app *App) openFTP() error {
+	drv, err := newLedisDriver(app)
+	if err != nil {
+		return err
 	}
-	//	perm := server.NewSimplePerm("root", "root")
-	//	opt := &server.ServerOpts{
-	//		Port: Port,
-	//		Factory: &ledisdriver.LedisDriverFactory{
-	//			Ldb:      app.Ledis(),
-	//			RootPath: rootPath,
-	//			Perm:     perm,
-	//		},
-	//		Auth: &server.SimpleAuth{
-	//			Name:     User,
-	//			Password: Pass,
-	//		},
-	//		Logger: new(server.StdLogger),
-	//	}
-	drv := &LedisDriver{BaseDir: rootPath, Ldb: app.Ledis()}
-	// start ftp server
-	ftpServer := server.NewFtpServer(drv)
-	ftpServer.Logger.SetLevelByName("trace")
-	if app.access != nil {
-		app.access.l.Info("Start ftp:", ftpServer.Addr(), " Root:", rootPath)
+
+	app.ftp = server.NewFtpServer(drv)
+	app.ftp.Logger.SetLevelByName(app.cfg.FTP.LogLevel)
+	if err = app.ftp.Listen(); err != nil {
+		return fmt.Errorf("ftp: %v", err)
 	}
-	if err := ftpServer.ListenAndServe(); err != nil {
-		if app.access != nil {
-			app.access.l.Error("Start ftp:", err)
-		}
+	return nil
+}
+
+func (app *App) ftpServe() {
+	if app.ftp == nil {
 		return
 	}
+
+	if app.access != nil {
+		app.access.l.Info("Start ftp:", app.ftp.Addr(), " Root:", "/")
+	}
+	app.ftp.Serve()
 }
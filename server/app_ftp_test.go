@@ -0,0 +1,92 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/r0123r/vredis/config"
+)
+
+func TestFTPConfig(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_ftp"
+	cfg.Addr = "127.0.0.1:11222"
+	// sha256 of "secret"
+	cfg.FTP.Users = []string{
+		"backup 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b 1 readonly",
+		"writer 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b 2",
+	}
+	cfg.FTP.PassivePorts = "50000-50100"
+
+	os.RemoveAll(cfg.DataDir)
+
+	app, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	drv, err := newLedisDriver(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, _ := drv.GetSettings(); s.ListenAddr != config.DefaultFTPAddr || s.IdleTimeout != 900 || s.DataPortRange.Start != 50000 || s.DataPortRange.End != 50100 {
+		t.Fatal(s)
+	} else if _, err := drv.GetTLSConfig(); err != errFTPNoTLS {
+		t.Fatal(err)
+	}
+
+	// the ACL users can't log in when the config has users
+	if u, _ := drv.authenticate("backup", "wrong"); u != nil {
+		t.Fatal("must fail")
+	} else if u, _ := drv.authenticate("default", ""); u != nil {
+		t.Fatal("must fail")
+	}
+
+	u, db := drv.authenticate("backup", "secret")
+	if u == nil || db != 1 {
+		t.Fatal(u, db)
+	}
+	ldb, _ := app.ldb.Select(db)
+	c := &LedisClientDriver{db: ldb, user: u, app: app, remoteAddr: "test"}
+	if err := c.permit("exists", []byte("a")); err != nil {
+		t.Fatal(err)
+	} else if err := c.permit("del", []byte("a")); err == nil {
+		t.Fatal("read only user must not write")
+	}
+
+	u, db = drv.authenticate("writer", "secret")
+	if u == nil || db != 2 {
+		t.Fatal(u, db)
+	}
+	ldb, _ = app.ldb.Select(db)
+	c = &LedisClientDriver{db: ldb, user: u, app: app, remoteAddr: "test"}
+	if err := c.permit("del", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the DB of another user
+	ldb, _ = app.ldb.Select(1)
+	c = &LedisClientDriver{db: ldb, user: u, app: app, remoteAddr: "test"}
+	if err := c.permit("exists", []byte("a")); err == nil {
+		t.Fatal("must fail")
+	}
+
+	for _, users := range [][]string{
+		{"a 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"},
+		{"a 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b 16"},
+		{"a 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b 0 rw"},
+		{"a secret 0"},
+	} {
+		if _, err := newFTPUsers(users, 16); err == nil {
+			t.Fatal(users)
+		}
+	}
+
+	for _, ports := range []string{"50000", "2-1", "a-b", "1-65536"} {
+		if _, err := parseFTPPortRange(ports); err == nil {
+			t.Fatal(ports)
+		}
+	}
+}
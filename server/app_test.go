@@ -42,7 +42,7 @@ func startTestAppAuth(password string) {
 		os.RemoveAll(cfg.DataDir)
 
 		var err error
-		testApp, err = NewApp(cfg)
+		testApp, err = NewApp(cfg, "")
 		if err != nil {
 			println(err.Error())
 			panic(err)
@@ -79,7 +79,7 @@ func startTestApp() {
 		os.RemoveAll(cfg.DataDir)
 
 		var err error
-		testApp, err = NewApp(cfg)
+		testApp, err = NewApp(cfg, "")
 		if err != nil {
 			println(err.Error())
 			panic(err)
@@ -2,7 +2,7 @@ package server
 
 import (
 	"bytes"
-	//	"fmt"
+	"fmt"
 	"io"
 	"strings"
 	"time"
@@ -24,22 +24,59 @@ type responseWriter interface {
 	flush()
 }
 
+// subscriber keeps the subscriptions of a connection.
+type subscriber interface {
+	subscribe(pattern bool, names [][]byte)
+}
+
 type syncAck struct {
 	id uint64
 	ch chan uint64
 }
 
+// clientStat is the connection metadata, updated after each command
+// and read by CLIENT LIST from other connections.
+type clientStat struct {
+	name sync2.AtomicString
+	cmd  sync2.AtomicString
+	user sync2.AtomicString
+	db   sync2.AtomicInt32
+	// unix nano time of the last command
+	active sync2.AtomicInt64
+	// bytes read but not parsed yet
+	qbuf sync2.AtomicInt64
+
+	noEvict sync2.AtomicBool
+}
+
 type client struct {
 	app *App
 	ldb *ledis.Ledis
 
+	id    uint64
+	ctime time.Time
+	stat  clientStat
+
+	// close the connection after the reply, for CLIENT KILL of itself
+	closeAfterReply bool
+
+	// switch to the monitor after the reply
+	monitor bool
+
 	db *ledis.DB
 
+	// the Tx of the running script, only for the lua clients
+	tx *ledis.Tx
+
 	remoteAddr string
 	cmd        string
 	args       [][]byte
 
-	isAuthed bool
+	// the authenticated ACL user, nil if not authenticated
+	user *aclUser
+
+	// SUBSCRIBE and PSUBSCRIBE, nil if the connection can't subscribe
+	subscriber subscriber
 
 	resp responseWriter
 
@@ -59,9 +96,14 @@ func newClient(app *App) *client {
 
 	c.app = app
 	c.ldb = app.ldb
-	c.isAuthed = false
+	c.user = app.acl.defaultUser()
 	c.db, _ = app.ldb.Select(0) //use default db
 
+	c.id = app.nextClientID()
+	c.ctime = time.Now()
+	c.stat.active.Set(c.ctime.UnixNano())
+	c.stat.user.Set(c.userName())
+
 	return c
 }
 
@@ -71,10 +113,6 @@ func (c *client) close() {
 	}
 }
 
-func (c *client) authEnabled() bool {
-	return len(c.app.cfg.AuthPassword) > 0 || c.app.cfg.AuthMethod != nil
-}
-
 func (c *client) perform() {
 	var err error
 
@@ -82,14 +120,71 @@ func (c *client) perform() {
 
 	c.cmd = strings.ToLower(c.cmd)
 
+	var cmd *command
+	var ok bool
+
+	executed := false
+	var d time.Duration
+
 	if len(c.cmd) == 0 {
 		err = ErrEmptyCommand
-	} else if exeCmd, ok := regCmds[c.cmd]; !ok {
+	} else if cmd, ok = regCmds[c.cmd]; !ok {
 		err = ErrNotFound
-	} else if c.authEnabled() && !c.isAuthed && c.cmd != "auth" {
+	} else if c.cmd != "auth" && !c.app.acl.active(c.user) {
+		c.user = nil
 		err = ErrNotAuthenticated
-	} else {
-		err = exeCmd(c)
+	} else if !cmd.checkArity(c.args) {
+		err = fmt.Errorf("wrong number of arguments for '%s' command", c.cmd)
+	} else if berr := c.checkBusy(cmd); berr != nil {
+		err = berr
+	} else if cmd.flags&cmdNoScript != 0 && c.tx != nil {
+		err = errScriptNotAllowed
+	} else if perr := c.checkPermission(cmd); perr != nil {
+		err = perr
+	}
+
+	if err == nil {
+		// CLIENT PAUSE blocks the commands here, the server may be read
+		// only when they resume
+		c.app.pause.wait(c, cmd)
+
+		if cmd.writes(c.args) && c.app.cfg.GetReadonly() {
+			err = ErrReadOnlyReplica
+		}
+	}
+
+	if err == nil {
+		c.feedMonitors(cmd)
+
+		if cmd.flags&cmdBlocking != 0 {
+			c.app.info.Stats.BlockedClients.Add(1)
+		}
+
+		begin := time.Now()
+		if c.withTriggers(cmd) {
+			err = c.callWithTriggers(cmd)
+		} else {
+			err = cmd.fn(c)
+		}
+		d = time.Since(begin)
+		executed = true
+
+		if cmd.flags&cmdBlocking != 0 {
+			c.app.info.Stats.BlockedClients.Add(-1)
+		}
+
+		c.observeCommand(d)
+	}
+
+	c.app.info.recordCommand(cmd, executed, d, err)
+
+	c.stat.cmd.Set(c.cmd)
+	c.stat.db.Set(int32(c.db.Index()))
+	c.stat.user.Set(c.userName())
+	c.stat.active.Set(time.Now().UnixNano())
+
+	if err == nil && c.app.keyAccess != nil {
+		c.app.keyAccess.touchCommand(c.db.Index(), cmd, c.args)
 	}
 
 	if c.app.access != nil {
@@ -113,6 +208,54 @@ func (c *client) perform() {
 	return
 }
 
+// performFunc runs f as the command of the arguments for the protocols
+// which don't run the commands, REST and FTP, after their ACL checks. Like
+// perform, it waits for CLIENT PAUSE, feeds the monitors, and records the
+// command in SLOWLOG, LATENCY, the commandstats and the key access.
+func (c *client) performFunc(cmd *command, f func() error) error {
+	c.app.pause.wait(c, cmd)
+
+	c.feedMonitors(cmd)
+
+	begin := time.Now()
+	err := f()
+	d := time.Since(begin)
+
+	c.observeCommand(d)
+	c.app.info.recordCommand(cmd, true, d, err)
+
+	if err == nil && c.app.keyAccess != nil {
+		c.app.keyAccess.touchCommand(c.db.Index(), cmd, c.args)
+	}
+	return err
+}
+
+// observeCommand adds the command execution to SLOWLOG and LATENCY.
+func (c *client) observeCommand(d time.Duration) {
+	if _, ok := c.resp.(*luaWriter); ok {
+		// the script is observed as a whole
+		return
+	}
+
+	c.app.slowlog.add(c, d)
+	c.app.latency.observe(latencyEventCommand, d)
+}
+
+func (c *client) checkPermission(cmd *command) error {
+	if cmd.name == "auth" {
+		return nil
+	}
+	return c.app.acl.permit(c.user, cmd, c.args, c.db.Index(), c.aclContext(), c.remoteAddr)
+}
+
+// selectDB chooses the database, in the Tx of the script for a lua client.
+func (c *client) selectDB(index int) (*ledis.DB, error) {
+	if c.tx != nil {
+		return c.tx.Select(index)
+	}
+	return c.ldb.Select(index)
+}
+
 func (c *client) catGenericCommand() []byte {
 	buffer := c.buf
 	buffer.Reset()
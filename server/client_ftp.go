@@ -18,6 +18,39 @@ type LedisClientDriver struct {
 	RootPath string // Base directory from which to server file
 	db       *ledis.DB
 	allocate int
+
+	user       *aclUser
+	app        *App
+	remoteAddr string
+}
+
+// permit checks the ACL user as if it runs the command with args.
+func (driver *LedisClientDriver) permit(name string, args ...[]byte) error {
+	app := driver.app
+	if !app.acl.active(driver.user) {
+		return ErrNotAuthenticated
+	}
+
+	return app.acl.permit(driver.user, regCmds[name], args, driver.db.Index(), "ftp", driver.remoteAddr)
+}
+
+// perform runs f as the command with args, after permit: it waits for
+// CLIENT PAUSE, feeds the monitors and records the command like the
+// commands of the RESP clients.
+func (driver *LedisClientDriver) perform(name string, args [][]byte, f func() error) error {
+	c := newClient(driver.app)
+	c.remoteAddr = "ftp:" + driver.remoteAddr
+	c.user = driver.user
+	c.cmd = name
+	c.args = args
+	c.db = driver.db
+
+	return c.performFunc(regCmds[name], f)
+}
+
+// update runs the writes of f in a Tx firing the triggers, like the commands.
+func (driver *LedisClientDriver) update(f func(db *ledis.DB) error) error {
+	return driver.app.Update(driver.db.Index(), f)
 }
 
 func (driver *LedisClientDriver) realPath(path string) []byte {
@@ -26,26 +59,38 @@ func (driver *LedisClientDriver) realPath(path string) []byte {
 
 // ChangeDirectory changes the current working directory
 func (driver *LedisClientDriver) ChangeDirectory(cc server.ClientContext, path string) error {
-	if path == "/" || path == "" {
-		driver.RootPath = path
-	} else {
-		rpath := driver.realPath(path + "/")
-		if ok, _ := driver.db.HKeyExists(rpath); ok != 1 {
+	rpath := driver.realPath(path + "/")
+	if err := driver.permit("hkeyexists", rpath); err != nil {
+		return err
+	}
+
+	return driver.perform("hkeyexists", [][]byte{rpath}, func() error {
+		if path == "/" || path == "" {
+			driver.RootPath = path
+		} else if ok, _ := driver.db.HKeyExists(rpath); ok != 1 {
 			return fmt.Errorf("Not a directory")
 		} else {
 			driver.RootPath = string(rpath)
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 // MakeDirectory creates a directory
 func (driver *LedisClientDriver) MakeDirectory(cc server.ClientContext, path string) error {
 	rpath := driver.realPath(path + "/")
-	if ok, _ := driver.db.HKeyExists(rpath); ok != 1 {
-		driver.db.HSet(rpath, []byte("modTime"), ledis.PutInt64(time.Now().Unix()))
+	if err := driver.permit("hset", rpath); err != nil {
+		return err
 	}
-	return nil
+
+	return driver.perform("hset", [][]byte{rpath}, func() error {
+		return driver.update(func(db *ledis.DB) error {
+			if ok, _ := db.HKeyExists(rpath); ok != 1 {
+				db.HSet(rpath, []byte("modTime"), ledis.PutInt64(time.Now().Unix()))
+			}
+			return nil
+		})
+	})
 }
 func (driver *LedisClientDriver) GetAtr(rpath []byte, isdir bool) (os.FileInfo, error) {
 	buf, _ := driver.db.HGet(rpath, []byte("modTime"))
@@ -66,7 +111,19 @@ func (driver *LedisClientDriver) GetAtr(rpath []byte, isdir bool) (os.FileInfo,
 
 // ListFiles lists the files of a directory
 func (driver *LedisClientDriver) ListFiles(cc server.ClientContext) ([]os.FileInfo, error) {
+	if err := driver.permit("scan"); err != nil {
+		return nil, err
+	}
 
+	var files []os.FileInfo
+	err := driver.perform("scan", nil, func() (err error) {
+		files, err = driver.listFiles(cc)
+		return err
+	})
+	return files, err
+}
+
+func (driver *LedisClientDriver) listFiles(cc server.ClientContext) ([]os.FileInfo, error) {
 	files := make([]os.FileInfo, 0)
 
 	cursor := []byte{}
@@ -113,6 +170,18 @@ func (driver *LedisClientDriver) ListFiles(cc server.ClientContext) ([]os.FileIn
 
 // ListFiles lists the files of a directory
 func (driver *LedisClientDriver) AsyncListFiles(cc server.ClientContext, cfiles chan<- os.FileInfo) {
+	if err := driver.permit("scan"); err != nil {
+		close(cfiles)
+		return
+	}
+
+	driver.perform("scan", nil, func() error {
+		driver.asyncListFiles(cc, cfiles)
+		return nil
+	})
+}
+
+func (driver *LedisClientDriver) asyncListFiles(cc server.ClientContext, cfiles chan<- os.FileInfo) {
 	cursor := []byte{}
 	var f os.FileInfo
 	var err error
@@ -158,6 +227,20 @@ func (driver *LedisClientDriver) AsyncListFiles(cc server.ClientContext, cfiles
 
 // GetFileInfo gets some info around a file or a directory
 func (driver *LedisClientDriver) GetFileInfo(cc server.ClientContext, path string) (os.FileInfo, error) {
+	rpath := driver.realPath(path)
+	if err := driver.permit("exists", rpath); err != nil {
+		return nil, err
+	}
+
+	var info os.FileInfo
+	err := driver.perform("exists", [][]byte{rpath}, func() (err error) {
+		info, err = driver.getFileInfo(path)
+		return err
+	})
+	return info, err
+}
+
+func (driver *LedisClientDriver) getFileInfo(path string) (os.FileInfo, error) {
 	if path == "/" {
 		return &VirtualFileInfo{name: path, isDir: true}, nil
 	}
@@ -194,46 +277,75 @@ func (driver *LedisClientDriver) ChmodFile(cc server.ClientContext, path string,
 // DeleteFile deletes a file or a directory
 func (driver *LedisClientDriver) DeleteFile(cc server.ClientContext, path string) error {
 	rpath := driver.realPath(path)
-	driver.db.Del(rpath)
-	size, err := driver.db.HClear(rpath)
-	if err == nil && size == 0 {
-		rpath = append(rpath, '/')
-		_, err = driver.db.HClear(rpath)
+	if err := driver.permit("del", rpath); err != nil {
+		return err
 	}
-	return err
+
+	return driver.perform("del", [][]byte{rpath}, func() error {
+		return driver.update(func(db *ledis.DB) error {
+			db.Del(rpath)
+			size, err := db.HClear(rpath)
+			if err == nil && size == 0 {
+				_, err = db.HClear(append(rpath, '/'))
+			}
+			return err
+		})
+	})
 }
 
 // RenameFile renames a file or a directory
 func (driver *LedisClientDriver) RenameFile(cc server.ClientContext, from, to string) error {
 	rp1 := driver.realPath(from)
 	rp2 := driver.realPath(to)
-	buf, err := driver.db.Get(rp1)
-	if err != nil {
-		return err
-	}
-	err = driver.db.Set(rp2, buf)
-	if err != nil {
-		return err
-	}
-	val, err := driver.db.HGetAll(rp1)
-	if err != nil {
+	if err := driver.permit("rename", rp1, rp2); err != nil {
 		return err
 	}
-	err = driver.db.HMset(rp2, val...)
-	if err != nil {
+
+	return driver.perform("rename", [][]byte{rp1, rp2}, func() error {
+		return driver.rename(rp1, rp2)
+	})
+}
+
+func (driver *LedisClientDriver) rename(rp1 []byte, rp2 []byte) error {
+	return driver.update(func(db *ledis.DB) error {
+		buf, err := db.Get(rp1)
+		if err != nil {
+			return err
+		}
+		err = db.Set(rp2, buf)
+		if err != nil {
+			return err
+		}
+		val, err := db.HGetAll(rp1)
+		if err != nil {
+			return err
+		}
+		err = db.HMset(rp2, val...)
+		if err != nil {
+			return err
+		}
+		_, err = db.HClear(rp1)
+		_, err = db.Del(rp1)
 		return err
-	}
-	_, err = driver.db.HClear(rp1)
-	_, err = driver.db.Del(rp1)
-	return err
+	})
 }
 
 // OpenFile opens a file in 3 possible modes: read, write, appending write (use appropriate flags)
 func (driver *LedisClientDriver) OpenFile(cc server.ClientContext, path string, flag int) (server.FileStream, error) {
+	name := "get"
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		name = "append"
+	}
+
+	if err := driver.permit(name, driver.realPath(path)); err != nil {
+		return nil, err
+	}
+
 	return &LedisVirtualFile{
 		rpath:    driver.realPath(path),
 		append:   (flag & os.O_APPEND) != 0,
 		db:       driver.db,
+		driver:   driver,
 		allocate: driver.allocate,
 	}, nil
 }
@@ -245,6 +357,7 @@ type LedisVirtualFile struct {
 	content    []byte // Content of the file
 	readOffset int    // Reading offset
 	db         *ledis.DB
+	driver     *LedisClientDriver
 	allocate   int
 }
 
@@ -257,7 +370,15 @@ func (f *LedisVirtualFile) Seek(n int64, w int) (int64, error) {
 
 func (f *LedisVirtualFile) Read(buffer []byte) (int, error) {
 	var err error
-	f.content, err = f.db.Get(f.rpath)
+	if f.readOffset == 0 {
+		// the RETR is performed as a GET on its first read
+		err = f.driver.perform("get", [][]byte{f.rpath}, func() (err error) {
+			f.content, err = f.db.Get(f.rpath)
+			return err
+		})
+	} else {
+		f.content, err = f.db.Get(f.rpath)
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -272,23 +393,34 @@ func (f *LedisVirtualFile) Read(buffer []byte) (int, error) {
 
 func (f *LedisVirtualFile) Write(buffer []byte) (int, error) {
 	if f.readOffset == 0 {
-		if !f.append {
-			if err := f.db.Set(f.rpath, []byte{}); err != nil {
-				f.db.HClear(f.rpath)
-				return 0, err
+		err := f.perform(func(db *ledis.DB) error {
+			if !f.append {
+				if err := db.Set(f.rpath, []byte{}); err != nil {
+					return err
+				}
 			}
+			_, err := db.HSet(f.rpath, []byte("modTime"), ledis.PutInt64(time.Now().Unix()))
+			return err
+		})
+		if err != nil {
+			return 0, err
 		}
-		f.db.HSet(f.rpath, []byte("modTime"), ledis.PutInt64(time.Now().Unix()))
 		f.content = make([]byte, f.allocate)
 	}
 	size := copy(f.content[f.readOffset:], buffer)
 	f.readOffset += size
 	if f.readOffset >= f.allocate {
 		fmt.Printf("write %q %v\n", f.rpath, f.append)
-		_, err := f.db.Append(f.rpath, f.content)
+		err := f.perform(func(db *ledis.DB) error {
+			_, err := db.Append(f.rpath, f.content)
+			return err
+		})
 		if err != nil {
-			f.db.Del(f.rpath)
-			f.db.HClear(f.rpath)
+			f.driver.update(func(db *ledis.DB) error {
+				db.Del(f.rpath)
+				_, err := db.HClear(f.rpath)
+				return err
+			})
 			return 0, err
 		}
 	}
@@ -296,6 +428,13 @@ func (f *LedisVirtualFile) Write(buffer []byte) (int, error) {
 	return size, nil
 }
 
+// perform runs the writes of the STOR as an APPEND, permitted by OpenFile.
+func (f *LedisVirtualFile) perform(update func(db *ledis.DB) error) error {
+	return f.driver.perform("append", [][]byte{f.rpath}, func() error {
+		return f.driver.update(update)
+	})
+}
+
 type VirtualFileInfo struct {
 	name    string
 	isDir   bool
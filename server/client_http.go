@@ -1,15 +1,17 @@
 package server
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/siddontang/go/bson"
-	"github.com/siddontang/go/hack"
 	"github.com/siddontang/go/log"
 	"github.com/r0123r/vredis/ledis"
 	"github.com/ugorji/go/codec"
@@ -20,42 +22,73 @@ var allowedContentTypes = map[string]struct{}{
 	"bson":    {},
 	"msgpack": {},
 }
-var httpUnsupportedCommands = map[string]struct{}{
-	"slaveof":  {},
-	"fullsync": {},
-	"sync":     {},
-	"quit":     {},
-	"begin":    {},
-	"commit":   {},
-	"rollback": {},
-}
+
+// the largest POST body, like the largest value
+const httpMaxBodySize = int64(ledis.MaxValueSize)
+
+var httpMsgpackHandle = &codec.MsgpackHandle{RawToString: true}
+
+var errHTTPBatchBSON = errors.New("unsupported content type: 'bson', only json, msgpack are supported by batch")
 
 type httpClient struct {
 	*client
+
+	// sent by a page of another origin
+	crossSite bool
 }
 
+// httpWriter keeps the reply of the command, {cmd: reply}, it is written
+// after the command, or with the other replies of a batch.
 type httpWriter struct {
 	contentType string
 	cmd         string
-	w           http.ResponseWriter
+
+	// the bulk replies are base64 encoded, for the binary values
+	base64 bool
+
+	// the streamed bulk replies are written to raw, if any, as the body
+	raw http.ResponseWriter
+
+	result interface{}
 }
 
 func newClientHTTP(app *App, w http.ResponseWriter, r *http.Request) {
 	app.connWait.Add(1)
 	defer app.connWait.Done()
 
-	var err error
 	c := new(httpClient)
 	c.client = newClient(app)
+	defer c.client.close()
 
-	err = c.makeRequest(app, r, w)
+	c.remoteAddr = c.addr(r)
+
+	// authenticated before any command
+	u, err := app.httpUser(r)
 	if err != nil {
-		c.client.close()
+		writeHTTPAuthError(w, err)
+		return
+	}
+	c.user = u
+	c.crossSite = httpCrossSite(r)
+
+	if r.Method == "POST" {
+		if err := c.servePost(app, w, r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := c.makeRequest(app, r, w); err == errHTTPCrossOrigin {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
 		w.Write([]byte(err.Error()))
 		return
 	}
 	c.perform()
-	c.client.close()
+
+	resp := c.resp.(*httpWriter)
+	writeHTTPResult(w, resp.contentType, resp.result)
 }
 
 func (c *httpClient) addr(r *http.Request) string {
@@ -84,17 +117,251 @@ func (c *httpClient) makeRequest(app *App, r *http.Request, w http.ResponseWrite
 	}
 
 	c.cmd = strings.ToLower(cmd)
-	if _, ok := httpUnsupportedCommands[c.cmd]; ok {
-		return fmt.Errorf("unsupported command: '%s'", cmd)
+	if err := app.httpAuth.permit(httpEndpointCommand, c.cmd, args); err != nil {
+		return err
+	} else if err := checkHTTPCrossSite(c.crossSite, c.cmd); err != nil {
+		return err
 	}
 
 	c.args = args
 
-	c.remoteAddr = c.addr(r)
-	c.resp = &httpWriter{contentType, cmd, w}
+	c.resp = &httpWriter{contentType: contentType, cmd: cmd, base64: r.FormValue("encoding") == "base64", raw: w}
 	return nil
 }
 
+// servePost runs the command of the body of POST /[db][/cmd], or the array
+// of commands of the body of POST /[db]/batch, one after the other.
+//
+// A command is {"cmd": "set", "args": ["a", 1, {"base64": "AA=="}]} in
+// JSON or msgpack, by the Content-Type of the request. The cmd of the path
+// is used if the body has none. The reply is in the same type, or the type
+// of the type parameter.
+func (c *httpClient) servePost(app *App, w http.ResponseWriter, r *http.Request) error {
+	var db int
+	var cmd string
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if n, err := strconv.Atoi(parts[0]); err == nil {
+		db = n
+		parts = parts[1:]
+	}
+	if len(parts) > 1 {
+		return fmt.Errorf("invalid path: '%s'", r.URL.Path)
+	} else if len(parts) == 1 {
+		cmd = parts[0]
+	}
+
+	var err error
+	if c.db, err = app.ldb.Select(db); err != nil {
+		return err
+	}
+
+	bodyType, err := httpBodyType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+	contentType := strings.ToLower(query.Get("type"))
+	if contentType == "" {
+		contentType = bodyType
+	} else if _, ok := allowedContentTypes[contentType]; !ok {
+		return fmt.Errorf("unsupported content type: '%s', only json, bson, msgpack are supported", contentType)
+	}
+	encoding := query.Get("encoding") == "base64"
+
+	body, err := decodeHTTPBody(http.MaxBytesReader(w, r.Body, httpMaxBodySize), bodyType)
+	if err != nil {
+		return err
+	}
+
+	if strings.ToLower(cmd) != "batch" {
+		name, args, err := parseHTTPCommand(body, cmd)
+		if err != nil {
+			return err
+		}
+
+		writeHTTPResult(w, contentType, c.execute(httpEndpointCommand, name, args, contentType, encoding, w))
+		return nil
+	}
+
+	if contentType == "bson" {
+		return errHTTPBatchBSON
+	}
+
+	cmds, ok := body.([]interface{})
+	if !ok {
+		return errors.New("invalid batch, must be an array of commands")
+	}
+
+	// all the commands are checked before running the first one
+	names := make([]string, len(cmds))
+	args := make([][][]byte, len(cmds))
+	for i, v := range cmds {
+		if names[i], args[i], err = parseHTTPCommand(v, ""); err != nil {
+			return fmt.Errorf("invalid batch command %d: %s", i, err.Error())
+		}
+	}
+
+	results := make([]interface{}, len(cmds))
+	for i := range cmds {
+		results[i] = c.execute(httpEndpointBatch, names[i], args[i], contentType, encoding, nil)
+	}
+
+	writeHTTPResult(w, contentType, results)
+	return nil
+}
+
+// execute runs the command of the endpoint, and returns its result, nil if
+// it was streamed to raw.
+func (c *httpClient) execute(endpoint string, cmd string, args [][]byte, contentType string, encoding bool, raw http.ResponseWriter) interface{} {
+	resp := &httpWriter{contentType: contentType, cmd: cmd, base64: encoding, raw: raw}
+
+	c.cmd = strings.ToLower(cmd)
+	if err := c.app.httpAuth.permit(endpoint, c.cmd, args); err != nil {
+		resp.writeError(err)
+		return resp.result
+	} else if err := checkHTTPCrossSite(c.crossSite, c.cmd); err != nil {
+		resp.writeError(err)
+		return resp.result
+	}
+
+	c.args = args
+	c.resp = resp
+	c.perform()
+
+	return resp.result
+}
+
+func httpBodyType(contentType string) (string, error) {
+	if contentType == "" {
+		return "json", nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+
+	switch mediaType {
+	case "application/json", "text/plain":
+		return "json", nil
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return "msgpack", nil
+	default:
+		return "", fmt.Errorf("unsupported body type: '%s', only json, msgpack are supported", mediaType)
+	}
+}
+
+func decodeHTTPBody(r io.Reader, bodyType string) (interface{}, error) {
+	var v interface{}
+
+	if bodyType == "msgpack" {
+		if err := codec.NewDecoder(r, httpMsgpackHandle).Decode(&v); err != nil {
+			return nil, fmt.Errorf("invalid msgpack body: %s", err.Error())
+		}
+		return v, nil
+	}
+
+	// the numbers are kept as written
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid json body: %s", err.Error())
+	}
+	return v, nil
+}
+
+// httpMap returns the map of a JSON or msgpack object.
+func httpMap(v interface{}) (map[string]interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			switch k := k.(type) {
+			case string:
+				m[k] = e
+			case []byte:
+				m[string(k)] = e
+			default:
+				return nil, false
+			}
+		}
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+// parseHTTPCommand returns the command of a body, cmd if it has none.
+func parseHTTPCommand(v interface{}, cmd string) (string, [][]byte, error) {
+	m, ok := httpMap(v)
+	if !ok {
+		return "", nil, errors.New("invalid command, must be an object")
+	}
+
+	if name, ok := m["cmd"]; ok {
+		b, err := httpArg(name)
+		if err != nil {
+			return "", nil, errors.New("invalid cmd")
+		}
+		cmd = string(b)
+	}
+
+	var args [][]byte
+	if v, ok := m["args"]; ok && v != nil {
+		ay, ok := v.([]interface{})
+		if !ok {
+			return "", nil, errors.New("invalid args, must be an array")
+		}
+
+		args = make([][]byte, len(ay))
+		for i, arg := range ay {
+			var err error
+			if args[i], err = httpArg(arg); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	return cmd, args, nil
+}
+
+// httpArg returns a string, a number, the bytes of msgpack, or the base64
+// decoded {"base64": "..."} as an argument.
+func httpArg(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case json.Number:
+		return []byte(v.String()), nil
+	case int64:
+		return strconv.AppendInt(nil, v, 10), nil
+	case uint64:
+		return strconv.AppendUint(nil, v, 10), nil
+	case float32:
+		return strconv.AppendFloat(nil, float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.AppendFloat(nil, v, 'f', -1, 64), nil
+	}
+
+	if m, ok := httpMap(v); ok && len(m) == 1 {
+		if s, ok := m["base64"].(string); ok {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 argument: %s", err.Error())
+			}
+			return b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid argument: %v", v)
+}
+
 func (c *httpClient) parseReqPath(r *http.Request) (db int, cmd string, args []string, contentType string) {
 
 	contentType = r.FormValue("type")
@@ -121,20 +388,44 @@ func (c *httpClient) parseReqPath(r *http.Request) (db int, cmd string, args []s
 // http writer
 
 func (w *httpWriter) genericWrite(result interface{}) {
-
-	m := map[string]interface{}{
+	w.result = map[string]interface{}{
 		w.cmd: result,
 	}
-	switch w.contentType {
-	case "json":
-		writeJSON(&m, w.w)
-	case "bson":
-		writeBSON(&m, w.w)
-	case "msgpack":
-		writeMsgPack(&m, w.w)
-	default:
-		log.Errorf("invalid content type %s", w.contentType)
+}
+
+// bulk returns the bulk reply as a string, base64 encoded with the base64
+// encoding.
+func (w *httpWriter) bulk(b []byte) interface{} {
+	if b == nil {
+		return nil
+	} else if w.base64 {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return string(b)
+}
+
+// array returns the array reply with its bulk replies as strings.
+func (w *httpWriter) array(lst []interface{}) []interface{} {
+	ay := make([]interface{}, len(lst))
+	for i, v := range lst {
+		switch v := v.(type) {
+		case []byte:
+			ay[i] = w.bulk(v)
+		case [][]byte:
+			sub := make([]interface{}, len(v))
+			for j, b := range v {
+				sub[j] = w.bulk(b)
+			}
+			ay[i] = sub
+		case []interface{}:
+			ay[i] = w.array(v)
+		case error:
+			ay[i] = v.Error()
+		default:
+			ay[i] = v
+		}
 	}
+	return ay
 }
 
 func (w *httpWriter) writeError(err error) {
@@ -158,62 +449,100 @@ func (w *httpWriter) writeInteger(n int64) {
 }
 
 func (w *httpWriter) writeBulk(b []byte) {
-	if b == nil {
-		w.genericWrite(nil)
-	} else {
-		w.genericWrite(hack.String(b))
-	}
+	w.genericWrite(w.bulk(b))
 }
 
 func (w *httpWriter) writeArray(lst []interface{}) {
-	w.genericWrite(lst)
+	if lst == nil {
+		w.genericWrite(nil)
+		return
+	}
+	w.genericWrite(w.array(lst))
 }
 
 func (w *httpWriter) writeSliceArray(lst [][]byte) {
 	arr := make([]interface{}, len(lst))
 	for i, elem := range lst {
-		if elem == nil {
-			arr[i] = nil
-		} else {
-			arr[i] = hack.String(elem)
-		}
+		arr[i] = w.bulk(elem)
 	}
 	w.genericWrite(arr)
 }
 
 func (w *httpWriter) writeFVPairArray(lst []ledis.FVPair) {
-	m := make(map[string]string)
+	m := make(map[string]interface{})
 	for _, elem := range lst {
-		m[hack.String(elem.Field)] = hack.String(elem.Value)
+		field := string(elem.Field)
+		if w.base64 {
+			field = base64.StdEncoding.EncodeToString(elem.Field)
+		}
+		m[field] = w.bulk(elem.Value)
 	}
 	w.genericWrite(m)
 }
 
 func (w *httpWriter) writeScorePairArray(lst []ledis.ScorePair, withScores bool) {
-	var arr []string
+	var arr []interface{}
 	if withScores {
-		arr = make([]string, 2*len(lst))
+		arr = make([]interface{}, 2*len(lst))
 		for i, data := range lst {
-			arr[2*i] = hack.String(data.Member)
+			arr[2*i] = w.bulk(data.Member)
 			arr[2*i+1] = strconv.FormatInt(data.Score, 10)
 		}
 	} else {
-		arr = make([]string, len(lst))
+		arr = make([]interface{}, len(lst))
 		for i, data := range lst {
-			arr[i] = hack.String(data.Member)
+			arr[i] = w.bulk(data.Member)
 		}
 	}
 	w.genericWrite(arr)
 }
 
+// writeBulkFrom streams the bulk reply as the body of the response, or
+// keeps it as the other replies in a batch.
 func (w *httpWriter) writeBulkFrom(n int64, rb io.Reader) {
-	w.writeError(fmt.Errorf("unsupport"))
+	if w.raw != nil {
+		// the REST objects have their own content type
+		if len(w.raw.Header().Get("Content-Type")) == 0 {
+			w.raw.Header().Set("Content-Type", "application/octet-stream")
+		}
+		w.raw.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+		if _, err := io.CopyN(w.raw, rb, n); err != nil {
+			log.Errorf("http stream bulk of %s error %s", w.cmd, err.Error())
+		}
+		w.result = nil
+		return
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rb, buf); err != nil {
+		w.writeError(err)
+		return
+	}
+	w.genericWrite(w.bulk(buf))
 }
 
 func (w *httpWriter) flush() {
 
 }
 
+// writeHTTPResult writes the result, nothing if the command has no reply.
+func writeHTTPResult(w http.ResponseWriter, contentType string, result interface{}) {
+	if result == nil {
+		return
+	}
+
+	switch contentType {
+	case "json":
+		writeJSON(result, w)
+	case "bson":
+		writeBSON(result, w)
+	case "msgpack":
+		writeMsgPack(result, w)
+	default:
+		log.Errorf("invalid content type %s", contentType)
+	}
+}
+
 func writeJSON(resutl interface{}, w http.ResponseWriter) {
 	buf, err := json.Marshal(resutl)
 	if err != nil {
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"testing"
+
+	"github.com/ugorji/go/codec"
 )
 
 func TestHttp(t *testing.T) {
@@ -38,3 +41,73 @@ func TestHttp(t *testing.T) {
 	}
 
 }
+
+func httpPost(t *testing.T, path string, contentType string, body []byte) (int, []byte) {
+	r, err := http.Post(fmt.Sprintf("http://%s%s", testApp.cfg.HttpAddr, path), contentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.StatusCode, b
+}
+
+func TestHttpPost(t *testing.T) {
+	startTestApp()
+
+	// the key has a slash, and the value is binary
+	if _, b := httpPost(t, "/", "application/json", []byte(`{"cmd":"set","args":["http/a b",{"base64":"AP8="}]}`)); string(b) != `{"set":[true,"OK"]}` {
+		t.Fatal(string(b))
+	} else if _, b := httpPost(t, "/0?encoding=base64", "application/json", []byte(`{"cmd":"get","args":["http/a b"]}`)); string(b) != `{"get":"AP8="}` {
+		t.Fatal(string(b))
+	} else if _, b := httpPost(t, "/0/strlen", "", []byte(`{"args":["http/a b"]}`)); string(b) != `{"strlen":2}` {
+		t.Fatal(string(b))
+	}
+
+	_, b := httpPost(t, "/batch", "application/json", []byte(`[
+		{"cmd":"set","args":["http_n",1]},
+		{"cmd":"incrby","args":["http_n",2]},
+		{"cmd":"mget","args":["http_n","http_none"]},
+		{"cmd":"nocmd"}
+	]`))
+
+	var results []map[string]interface{}
+	if err := json.Unmarshal(b, &results); err != nil {
+		t.Fatal(string(b), err)
+	} else if len(results) != 4 {
+		t.Fatal(results)
+	} else if v := results[1]["incrby"]; v != float64(3) {
+		t.Fatal(v)
+	} else if v := fmt.Sprint(results[2]["mget"]); v != "[3 <nil>]" {
+		t.Fatal(v)
+	} else if v := fmt.Sprint(results[3]["nocmd"]); v != "[false ERR command not found]" {
+		t.Fatal(v)
+	}
+
+	var body bytes.Buffer
+	var h codec.MsgpackHandle
+	if err := codec.NewEncoder(&body, &h).Encode(map[string]interface{}{"cmd": "get", "args": []interface{}{[]byte("http_n")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, b = httpPost(t, "/", "application/msgpack", body.Bytes())
+
+	var v map[string]interface{}
+	if err := codec.NewDecoderBytes(b, &codec.MsgpackHandle{RawToString: true}).Decode(&v); err != nil {
+		t.Fatal(err)
+	} else if v["get"] != "3" {
+		t.Fatal(v)
+	}
+
+	if code, _ := httpPost(t, "/", "application/json", []byte(`{"cmd":"get","args":[true]}`)); code != http.StatusBadRequest {
+		t.Fatal(code)
+	} else if code, _ := httpPost(t, "/batch", "application/json", []byte(`{"cmd":"get"}`)); code != http.StatusBadRequest {
+		t.Fatal(code)
+	} else if code, _ := httpPost(t, "/", "text/html", []byte(`{}`)); code != http.StatusBadRequest {
+		t.Fatal(code)
+	}
+}
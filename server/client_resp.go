@@ -25,11 +25,18 @@ var errClientQuit = errors.New("remote client quit")
 type respClient struct {
 	*client
 
-	conn       net.Conn
-	sub        map[string]chan []interface{}
+	conn net.Conn
+
+	// the subscribed channels and patterns, guarded by app.rcm
+	channels map[string]struct{}
+	patterns map[string]*ledis.Glob
+
+	br         *bufio.Reader
 	respReader *goredis.RespReader
 
 	activeQuit bool
+
+	monitoring bool
 }
 
 type respWriter struct {
@@ -77,9 +84,11 @@ func newClientRESP(conn net.Conn, app *App) {
 		tcpConn.SetReadBuffer(app.cfg.ConnReadBufferSize)
 		tcpConn.SetWriteBuffer(app.cfg.ConnWriteBufferSize)
 	}
-	c.sub = make(map[string]chan []interface{}, 0)
-	br := bufio.NewReaderSize(conn, app.cfg.ConnReadBufferSize)
-	c.respReader = goredis.NewRespReader(br)
+	c.channels = make(map[string]struct{})
+	c.patterns = make(map[string]*ledis.Glob)
+	c.client.subscriber = c
+	c.br = bufio.NewReaderSize(conn, app.cfg.ConnReadBufferSize)
+	c.respReader = goredis.NewRespReader(c.br)
 
 	c.resp = newWriterRESP(conn, app.cfg.ConnWriteBufferSize)
 	c.remoteAddr = conn.RemoteAddr().String()
@@ -116,6 +125,10 @@ func (c *respClient) run() {
 
 		c.app.delRespClient(c)
 
+		if c.monitoring {
+			c.app.monitors.remove(c)
+		}
+
 		c.app.connWait.Done()
 	}()
 
@@ -138,6 +151,7 @@ func (c *respClient) run() {
 
 		reqData, err := c.respReader.ParseRequest()
 		if err == nil {
+			c.stat.qbuf.Set(int64(c.br.Buffered()))
 			err = c.handleRequest(reqData)
 		}
 		if err != nil {
@@ -155,6 +169,16 @@ func (c *respClient) handleRequest(reqData [][]byte) error {
 		c.args = reqData[1:]
 	}
 
+	if c.monitoring {
+		// only QUIT is handled, the monitor owns the writer
+		if c.cmd == "quit" {
+			c.activeQuit = true
+			c.conn.Close()
+			return errClientQuit
+		}
+		return nil
+	}
+
 	if c.cmd == "xselect" {
 		err := c.handleXSelectCmd()
 		if err != nil {
@@ -181,19 +205,40 @@ func (c *respClient) handleRequest(reqData [][]byte) error {
 		p.Signal(os.Interrupt)
 
 		return errClientQuit
-	} else if c.cmd == "subscribe" {
-		for _, key := range c.args {
-			c.sub[string(key)] = make(chan []interface{})
-			c.resp.writeArray([]interface{}{[]byte("subscribe"), key, int64(1)})
-		}
-		c.resp.flush()
-		return nil
 	}
 	c.perform()
 
+	if c.closeAfterReply {
+		return errClientQuit
+	} else if c.monitor && !c.monitoring {
+		c.monitoring = true
+		c.app.monitors.add(c)
+	}
+
 	return nil
 }
 
+// subscribe replies the number of subscriptions after each name, the
+// messages are written by Publish.
+func (c *respClient) subscribe(pattern bool, names [][]byte) {
+	c.app.rcm.Lock()
+	defer c.app.rcm.Unlock()
+
+	kind := []byte("subscribe")
+	if pattern {
+		kind = []byte("psubscribe")
+	}
+
+	for _, name := range names {
+		if pattern {
+			c.patterns[string(name)] = ledis.CompileGlob(string(name))
+		} else {
+			c.channels[string(name)] = struct{}{}
+		}
+		c.resp.writeArray([]interface{}{kind, name, int64(len(c.channels) + len(c.patterns))})
+	}
+}
+
 // XSELECT db THEN command
 func (c *respClient) handleXSelectCmd() error {
 	if len(c.args) <= 2 {
@@ -0,0 +1,335 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func TestACL(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_acl"
+	cfg.Addr = "127.0.0.1:11189"
+	cfg.AuthPassword = "admin"
+	cfg.ACL.Users = []string{
+		"reader on >reader ~app:* +@read -memory +eval db:0",
+		"writer on >writer allkeys +@all -@dangerous db:0 db:1",
+	}
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	admin := goredis.NewClient(cfg.Addr, "admin")
+	admin.SetMaxIdleConns(1)
+	defer admin.Close()
+
+	if v, err := goredis.String(admin.Do("acl", "whoami")); err != nil {
+		t.Fatal(err)
+	} else if v != "default" {
+		t.Fatal(v)
+	}
+
+	if _, err := admin.Do("set", "app:1", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if _, err := reader.Do("get", "app:1"); err == nil || err.Error() != "not authenticated" {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.Do("auth", "reader", "bad"); err == nil {
+		t.Fatal("must fail")
+	}
+
+	if _, err := reader.Do("auth", "reader", "reader"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.String(reader.Do("acl", "whoami")); err != nil {
+		t.Fatal(err)
+	} else if v != "reader" {
+		t.Fatal(v)
+	}
+
+	if v, err := goredis.String(reader.Do("get", "app:1")); err != nil {
+		t.Fatal(err)
+	} else if v != "a" {
+		t.Fatal(v)
+	}
+
+	noPerm := func(err error) bool {
+		return err != nil && strings.HasPrefix(err.Error(), "NOPERM")
+	}
+
+	if _, err := reader.Do("set", "app:1", "b"); !noPerm(err) {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.Do("get", "other"); !noPerm(err) {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.Do("memory", "usage", "app:1"); !noPerm(err) {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.Do("select", "1"); !noPerm(err) {
+		t.Fatal(err)
+	}
+
+	// the script runs with the permissions of the caller
+	if _, err := reader.Do("eval", "return redis.call('set', KEYS[1], 'b')", 1, "app:1"); err == nil {
+		t.Fatal("must fail")
+	}
+
+	writer, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	if _, err := writer.Do("auth", "writer", "writer"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := writer.Do("select", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := writer.Do("set", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	// only some subcommands of CLIENT are admin commands
+	if _, err := writer.Do("client", "setname", "writer"); err != nil {
+		t.Fatal(err)
+	} else if v, err := goredis.String(writer.Do("client", "getname")); err != nil || v != "writer" {
+		t.Fatal(v, err)
+	} else if _, err := writer.Do("client", "id"); err != nil {
+		t.Fatal(err)
+	} else if _, err := writer.Do("client", "info"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sub := range []string{"kill", "list", "no-evict", "pause", "unpause"} {
+		if _, err := writer.Do("client", sub); !noPerm(err) {
+			t.Fatal(sub, err)
+		}
+	}
+
+	if _, err := writer.Do("acl", "users"); !noPerm(err) {
+		t.Fatal(err)
+	}
+
+	if _, err := writer.Do("select", "2"); !noPerm(err) {
+		t.Fatal(err)
+	}
+
+	// runtime changes apply to the logged in clients
+	if _, err := admin.Do("acl", "setuser", "reader", "+set"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.Do("set", "app:1", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := admin.Do("acl", "setuser", "reader", "+nosuchcommand"); err == nil {
+		t.Fatal("must fail")
+	}
+
+	if v, err := goredis.Strings(admin.Do("acl", "users")); err != nil {
+		t.Fatal(err)
+	} else if strings.Join(v, " ") != "default reader writer" {
+		t.Fatal(v)
+	}
+
+	if v, err := goredis.Strings(admin.Do("acl", "list")); err != nil {
+		t.Fatal(err)
+	} else if len(v) != 3 || !strings.HasPrefix(v[1], "user reader on #") ||
+		!strings.HasSuffix(v[1], "~app:* db:0 -@all +@read -memory +eval +set") {
+		t.Fatal(v)
+	}
+
+	if v, err := goredis.Values(admin.Do("acl", "getuser", "reader")); err != nil {
+		t.Fatal(err)
+	} else if len(v) != 10 {
+		t.Fatal(v)
+	} else if s, _ := goredis.String(v[5], nil); s != "-@all +@read -memory +eval +set" {
+		t.Fatal(s)
+	}
+
+	if v, err := goredis.Values(admin.Do("acl", "log")); err != nil {
+		t.Fatal(err)
+	} else if len(v) == 0 {
+		t.Fatal("empty acl log")
+	} else if e, err := goredis.Values(v[0], nil); err != nil {
+		t.Fatal(err)
+	} else if reason, _ := goredis.String(e[3], nil); reason != "db" {
+		t.Fatal(reason)
+	}
+
+	if _, err := admin.Do("acl", "log", "reset"); err != nil {
+		t.Fatal(err)
+	} else if v, err := goredis.Values(admin.Do("acl", "log")); err != nil || len(v) != 0 {
+		t.Fatal(v, err)
+	}
+
+	if v, err := admin.Do("acl", "dryrun", "reader", "get", "app:2"); err != nil {
+		t.Fatal(err)
+	} else if v != "OK" {
+		t.Fatal(v)
+	}
+
+	// the commands reaching the other databases
+	for _, args := range [][]interface{}{
+		{"flushall"},
+		{"xmigrate", "127.0.0.1", "6380", "kv", "k", "5", "10"},
+		{"xmigratedb", "127.0.0.1", "6380", "kv", "10", "5", "10"},
+	} {
+		if v, err := goredis.String(admin.Do("acl", append([]interface{}{"dryrun", "writer"}, args...)...)); err != nil {
+			t.Fatal(err)
+		} else if v == "OK" {
+			t.Fatal(args)
+		}
+	}
+	if v, err := admin.Do("acl", "dryrun", "writer", "xmigrate", "127.0.0.1", "6380", "kv", "k", "1", "10"); err != nil {
+		t.Fatal(err)
+	} else if v != "OK" {
+		t.Fatal(v)
+	}
+
+	// the source keys of zunionstore follow numkeys
+	if _, err := admin.Do("acl", "setuser", "reader", "+zunionstore"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := admin.Do("acl", "dryrun", "reader", "zunionstore", "app:d", "2", "app:a", "app:b"); err != nil {
+		t.Fatal(err)
+	} else if v != "OK" {
+		t.Fatal(v)
+	}
+	if v, err := goredis.String(admin.Do("acl", "dryrun", "reader", "zunionstore", "app:d", "2", "app:a", "other")); err != nil {
+		t.Fatal(err)
+	} else if v == "OK" {
+		t.Fatal(v)
+	}
+
+	if v, err := goredis.Strings(admin.Do("acl", "cat", "hash")); err != nil {
+		t.Fatal(err)
+	} else if len(v) == 0 {
+		t.Fatal(v)
+	}
+
+	if v, err := goredis.Strings(admin.Do("acl", "cat", "admin")); err != nil {
+		t.Fatal(err)
+	} else if s := strings.Join(v, " "); !strings.Contains(s, "client|kill") || strings.Contains(s, "client|setname") {
+		t.Fatal(s)
+	}
+
+	if _, err := admin.Do("acl", "deluser", "default"); err == nil {
+		t.Fatal("must fail")
+	}
+
+	if n, err := goredis.Int(admin.Do("acl", "deluser", "reader", "nobody")); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	// the deleted user is logged out
+	if _, err := reader.Do("get", "app:1"); err == nil || err.Error() != "not authenticated" {
+		t.Fatal(err)
+	}
+}
+
+func TestACLLoad(t *testing.T) {
+	dir := "/tmp/test_acl_load"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+
+	file := path.Join(dir, "ledis.toml")
+	writeUsers := func(users string) {
+		data := "addr = \"127.0.0.1:11223\"\ndata_dir = \"" + dir + "/data\"\n[acl]\nusers = [" + users + "]\n"
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeUsers(`"reader on >reader ~* +@read alldbs"`)
+
+	cfg, err := config.NewConfigWithFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AuthMethod = func(c *config.Config, password string) bool {
+		return password == "magic"
+	}
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	connect := func(auth ...interface{}) *goredis.Conn {
+		c, err := goredis.Connect(cfg.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(auth) > 0 {
+			if _, err := c.Do("auth", auth...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return c
+	}
+
+	admin := connect("magic")
+	defer admin.Close()
+	reader := connect("reader", "reader")
+	defer reader.Close()
+
+	if _, err := admin.Do("acl", "load"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the users still in the file stay logged in
+	for _, c := range []*goredis.Conn{admin, reader} {
+		if _, err := c.Do("get", "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the default user is still checked by the auth method
+	anon := connect()
+	defer anon.Close()
+	if _, err := anon.Do("get", "a"); err == nil || err.Error() != "not authenticated" {
+		t.Fatal(err)
+	}
+
+	writeUsers("")
+	if _, err := admin.Do("acl", "load"); err != nil {
+		t.Fatal(err)
+	} else if _, err := reader.Do("get", "a"); err == nil || err.Error() != "not authenticated" {
+		t.Fatal(err)
+	} else if _, err := admin.Do("get", "a"); err != nil {
+		t.Fatal(err)
+	}
+}
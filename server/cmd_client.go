@@ -0,0 +1,470 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siddontang/go/hack"
+)
+
+var (
+	errNoSuchClient = errors.New("No such client")
+	errClientName   = errors.New("Client names cannot contain spaces, newlines or special characters.")
+	errClientType   = errors.New("Unknown client type")
+	errPauseTimeout = errors.New("timeout is not an integer or out of range")
+)
+
+// clientPause blocks the clients for CLIENT PAUSE.
+type clientPause struct {
+	sync.Mutex
+
+	// pause all commands, not only writes
+	all bool
+	end time.Time
+
+	// closed when the pause ends
+	ch    chan struct{}
+	timer *time.Timer
+}
+
+func (p *clientPause) pause(d time.Duration, all bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	end := time.Now().Add(d)
+
+	if p.ch != nil {
+		// keep the most restrictive mode and the latest end
+		p.all = p.all || all
+		if end.After(p.end) {
+			p.end = end
+			p.timer.Reset(d)
+		}
+		return
+	}
+
+	p.all = all
+	p.end = end
+	p.ch = make(chan struct{})
+	p.timer = time.AfterFunc(d, p.expire)
+}
+
+// expire ends the pause when the timer fires, unless the pause has been
+// extended or restarted while the timer was waiting for the lock.
+func (p *clientPause) expire() {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.ch != nil && !time.Now().Before(p.end) {
+		p.stop()
+	}
+}
+
+func (p *clientPause) unpause() {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.ch != nil {
+		p.stop()
+	}
+}
+
+// stop ends the pause, the lock must be held.
+func (p *clientPause) stop() {
+	p.timer.Stop()
+	close(p.ch)
+	p.ch = nil
+}
+
+// wait blocks until the pause ends if the command is paused.
+func (p *clientPause) wait(c *client, cmd *command) {
+	if cmd.admin(c.args) {
+		// replication and the commands to unpause
+		return
+	} else if _, ok := c.resp.(*luaWriter); ok {
+		// the script has been paused already
+		return
+	}
+
+	p.Lock()
+	ch := p.ch
+	all := p.all
+	p.Unlock()
+
+	if ch == nil {
+		return
+	}
+
+	if all || cmd.flags&cmdWrite != 0 || cmd.category == catScripting || cmd.name == "publish" {
+		select {
+		case <-ch:
+		case <-c.app.quit:
+		}
+	}
+}
+
+func (app *App) nextClientID() uint64 {
+	return app.lastClientID.Add(1)
+}
+
+func (app *App) isSlave(c *client) bool {
+	app.slock.Lock()
+	defer app.slock.Unlock()
+
+	for _, s := range app.slaves {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+// clientType returns normal, replica or pubsub, the rcm lock must be held.
+func (app *App) clientType(rc *respClient) string {
+	if app.isSlave(rc.client) {
+		return "replica"
+	} else if len(rc.channels)+len(rc.patterns) > 0 {
+		return "pubsub"
+	}
+	return "normal"
+}
+
+// clientInfo returns the CLIENT LIST line of c, rc is nil if c is not
+// a RESP connection. The rcm lock must be held.
+func (app *App) clientInfo(c *client, rc *respClient, now time.Time) string {
+	var buf bytes.Buffer
+
+	laddr := ""
+	flags := "N"
+	sub := 0
+	psub := 0
+	qbuf := c.stat.qbuf.Get()
+	rbs := 0
+	wbs := 0
+
+	if rc != nil {
+		laddr = rc.conn.LocalAddr().String()
+		sub = len(rc.channels)
+		psub = len(rc.patterns)
+		rbs = app.cfg.ConnReadBufferSize
+		wbs = app.cfg.ConnWriteBufferSize
+
+		switch app.clientType(rc) {
+		case "replica":
+			flags = "S"
+		case "pubsub":
+			flags = "P"
+		}
+	}
+
+	if c.stat.noEvict.Get() {
+		flags += "e"
+	}
+
+	active := time.Unix(0, c.stat.active.Get())
+
+	fmt.Fprintf(&buf, "id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d",
+		c.id, c.remoteAddr, laddr, c.stat.name.Get(),
+		int64(now.Sub(c.ctime).Seconds()), int64(now.Sub(active).Seconds()),
+		flags, c.stat.db.Get(), sub, psub)
+
+	fmt.Fprintf(&buf, " qbuf=%d qbuf-free=%d rbs=%d wbs=%d cmd=%s user=%s",
+		qbuf, int64(rbs)-qbuf, rbs, wbs, c.stat.cmd.Get(), c.stat.user.Get())
+
+	return buf.String()
+}
+
+// CLIENT LIST|INFO|ID|SETNAME|GETNAME|KILL|PAUSE|UNPAUSE|NO-EVICT|HELP
+func clientCommand(c *client) error {
+	args := c.args[1:]
+
+	switch strings.ToLower(hack.String(c.args[0])) {
+	case "id":
+		c.resp.writeInteger(int64(c.id))
+	case "info":
+		c.app.rcm.Lock()
+		info := c.app.clientInfo(c, c.app.respClient(c), time.Now())
+		c.app.rcm.Unlock()
+
+		c.resp.writeBulk([]byte(info + "\n"))
+	case "list":
+		return clientList(c, args)
+	case "setname":
+		if len(args) != 1 {
+			return ErrCmdParams
+		}
+
+		for _, b := range args[0] {
+			if b < '!' || b > '~' {
+				return errClientName
+			}
+		}
+
+		c.stat.name.Set(string(args[0]))
+		c.resp.writeStatus(OK)
+	case "getname":
+		if name := c.stat.name.Get(); len(name) > 0 {
+			c.resp.writeBulk([]byte(name))
+		} else {
+			c.resp.writeBulk(nil)
+		}
+	case "kill":
+		return clientKill(c, args)
+	case "pause":
+		if len(args) == 0 || len(args) > 2 {
+			return ErrCmdParams
+		}
+
+		ms, err := strconv.ParseInt(hack.String(args[0]), 10, 64)
+		if err != nil || ms < 0 {
+			return errPauseTimeout
+		}
+
+		all := true
+		if len(args) == 2 {
+			switch strings.ToLower(hack.String(args[1])) {
+			case "write":
+				all = false
+			case "all":
+			default:
+				return ErrSyntax
+			}
+		}
+
+		c.app.pause.pause(time.Duration(ms)*time.Millisecond, all)
+		c.resp.writeStatus(OK)
+	case "unpause":
+		c.app.pause.unpause()
+		c.resp.writeStatus(OK)
+	case "no-evict":
+		if len(args) != 1 {
+			return ErrCmdParams
+		}
+
+		switch strings.ToLower(hack.String(args[0])) {
+		case "on":
+			c.stat.noEvict.Set(true)
+		case "off":
+			c.stat.noEvict.Set(false)
+		default:
+			return ErrSyntax
+		}
+		c.resp.writeStatus(OK)
+	case "help":
+		c.resp.writeSliceArray([][]byte{
+			[]byte("CLIENT ID"),
+			[]byte("CLIENT INFO"),
+			[]byte("CLIENT LIST [TYPE normal|replica|pubsub] [ID <id> ...]"),
+			[]byte("CLIENT SETNAME <name>"),
+			[]byte("CLIENT GETNAME"),
+			[]byte("CLIENT KILL <ip:port>"),
+			[]byte("CLIENT KILL <filter> <value> ... (ID, ADDR, LADDR, USER, TYPE, SKIPME, MAXAGE)"),
+			[]byte("CLIENT PAUSE <timeout-ms> [WRITE|ALL]"),
+			[]byte("CLIENT UNPAUSE"),
+			[]byte("CLIENT NO-EVICT ON|OFF"),
+		})
+	default:
+		return ErrSyntax
+	}
+
+	return nil
+}
+
+// respClient returns the RESP connection of c, the rcm lock must be held.
+func (app *App) respClient(c *client) *respClient {
+	for rc := range app.rcs {
+		if rc.client == c {
+			return rc
+		}
+	}
+	return nil
+}
+
+func clientList(c *client, args [][]byte) error {
+	var typ string
+	var ids map[uint64]struct{}
+
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(hack.String(args[i])) {
+		case "type":
+			if i+1 >= len(args) {
+				return ErrSyntax
+			}
+			i++
+			typ = strings.ToLower(hack.String(args[i]))
+			if typ == "slave" {
+				typ = "replica"
+			} else if typ != "normal" && typ != "replica" && typ != "pubsub" {
+				return errClientType
+			}
+		case "id":
+			if i+1 >= len(args) {
+				return ErrSyntax
+			}
+			ids = make(map[uint64]struct{})
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseUint(hack.String(args[i]), 10, 64)
+				if err != nil {
+					return ErrValue
+				}
+				ids[id] = struct{}{}
+			}
+		default:
+			return ErrSyntax
+		}
+	}
+
+	now := time.Now()
+
+	c.app.rcm.Lock()
+	rcs := make([]*respClient, 0, len(c.app.rcs))
+	for rc := range c.app.rcs {
+		if _, ok := ids[rc.id]; ids != nil && !ok {
+			continue
+		} else if len(typ) > 0 && c.app.clientType(rc) != typ {
+			continue
+		}
+		rcs = append(rcs, rc)
+	}
+
+	sort.Slice(rcs, func(i, j int) bool { return rcs[i].id < rcs[j].id })
+
+	var buf bytes.Buffer
+	for _, rc := range rcs {
+		buf.WriteString(c.app.clientInfo(rc.client, rc, now))
+		buf.WriteByte('\n')
+	}
+	c.app.rcm.Unlock()
+
+	c.resp.writeBulk(buf.Bytes())
+	return nil
+}
+
+type clientFilter struct {
+	id     uint64
+	addr   string
+	laddr  string
+	user   string
+	typ    string
+	maxAge int64
+	skipMe bool
+}
+
+func (f *clientFilter) match(app *App, rc *respClient, self *client, now time.Time) bool {
+	if f.skipMe && rc.client == self {
+		return false
+	} else if f.id != 0 && rc.id != f.id {
+		return false
+	} else if len(f.addr) > 0 && rc.remoteAddr != f.addr {
+		return false
+	} else if len(f.laddr) > 0 && rc.conn.LocalAddr().String() != f.laddr {
+		return false
+	} else if len(f.user) > 0 && rc.stat.user.Get() != f.user {
+		return false
+	} else if len(f.typ) > 0 && app.clientType(rc) != f.typ {
+		return false
+	} else if f.maxAge > 0 && int64(now.Sub(rc.ctime).Seconds()) < f.maxAge {
+		return false
+	}
+	return true
+}
+
+// CLIENT KILL ip:port | CLIENT KILL filter value ...
+func clientKill(c *client, args [][]byte) error {
+	if len(args) == 0 {
+		return ErrCmdParams
+	}
+
+	if len(args) == 1 {
+		// the old form kills one client by address
+		f := clientFilter{addr: string(args[0])}
+		if n := killClients(c, &f); n == 0 {
+			return errNoSuchClient
+		}
+		c.resp.writeStatus(OK)
+		return nil
+	} else if len(args)%2 != 0 {
+		return ErrSyntax
+	}
+
+	f := clientFilter{skipMe: true}
+	for i := 0; i < len(args); i += 2 {
+		v := hack.String(args[i+1])
+
+		switch strings.ToLower(hack.String(args[i])) {
+		case "id":
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil || id == 0 {
+				return ErrValue
+			}
+			f.id = id
+		case "addr":
+			f.addr = string(args[i+1])
+		case "laddr":
+			f.laddr = string(args[i+1])
+		case "user":
+			f.user = string(args[i+1])
+		case "type":
+			f.typ = strings.ToLower(v)
+			if f.typ == "slave" {
+				f.typ = "replica"
+			} else if f.typ != "normal" && f.typ != "replica" && f.typ != "pubsub" {
+				return errClientType
+			}
+		case "skipme":
+			switch strings.ToLower(v) {
+			case "yes":
+				f.skipMe = true
+			case "no":
+				f.skipMe = false
+			default:
+				return ErrSyntax
+			}
+		case "maxage":
+			age, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || age <= 0 {
+				return ErrValue
+			}
+			f.maxAge = age
+		default:
+			return ErrSyntax
+		}
+	}
+
+	c.resp.writeInteger(killClients(c, &f))
+	return nil
+}
+
+// killClients closes the connections matching the filter. The calling
+// connection is closed after the reply.
+func killClients(c *client, f *clientFilter) int64 {
+	now := time.Now()
+
+	c.app.rcm.Lock()
+	defer c.app.rcm.Unlock()
+
+	var n int64
+	for rc := range c.app.rcs {
+		if !f.match(c.app, rc, c, now) {
+			continue
+		}
+
+		n++
+		if rc.client == c {
+			c.closeAfterReply = true
+		} else {
+			rc.conn.Close()
+		}
+	}
+	return n
+}
+
+func init() {
+	register("client", clientCommand)
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func TestClient(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_client"
+	cfg.Addr = "127.0.0.1:11190"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	c1, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+
+	c2, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	id1, err := goredis.Int64(c1.Do("client", "id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id2, err := goredis.Int64(c2.Do("client", "id"))
+	if err != nil {
+		t.Fatal(err)
+	} else if id2 == id1 {
+		t.Fatal(id2)
+	}
+
+	if v, err := c1.Do("client", "getname"); err != nil || v != nil {
+		t.Fatal(v, err)
+	}
+
+	if _, err := c1.Do("client", "setname", "bad name"); err == nil {
+		t.Fatal("must fail")
+	}
+
+	if _, err := c1.Do("client", "setname", "worker"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.String(c1.Do("client", "getname")); err != nil || v != "worker" {
+		t.Fatal(v, err)
+	}
+
+	if _, err := c2.Do("select", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.String(c1.Do("client", "list")); err != nil {
+		t.Fatal(err)
+	} else if lines := strings.Split(strings.TrimSpace(v), "\n"); len(lines) != 2 {
+		t.Fatal(v)
+	} else if !strings.HasPrefix(lines[0], fmt.Sprintf("id=%d ", id1)) || !strings.Contains(lines[0], " name=worker ") {
+		t.Fatal(lines[0])
+	} else if !strings.Contains(lines[1], " db=3 ") || !strings.Contains(lines[1], " cmd=select ") {
+		t.Fatal(lines[1])
+	}
+
+	if v, err := goredis.String(c1.Do("client", "list", "id", id2)); err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(v, fmt.Sprintf("id=%d ", id2)) || strings.Count(v, "\n") != 1 {
+		t.Fatal(v)
+	}
+
+	if v, err := goredis.String(c1.Do("client", "info")); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(v, " name=worker ") || !strings.Contains(v, " cmd=client ") {
+		t.Fatal(v)
+	}
+
+	// writers wait and readers continue
+	if _, err := c1.Do("client", "pause", 10000, "write"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c2.Do("get", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c2.Do("set", "a", "1")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatal("write is not paused", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := c1.Do("client", "unpause"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write is still paused")
+	}
+
+	// the pause ends after the timeout
+	if _, err := c1.Do("client", "pause", 50, "all"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := c2.Do("get", "a"); err != nil {
+		t.Fatal(err)
+	} else if time.Since(start) < 40*time.Millisecond {
+		t.Fatal("read is not paused")
+	}
+
+	if n, err := goredis.Int(c1.Do("client", "kill", "id", id2)); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if _, err := c2.Do("ping"); err == nil {
+		t.Fatal("must be killed")
+	}
+
+	if _, err := c1.Do("client", "kill", "127.0.0.1:1"); err == nil {
+		t.Fatal("must fail")
+	}
+
+	// SKIPME is yes by default
+	if n, err := goredis.Int(c1.Do("client", "kill", "type", "normal")); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int(c1.Do("client", "kill", "id", id1, "skipme", "no")); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if _, err := c1.Do("ping"); err == nil {
+		t.Fatal("must be killed")
+	}
+}
+
+func TestClientPauseExtend(t *testing.T) {
+	p := &clientPause{}
+	p.pause(time.Hour, false)
+	defer p.unpause()
+
+	ch := p.ch
+
+	// the timer of an extended pause fires before the new end
+	p.expire()
+
+	select {
+	case <-ch:
+		t.Fatal("the extended pause has ended")
+	default:
+	}
+
+	p.unpause()
+
+	select {
+	case <-ch:
+	default:
+		t.Fatal("the pause has not ended")
+	}
+}
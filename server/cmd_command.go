@@ -0,0 +1,163 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/siddontang/go/hack"
+)
+
+var errNoKeyArguments = errors.New("the command has no key arguments")
+
+// redis command groups of the ACL categories
+var categoryGroups = map[string]string{
+	catString:    "string",
+	catBitmap:    "bitmap",
+	catList:      "list",
+	catHash:      "hash",
+	catSet:       "set",
+	catSortedSet: "sorted-set",
+	catKeyspace:  "generic",
+	catScripting: "scripting",
+	catConn:      "connection",
+}
+
+func sortedCommands() []*command {
+	cmds := make([]*command, 0, len(regCmds))
+	for _, cmd := range regCmds {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].name < cmds[j].name })
+	return cmds
+}
+
+func (cmd *command) info() []interface{} {
+	flags := make([]interface{}, 0, 2)
+	for _, name := range cmd.flagNames() {
+		flags = append(flags, name)
+	}
+
+	categories := make([]interface{}, 0, len(cmd.categories))
+	for _, name := range cmd.categories {
+		categories = append(categories, name)
+	}
+
+	return []interface{}{
+		[]byte(cmd.name),
+		int64(cmd.arity),
+		flags,
+		int64(cmd.firstKey),
+		int64(cmd.lastKey),
+		int64(cmd.keyStep),
+		categories,
+	}
+}
+
+func (cmd *command) docs() []interface{} {
+	group := "server"
+	if cmd.custom {
+		group = "module"
+	} else if g, ok := categoryGroups[cmd.category]; ok {
+		group = g
+	} else if cmd.flags&cmdPubSub != 0 {
+		group = "pubsub"
+	}
+
+	doc := commandDocs[cmd.name]
+
+	return []interface{}{
+		[]byte("summary"), []byte(doc.summary),
+		[]byte("group"), []byte(group),
+		[]byte("syntax"), []byte(strings.TrimSpace(strings.ToUpper(cmd.name) + " " + doc.arguments)),
+	}
+}
+
+// COMMAND [COUNT|INFO|DOCS|LIST|GETKEYS|HELP]
+func commandCommand(c *client) error {
+	if len(c.args) == 0 {
+		cmds := sortedCommands()
+		ay := make([]interface{}, len(cmds))
+		for i, cmd := range cmds {
+			ay[i] = cmd.info()
+		}
+		c.resp.writeArray(ay)
+		return nil
+	}
+
+	args := c.args[1:]
+
+	switch strings.ToLower(hack.String(c.args[0])) {
+	case "count":
+		c.resp.writeInteger(int64(len(regCmds)))
+	case "list":
+		cmds := sortedCommands()
+		ay := make([][]byte, len(cmds))
+		for i, cmd := range cmds {
+			ay[i] = []byte(cmd.name)
+		}
+		c.resp.writeSliceArray(ay)
+	case "info":
+		if len(args) == 0 {
+			for _, cmd := range sortedCommands() {
+				args = append(args, []byte(cmd.name))
+			}
+		}
+
+		ay := make([]interface{}, len(args))
+		for i, name := range args {
+			if cmd, ok := regCmds[strings.ToLower(hack.String(name))]; ok {
+				ay[i] = cmd.info()
+			}
+		}
+		c.resp.writeArray(ay)
+	case "docs":
+		if len(args) == 0 {
+			for _, cmd := range sortedCommands() {
+				args = append(args, []byte(cmd.name))
+			}
+		}
+
+		ay := make([]interface{}, 0, 2*len(args))
+		for _, name := range args {
+			if cmd, ok := regCmds[strings.ToLower(hack.String(name))]; ok {
+				ay = append(ay, []byte(cmd.name), cmd.docs())
+			}
+		}
+		c.resp.writeArray(ay)
+	case "getkeys":
+		if len(args) == 0 {
+			return ErrCmdParams
+		}
+
+		cmd, ok := regCmds[strings.ToLower(hack.String(args[0]))]
+		if !ok {
+			return ErrNotFound
+		} else if !cmd.checkArity(args[1:]) {
+			return ErrCmdParams
+		}
+
+		keys := cmd.keys(args[1:])
+		if len(keys) == 0 {
+			return errNoKeyArguments
+		}
+		c.resp.writeSliceArray(keys)
+	case "help":
+		c.resp.writeSliceArray([][]byte{
+			[]byte("COMMAND"),
+			[]byte("COMMAND COUNT"),
+			[]byte("COMMAND LIST"),
+			[]byte("COMMAND INFO [<command-name> ...]"),
+			[]byte("COMMAND DOCS [<command-name> ...]"),
+			[]byte("COMMAND GETKEYS <full-command>"),
+		})
+	default:
+		return ErrSyntax
+	}
+
+	return nil
+}
+
+func init() {
+	register("command", commandCommand)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func statusStrings(v interface{}) []string {
+	ay, _ := goredis.Values(v, nil)
+	ss := make([]string, len(ay))
+	for i, s := range ay {
+		ss[i], _ = s.(string)
+	}
+	return ss
+}
+
+func TestCommand(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	if n, err := goredis.Int(c.Do("command", "count")); err != nil {
+		t.Fatal(err)
+	} else if n != len(regCmds) {
+		t.Fatal(n)
+	}
+
+	if ay, err := goredis.Values(c.Do("command")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != len(regCmds) {
+		t.Fatal(len(ay))
+	}
+
+	ay, err := goredis.Values(c.Do("command", "info", "get", "mset", "no_such_command"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 3 {
+		t.Fatal(len(ay))
+	} else if ay[2] != nil {
+		t.Fatal(ay[2])
+	}
+
+	get, _ := goredis.Values(ay[0], nil)
+	if name, _ := goredis.String(get[0], nil); name != "get" {
+		t.Fatal(name)
+	} else if arity, _ := goredis.Int(get[1], nil); arity != 2 {
+		t.Fatal(arity)
+	} else if flags := statusStrings(get[2]); strings.Join(flags, " ") != "readonly" {
+		t.Fatal(flags)
+	} else if cats := statusStrings(get[6]); strings.Join(cats, " ") != "@string @read" {
+		t.Fatal(cats)
+	}
+
+	mset, _ := goredis.Values(ay[1], nil)
+	if first, _ := goredis.Int(mset[3], nil); first != 1 {
+		t.Fatal(first)
+	} else if last, _ := goredis.Int(mset[4], nil); last != -1 {
+		t.Fatal(last)
+	} else if step, _ := goredis.Int(mset[5], nil); step != 2 {
+		t.Fatal(step)
+	}
+
+	if keys, err := goredis.Strings(c.Do("command", "getkeys", "mset", "a", "1", "b", "2")); err != nil {
+		t.Fatal(err)
+	} else if strings.Join(keys, " ") != "a b" {
+		t.Fatal(keys)
+	}
+
+	if keys, err := goredis.Strings(c.Do("command", "getkeys", "zunionstore", "d", "2", "a", "b", "weights", "1", "2")); err != nil {
+		t.Fatal(err)
+	} else if strings.Join(keys, " ") != "d a b" {
+		t.Fatal(keys)
+	}
+
+	if ay, err := goredis.Values(c.Do("command", "docs", "get")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 2 {
+		t.Fatal(len(ay))
+	} else if doc, _ := goredis.Strings(ay[1], nil); len(doc) != 6 || doc[3] != "string" || doc[5] != "GET key" {
+		t.Fatal(doc)
+	}
+
+	if _, err := c.Do("get"); err == nil || !strings.Contains(err.Error(), "wrong number of arguments") {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("set", "a"); err == nil {
+		t.Fatal("must error")
+	}
+}
+
+func TestCommandReadonly(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_command_readonly"
+	cfg.Addr = "127.0.0.1:11188"
+	cfg.Readonly = true
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	c := goredis.NewClient(cfg.Addr, "")
+	c.SetMaxIdleConns(1)
+	defer c.Close()
+
+	if _, err := c.Do("set", "a", "1"); err == nil || !strings.HasPrefix(err.Error(), "READONLY") {
+		t.Fatal(err)
+	}
+
+	if v, err := c.Do("get", "a"); err != nil {
+		t.Fatal(err)
+	} else if v != nil {
+		t.Fatal(v)
+	}
+}
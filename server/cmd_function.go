@@ -0,0 +1,314 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/hack"
+	"github.com/siddontang/rdb"
+)
+
+func fcallGenericCommand(c *client, readonly bool) error {
+	s := c.app.script
+
+	keys, argv, err := parseEvalArgs(c)
+	if err != nil {
+		return err
+	}
+
+	if err := s.syncFunctions(); err != nil {
+		return err
+	}
+
+	f := s.lookupFunction(hack.String(c.args[0]))
+	if f == nil {
+		return errFunctionNotFound
+	}
+
+	r, err := s.fcall(c, f, keys, argv, readonly)
+	if err != nil {
+		return err
+	}
+
+	writeValue(c.resp, r)
+	return nil
+}
+
+func fcallCommand(c *client) error {
+	return fcallGenericCommand(c, false)
+}
+
+func fcallroCommand(c *client) error {
+	return fcallGenericCommand(c, true)
+}
+
+func functionCommand(c *client) error {
+	args := c.args
+
+	if len(args) < 1 {
+		return ErrCmdParams
+	}
+
+	if err := c.app.script.syncFunctions(); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(hack.String(args[0])) {
+	case "load":
+		return functionLoadCommand(c)
+	case "list":
+		return functionListCommand(c)
+	case "delete":
+		return functionDeleteCommand(c)
+	case "dump":
+		return functionDumpCommand(c)
+	case "restore":
+		return functionRestoreCommand(c)
+	case "flush":
+		return functionFlushCommand(c)
+	default:
+		return fmt.Errorf("invalid function %s", args[0])
+	}
+}
+
+func functionLoadCommand(c *client) error {
+	s := c.app.script
+	args := c.args[1:]
+
+	replace := false
+	if len(args) == 2 && strings.ToLower(hack.String(args[0])) == "replace" {
+		replace = true
+		args = args[1:]
+	}
+
+	if len(args) != 1 {
+		return ErrCmdParams
+	}
+
+	lib, err := s.compileLibrary(args[0])
+	if err != nil {
+		return err
+	}
+
+	s.funcWriteLock.Lock()
+	defer s.funcWriteLock.Unlock()
+
+	libs := s.libraries()
+	if _, ok := libs[lib.name]; ok && !replace {
+		return fmt.Errorf("ERR Library '%s' already exists", lib.name)
+	}
+	libs[lib.name] = lib
+
+	if err := s.saveLibraries(libs); err != nil {
+		return err
+	}
+
+	c.resp.writeBulk(hack.Slice(lib.name))
+	return nil
+}
+
+func functionListCommand(c *client) error {
+	s := c.app.script
+	args := c.args[1:]
+
+	var pattern *ledis.Glob
+	withCode := false
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(hack.String(args[i])) {
+		case "libraryname":
+			if i+1 >= len(args) || pattern != nil {
+				return ErrCmdParams
+			}
+			pattern = ledis.CompileGlob(hack.String(args[i+1]))
+			i++
+		case "withcode":
+			withCode = true
+		default:
+			return ErrCmdParams
+		}
+	}
+
+	libs := s.libraries()
+	names := make([]string, 0, len(libs))
+	for name := range libs {
+		if pattern == nil || pattern.Match(hack.Slice(name)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	ay := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		lib := libs[name]
+
+		funcs := make([]interface{}, len(lib.funcs))
+		for i, f := range lib.funcs {
+			var desc interface{}
+			if len(f.desc) > 0 {
+				desc = hack.Slice(f.desc)
+			}
+
+			flags := make([][]byte, len(f.flags))
+			for j, flag := range f.flags {
+				flags[j] = hack.Slice(flag)
+			}
+
+			funcs[i] = []interface{}{
+				[]byte("name"), hack.Slice(f.name),
+				[]byte("description"), desc,
+				[]byte("flags"), flags,
+			}
+		}
+
+		item := []interface{}{
+			[]byte("library_name"), hack.Slice(lib.name),
+			[]byte("engine"), []byte("LUA"),
+			[]byte("functions"), funcs,
+		}
+		if withCode {
+			item = append(item, []byte("library_code"), lib.code)
+		}
+
+		ay = append(ay, item)
+	}
+
+	c.resp.writeArray(ay)
+	return nil
+}
+
+func functionDeleteCommand(c *client) error {
+	s := c.app.script
+
+	if len(c.args) != 2 {
+		return ErrCmdParams
+	}
+
+	s.funcWriteLock.Lock()
+	defer s.funcWriteLock.Unlock()
+
+	libs := s.libraries()
+	name := hack.String(c.args[1])
+	if _, ok := libs[name]; !ok {
+		return errLibraryNotFound
+	}
+	delete(libs, name)
+
+	if err := s.saveLibraries(libs); err != nil {
+		return err
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+// the payload of FUNCTION DUMP is the codes of the libraries, as a list
+// in the DUMP format.
+func functionDumpCommand(c *client) error {
+	if len(c.args) != 1 {
+		return ErrCmdParams
+	}
+
+	libs := c.app.script.libraries()
+	names := make([]string, 0, len(libs))
+	for name := range libs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	codes := make(rdb.List, len(names))
+	for i, name := range names {
+		codes[i] = libs[name].code
+	}
+
+	data, err := rdb.Dump(codes)
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeBulk(data)
+	return nil
+}
+
+func functionRestoreCommand(c *client) error {
+	s := c.app.script
+	args := c.args[1:]
+
+	if len(args) != 1 && len(args) != 2 {
+		return ErrCmdParams
+	}
+
+	policy := "append"
+	if len(args) == 2 {
+		policy = strings.ToLower(hack.String(args[1]))
+		if policy != "append" && policy != "replace" && policy != "flush" {
+			return errors.New("ERR Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE.")
+		}
+	}
+
+	d, err := rdb.DecodeDump(args[0])
+	if err != nil {
+		return errors.New("ERR payload version or checksum are wrong")
+	}
+
+	codes, ok := d.(rdb.List)
+	if !ok {
+		return errors.New("ERR given payload is not a function dump")
+	}
+
+	restored := make([]*functionLib, len(codes))
+	for i, code := range codes {
+		if restored[i], err = s.compileLibrary(code); err != nil {
+			return err
+		}
+	}
+
+	s.funcWriteLock.Lock()
+	defer s.funcWriteLock.Unlock()
+
+	libs := s.libraries()
+	if policy == "flush" {
+		libs = make(map[string]*functionLib)
+	}
+
+	for _, lib := range restored {
+		if _, ok := libs[lib.name]; ok && policy == "append" {
+			return fmt.Errorf("ERR Library %s already exists", lib.name)
+		}
+		libs[lib.name] = lib
+	}
+
+	if err := s.saveLibraries(libs); err != nil {
+		return err
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+func functionFlushCommand(c *client) error {
+	s := c.app.script
+
+	// ASYNC and SYNC are accepted, the flush is always synchronous
+	if len(c.args) > 2 {
+		return ErrCmdParams
+	}
+
+	s.funcWriteLock.Lock()
+	defer s.funcWriteLock.Unlock()
+
+	if err := s.saveLibraries(make(map[string]*functionLib)); err != nil {
+		return err
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+func init() {
+	register("fcall", fcallCommand)
+	register("fcall_ro", fcallroCommand)
+	register("function", functionCommand)
+}
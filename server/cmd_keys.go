@@ -2,27 +2,146 @@ package server
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/hack"
 )
 
-func cmd_Command(c *client) error {
-	return ErrCmdParams
-}
+var errKeyAccessTracking = errors.New("key access tracking is disabled, set key_access_tracking to enable it")
 
+// OBJECT ENCODING|IDLETIME|FREQ|REFCOUNT key
 func cmd_Object(c *client) error {
-	return ErrCmdParams
+	args := c.args
+	if len(args) < 1 {
+		return ErrCmdParams
+	}
+
+	sub := strings.ToLower(hack.String(args[0]))
+	if sub == "help" {
+		c.resp.writeSliceArray([][]byte{
+			[]byte("OBJECT ENCODING <key>"),
+			[]byte("OBJECT IDLETIME <key>"),
+			[]byte("OBJECT FREQ <key>"),
+			[]byte("OBJECT REFCOUNT <key>"),
+		})
+		return nil
+	} else if len(args) != 2 {
+		return ErrCmdParams
+	}
+
+	key := args[1]
+	tp := lookupKeyType(c.db, key)
+	if tp == "none" {
+		c.resp.writeBulk(nil)
+		return nil
+	}
+
+	switch sub {
+	case "encoding":
+		enc, err := objectEncoding(c.db, tp, key)
+		if err != nil {
+			return err
+		}
+		c.resp.writeBulk([]byte(enc))
+	case "idletime":
+		if c.app.keyAccess == nil {
+			return errKeyAccessTracking
+		}
+		c.resp.writeInteger(c.app.keyAccess.idleTime(c.db.Index(), key))
+	case "freq":
+		if c.app.keyAccess == nil {
+			return errKeyAccessTracking
+		}
+		c.resp.writeInteger(c.app.keyAccess.frequency(c.db.Index(), key))
+	case "refcount":
+		c.resp.writeInteger(1)
+	default:
+		return ErrSyntax
+	}
+	return nil
+}
+
+// objectEncoding returns the redis encoding names, only for the tools
+// which expect them: ledis has a single layout per type, a string is one
+// kv entry and the other types keep a meta (size) key plus one ordered
+// store entry per element, whatever the size. The string names follow the
+// redis rules on the value, the others never change.
+func objectEncoding(db *ledis.DB, tp string, key []byte) (string, error) {
+	switch tp {
+	case "string":
+		n, err := db.StrLen(key)
+		if err != nil {
+			return "", err
+		}
+		if n <= 20 {
+			v, err := db.Get(key)
+			if err != nil {
+				return "", err
+			}
+			if _, err := strconv.ParseInt(hack.String(v), 10, 64); err == nil {
+				return "int", nil
+			}
+		}
+		if n <= 44 {
+			return "embstr", nil
+		}
+		return "raw", nil
+	case "list":
+		return "quicklist", nil
+	case "hash", "set":
+		return "hashtable", nil
+	case "zset":
+		return "skiplist", nil
+	default:
+		return "", ErrSyntax
+	}
+}
+
+func cmd_RandomKey(c *client) error {
+	if len(c.args) != 0 {
+		return ErrCmdParams
+	}
+
+	key, err := c.db.RandomKey()
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeBulk(key)
+	return nil
+}
+
+func lookupKeyType(db *ledis.DB, k []byte) string {
+	if exists, _ := db.Exists(k); exists == 1 {
+		return "string"
+	} else if exists, _ := db.HKeyExists(k); exists == 1 {
+		return "hash"
+	} else if exists, _ := db.LKeyExists(k); exists == 1 {
+		return "list"
+	} else if exists, _ := db.SKeyExists(k); exists == 1 {
+		return "set"
+	} else if exists, _ := db.ZKeyExists(k); exists == 1 {
+		return "zset"
+	}
+	return "none"
 }
+
 func cmd_TTL(c *client) error {
 	args := c.args
 	if len(args) != 1 {
 		return ErrCmdParams
 	}
 	key := args[0]
-	ret := int64(-2)
-	if ok, _ := c.db.LKeyExists(key); ok == 1 {
+	ret := int64(-1)
+	// the types in the order of EXPIRE, the value of a REST object
+	// before the hash of its metadata
+	if ok, _ := c.db.Exists(key); ok == 1 {
+		ret, _ = c.db.TTL(key)
+	} else if ok, _ := c.db.LKeyExists(key); ok == 1 {
 		ret, _ = c.db.LTTL(key)
 	} else if ok, _ := c.db.SKeyExists(key); ok == 1 {
 		ret, _ = c.db.STTL(key)
@@ -30,8 +149,6 @@ func cmd_TTL(c *client) error {
 		ret, _ = c.db.ZTTL(key)
 	} else if ok, _ := c.db.HKeyExists(key); ok == 1 {
 		ret, _ = c.db.HTTL(key)
-	} else if ok, _ := c.db.Exists(key); ok == 1 {
-		ret, _ = c.db.TTL(key)
 	}
 	c.resp.writeInteger(ret)
 	return nil
@@ -42,26 +159,13 @@ func cmd_Type(c *client) error {
 	if len(args) != 1 {
 		return ErrCmdParams
 	}
-	k := args[0]
-
-	if exists, _ := c.db.Exists(k); exists == 1 {
-		c.resp.writeStatus("string")
-	} else if exists, _ := c.db.HKeyExists(k); exists == 1 {
-		c.resp.writeStatus("hash")
-	} else if exists, _ := c.db.LKeyExists(k); exists == 1 {
-		c.resp.writeStatus("list")
-	} else if exists, _ := c.db.SKeyExists(k); exists == 1 {
-		c.resp.writeStatus("set")
-	} else if exists, _ := c.db.ZKeyExists(k); exists == 1 {
-		c.resp.writeStatus("zset")
-	} else {
-		c.resp.writeStatus("none")
-	}
+
+	c.resp.writeStatus(lookupKeyType(c.db, args[0]))
 	return nil
 }
 func cmd_FlushAll(c *client) error {
 	for i := 0; i < c.app.cfg.Databases; i++ {
-		db, err := c.ldb.Select(i)
+		db, err := c.selectDB(i)
 		if err != nil {
 			return err
 		}
@@ -109,85 +213,17 @@ func cmd_Del(c *client) error {
 	return nil
 }
 func cmd_Exists(c *client) error {
-	if len(c.args) == 0 {
+	if len(c.args) != 1 {
 		return ErrCmdParams
 	}
 	count := int64(0)
-	for _, k := range c.args {
-		if exists, _ := c.db.Exists(k); exists == 1 {
-			count++
-		}
-		if exists, _ := c.db.HKeyExists(k); exists == 1 {
-			count++
-		}
-
-		if exists, _ := c.db.LKeyExists(k); exists == 1 {
-			count++
-		}
-		if exists, _ := c.db.SKeyExists(k); exists == 1 {
-			count++
-		}
-		if exists, _ := c.db.ZKeyExists(k); exists == 1 {
-			count++
-		}
+	if lookupKeyType(c.db, c.args[0]) != "none" {
+		count = 1
 	}
 	c.resp.writeInteger(count)
 	return nil
 }
 
-func patternRE(k string) string {
-	re := bytes.Buffer{}
-	re.WriteString(`^\Q`)
-	for i := 0; i < len(k); i++ {
-		p := k[i]
-		switch p {
-		case '*':
-			re.WriteString(`\E.*\Q`)
-		case '?':
-			re.WriteString(`\E.\Q`)
-		case '[':
-			charClass := bytes.Buffer{}
-			i++
-			for ; i < len(k); i++ {
-				if k[i] == ']' {
-					break
-				}
-				if k[i] == '\\' {
-					if i == len(k)-1 {
-						// Ends with a '\'. U-huh.
-						return ""
-					}
-					charClass.WriteByte(k[i])
-					i++
-					charClass.WriteByte(k[i])
-					continue
-				}
-				charClass.WriteByte(k[i])
-			}
-			if charClass.Len() == 0 {
-				// '[]' is valid in Redis, but matches nothing.
-				return ""
-			}
-			re.WriteString(`\E[`)
-			re.Write(charClass.Bytes())
-			re.WriteString(`]\Q`)
-
-		case '\\':
-			if i == len(k)-1 {
-				// Ends with a '\'. U-huh.
-				return ""
-			}
-			// Forget the \, keep the next char.
-			i++
-			re.WriteByte(k[i])
-			continue
-		default:
-			re.WriteByte(p)
-		}
-	}
-	re.WriteString(`\E$`)
-	return re.String()
-}
 func cmd_Keys(c *client) error {
 	var err error
 	if len(c.args) != 1 {
@@ -195,11 +231,11 @@ func cmd_Keys(c *client) error {
 	}
 
 	var values, val [][]byte
-	match := patternRE(string(c.args[0]))
+	match := ledis.CompileGlob(string(c.args[0]))
 	cursor := []byte{}
 	count := 10
 	for {
-		val, err = c.db.Scan(ledis.KV, cursor, count, false, match)
+		val, err = c.db.ScanGlob(ledis.KV, cursor, count, false, match)
 		if err != nil {
 			return err
 		}
@@ -211,7 +247,7 @@ func cmd_Keys(c *client) error {
 		cursor = val[len(val)-1]
 	}
 	for {
-		val, err = c.db.Scan(ledis.LIST, cursor, count, false, match)
+		val, err = c.db.ScanGlob(ledis.LIST, cursor, count, false, match)
 		if err != nil {
 			return err
 		}
@@ -223,7 +259,7 @@ func cmd_Keys(c *client) error {
 		cursor = val[len(val)-1]
 	}
 	for {
-		val, err = c.db.Scan(ledis.SET, cursor, count, false, match)
+		val, err = c.db.ScanGlob(ledis.SET, cursor, count, false, match)
 		if err != nil {
 			return err
 		}
@@ -236,7 +272,7 @@ func cmd_Keys(c *client) error {
 		cursor = val[len(val)-1]
 	}
 	for {
-		val, err = c.db.Scan(ledis.ZSET, cursor, count, false, match)
+		val, err = c.db.ScanGlob(ledis.ZSET, cursor, count, false, match)
 		if err != nil {
 			return err
 		}
@@ -249,7 +285,7 @@ func cmd_Keys(c *client) error {
 		cursor = val[len(val)-1]
 	}
 	for {
-		val, err = c.db.Scan(ledis.HASH, cursor, count, false, match)
+		val, err = c.db.ScanGlob(ledis.HASH, cursor, count, false, match)
 		if err != nil {
 			return err
 		}
@@ -300,27 +336,27 @@ func cmd_Scan(c *client) error {
 	}
 
 	var values, val [][]byte
-	match := patternRE(pattern)
-	values, err = c.db.Scan(ledis.KV, cursor, count, false, match)
+	match := ledis.CompileGlob(pattern)
+	values, err = c.db.ScanGlob(ledis.KV, cursor, count, false, match)
 	if err != nil {
 		return err
 	}
-	val, err = c.db.Scan(ledis.LIST, cursor, count, false, match)
+	val, err = c.db.ScanGlob(ledis.LIST, cursor, count, false, match)
 	if err != nil {
 		return err
 	}
 	values = append(values, val...)
-	val, err = c.db.Scan(ledis.SET, cursor, count, false, match)
+	val, err = c.db.ScanGlob(ledis.SET, cursor, count, false, match)
 	if err != nil {
 		return err
 	}
 	values = append(values, val...)
-	val, err = c.db.Scan(ledis.ZSET, cursor, count, false, match)
+	val, err = c.db.ScanGlob(ledis.ZSET, cursor, count, false, match)
 	if err != nil {
 		return err
 	}
 	values = append(values, val...)
-	val, err = c.db.Scan(ledis.HASH, cursor, count, false, match)
+	val, err = c.db.ScanGlob(ledis.HASH, cursor, count, false, match)
 	if err != nil {
 		return err
 	}
@@ -485,8 +521,8 @@ func cmd_ZRem(c *client) error {
 	return nil
 }
 func init() {
-	register("command", cmd_Command)
-	//	register("object", objectCommand)
+	register("object", cmd_Object)
+	register("randomkey", cmd_RandomKey)
 	register("type", cmd_Type)
 	register("ttl", cmd_TTL)
 	register("del", cmd_Del)
@@ -513,7 +549,7 @@ func cmd_Expire(c *client) error {
 		return ErrCmdParams
 	}
 	key := c.args[0]
-	ret := int64(-2)
+	ret := int64(0)
 	duration, err := ledis.StrInt64(args[1], nil)
 	if err != nil {
 		return ErrValue
@@ -603,32 +639,50 @@ func Publish(app *App, key, value []byte) int64 {
 	i := int64(0)
 	reply := []interface{}{[]byte("message"), key, value}
 	for rc, _ := range app.rcs {
-		if _, ok := rc.sub[string(key)]; ok {
+		n := i
+		if _, ok := rc.channels[string(key)]; ok {
 			i++
-
 			rc.resp.writeArray(reply)
+		}
+		for p, g := range rc.patterns {
+			if g.Match(key) {
+				i++
+				rc.resp.writeArray([]interface{}{[]byte("pmessage"), []byte(p), key, value})
+			}
+		}
+		if i > n {
 			rc.resp.flush()
-
 		}
 	}
+	for s := range app.hss {
+		i += s.publish(key, value)
+	}
 	return i
 }
 func cmd_Set(c *client) error {
 	args := c.args
 
+	// SET key value [EX seconds]
+	var expire int64
+	switch len(args) {
+	case 2:
+	case 4:
+		if !strings.EqualFold(string(args[2]), "ex") {
+			return ErrSyntax
+		}
+		var err error
+		if expire, err = ledis.StrInt64(args[3], nil); err != nil || expire <= 0 {
+			return ErrValue
+		}
+	default:
+		return ErrCmdParams
+	}
+
 	if err := c.db.Set(args[0], args[1]); err != nil {
 		return err
 	} else {
-		if len(args) > 1 {
-
-			switch string(args[1]) {
-			case "ex", "EX":
-				expire, err := ledis.StrInt64(args[2], nil)
-				if err != nil {
-					return err
-				}
-				c.db.Expire(args[0], expire)
-			}
+		if expire > 0 {
+			c.db.Expire(args[0], expire)
 		}
 		c.resp.writeStatus(OK)
 		notify := []byte(fmt.Sprint("__keyspace@", c.db.Index(), "__:", string(args[0])))
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func TestObject(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_object"
+	cfg.Addr = "127.0.0.1:11187"
+	cfg.KeyAccessTracking = true
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	c := goredis.NewClient(cfg.Addr, "")
+	c.SetMaxIdleConns(1)
+	defer c.Close()
+
+	if v, err := c.Do("randomkey"); err != nil {
+		t.Fatal(err)
+	} else if v != nil {
+		t.Fatal(v)
+	}
+
+	c.Do("set", "object_int", "12345")
+	c.Do("set", "object_str", "hello")
+	c.Do("hset", "object_hash", "f", "v")
+	c.Do("zadd", "object_zset", 1, "m")
+
+	for key, enc := range map[string]string{
+		"object_int":  "int",
+		"object_str":  "embstr",
+		"object_hash": "hashtable",
+		"object_zset": "skiplist",
+	} {
+		if v, err := goredis.String(c.Do("object", "encoding", key)); err != nil {
+			t.Fatal(err)
+		} else if v != enc {
+			t.Fatal(key, v)
+		}
+	}
+
+	if v, err := c.Do("object", "encoding", "object_none"); err != nil {
+		t.Fatal(err)
+	} else if v != nil {
+		t.Fatal(v)
+	}
+
+	if n, err := goredis.Int64(c.Do("object", "idletime", "object_str")); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int64(c.Do("object", "freq", "object_str")); err != nil {
+		t.Fatal(err)
+	} else if n < lfuInitVal {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int64(c.Do("object", "refcount", "object_hash")); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if v, err := goredis.String(c.Do("randomkey")); err != nil {
+		t.Fatal(err)
+	} else if v != "object_int" && v != "object_str" && v != "object_hash" && v != "object_zset" {
+		t.Fatal(v)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/hack"
+)
+
+const defaultMemoryUsageSamples = 5
+
+var keyDataTypes = map[string]ledis.DataType{
+	"string": KV,
+	"list":   LIST,
+	"hash":   HASH,
+	"set":    SET,
+	"zset":   ZSET,
+}
+
+// MEMORY USAGE key [SAMPLES count]
+func memoryCommand(c *client) error {
+	if len(c.args) < 1 {
+		return ErrCmdParams
+	}
+
+	switch strings.ToLower(hack.String(c.args[0])) {
+	case "usage":
+		return memoryUsageCommand(c)
+	case "help":
+		c.resp.writeSliceArray([][]byte{
+			[]byte("MEMORY USAGE <key> [SAMPLES <count>]"),
+		})
+		return nil
+	default:
+		return ErrSyntax
+	}
+}
+
+func memoryUsageCommand(c *client) error {
+	args := c.args[1:]
+	if len(args) != 1 && len(args) != 3 {
+		return ErrCmdParams
+	}
+
+	samples := defaultMemoryUsageSamples
+	if len(args) == 3 {
+		if strings.ToLower(hack.String(args[1])) != "samples" {
+			return ErrSyntax
+		}
+
+		var err error
+		if samples, err = strconv.Atoi(hack.String(args[2])); err != nil || samples < 0 {
+			return ErrValue
+		}
+	}
+
+	key := args[0]
+	tp, ok := keyDataTypes[lookupKeyType(c.db, key)]
+	if !ok {
+		c.resp.writeBulk(nil)
+		return nil
+	}
+
+	n, err := c.db.KeyUsage(tp, key, samples)
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeInteger(n)
+	return nil
+}
+
+func init() {
+	register("memory", memoryCommand)
+}
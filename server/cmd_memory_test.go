@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/siddontang/goredis"
+)
+
+func TestMemoryUsage(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	key := "memory_usage_hash"
+	for i := 0; i < 20; i++ {
+		if _, err := c.Do("hset", key, fmt.Sprintf("f%02d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := goredis.Int64(c.Do("memory", "usage", key, "samples", 0))
+	if err != nil {
+		t.Fatal(err)
+	} else if all == 0 {
+		t.Fatal(all)
+	}
+
+	if n, err := goredis.Int64(c.Do("memory", "usage", key)); err != nil {
+		t.Fatal(err)
+	} else if n != all {
+		t.Fatal(n, all)
+	}
+
+	if v, err := c.Do("memory", "usage", "memory_usage_none"); err != nil {
+		t.Fatal(err)
+	} else if v != nil {
+		t.Fatal(v)
+	}
+
+	if _, err := c.Do("memory", "usage", key, "samples"); err == nil {
+		t.Fatal("must error")
+	}
+}
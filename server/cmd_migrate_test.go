@@ -63,13 +63,13 @@ func TestMigrate(t *testing.T) {
 	s2Cfg.DataDir = fmt.Sprintf("%s/s2", data_dir)
 	s2Cfg.Addr = "127.0.0.1:11186"
 
-	s1, err := NewApp(s1Cfg)
+	s1, err := NewApp(s1Cfg, "")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer s1.Close()
 
-	s2, err := NewApp(s2Cfg)
+	s2, err := NewApp(s2Cfg, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/siddontang/go/hack"
+	"github.com/siddontang/go/log"
 	"github.com/siddontang/go/num"
 	"github.com/r0123r/vredis/ledis"
 )
@@ -96,6 +98,58 @@ func fullsyncCommand(c *client) error {
 	return nil
 }
 
+// SAVE creates a snapshot, the latest one of FULLSYNC.
+func saveCommand(c *client) error {
+	if len(c.args) != 0 {
+		return ErrCmdParams
+	}
+
+	s, _, err := c.app.snap.Create(c.app.ldb)
+	if err != nil {
+		return err
+	}
+	s.Close()
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+// BGSAVE creates a snapshot in background, its status is in INFO
+// persistence.
+func bgsaveCommand(c *client) error {
+	if len(c.args) != 0 {
+		return ErrCmdParams
+	}
+
+	snap := c.app.snap
+	if snap.dumping.Get() || !snap.bgsaving.CompareAndSwap(0, 1) {
+		return errors.New("background save already in progress")
+	}
+
+	go func() {
+		defer snap.bgsaving.Set(0)
+
+		s, _, err := snap.Create(c.app.ldb)
+		if err != nil {
+			log.Errorf("background save error %s", err.Error())
+			return
+		}
+		s.Close()
+	}()
+
+	c.resp.writeStatus("Background saving started")
+	return nil
+}
+
+func lastsaveCommand(c *client) error {
+	if len(c.args) != 0 {
+		return ErrCmdParams
+	}
+
+	c.resp.writeInteger(c.app.snap.lastSave.Get())
+	return nil
+}
+
 var dummyBuf = make([]byte, 8)
 
 func syncCommand(c *client) error {
@@ -268,6 +322,9 @@ func splitHostPort(str string) (string, int16, error) {
 func init() {
 	register("slaveof", slaveofCommand)
 	register("fullsync", fullsyncCommand)
+	register("save", saveCommand)
+	register("bgsave", bgsaveCommand)
+	register("lastsave", lastsaveCommand)
 	register("sync", syncCommand)
 	register("replconf", replconfCommand)
 	register("role", roleCommand)
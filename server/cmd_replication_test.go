@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -49,7 +50,7 @@ func TestReplication(t *testing.T) {
 	var master *App
 	var slave *App
 	var err error
-	master, err = NewApp(masterCfg)
+	master, err = NewApp(masterCfg, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -61,7 +62,7 @@ func TestReplication(t *testing.T) {
 	slaveCfg.SlaveOf = masterCfg.Addr
 	slaveCfg.UseReplication = true
 
-	slave, err = NewApp(slaveCfg)
+	slave, err = NewApp(slaveCfg, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -170,3 +171,49 @@ func checkTestRole(addr string, checkRoles []interface{}) error {
 	}
 	return nil
 }
+
+func TestSave(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_save"
+	cfg.Addr = "127.0.0.1:11219"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	go s.Run()
+
+	c := goredis.NewClient(cfg.Addr, "")
+	defer c.Close()
+
+	if v, err := goredis.String(c.Do("save")); err != nil || v != OK {
+		t.Fatal(v, err)
+	} else if n, err := goredis.Int64(c.Do("lastsave")); err != nil || n < time.Now().Unix()-1 {
+		t.Fatal(n, err)
+	} else if len(s.snap.names) != 1 {
+		t.Fatal(s.snap.names)
+	}
+
+	// another BGSAVE is starting
+	s.snap.bgsaving.Set(1)
+	if _, err := c.Do("bgsave"); err == nil || !strings.Contains(err.Error(), "already in progress") {
+		t.Fatal(err)
+	}
+	s.snap.bgsaving.Set(0)
+
+	if v, err := goredis.String(c.Do("bgsave")); err != nil || v != "Background saving started" {
+		t.Fatal(v, err)
+	}
+
+	for i := 0; i < 50 && s.snap.bgsaving.Get() != 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if !s.snap.lastOK.Get() {
+		t.Fatal("bgsave failed")
+	}
+}
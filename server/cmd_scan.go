@@ -11,7 +11,7 @@ import (
 	"github.com/r0123r/vredis/ledis"
 )
 
-func parseXScanArgs(args [][]byte) (cursor []byte, match string, count int, desc bool, err error) {
+func parseXScanArgs(args [][]byte) (cursor []byte, match *ledis.Glob, count int, desc bool, err error) {
 	cursor = args[0]
 
 	args = args[1:]
@@ -28,7 +28,7 @@ func parseXScanArgs(args [][]byte) (cursor []byte, match string, count int, desc
 				return
 			}
 
-			match = hack.String(args[i+1])
+			match = ledis.CompileGlob(hack.String(args[i+1]))
 			i++
 		case "COUNT":
 			if i+1 >= len(args) {
@@ -57,7 +57,7 @@ func parseXScanArgs(args [][]byte) (cursor []byte, match string, count int, desc
 	return
 }
 
-func parseScanArgs(args [][]byte) (cursor []byte, match string, count int, desc bool, err error) {
+func parseScanArgs(args [][]byte) (cursor []byte, match *ledis.Glob, count int, desc bool, err error) {
 	cursor, match, count, desc, err = parseXScanArgs(args)
 	if bytes.Compare(cursor, nilCursorRedis) == 0 {
 		cursor = nilCursorLedis
@@ -67,7 +67,7 @@ func parseScanArgs(args [][]byte) (cursor []byte, match string, count int, desc
 
 type scanCommandGroup struct {
 	lastCursor []byte
-	parseArgs  func(args [][]byte) (cursor []byte, match string, count int, desc bool, err error)
+	parseArgs  func(args [][]byte) (cursor []byte, match *ledis.Glob, count int, desc bool, err error)
 }
 
 // XSCAN type cursor [MATCH match] [COUNT count] [ASC|DESC]
@@ -103,9 +103,9 @@ func (scg scanCommandGroup) xscanCommand(c *client) error {
 	var ay [][]byte
 
 	if !desc {
-		ay, err = c.db.Scan(dataType, cursor, count, false, match)
+		ay, err = c.db.ScanGlob(dataType, cursor, count, false, match)
 	} else {
-		ay, err = c.db.RevScan(dataType, cursor, count, false, match)
+		ay, err = c.db.RevScanGlob(dataType, cursor, count, false, match)
 	}
 
 	if err != nil {
@@ -142,9 +142,9 @@ func (scg scanCommandGroup) xhscanCommand(c *client) error {
 	var ay []ledis.FVPair
 
 	if !desc {
-		ay, err = c.db.HScan(key, cursor, count, false, match)
+		ay, err = c.db.HScanGlob(key, cursor, count, false, match)
 	} else {
-		ay, err = c.db.HRevScan(key, cursor, count, false, match)
+		ay, err = c.db.HRevScanGlob(key, cursor, count, false, match)
 	}
 
 	if err != nil {
@@ -189,9 +189,9 @@ func (scg scanCommandGroup) xsscanCommand(c *client) error {
 	var ay [][]byte
 
 	if !desc {
-		ay, err = c.db.SScan(key, cursor, count, false, match)
+		ay, err = c.db.SScanGlob(key, cursor, count, false, match)
 	} else {
-		ay, err = c.db.SRevScan(key, cursor, count, false, match)
+		ay, err = c.db.SRevScanGlob(key, cursor, count, false, match)
 	}
 
 	if err != nil {
@@ -230,9 +230,9 @@ func (scg scanCommandGroup) xzscanCommand(c *client) error {
 	var ay []ledis.ScorePair
 
 	if !desc {
-		ay, err = c.db.ZScan(key, cursor, count, false, match)
+		ay, err = c.db.ZScanGlob(key, cursor, count, false, match)
 	} else {
-		ay, err = c.db.ZRevScan(key, cursor, count, false, match)
+		ay, err = c.db.ZRevScanGlob(key, cursor, count, false, match)
 	}
 
 	if err != nil {
@@ -16,7 +16,7 @@ func TestScan(t *testing.T) {
 
 	os.RemoveAll(cfg.DataDir)
 
-	s, err := NewApp(cfg)
+	s, err := NewApp(cfg, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -32,6 +32,7 @@ func TestScan(t *testing.T) {
 	testListKeyScan(t, c)
 	testZSetKeyScan(t, c)
 	testSetKeyScan(t, c)
+	testMatchScan(t, c)
 }
 
 func checkScanValues(t *testing.T, ay interface{}, values ...interface{}) {
@@ -123,6 +124,45 @@ func testSetKeyScan(t *testing.T, c *goredis.Client) {
 	checkScan(t, c, "SET")
 }
 
+func testMatchScan(t *testing.T, c *goredis.Client) {
+	for _, k := range []string{"user:1", "user:2", "userx"} {
+		if _, err := c.Do("set", k, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Do("hset", "user:3", "f", "v")
+
+	if ay, err := goredis.Strings(c.Do("keys", "user:*")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 3 {
+		t.Fatal(ay)
+	}
+
+	if ay, err := goredis.Values(c.Do("scan", "0", "match", "user:[12]")); err != nil {
+		t.Fatal(err)
+	} else {
+		checkScanValues(t, ay[1], "user:1", "user:2")
+	}
+
+	if ay, err := goredis.Values(c.Do("XSCAN", "KV", "", "match", "user*", "count", 10)); err != nil {
+		t.Fatal(err)
+	} else {
+		checkScanValues(t, ay[1], "user:1", "user:2", "userx")
+	}
+
+	if ay, err := goredis.Values(c.Do("XSCAN", "KV", "", "match", "user?", "desc")); err != nil {
+		t.Fatal(err)
+	} else {
+		checkScanValues(t, ay[1], "userx")
+	}
+
+	if ay, err := goredis.Values(c.Do("XHSCAN", "user:3", "", "match", "f*")); err != nil {
+		t.Fatal(err)
+	} else {
+		checkScanValues(t, ay[1], "f", "v")
+	}
+}
+
 func TestXHashScan(t *testing.T) {
 	c := getTestConn()
 	defer c.Close()
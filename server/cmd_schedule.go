@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/siddontang/go/hack"
+)
+
+func scheduleCommand(c *client) error {
+	args := c.args
+
+	if len(args) < 1 {
+		return ErrCmdParams
+	}
+
+	if err := c.app.sched.sync(); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(hack.String(args[0])) {
+	case "add":
+		return scheduleAddCommand(c)
+	case "list":
+		return scheduleListCommand(c)
+	case "del":
+		return scheduleDelCommand(c)
+	case "run":
+		return scheduleRunCommand(c)
+	case "history":
+		return scheduleHistoryCommand(c)
+	default:
+		return fmt.Errorf("invalid schedule %s", args[0])
+	}
+}
+
+// SCHEDULE ADD name cron sha numkeys [key ...] [arg ...]
+func scheduleAddCommand(c *client) error {
+	args := c.args[1:]
+
+	if len(args) < 4 {
+		return ErrCmdParams
+	}
+
+	spec, err := parseCron(string(args[1]))
+	if err != nil {
+		return err
+	}
+
+	n, err := strconv.Atoi(hack.String(args[3]))
+	if err != nil || n < 0 {
+		return ErrValue
+	} else if n > len(args)-4 {
+		return ErrCmdParams
+	}
+
+	j := &job{
+		name: string(args[0]),
+		Cron: string(args[1]),
+		Sha:  strings.ToLower(string(args[2])),
+		DB:   c.db.Index(),
+		spec: spec,
+	}
+
+	if j.Script = c.app.script.source(j.Sha); j.Script == nil {
+		return errors.New("NOSCRIPT no matching script, please use SCRIPT LOAD")
+	}
+
+	// the arguments are reused by the next command
+	j.Keys = make([][]byte, 0, n)
+	for _, key := range args[4 : 4+n] {
+		j.Keys = append(j.Keys, append([]byte(nil), key...))
+	}
+	j.Args = make([][]byte, 0, len(args)-4-n)
+	for _, arg := range args[4+n:] {
+		j.Args = append(j.Args, append([]byte(nil), arg...))
+	}
+
+	if err := c.app.sched.save(j.name, j); err != nil {
+		return err
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+func scheduleListCommand(c *client) error {
+	if len(c.args) != 1 {
+		return ErrCmdParams
+	}
+
+	jobs, next := c.app.sched.list()
+
+	ay := make([]interface{}, len(jobs))
+	for i, j := range jobs {
+		var nextRun int64
+		if !next[i].IsZero() {
+			nextRun = next[i].Unix()
+		}
+
+		ay[i] = []interface{}{
+			[]byte("name"), hack.Slice(j.name),
+			[]byte("cron"), hack.Slice(j.Cron),
+			[]byte("sha"), hack.Slice(j.Sha),
+			[]byte("db"), int64(j.DB),
+			[]byte("keys"), j.Keys,
+			[]byte("args"), j.Args,
+			[]byte("next_run"), nextRun,
+		}
+	}
+
+	c.resp.writeArray(ay)
+	return nil
+}
+
+func scheduleDelCommand(c *client) error {
+	if len(c.args) != 2 {
+		return ErrCmdParams
+	}
+
+	if err := c.app.sched.save(string(c.args[1]), nil); err != nil {
+		return err
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+// SCHEDULE RUN name runs the job now, and replies its reply.
+func scheduleRunCommand(c *client) error {
+	if len(c.args) != 2 {
+		return ErrCmdParams
+	}
+
+	sc := c.app.sched
+	if !sc.isMaster() {
+		return ErrReadOnlyReplica
+	}
+
+	j := sc.get(string(c.args[1]))
+	if j == nil {
+		return errScheduleNotFound
+	}
+
+	r, err := sc.run(j)
+	if err != nil {
+		return err
+	}
+
+	writeValue(c.resp, r)
+	return nil
+}
+
+// SCHEDULE HISTORY [name]
+func scheduleHistoryCommand(c *client) error {
+	if len(c.args) > 2 {
+		return ErrCmdParams
+	}
+
+	var name string
+	if len(c.args) == 2 {
+		name = string(c.args[1])
+	}
+
+	runs := c.app.sched.runs(name)
+
+	ay := make([]interface{}, len(runs))
+	for i, r := range runs {
+		var runErr interface{}
+		if r.err != nil {
+			runErr = []byte(r.err.Error())
+		}
+
+		ay[i] = []interface{}{
+			[]byte("id"), r.id,
+			[]byte("name"), hack.Slice(r.name),
+			[]byte("time"), r.time,
+			[]byte("duration"), r.duration,
+			[]byte("error"), runErr,
+		}
+	}
+
+	c.resp.writeArray(ay)
+	return nil
+}
+
+func init() {
+	register("schedule", scheduleCommand)
+}
@@ -1,8 +1,6 @@
 package server
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
 	"errors"
 	"fmt"
 
@@ -14,91 +12,46 @@ import (
 	"github.com/yuin/gopher-lua"
 )
 
-func parseEvalArgs(l *lua.LState, c *client) error {
+func parseEvalArgs(c *client) (keys [][]byte, argv [][]byte, err error) {
 	args := c.args
 	if len(args) < 2 {
-		return ErrCmdParams
+		return nil, nil, ErrCmdParams
 	}
 
 	args = args[1:]
 
 	n, err := strconv.Atoi(hack.String(args[0]))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	if n > len(args)-1 {
-		return ErrCmdParams
+		return nil, nil, ErrCmdParams
 	}
 
-	luaSetGlobalArray(l, "KEYS", args[1:n+1])
-	luaSetGlobalArray(l, "ARGV", args[n+1:])
-
-	return nil
+	return args[1 : n+1], args[n+1:], nil
 }
 
 func evalGenericCommand(c *client, evalSha1 bool) (err error) {
 	s := c.app.script
-	luaClient := s.c
-	l := s.l
 
-	s.Lock()
-
-	defer func() {
-		luaClient.db = nil
-		// luaClient.script = nil
-
-		s.Unlock()
-	}()
-
-	luaClient.db = c.db
-	// luaClient.script = m
-	luaClient.remoteAddr = c.remoteAddr
-
-	if err := parseEvalArgs(l, c); err != nil {
+	keys, argv, err := parseEvalArgs(c)
+	if err != nil {
 		return err
 	}
 
-	var key string
+	var proto *lua.FunctionProto
 	if !evalSha1 {
-		h := sha1.Sum(c.args[0])
-		key = hex.EncodeToString(h[0:20])
-	} else {
-		key = strings.ToLower(hack.String(c.args[0]))
-	}
-
-	global := l.GetGlobal(key)
-
-	if global.Type() == lua.LTNil {
-		if evalSha1 {
-			return errors.New("NOSCRIPT no matching script, please use EVAL")
-		}
-
-		val, err := l.LoadString(hack.String(c.args[0]))
-		if err != nil {
+		if _, proto, err = s.load(c.args[0]); err != nil {
 			return err
 		}
-
-		l.SetGlobal(key, val)
-		s.chunks[key] = struct{}{}
-		global = val
+	} else if proto = s.lookup(strings.ToLower(hack.String(c.args[0]))); proto == nil {
+		return errors.New("NOSCRIPT no matching script, please use EVAL")
 	}
 
-	l.Push(global)
-
-	// catch any uncaught panic
-	// this happens for example when the user,
-	// makes a mistake using `ledis.call`
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("panic: %v", r)
-		}
-	}()
-	l.Call(0, lua.MultRet)
-
-	r := luaReplyToLedisReply(l)
-	if v, ok := r.(error); ok {
-		return v
+	r, err := s.run(c, proto, keys, argv)
+	if err != nil {
+		return err
 	}
 
 	writeValue(c.resp, r)
@@ -114,18 +67,6 @@ func evalshaCommand(c *client) error {
 }
 
 func scriptCommand(c *client) error {
-	s := c.app.script
-	l := s.l
-
-	s.Lock()
-
-	base := l.GetTop()
-
-	defer func() {
-		l.SetTop(base)
-		s.Unlock()
-	}()
-
 	args := c.args
 
 	if len(args) < 1 {
@@ -139,6 +80,8 @@ func scriptCommand(c *client) error {
 		return scriptExistsCommand(c)
 	case "flush":
 		return scriptFlushCommand(c)
+	case "kill":
+		return scriptKillCommand(c)
 	default:
 		return fmt.Errorf("invalid script %s", args[0])
 	}
@@ -146,23 +89,15 @@ func scriptCommand(c *client) error {
 
 func scriptLoadCommand(c *client) error {
 	s := c.app.script
-	l := s.l
 
 	if len(c.args) != 2 {
 		return ErrCmdParams
 	}
 
-	h := sha1.Sum(c.args[1])
-	key := hex.EncodeToString(h[0:20])
-
-	val, err := l.LoadString(hack.String(c.args[1]))
+	key, _, err := s.load(c.args[1])
 	if err != nil {
 		return err
 	}
-	l.Push(val)
-
-	l.SetGlobal(key, val)
-	s.chunks[key] = struct{}{}
 
 	c.resp.writeBulk(hack.Slice(key))
 	return nil
@@ -177,7 +112,7 @@ func scriptExistsCommand(c *client) error {
 
 	ay := make([]interface{}, len(c.args[1:]))
 	for i, n := range c.args[1:] {
-		if _, ok := s.chunks[hack.String(n)]; ok {
+		if s.lookup(strings.ToLower(hack.String(n))) != nil {
 			ay[i] = int64(1)
 		} else {
 			ay[i] = int64(0)
@@ -190,20 +125,29 @@ func scriptExistsCommand(c *client) error {
 
 func scriptFlushCommand(c *client) error {
 	s := c.app.script
-	l := s.l
 
-	if len(c.args) != 1 {
+	// ASYNC and SYNC are accepted, the flush is always synchronous
+	if len(c.args) > 2 {
 		return ErrCmdParams
 	}
 
-	for n := range s.chunks {
-		l.SetGlobal(n, lua.LNil)
+	s.flush()
+
+	c.resp.writeStatus(OK)
+
+	return nil
+}
+
+func scriptKillCommand(c *client) error {
+	if len(c.args) != 1 {
+		return ErrCmdParams
 	}
 
-	s.chunks = map[string]struct{}{}
+	if err := c.app.script.kill(); err != nil {
+		return err
+	}
 
 	c.resp.writeStatus(OK)
-
 	return nil
 }
 
@@ -3,7 +3,9 @@ package server
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/siddontang/goredis"
 )
@@ -62,3 +64,147 @@ func TestCmdEval(t *testing.T) {
 		t.Fatal(fmt.Sprintf("%v", ay))
 	}
 }
+
+// the scripts hold the write lock of ledis, the commands taking it too
+// must fail instead of blocking the server
+func TestCmdEvalNoScript(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	for _, script := range []string{
+		"return redis.call('fullsync')",
+		"return redis.call('sync', 1)",
+		"return redis.call('slaveof', 'no', 'one')",
+		"return redis.call('bgsave')",
+		"return redis.call('config', 'get', 'addr')",
+	} {
+		if _, err := c.Do("eval", script, 0); err == nil || !strings.Contains(err.Error(), "not allowed from scripts") {
+			t.Fatal(script, err)
+		}
+	}
+
+	for name, spec := range commandTable {
+		if spec.flags&cmdAdmin != 0 && spec.flags&cmdNoScript == 0 {
+			t.Fatalf("admin command %s can be called by scripts", name)
+		}
+	}
+}
+
+func TestCmdEvalAtomic(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	// the writes of a script which raises an error are dropped
+	if _, err := c.Do("eval", "redis.call('set', KEYS[1], '1') redis.call('rpush', KEYS[2], 'a') error('boom')", 2, "atomic_a", "atomic_l"); err == nil {
+		t.Fatal("must error")
+	}
+
+	if n, err := goredis.Int(c.Do("exists", "atomic_a")); err != nil || n != 0 {
+		t.Fatal(n, err)
+	} else if n, err := goredis.Int(c.Do("llen", "atomic_l")); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+
+	// the script reads its writes
+	if v, err := goredis.Strings(c.Do("eval", "redis.call('rpush', KEYS[1], 'a', 'b') redis.call('lpop', KEYS[1]) return redis.call('lrange', KEYS[1], 0, -1)", 1, "atomic_l")); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(v, []string{"b"}) {
+		t.Fatal(v)
+	}
+
+	// and writes into the selected db
+	if v, err := goredis.String(c.Do("eval", "redis.call('select', 3) redis.call('set', KEYS[1], 'x') return redis.call('get', KEYS[1])", 1, "atomic_a")); err != nil {
+		t.Fatal(err)
+	} else if v != "x" {
+		t.Fatal(v)
+	}
+
+	c3 := getTestConn()
+	defer c3.Close()
+	if _, err := c3.Do("select", 3); err != nil {
+		t.Fatal(err)
+	} else if v, err := goredis.String(c3.Do("get", "atomic_a")); err != nil || v != "x" {
+		t.Fatal(v, err)
+	}
+	if _, err := c3.Do("select", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("eval", "return redis.call('eval', 'return 1', 0)", 0); err == nil || !strings.Contains(err.Error(), "not allowed from scripts") {
+		t.Fatal(err)
+	}
+
+	// the others don't see the writes before the end, and writers wait
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Do("eval", "redis.call('set', KEYS[1], '1') local i = 0 while i < 3000000 do i = i + 1 end redis.call('set', KEYS[1], '2')", 1, "atomic_b")
+		done <- err
+	}()
+
+	r := getTestConn()
+	defer r.Close()
+	w := getTestConn()
+	defer w.Close()
+
+	// the loop of the script takes longer
+	time.Sleep(50 * time.Millisecond)
+	if v, err := r.Do("get", "atomic_b"); err != nil || v != nil {
+		t.Fatal(v, err)
+	}
+
+	if _, err := w.Do("set", "atomic_b", "3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.String(r.Do("get", "atomic_b")); err != nil || v != "3" {
+		t.Fatal(v, err)
+	}
+}
+
+func TestCmdEvalLibs(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	tests := []struct {
+		script string
+		result string
+	}{
+		{"return cmsgpack.unpack(cmsgpack.pack({1, 'a', {x = 1.5}}))[3].x == 1.5 and 'ok'", "ok"},
+		{"local a, b = cmsgpack.unpack(cmsgpack.pack(-3, 'b')) return a .. b", "-3b"},
+		{"return cmsgpack.pack({1, 2})", "\x92\x01\x02"},
+		{"return struct.pack('>HB', 258, 3)", "\x01\x02\x03"},
+		{"local a, b, s, pos = struct.unpack('<i2bs', struct.pack('<i2bs', -2, 5, 'xy')) return a .. ' ' .. b .. ' ' .. s .. ' ' .. pos", "-2 5 xy 7"},
+		{"local s = struct.unpack('b c0', struct.pack('b c0', 3, 'abc')) return s", "abc"},
+		{"return tostring(struct.size('!4 b i'))", "8"},
+		{"return bit.tohex(bit.band(0xff, 0x0f)) .. bit.tohex(-1, -4)", "0000000fFFFF"},
+		{"return tostring(bit.bor(1, 2, 4) + bit.lshift(1, 4) + bit.tobit(2^32 + 1))", "24"},
+		{"return tostring(bit.arshift(-256, 4)) .. ' ' .. tostring(bit.rshift(-256, 28))", "-16 15"},
+		{"redis.log(redis.LOG_WARNING, 'from', 'script') return 'ok'", "ok"},
+		{"redis.breakpoint() redis.set_repl(redis.REPL_ALL) return 'ok'", "ok"},
+		{"redis.setresp(3) return tostring(redis.call('get', 'libs_nokey'))", "nil"},
+		{"return tostring(redis.call('get', 'libs_nokey'))", "false"},
+	}
+
+	for _, test := range tests {
+		if v, err := goredis.String(c.Do("eval", test.script, 0)); err != nil {
+			t.Fatal(test.script, err)
+		} else if v != test.result {
+			t.Fatalf("%s: %q != %q", test.script, v, test.result)
+		}
+	}
+
+	for _, script := range []string{
+		"redis.log(9, 'x')",
+		"redis.set_repl(8)",
+		"redis.setresp(4)",
+		"return struct.unpack('i4', 'ab')",
+	} {
+		if _, err := c.Do("eval", script, 0); err == nil {
+			t.Fatal(script, "must error")
+		}
+	}
+}
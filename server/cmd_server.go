@@ -1,14 +1,14 @@
 package server
 
 import (
+	"fmt"
+
 	"github.com/siddontang/go/hack"
 	"github.com/siddontang/go/num"
 
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/r0123r/vredis/config"
 )
 
 func pingCommand(c *client) error {
@@ -16,28 +16,32 @@ func pingCommand(c *client) error {
 	return nil
 }
 
-func defaultAuth(c *config.Config, password string) bool {
-	return c.AuthPassword == password
-}
-
+// AUTH [username] password
 func authCommand(c *client) error {
-	if len(c.args) != 1 {
+	var name, pass string
+	switch len(c.args) {
+	case 1:
+		if c.app.acl.defaultUser() != nil {
+			// no password is set
+			return ErrAuthenticationFailure
+		}
+		name, pass = aclDefaultUser, string(c.args[0])
+	case 2:
+		name, pass = string(c.args[0]), string(c.args[1])
+	default:
 		return ErrCmdParams
 	}
 
-	method := defaultAuth
-	if c.app.cfg.AuthMethod != nil {
-		method = c.app.cfg.AuthMethod
-	}
-
-	if method(c.app.cfg, string(c.args[0])) {
-		c.isAuthed = true
-		c.resp.writeStatus(OK)
-		return nil
-	} else {
-		c.isAuthed = false
+	u := c.app.authenticate(name, pass)
+	if u == nil {
+		c.user = nil
+		c.app.acl.addLog(aclDenyAuth, c.aclContext(), "AUTH", name, c.remoteAddr)
 		return ErrAuthenticationFailure
 	}
+
+	c.user = u
+	c.resp.writeStatus(OK)
+	return nil
 }
 
 func echoCommand(c *client) error {
@@ -57,21 +61,11 @@ func selectCommand(c *client) error {
 	if index, err := strconv.Atoi(hack.String(c.args[0])); err != nil {
 		return err
 	} else {
-		// if c.db.IsInMulti() {
-		// 	if err := c.script.Select(index); err != nil {
-		// 		return err
-		// 	} else {
-		// 		c.db = c.script.DB
-		// 	}
-		// } else {
-		// 	if db, err := c.ldb.Select(index); err != nil {
-		// 		return err
-		// 	} else {
-		// 		c.db = db
-		// 	}
-		// }
-
-		if db, err := c.ldb.Select(index); err != nil {
+		if err := c.app.acl.permitDB(c.user, index, c.aclContext(), c.remoteAddr); err != nil {
+			return err
+		}
+
+		if db, err := c.selectDB(index); err != nil {
 			return err
 		} else {
 			c.db = db
@@ -155,12 +149,62 @@ func configGetCommand(c *client) error {
 	switch key {
 	case "databases":
 		ay = append(ay, []byte("databases"), num.FormatIntToSlice(c.app.cfg.Databases))
+	case "slowlog-log-slower-than":
+		ay = append(ay, []byte(key), num.FormatInt64ToSlice(c.app.slowlog.slowerThan.Get()))
+	case "slowlog-max-len":
+		ay = append(ay, []byte(key), num.FormatIntToSlice(c.app.cfg.SlowlogMaxLen))
+	case "latency-monitor-threshold":
+		ay = append(ay, []byte(key), num.FormatInt64ToSlice(c.app.latency.threshold.Get()))
+	case "lua-time-limit":
+		ay = append(ay, []byte(key), num.FormatInt64ToSlice(c.app.script.timeLimit.Get()))
 	}
 
 	c.resp.writeSliceArray(ay)
 	return nil
 }
 
+func configSetCommand(c *client) error {
+	args := c.args
+	if len(args) != 3 {
+		return ErrCmdParams
+	}
+
+	n, err := strconv.ParseInt(hack.String(args[2]), 10, 64)
+	if err != nil {
+		return ErrValue
+	}
+
+	// the config is updated for CONFIG REWRITE
+	switch strings.ToLower(hack.String(args[1])) {
+	case "slowlog-log-slower-than":
+		c.app.slowlog.slowerThan.Set(n)
+		c.app.cfg.SlowlogLogSlowerThan = n
+	case "slowlog-max-len":
+		if n <= 0 {
+			return ErrValue
+		}
+		c.app.slowlog.setMaxLen(int(n))
+		c.app.cfg.SlowlogMaxLen = int(n)
+	case "latency-monitor-threshold":
+		if n < 0 {
+			return ErrValue
+		}
+		c.app.latency.threshold.Set(n)
+		c.app.cfg.LatencyMonitorThreshold = n
+	case "lua-time-limit":
+		if n < 0 {
+			return ErrValue
+		}
+		c.app.script.timeLimit.Set(n)
+		c.app.cfg.LuaTimeLimit = n
+	default:
+		return fmt.Errorf("unsupported CONFIG parameter: %s", args[1])
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
 func configCommand(c *client) error {
 	if len(c.args) < 1 {
 		return ErrCmdParams
@@ -176,6 +220,12 @@ func configCommand(c *client) error {
 		}
 	case "get":
 		return configGetCommand(c)
+	case "set":
+		return configSetCommand(c)
+	case "resetstat":
+		c.app.info.resetStats()
+		c.resp.writeStatus(OK)
+		return nil
 	default:
 		return ErrCmdParams
 	}
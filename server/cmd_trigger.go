@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/hack"
+)
+
+func triggerCommand(c *client) error {
+	args := c.args
+
+	if len(args) < 1 {
+		return ErrCmdParams
+	}
+
+	if err := c.app.triggers.sync(); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(hack.String(args[0])) {
+	case "register":
+		return triggerRegisterCommand(c)
+	case "list":
+		return triggerListCommand(c)
+	case "unregister":
+		return triggerUnregisterCommand(c)
+	default:
+		return fmt.Errorf("invalid trigger %s", args[0])
+	}
+}
+
+// TRIGGER REGISTER name function pattern [EVENTS event [event ...]]
+func triggerRegisterCommand(c *client) error {
+	args := c.args[1:]
+
+	if len(args) < 3 || len(args) == 4 {
+		return ErrCmdParams
+	}
+
+	t := &trigger{
+		name:     string(args[0]),
+		Function: string(args[1]),
+		Pattern:  string(args[2]),
+		Events:   triggerEvents,
+	}
+
+	if len(args) > 3 {
+		if strings.ToLower(hack.String(args[3])) != "events" {
+			return ErrCmdParams
+		}
+
+		t.Events = nil
+		for _, arg := range args[4:] {
+			event := strings.ToLower(string(arg))
+			if event != ledis.KeyWrite && event != ledis.KeyDel && event != ledis.KeyExpired {
+				return errTriggerEvent
+			}
+			t.Events = append(t.Events, event)
+		}
+	}
+
+	if err := c.app.script.syncFunctions(); err != nil {
+		return err
+	} else if c.app.script.lookupFunction(t.Function) == nil {
+		return errFunctionNotFound
+	}
+
+	t.glob = ledis.CompileGlob(t.Pattern)
+
+	if err := c.app.triggers.save(t.name, t); err != nil {
+		return err
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+func triggerListCommand(c *client) error {
+	if len(c.args) != 1 {
+		return ErrCmdParams
+	}
+
+	triggers := c.app.triggers.list()
+
+	ay := make([]interface{}, len(triggers))
+	for i, t := range triggers {
+		events := make([][]byte, len(t.Events))
+		for j, event := range t.Events {
+			events[j] = hack.Slice(event)
+		}
+
+		ay[i] = []interface{}{
+			[]byte("name"), hack.Slice(t.name),
+			[]byte("function"), hack.Slice(t.Function),
+			[]byte("pattern"), hack.Slice(t.Pattern),
+			[]byte("events"), events,
+		}
+	}
+
+	c.resp.writeArray(ay)
+	return nil
+}
+
+func triggerUnregisterCommand(c *client) error {
+	if len(c.args) != 2 {
+		return ErrCmdParams
+	}
+
+	if err := c.app.triggers.save(string(c.args[1]), nil); err != nil {
+		return err
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+func init() {
+	register("trigger", triggerCommand)
+}
@@ -2,17 +2,450 @@ package server
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
 type CommandFunc func(c *client) error
 
-var regCmds = map[string]CommandFunc{}
+type commandFlag uint32
+
+const (
+	// the command may modify the data
+	cmdWrite commandFlag = 1 << iota
+	// the command only reads the data
+	cmdReadOnly
+	// administrative command, like CONFIG and SLAVEOF
+	cmdAdmin
+	// pub/sub related command
+	cmdPubSub
+	// the command may block the client
+	cmdBlocking
+	// the command can't be called by scripts
+	cmdNoScript
+	// the last key is followed by numkeys and numkeys more keys
+	cmdMovableKeys
+)
+
+var commandFlagNames = []struct {
+	flag commandFlag
+	name string
+}{
+	{cmdWrite, "write"},
+	{cmdReadOnly, "readonly"},
+	{cmdAdmin, "admin"},
+	{cmdPubSub, "pubsub"},
+	{cmdBlocking, "blocking"},
+	{cmdNoScript, "noscript"},
+	{cmdMovableKeys, "movablekeys"},
+}
+
+// commandSpec describes a command the same way as redis COMMAND INFO.
+type commandSpec struct {
+	// the number of arguments including the command name,
+	// -N means at least N arguments
+	arity int
+	flags commandFlag
+
+	// positions of the key arguments, the command name is 0, a negative
+	// lastKey counts from the end, and 0 means the command has no key.
+	firstKey int
+	lastKey  int
+	keyStep  int
+
+	// the data type ACL category, like @string or @keyspace,
+	// other categories are implied by the flags
+	category string
+}
+
+type commandDoc struct {
+	arguments string
+	group     string
+	summary   string
+}
+
+type command struct {
+	commandSpec
+
+	name string
+	fn   CommandFunc
+
+	// registered by RegisterCommand
+	custom bool
+
+	// ACL categories
+	categories []string
+}
+
+// regCmds is the command table, keyed by the lower case command name.
+var regCmds = map[string]*command{}
 
 func register(name string, f CommandFunc) {
-	if _, ok := regCmds[strings.ToLower(name)]; ok {
+	name = strings.ToLower(name)
+	if _, ok := regCmds[name]; ok {
 		panic(fmt.Sprintf("%s has been registered", name))
 	}
 
-	regCmds[name] = f
+	spec, ok := commandTable[name]
+	if !ok {
+		// unknown commands accept any arguments
+		spec = commandSpec{arity: -1}
+	}
+
+	regCmds[name] = newCommand(name, f, spec)
+}
+
+func newCommand(name string, f CommandFunc, spec commandSpec) *command {
+	cmd := &command{commandSpec: spec, name: name, fn: f}
+
+	if len(spec.category) > 0 {
+		cmd.categories = append(cmd.categories, spec.category)
+	}
+
+	for _, v := range []struct {
+		flag       commandFlag
+		categories []string
+	}{
+		{cmdWrite, []string{"@write"}},
+		{cmdReadOnly, []string{"@read"}},
+		{cmdAdmin, []string{"@admin", "@dangerous"}},
+		{cmdPubSub, []string{"@pubsub"}},
+		{cmdBlocking, []string{"@blocking"}},
+	} {
+		if spec.flags&v.flag != 0 {
+			cmd.categories = append(cmd.categories, v.categories...)
+		}
+	}
+
+	return cmd
+}
+
+func (cmd *command) flagNames() []string {
+	names := []string{}
+	for _, v := range commandFlagNames {
+		if cmd.flags&v.flag != 0 {
+			names = append(names, v.name)
+		}
+	}
+	return names
+}
+
+// crossDBCommands reach other databases than the selected one, all of them
+// for -1, or the database of the argument at the index, args does not
+// include the command name.
+var crossDBCommands = map[string]int{
+	"flushall":   -1,
+	"xmigrate":   4,
+	"xmigratedb": 4,
+}
+
+// readOnlySubcommands are the subcommands of the write commands which
+// don't write, they run on the read only servers.
+var readOnlySubcommands = map[string][]string{
+	"function": {"list", "dump"},
+}
+
+// adminSubcommands are the administrative subcommands of the commands
+// which are not flagged cmdAdmin, they are in @admin and @dangerous too.
+var adminSubcommands = map[string][]string{
+	"client": {"kill", "list", "no-evict", "pause", "unpause"},
+}
+
+// admin reports whether the command with the arguments is administrative.
+func (cmd *command) admin(args [][]byte) bool {
+	if cmd.flags&cmdAdmin != 0 {
+		return true
+	} else if len(args) > 0 {
+		for _, sub := range adminSubcommands[cmd.name] {
+			if strings.EqualFold(sub, string(args[0])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// categoriesOf returns the ACL categories of the command with the arguments.
+func (cmd *command) categoriesOf(args [][]byte) []string {
+	if cmd.flags&cmdAdmin == 0 && cmd.admin(args) {
+		return append(cmd.categories[:len(cmd.categories):len(cmd.categories)], "@admin", "@dangerous")
+	}
+	return cmd.categories
+}
+
+// writes reports whether the command with the arguments may modify the data.
+func (cmd *command) writes(args [][]byte) bool {
+	if cmd.flags&cmdWrite == 0 {
+		return false
+	} else if len(args) > 0 {
+		for _, sub := range readOnlySubcommands[cmd.name] {
+			if strings.EqualFold(sub, string(args[0])) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkArity checks the argument count, args does not include the command name.
+func (cmd *command) checkArity(args [][]byte) bool {
+	n := len(args) + 1
+	if cmd.arity >= 0 {
+		return n == cmd.arity
+	}
+	return n >= -cmd.arity
+}
+
+// keys returns the key arguments, args does not include the command name.
+func (cmd *command) keys(args [][]byte) [][]byte {
+	if cmd.firstKey <= 0 || cmd.firstKey > len(args) {
+		return nil
+	}
+
+	last := cmd.lastKey
+	if last < 0 {
+		last = len(args) + 1 + last
+	}
+	if last > len(args) {
+		last = len(args)
+	}
+
+	step := cmd.keyStep
+	if step <= 0 {
+		step = 1
+	}
+
+	var keys [][]byte
+	for i := cmd.firstKey; i <= last; i += step {
+		keys = append(keys, args[i-1])
+	}
+
+	if cmd.flags&cmdMovableKeys != 0 && last < len(args) {
+		// an invalid numkeys fails the command itself
+		n, err := strconv.Atoi(string(args[last]))
+		if err != nil || n < 0 {
+			return keys
+		}
+		if n > len(args)-last-1 {
+			n = len(args) - last - 1
+		}
+		keys = append(keys, args[last+1:last+1+n]...)
+	}
+	return keys
+}
+
+const (
+	catString    = "@string"
+	catBitmap    = "@bitmap"
+	catList      = "@list"
+	catHash      = "@hash"
+	catSet       = "@set"
+	catSortedSet = "@sortedset"
+	catKeyspace  = "@keyspace"
+	catScripting = "@scripting"
+	catConn      = "@connection"
+)
+
+// commandTable describes every built-in command, see commandSpec.
+var commandTable = map[string]commandSpec{
+	// keyspace
+	"del":       {-2, cmdWrite, 1, -1, 1, catKeyspace},
+	"dump":      {2, cmdReadOnly, 1, 1, 1, catKeyspace},
+	"exists":    {2, cmdReadOnly, 1, 1, 1, catKeyspace},
+	"expire":    {3, cmdWrite, 1, 1, 1, catKeyspace},
+	"expireat":  {3, cmdWrite, 1, 1, 1, catKeyspace},
+	"keys":      {2, cmdReadOnly, 0, 0, 0, catKeyspace},
+	"object":    {-2, cmdReadOnly, 2, 2, 1, catKeyspace},
+	"persist":   {2, cmdWrite, 1, 1, 1, catKeyspace},
+	"randomkey": {1, cmdReadOnly, 0, 0, 0, catKeyspace},
+	"rename":    {3, cmdWrite, 1, 2, 1, catKeyspace},
+	"restore":   {4, cmdWrite, 1, 1, 1, catKeyspace},
+	"scan":      {-2, cmdReadOnly, 0, 0, 0, catKeyspace},
+	"ttl":       {2, cmdReadOnly, 1, 1, 1, catKeyspace},
+	"type":      {2, cmdReadOnly, 1, 1, 1, catKeyspace},
+	"xscan":     {-3, cmdReadOnly, 0, 0, 0, catKeyspace},
+	"dbsize":    {1, cmdReadOnly, 0, 0, 0, catKeyspace},
+	"flushdb":   {-1, cmdWrite, 0, 0, 0, catKeyspace},
+	"flushall":  {-1, cmdWrite, 0, 0, 0, catKeyspace},
+
+	// string
+	"append":   {3, cmdWrite, 1, 1, 1, catString},
+	"decr":     {2, cmdWrite, 1, 1, 1, catString},
+	"decrby":   {3, cmdWrite, 1, 1, 1, catString},
+	"get":      {2, cmdReadOnly, 1, 1, 1, catString},
+	"getrange": {4, cmdReadOnly, 1, 1, 1, catString},
+	"getset":   {3, cmdWrite, 1, 1, 1, catString},
+	"incr":     {2, cmdWrite, 1, 1, 1, catString},
+	"incrby":   {3, cmdWrite, 1, 1, 1, catString},
+	"kdump":    {2, cmdReadOnly, 1, 1, 1, catString},
+	"mget":     {-2, cmdReadOnly, 1, -1, 1, catString},
+	"mset":     {-3, cmdWrite, 1, -1, 2, catString},
+	"set":      {-3, cmdWrite, 1, 1, 1, catString},
+	"setex":    {4, cmdWrite, 1, 1, 1, catString},
+	"setnx":    {3, cmdWrite, 1, 1, 1, catString},
+	"setrange": {4, cmdWrite, 1, 1, 1, catString},
+	"strlen":   {2, cmdReadOnly, 1, 1, 1, catString},
+	"bitcount": {-2, cmdReadOnly, 1, 1, 1, catBitmap},
+	"bitop":    {-4, cmdWrite, 2, -1, 1, catBitmap},
+	"bitpos":   {-3, cmdReadOnly, 1, 1, 1, catBitmap},
+	"getbit":   {3, cmdReadOnly, 1, 1, 1, catBitmap},
+	"setbit":   {4, cmdWrite, 1, 1, 1, catBitmap},
+
+	// list
+	"blpop":       {-3, cmdWrite | cmdBlocking | cmdNoScript, 1, -2, 1, catList},
+	"brpop":       {-3, cmdWrite | cmdBlocking | cmdNoScript, 1, -2, 1, catList},
+	"brpoplpush":  {4, cmdWrite | cmdBlocking | cmdNoScript, 1, 2, 1, catList},
+	"lclear":      {2, cmdWrite, 1, 1, 1, catList},
+	"ldump":       {2, cmdReadOnly, 1, 1, 1, catList},
+	"lexpire":     {3, cmdWrite, 1, 1, 1, catList},
+	"lexpireat":   {3, cmdWrite, 1, 1, 1, catList},
+	"lindex":      {3, cmdReadOnly, 1, 1, 1, catList},
+	"lkeyexists":  {2, cmdReadOnly, 1, 1, 1, catList},
+	"llen":        {2, cmdReadOnly, 1, 1, 1, catList},
+	"lmclear":     {-2, cmdWrite, 1, -1, 1, catList},
+	"lpersist":    {2, cmdWrite, 1, 1, 1, catList},
+	"lpop":        {2, cmdWrite, 1, 1, 1, catList},
+	"lpush":       {-3, cmdWrite, 1, 1, 1, catList},
+	"lrange":      {4, cmdReadOnly, 1, 1, 1, catList},
+	"lrem":        {4, cmdWrite, 1, 1, 1, catList},
+	"lset":        {4, cmdWrite, 1, 1, 1, catList},
+	"ltrim":       {4, cmdWrite, 1, 1, 1, catList},
+	"ltrim_back":  {3, cmdWrite, 1, 1, 1, catList},
+	"ltrim_front": {3, cmdWrite, 1, 1, 1, catList},
+	"lttl":        {2, cmdReadOnly, 1, 1, 1, catList},
+	"rpop":        {2, cmdWrite, 1, 1, 1, catList},
+	"rpoplpush":   {3, cmdWrite, 1, 2, 1, catList},
+	"rpush":       {-3, cmdWrite, 1, 1, 1, catList},
+	"xlsort":      {-2, cmdWrite, 1, 1, 1, catList},
+
+	// hash
+	"hclear":     {2, cmdWrite, 1, 1, 1, catHash},
+	"hdel":       {-3, cmdWrite, 1, 1, 1, catHash},
+	"hdump":      {2, cmdReadOnly, 1, 1, 1, catHash},
+	"hexists":    {3, cmdReadOnly, 1, 1, 1, catHash},
+	"hexpire":    {3, cmdWrite, 1, 1, 1, catHash},
+	"hexpireat":  {3, cmdWrite, 1, 1, 1, catHash},
+	"hget":       {3, cmdReadOnly, 1, 1, 1, catHash},
+	"hgetall":    {2, cmdReadOnly, 1, 1, 1, catHash},
+	"hincrby":    {4, cmdWrite, 1, 1, 1, catHash},
+	"hkeyexists": {2, cmdReadOnly, 1, 1, 1, catHash},
+	"hkeys":      {2, cmdReadOnly, 1, 1, 1, catHash},
+	"hlen":       {2, cmdReadOnly, 1, 1, 1, catHash},
+	"hmclear":    {-2, cmdWrite, 1, -1, 1, catHash},
+	"hmget":      {-3, cmdReadOnly, 1, 1, 1, catHash},
+	"hmset":      {-4, cmdWrite, 1, 1, 1, catHash},
+	"hpersist":   {2, cmdWrite, 1, 1, 1, catHash},
+	"hscan":      {-3, cmdReadOnly, 1, 1, 1, catHash},
+	"hset":       {4, cmdWrite, 1, 1, 1, catHash},
+	"httl":       {2, cmdReadOnly, 1, 1, 1, catHash},
+	"hvals":      {2, cmdReadOnly, 1, 1, 1, catHash},
+	"xhscan":     {-3, cmdReadOnly, 1, 1, 1, catHash},
+
+	// set
+	"sadd":        {-3, cmdWrite, 1, 1, 1, catSet},
+	"scard":       {2, cmdReadOnly, 1, 1, 1, catSet},
+	"sclear":      {2, cmdWrite, 1, 1, 1, catSet},
+	"sdiff":       {-2, cmdReadOnly, 1, -1, 1, catSet},
+	"sdiffstore":  {-3, cmdWrite, 1, -1, 1, catSet},
+	"sdump":       {2, cmdReadOnly, 1, 1, 1, catSet},
+	"sexpire":     {3, cmdWrite, 1, 1, 1, catSet},
+	"sexpireat":   {3, cmdWrite, 1, 1, 1, catSet},
+	"sinter":      {-2, cmdReadOnly, 1, -1, 1, catSet},
+	"sinterstore": {-3, cmdWrite, 1, -1, 1, catSet},
+	"sismember":   {3, cmdReadOnly, 1, 1, 1, catSet},
+	"skeyexists":  {2, cmdReadOnly, 1, 1, 1, catSet},
+	"smclear":     {-2, cmdWrite, 1, -1, 1, catSet},
+	"smembers":    {2, cmdReadOnly, 1, 1, 1, catSet},
+	"spersist":    {2, cmdWrite, 1, 1, 1, catSet},
+	"srem":        {-3, cmdWrite, 1, 1, 1, catSet},
+	"sscan":       {-3, cmdReadOnly, 1, 1, 1, catSet},
+	"sttl":        {2, cmdReadOnly, 1, 1, 1, catSet},
+	"sunion":      {-2, cmdReadOnly, 1, -1, 1, catSet},
+	"sunionstore": {-3, cmdWrite, 1, -1, 1, catSet},
+	"xsscan":      {-3, cmdReadOnly, 1, 1, 1, catSet},
+	"xssort":      {-2, cmdWrite, 1, 1, 1, catSet},
+
+	// sorted set
+	"xzscan":           {-3, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"xzsort":           {-2, cmdWrite, 1, 1, 1, catSortedSet},
+	"zadd":             {-4, cmdWrite, 1, 1, 1, catSortedSet},
+	"zcard":            {2, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zclear":           {2, cmdWrite, 1, 1, 1, catSortedSet},
+	"zcount":           {4, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zdump":            {2, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zexpire":          {3, cmdWrite, 1, 1, 1, catSortedSet},
+	"zexpireat":        {3, cmdWrite, 1, 1, 1, catSortedSet},
+	"zincrby":          {4, cmdWrite, 1, 1, 1, catSortedSet},
+	"zinterstore":      {-4, cmdWrite | cmdMovableKeys, 1, 1, 1, catSortedSet},
+	"zkeyexists":       {2, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zlexcount":        {4, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zmclear":          {-2, cmdWrite, 1, -1, 1, catSortedSet},
+	"zpersist":         {2, cmdWrite, 1, 1, 1, catSortedSet},
+	"zrange":           {-4, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zrangebylex":      {-4, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zrangebyscore":    {-4, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zrank":            {3, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zrem":             {-3, cmdWrite, 1, 1, 1, catSortedSet},
+	"zremrangebylex":   {4, cmdWrite, 1, 1, 1, catSortedSet},
+	"zremrangebyrank":  {4, cmdWrite, 1, 1, 1, catSortedSet},
+	"zremrangebyscore": {4, cmdWrite, 1, 1, 1, catSortedSet},
+	"zrevrange":        {-4, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zrevrangebyscore": {-4, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zrevrank":         {3, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zscan":            {-3, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zscore":           {3, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zttl":             {2, cmdReadOnly, 1, 1, 1, catSortedSet},
+	"zunionstore":      {-4, cmdWrite | cmdMovableKeys, 1, 1, 1, catSortedSet},
+
+	// migration
+	"xdump":      {3, cmdReadOnly, 2, 2, 1, catKeyspace},
+	"xrestore":   {5, cmdWrite, 2, 2, 1, catKeyspace},
+	"xmigrate":   {7, cmdWrite, 4, 4, 1, catKeyspace},
+	"xmigratedb": {7, cmdWrite, 0, 0, 0, catKeyspace},
+
+	// pub/sub
+	"publish":    {3, cmdPubSub, 0, 0, 0, ""},
+	"subscribe":  {-2, cmdPubSub | cmdNoScript, 0, 0, 0, ""},
+	"psubscribe": {-2, cmdPubSub | cmdNoScript, 0, 0, 0, ""},
+
+	// scripting
+	"eval":     {-3, cmdNoScript, 0, 0, 0, catScripting},
+	"evalsha":  {-3, cmdNoScript, 0, 0, 0, catScripting},
+	"script":   {-2, cmdNoScript, 0, 0, 0, catScripting},
+	"fcall":    {-3, cmdNoScript, 0, 0, 0, catScripting},
+	"fcall_ro": {-3, cmdNoScript, 0, 0, 0, catScripting},
+	"function": {-2, cmdWrite | cmdNoScript, 0, 0, 0, catScripting},
+	"trigger":  {-2, cmdAdmin | cmdNoScript, 0, 0, 0, catScripting},
+	"schedule": {-2, cmdAdmin | cmdNoScript, 0, 0, 0, catScripting},
+
+	// connection
+	"auth":   {-2, 0, 0, 0, 0, catConn},
+	"echo":   {2, 0, 0, 0, 0, catConn},
+	"ping":   {-1, 0, 0, 0, 0, catConn},
+	"health": {1, 0, 0, 0, 0, catConn},
+	"select": {2, 0, 0, 0, 0, catConn},
+
+	// server, the admin commands can't be called by scripts, which hold
+	// the write lock of ledis, the admin subcommands of CLIENT are in
+	// adminSubcommands
+	"acl":     {-2, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"client":  {-2, cmdNoScript, 0, 0, 0, catConn},
+	"command": {-1, 0, 0, 0, 0, catConn},
+	"config":  {-2, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"info":    {-1, 0, 0, 0, 0, ""},
+	"latency": {-2, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"memory":  {-2, cmdReadOnly, 2, 2, 1, ""},
+	"monitor": {1, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"role":    {1, 0, 0, 0, 0, ""},
+	"slowlog": {-2, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"time":    {1, 0, 0, 0, 0, ""},
+
+	// replication
+	"bgsave":   {1, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"fullsync": {-1, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"lastsave": {1, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"replconf": {-1, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"save":     {1, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"slaveof":  {-3, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
+	"sync":     {2, cmdAdmin | cmdNoScript, 0, 0, 0, ""},
 }
@@ -0,0 +1,154 @@
+// This file was generated by .tools/generate_commands.py on Mon Oct 19 2026 15:39:49 +0000
+package server
+
+var commandDocs = map[string]commandDoc{
+	"acl":              {"subcommand [arg ...]", "Server", "Manage the ACL users"},
+	"append":           {"key value", "KV", ""},
+	"auth":             {"[username] password", "Server", "Authenticate the connection"},
+	"bgsave":           {"", "Server", "Create a snapshot as `SAVE` does, in background"},
+	"bitcount":         {"key [start] [end]", "KV", ""},
+	"bitop":            {"operation destkey key [key ...]", "KV", ""},
+	"bitpos":           {"key bit [start] [end]", "KV", ""},
+	"blpop":            {"key [key ...] timeout", "List", "BLPOP is a blocking list pop primitive"},
+	"brpop":            {"key [key ...] timeout", "List", "See [BLPOP key [key ...] timeout](#blpop-key-key--timeout) for more information"},
+	"client":           {"subcommand [arg ...]", "Server", "Inspect and manage the client connections"},
+	"command":          {"[COUNT|LIST|INFO|DOCS|GETKEYS] [arg ...]", "Server", "Return details about the commands, the same way as redis"},
+	"decr":             {"key", "KV", "Decrements the number stored at key by one"},
+	"decrby":           {"key decrement", "KV", "Decrements the number stored at key by decrement"},
+	"del":              {"key [key ...]", "KV", "Removes the specified keys"},
+	"dump":             {"key", "KV", "Serialize the value stored at key with KV type in a Redis-specific format like RDB and return it to the user"},
+	"echo":             {"message", "Server", "Returns message"},
+	"eval":             {"script numkeys key [key ...] arg [arg ...]", "Script", ""},
+	"evalsha":          {"sha1 numkeys key [key ...] arg [arg ...]", "Script", ""},
+	"exists":           {"key", "KV", "Returns if key exists"},
+	"expire":           {"key seconds", "KV", "Set a timeout on key"},
+	"expireat":         {"key timestamp", "KV", "Set an expired unix timestamp on key"},
+	"fcall":            {"function numkeys [key ...] [arg ...]", "Script", "Call a function of a loaded library, with the keys and the arguments as its two table arguments"},
+	"fcall_ro":         {"function numkeys [key ...] [arg ...]", "Script", "Like FCALL, for the functions registered with the `no-writes` flag only"},
+	"flushall":         {"-", "Server", "Delete all the keys of all the existing databases and replication logs, not just the currently selected one"},
+	"flushdb":          {"-", "Server", "Delete all the keys of the currently selected DB"},
+	"fullsync":         {"[NEW]", "Replication", "Inner command, starts a fullsync from the master set by SLAVEOF"},
+	"get":              {"key", "KV", "Get the value of key"},
+	"getbit":           {"key offset", "KV", ""},
+	"getrange":         {"key start end", "KV", ""},
+	"getset":           {"key value", "KV", "Atomically sets key to value and returns the old value stored at key"},
+	"hclear":           {"key", "Hash", "Deletes the specified hash key"},
+	"hdel":             {"key field [field ...]", "Hash", "Removes the specified fiedls from the hash stored at key"},
+	"hdump":            {"key", "Hash", "See [DUMP](#dump-key) for more information"},
+	"health":           {"-", "Server", "Report whether the node is alive and ready to serve"},
+	"hexists":          {"key field", "Hash", "Returns if field is an existing field in the hash stored at key"},
+	"hexpire":          {"key seconds", "Hash", "Sets a hash key's time to live in seconds, like expire similarly"},
+	"hexpireat":        {"key timestamp", "Hash", "Sets the expiration for a hash key as a unix timestamp, like expireat similarly"},
+	"hget":             {"key field", "Hash", "Returns the value associated with field in the hash stored at key"},
+	"hgetall":          {"key", "Hash", "Returns all fields and values of the hash stored at key"},
+	"hincrby":          {"key field increment", "Hash", "Increments the number stored at field in the hash stored at key by increment"},
+	"hkeyexists":       {"key", "Hash", "Check key exists for hash data, like [EXISTS key](#exists-key)"},
+	"hkeys":            {"key", "Hash", "Return all fields in the hash stored at key"},
+	"hlen":             {"key", "Hash", "Returns the number of fields contained in the hash stored at key"},
+	"hmclear":          {"key [key ...]", "Hash", "Deletes the specified hash keys"},
+	"hmget":            {"key field [field ...]", "Hash", "Returns the values associated with the specified fields in the hash stored at key"},
+	"hmset":            {"key field value [field value ...]", "Hash", "Sets the specified fields to their respective values in the hash stored at key"},
+	"hpersist":         {"key", "Hash", "Remove the expiration from a hash key, like persist similarly"},
+	"hscan":            {"key cursor [MATCH match] [COUNT count] [ASC|DESC]", "Hash", "Same like XHSCAN, but made redis compatible"},
+	"hset":             {"key field value", "Hash", "Sets field in the hash stored at key to value"},
+	"httl":             {"key", "Hash", "Returns the remaining time to live of a key that has a timeout"},
+	"hvals":            {"key", "Hash", "Returns all values in the hash stored at key"},
+	"incr":             {"key", "KV", "Increments the number stored at key by one"},
+	"incrby":           {"key increment", "KV", "Increments the number stored at key by increment"},
+	"info":             {"[section]", "Server", "Return information and statistic about the server in a format that is simple to parse by computers and easy to read by humans"},
+	"lastsave":         {"", "Server", "The unix time of the latest snapshot, or of the server start if there is none"},
+	"latency":          {"subcommand [arg ...]", "Server", "Report the latency spikes, the events that took at least `latency_monitor_threshold` milliseconds (0 by default, which disables the monitor, it can be changed with `CONFIG SET latency-monitor-threshold <ms>`)"},
+	"lclear":           {"key", "List", "Deletes the specified list key"},
+	"ldump":            {"key", "List", "See [DUMP](#dump-key) for more information"},
+	"lexpire":          {"key seconds", "List", "Set a timeout on key"},
+	"lexpireat":        {"key timestamp", "List", "Set an expired unix timestamp on key"},
+	"lindex":           {"key index", "List", "Returns the element at index index in the list stored at key"},
+	"lkeyexists":       {"key", "List", "Check key exists for list data, like [EXISTS key](#exists-key)"},
+	"llen":             {"key", "List", "Returns the length of the list stored at key"},
+	"lmclear":          {"key [key ...]", "List", "Delete multiple keys from list"},
+	"lpersist":         {"key", "List", "Remove the existing timeout on key"},
+	"lpop":             {"key", "List", "Removes and returns the first element of the list stored at key"},
+	"lpush":            {"key value [value ...]", "List", "Insert all the specified values at the head of the list stored at key"},
+	"lrange":           {"key start stop", "List", "Returns the specified elements of the list stored at key"},
+	"lttl":             {"key", "List", "Returns the remaining time to live of a key that has a timeout"},
+	"memory":           {"USAGE key [SAMPLES count]", "Server", "Return the number of bytes the key takes in the store: its meta entry, every member entry and the expire entries, all in their encoded form"},
+	"mget":             {"key [key ...]", "KV", "Returns the values of all specified keys"},
+	"monitor":          {"", "Server", "Switch the RESP connection to the monitor mode, it receives a line for every command executed by the RESP, HTTP, FTP and Lua clients, with the unix time in microseconds, the DB index and the client address (`lua` for the commands called by scripts, `ftp:` followed by the address for the FTP operations, which are reported as the equivalent commands)"},
+	"mset":             {"key value [key value ...]", "KV", "Sets the given keys to their respective values"},
+	"object":           {"subcommand key", "Server", "Inspect the internals of the key"},
+	"persist":          {"key", "KV", "Remove the existing timeout on key"},
+	"ping":             {"-", "Server", "Returns PONG"},
+	"randomkey":        {"", "Server", "Return a random key from the currently selected database"},
+	"restore":          {"key ttl value", "Server", "Create a key associated with a value that is obtained by deserializing the provided serialized value (obtained via DUMP, LDUMP, HDUMP, SDUMP, ZDUMP)"},
+	"role":             {"-", "Server", "Provide information on the role of an intance in the context of replication"},
+	"rpop":             {"key", "List", "Removes and returns the last element of the list stored at key"},
+	"rpush":            {"key value [value ...]", "List", "Insert all the specified values at the tail of the list stored at key"},
+	"sadd":             {"key member [member ...]", "Set", "Add the specified members to the set stored at key"},
+	"save":             {"", "Server", "Create a snapshot of all the databases in the `[snapshot]` path, the one `FULLSYNC` sends to the replicas, the oldest ones past `max_num` are removed"},
+	"scard":            {"key", "Set", "Returns the set cardinality (number of elements) of the set stored at key"},
+	"sclear":           {"key", "Set", "Deletes the specified set key"},
+	"sdiff":            {"key [key ...]", "Set", "Returns the members of the set resulting from the difference between the first set and all the successive sets"},
+	"sdiffstore":       {"destination key [key ...]", "Set", "This command is equal to `SDIFF`, but instead of returning the resulting set, it is stored in destination"},
+	"sdump":            {"key", "Set", "See [DUMP](#dump-key) for more information"},
+	"select":           {"index", "Server", "Select the DB with having the specified zero-based numeric index"},
+	"set":              {"key value [EX seconds]", "KV", "Set key to the value"},
+	"setbit":           {"key offset value", "KV", "## Hash"},
+	"setex":            {"key seconds value", "KV", "Set key to hold the string value and set key to timeout after a given number of seconds"},
+	"setnx":            {"key value", "KV", "Set key to the value if key does not exist"},
+	"setrange":         {"key offset value", "KV", ""},
+	"sexpire":          {"key seconds", "Set", "Sets a set key’s time to live in seconds, like expire similarly"},
+	"sexpireat":        {"key timestamp", "Set", "Sets the expiration for a set key as a unix timestamp, like expireat similarly"},
+	"sinter":           {"key [key ...]", "Set", "Returns the members of the set resulting from the intersection of all the given sets"},
+	"sinterstore":      {"destination key [key ...]", "Set", "This command is equal to `SINTER`, but instead of returning the resulting set, it is stored in destination"},
+	"sismember":        {"key member", "Set", "Returns if member is a member of the set stored at key"},
+	"skeyexists":       {"key", "Set", "Check key exists for set data, like [EXISTS key](#exists-key)"},
+	"slaveof":          {"host port [RESTART] [READONLY]", "Replication", "Changes the replication settings of a slave on the fly"},
+	"slowlog":          {"subcommand [arg]", "Server", "Read or reset the slow log, the latest commands whose execution took longer than `slowlog_log_slower_than` microseconds (10000 by default, 0 logs every command and a negative value disables it)"},
+	"smclear":          {"key [key ...]", "Set", "Deletes the specified set keys"},
+	"smembers":         {"key", "Set", "Returns all the members of the set value stored at key"},
+	"spersist":         {"key", "Set", "Remove the expiration from a set key, like persist similarly"},
+	"srem":             {"key member [member ...]", "Set", "Remove the specified members from the set stored at key"},
+	"sscan":            {"key cursor [MATCH match] [COUNT count] [ASC|DESC]", "Set", "Same like XSSCAN, but made redis compatible"},
+	"strlen":           {"key", "KV", ""},
+	"sttl":             {"key", "Set", "Returns the remaining time to live of a key that has a timeout"},
+	"sunion":           {"key [key ...]", "Set", "Returns the members of the set resulting from the union of all the given sets"},
+	"sunionstore":      {"destination key [key ...]", "Set", "This command is equal to SUNION, but instead of returning the resulting set, it is stored in destination"},
+	"sync":             {"logid", "Replication", "Inner command, syncs the new changed from master set by SLAVEOF with logid"},
+	"time":             {"-", "Server", "The TIME command returns the current server time as a two items lists: a Unix timestamp and the amount of microseconds already elapsed in the current second"},
+	"ttl":              {"key", "KV", "Returns the remaining time to live of a key that has a timeout"},
+	"xhscan":           {"key cursor [MATCH match] [COUNT count] [ASC|DESC]", "Hash", "Same like XSCAN, but return array of elements"},
+	"xlsort":           {"key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC|DESC] [ALPHA] [STORE destination]", "List", "Returns or stores the elements contained in the list at key"},
+	"xscan":            {"type cursor [MATCH match] [COUNT count] [ASC|DESC]", "Server", "Iterate data type keys incrementally"},
+	"xsscan":           {"key cursor [MATCH match] [COUNT count] [ASC|DESC]", "Set", "Same like XSCAN"},
+	"xssort":           {"key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC|DESC] [ALPHA] [STORE destination]", "Set", "Returns or stores the elements contained in the set at key"},
+	"xzscan":           {"key cursor [MATCH match] [COUNT count] [ASC|DESC]", "ZSet", "Same like XSCAN, but return array of elements"},
+	"xzsort":           {"key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC|DESC] [ALPHA] [STORE destination]", "ZSet", "Returns or stores the elements contained in the zset at key"},
+	"zadd":             {"key score member [score member ...]", "ZSet", "Adds all the specified members with the specified scores to the sorted set stored at key"},
+	"zcard":            {"key", "ZSet", "Returns the sorted set cardinality (number of elements) of the sorted set stored at key"},
+	"zclear":           {"key", "ZSet", "Delete the specified  key"},
+	"zcount":           {"key min max", "ZSet", "Returns the number of elements in the sorted set at key with a score between `min` and `max`"},
+	"zdump":            {"key", "ZSet", "See [DUMP](#dump-key) for more information"},
+	"zexpire":          {"key seconds", "ZSet", "Set a timeout on key"},
+	"zexpireat":        {"key timestamp", "ZSet", "Set an expired unix timestamp on key"},
+	"zincrby":          {"key increment member", "ZSet", "Increments the score of member in the sorted set stored at key by increment"},
+	"zinterstore":      {"destkey numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]", "ZSet", "Computes the intersection of numkeys sorted sets given by the specified keys, and stores the result in destination"},
+	"zkeyexists":       {"key", "ZSet", "Check key exists for zset data, like [EXISTS key](#exists-key)"},
+	"zlexcount":        {"key min max", "ZSet", "Returns the number of elements in the sorted set at key with a value between min and max"},
+	"zmclear":          {"key [key ...]", "ZSet", "Delte multiple keys one time"},
+	"zpersist":         {"key", "ZSet", "Remove the existing timeout on key"},
+	"zrange":           {"key start stop [WITHSCORES]", "ZSet", "Returns the specified range of elements in the sorted set stored at key"},
+	"zrangebylex":      {"key min max [LIMIT offset count]", "ZSet", "When all the elements in a sorted set are inserted with the same score, in order to force lexicographical ordering, this command returns all the elements in the sorted set at key with a value between min and max"},
+	"zrangebyscore":    {"key min max [WITHSCORES] [LIMIT offset count]", "ZSet", "Returns all the elements in the sorted set at key with a score between `min` and `max` (including elements with score equal to `min` or `max`)"},
+	"zrank":            {"key member", "ZSet", "Returns the rank of member in the sorted set stored at key, with the scores ordered from low to high"},
+	"zrem":             {"key member [member ...]", "ZSet", "Removes the specified members from the sorted set stored at key"},
+	"zremrangbylex":    {"key min max", "ZSet", ""},
+	"zremrangebyrank":  {"key start stop", "ZSet", "Removes all elements in the sorted set stored at key with rank between start and stop"},
+	"zremrangebyscore": {"key min max", "ZSet", "Removes all elements in the sorted set stored at key with a score between `min` and `max` (inclusive)"},
+	"zrevrange":        {"key start stop [WITHSCORES]", "ZSet", "Returns the specified range of elements in the sorted set stored at key"},
+	"zrevrangebyscore": {"key max min  [WITHSCORES][LIMIT offset count]", "ZSet", "Returns all the elements in the sorted set at key with a score between max and min (including elements with score equal to max or min)"},
+	"zrevrank":         {"key member", "ZSet", "Returns the rank of member in the sorted set stored at key, with the scores ordered from high to low"},
+	"zscan":            {"key cursor [MATCH match] [COUNT count] [ASC|DESC]", "ZSet", "Same like XZSCAN, but made redis compatible"},
+	"zscore":           {"key member", "ZSet", "Returns the score of member in the sorted set at key"},
+	"zttl":             {"key", "ZSet", "Returns the remaining time to live of a key that has a timeout"},
+	"zunionstore":      {"destkey numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]", "ZSet", "Computes the union of numkeys sorted sets given by the specified keys, and stores the result in destination"},
+}
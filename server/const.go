@@ -16,6 +16,7 @@ var (
 	ErrSyntax                = errors.New("syntax error")
 	ErrOffset                = errors.New("offset bit is not an natural number")
 	ErrBool                  = errors.New("value is not 0 or 1")
+	ErrReadOnlyReplica       = errors.New("READONLY You can't write against a read only replica.")
 )
 
 var (
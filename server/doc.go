@@ -37,4 +37,23 @@
 //  curl http://127.0.0.1:11181/0/GET/hello?type=json
 //  → {"GET":"world"}
 //
+// Custom Commands
+//
+// Programs embedding the server can add their own commands before the app runs,
+// they work over RESP, HTTP and Lua like the built-in ones:
+//
+//  server.RegisterCommand(server.CommandSpec{
+//      Name:     "HELLO",
+//      Arity:    2,
+//      Flags:    []string{"readonly"},
+//      FirstKey: 1, LastKey: 1, KeyStep: 1,
+//  }, func(ctx *server.Context) error {
+//      v, err := ctx.DB().Get(ctx.Args()[0])
+//      if err != nil {
+//          return err
+//      }
+//      ctx.Writer().WriteBulk(append([]byte("hello "), v...))
+//      return nil
+//  })
+//
 package server
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/r0123r/vredis/ledis"
+)
+
+var (
+	errCommandsFrozen = errors.New("commands must be registered before the app runs")
+	errCommandName    = errors.New("empty command name")
+)
+
+// commandsFrozen is set when the first app runs, the command table
+// is read without lock after that.
+var commandsFrozen int32
+
+// ResponseWriter writes the reply of a command, it works the same way
+// for RESP, HTTP and Lua clients.
+type ResponseWriter interface {
+	WriteError(err error)
+	WriteStatus(status string)
+	WriteInteger(n int64)
+	// WriteBulk writes a bulk string, nil writes a null bulk
+	WriteBulk(b []byte)
+	// WriteArray writes an array of []byte, int64, string (as status),
+	// error, nil, [][]byte or nested []interface{} values
+	WriteArray(lst []interface{})
+	WriteSliceArray(lst [][]byte)
+	WriteFVPairArray(lst []ledis.FVPair)
+	WriteScorePairArray(lst []ledis.ScorePair, withScores bool)
+}
+
+type responseWriterWrapper struct {
+	w responseWriter
+}
+
+func (w responseWriterWrapper) WriteError(err error)      { w.w.writeError(err) }
+func (w responseWriterWrapper) WriteStatus(status string) { w.w.writeStatus(status) }
+func (w responseWriterWrapper) WriteInteger(n int64)      { w.w.writeInteger(n) }
+func (w responseWriterWrapper) WriteBulk(b []byte)        { w.w.writeBulk(b) }
+
+func (w responseWriterWrapper) WriteArray(lst []interface{}) { w.w.writeArray(lst) }
+
+func (w responseWriterWrapper) WriteSliceArray(lst [][]byte) { w.w.writeSliceArray(lst) }
+
+func (w responseWriterWrapper) WriteFVPairArray(lst []ledis.FVPair) { w.w.writeFVPairArray(lst) }
+
+func (w responseWriterWrapper) WriteScorePairArray(lst []ledis.ScorePair, withScores bool) {
+	w.w.writeScorePairArray(lst, withScores)
+}
+
+// Context is the request context of a custom command.
+type Context struct {
+	c *client
+}
+
+// Command returns the lower case command name.
+func (ctx *Context) Command() string {
+	return ctx.c.cmd
+}
+
+// Args returns the command arguments, without the command name.
+// The arguments are only valid until the handler returns.
+func (ctx *Context) Args() [][]byte {
+	return ctx.c.args
+}
+
+// DB returns the database selected by the client.
+func (ctx *Context) DB() *ledis.DB {
+	return ctx.c.db
+}
+
+// Ledis returns the ledis instance of the app. When the command is called
+// by a script or a trigger, Tx is not nil and the script holds the write
+// lock of ledis: Begin and the other calls taking the lock deadlock, use
+// DB or Select instead. Its writes don't fire the triggers, use Update.
+func (ctx *Context) Ledis() *ledis.Ledis {
+	return ctx.c.ldb
+}
+
+// Update calls f with the selected database in a Tx, and fires the
+// triggers of its writes. The write commands and the scripts run in a Tx
+// firing the triggers already, f is called in their Tx.
+func (ctx *Context) Update(f func(db *ledis.DB) error) error {
+	if ctx.c.tx != nil {
+		return f(ctx.c.db)
+	}
+	return ctx.c.app.Update(ctx.c.db.Index(), f)
+}
+
+// Tx returns the Tx of the script or the trigger calling the command, nil
+// for the other clients.
+func (ctx *Context) Tx() *ledis.Tx {
+	return ctx.c.tx
+}
+
+// Select returns the database of the index, in the Tx of the calling
+// script if there is one.
+func (ctx *Context) Select(index int) (*ledis.DB, error) {
+	return ctx.c.selectDB(index)
+}
+
+// RemoteAddr returns the client address, empty for Lua scripts.
+func (ctx *Context) RemoteAddr() string {
+	return ctx.c.remoteAddr
+}
+
+// Writer returns the response writer of the client.
+func (ctx *Context) Writer() ResponseWriter {
+	return responseWriterWrapper{ctx.c.resp}
+}
+
+// Handler handles a custom command. If it returns an error, the error
+// is written as the reply and nothing must have been written before.
+type Handler func(ctx *Context) error
+
+// CommandSpec describes a custom command, the same way as COMMAND INFO.
+type CommandSpec struct {
+	Name string
+
+	// the number of arguments including the command name,
+	// -N means at least N arguments, 0 means any
+	Arity int
+
+	// write, readonly, admin, pubsub or blocking.
+	// Write commands are rejected on read only replicas.
+	Flags []string
+
+	// positions of the key arguments, the command name is 0, a negative
+	// LastKey counts from the end, and 0 means the command has no key.
+	FirstKey int
+	LastKey  int
+	KeyStep  int
+
+	// ACL categories, like @string, the ones implied by the flags are added
+	Categories []string
+
+	// for COMMAND DOCS
+	Summary   string
+	Arguments string
+}
+
+// RegisterCommand registers a custom command. It must be called before
+// any App runs, and the command name must not be registered yet.
+func RegisterCommand(spec CommandSpec, h Handler) error {
+	if atomic.LoadInt32(&commandsFrozen) != 0 {
+		return errCommandsFrozen
+	}
+
+	name := strings.ToLower(spec.Name)
+	if len(name) == 0 {
+		return errCommandName
+	} else if _, ok := regCmds[name]; ok {
+		return fmt.Errorf("%s has been registered", name)
+	}
+
+	s := commandSpec{
+		arity:    spec.Arity,
+		firstKey: spec.FirstKey,
+		lastKey:  spec.LastKey,
+		keyStep:  spec.KeyStep,
+	}
+
+	if s.arity == 0 {
+		s.arity = -1
+	}
+
+	for _, f := range spec.Flags {
+		flag, ok := parseCommandFlag(f)
+		if !ok {
+			return fmt.Errorf("invalid command flag %s", f)
+		}
+		s.flags |= flag
+	}
+
+	cmd := newCommand(name, func(c *client) error {
+		return h(&Context{c})
+	}, s)
+
+	cmd.custom = true
+	cmd.categories = append(append([]string{}, spec.Categories...), cmd.categories...)
+
+	regCmds[name] = cmd
+	commandDocs[name] = commandDoc{spec.Arguments, "Module", spec.Summary}
+
+	return nil
+}
+
+func parseCommandFlag(name string) (commandFlag, bool) {
+	for _, v := range commandFlagNames {
+		if strings.EqualFold(v.name, name) {
+			return v.flag, true
+		}
+	}
+	return 0, false
+}
+
+func freezeCommands() {
+	atomic.StoreInt32(&commandsFrozen, 1)
+}
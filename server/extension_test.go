@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/siddontang/goredis"
+)
+
+func init() {
+	// xappend key value [value ...], append the values to the string key
+	err := RegisterCommand(CommandSpec{
+		Name:       "XAPPEND",
+		Arity:      -3,
+		Flags:      []string{"write"},
+		FirstKey:   1,
+		LastKey:    1,
+		KeyStep:    1,
+		Categories: []string{"@string"},
+		Summary:    "Append the values to the key",
+		Arguments:  "key value [value ...]",
+	}, func(ctx *Context) error {
+		args := ctx.Args()
+
+		v, err := ctx.DB().Get(args[0])
+		if err != nil {
+			return err
+		}
+
+		v = append(v, bytes.Join(args[1:], nil)...)
+		if err = ctx.DB().Set(args[0], v); err != nil {
+			return err
+		}
+
+		ctx.Writer().WriteBulk(v)
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	c.Do("del", "ext_key")
+
+	if v, err := goredis.String(c.Do("xappend", "ext_key", "a", "b")); err != nil {
+		t.Fatal(err)
+	} else if v != "ab" {
+		t.Fatal(v)
+	}
+
+	if _, err := c.Do("xappend", "ext_key"); err == nil {
+		t.Fatal("must arity error")
+	}
+
+	if v, err := goredis.String(c.Do("eval", `return ledis.call("xappend", KEYS[1], ARGV[1])`, 1, "ext_key", "c")); err != nil {
+		t.Fatal(err)
+	} else if v != "abc" {
+		t.Fatal(v)
+	}
+
+	r, err := http.Get("http://127.0.0.1:21181/XAPPEND/ext_key/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+
+	var v struct {
+		Data string `json:"XAPPEND"`
+	}
+	if err = json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	} else if v.Data != "abcd" {
+		t.Fatal(v.Data)
+	}
+
+	if ay, err := goredis.Values(c.Do("command", "info", "xappend")); err != nil {
+		t.Fatal(err)
+	} else if info, _ := goredis.Values(ay[0], nil); len(info) != 7 {
+		t.Fatal(info)
+	} else if cats := statusStrings(info[6]); len(cats) != 2 || cats[0] != "@string" || cats[1] != "@write" {
+		t.Fatal(cats)
+	}
+
+	if err := RegisterCommand(CommandSpec{Name: "get"}, nil); err == nil {
+		t.Fatal("must duplicated error")
+	}
+
+	freezeCommands()
+	if err := RegisterCommand(CommandSpec{Name: "xappend2"}, nil); err != errCommandsFrozen {
+		t.Fatal(err)
+	}
+}
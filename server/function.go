@@ -0,0 +1,423 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/log"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// The function libraries are kept in the meta space, so they survive the
+// restarts and are replicated. The version key changes with every change,
+// the servers reload the libraries when it is not the one they loaded.
+const (
+	functionLibPrefix  = "function:lib:"
+	functionVersionKey = "function:version"
+
+	// the top level code of a library only registers its functions
+	functionLoadTimeout = 500 * time.Millisecond
+)
+
+var (
+	errFunctionNotFound = errors.New("ERR Function not found")
+	errLibraryNotFound  = errors.New("ERR Library not found")
+	errFunctionWrite    = errors.New("ERR Can not execute a script with write flag using *_ro command.")
+	errFunctionNoName   = errors.New("ERR Library name was not given")
+	errFunctionNoFuncs  = errors.New("ERR No functions registered")
+)
+
+var functionFlags = map[string]bool{
+	"no-writes":             true,
+	"allow-oom":             true,
+	"allow-stale":           true,
+	"no-cluster":            true,
+	"allow-cross-slot-keys": true,
+}
+
+type function struct {
+	name  string
+	lib   *functionLib
+	desc  string
+	flags []string
+
+	noWrites bool
+}
+
+type functionLib struct {
+	name  string
+	code  []byte
+	proto *lua.FunctionProto
+
+	// sorted by name
+	funcs []*function
+}
+
+// functionLoad collects the functions registered by a library.
+type functionLoad struct {
+	lib       *functionLib
+	funcs     []*function
+	callbacks map[string]*lua.LFunction
+}
+
+func validFunctionName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLibraryMeta parses the "#!lua name=<library>" first line, the
+// returned body has an empty first line to keep the line numbers.
+func parseLibraryMeta(code []byte) (string, []byte, error) {
+	line := code
+	body := []byte{}
+	if n := bytes.IndexByte(code, '\n'); n >= 0 {
+		line = code[:n]
+		body = code[n:]
+	}
+
+	if !bytes.HasPrefix(line, []byte("#!")) {
+		return "", nil, errors.New("ERR Missing library metadata")
+	}
+
+	fields := strings.Fields(string(line[2:]))
+	if len(fields) == 0 || strings.ToLower(fields[0]) != "lua" {
+		engine := ""
+		if len(fields) > 0 {
+			engine = fields[0]
+		}
+		return "", nil, fmt.Errorf("ERR Engine '%s' not found", engine)
+	}
+
+	name := ""
+	for _, field := range fields[1:] {
+		if !strings.HasPrefix(field, "name=") {
+			return "", nil, fmt.Errorf("ERR Invalid metadata value given: %s", field)
+		}
+		name = field[len("name="):]
+	}
+
+	if len(name) == 0 {
+		return "", nil, errFunctionNoName
+	} else if !validFunctionName(name) {
+		return "", nil, errors.New("ERR Library names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+
+	return name, body, nil
+}
+
+// compileLibrary compiles the library, and runs it once for its functions.
+func (s *script) compileLibrary(code []byte) (*functionLib, error) {
+	name, body, err := parseLibraryMeta(code)
+	if err != nil {
+		return nil, err
+	}
+
+	chunk, err := parse.Parse(bytes.NewReader(body), name)
+	if err != nil {
+		return nil, fmt.Errorf("ERR Error compiling function: %v", err)
+	}
+
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, fmt.Errorf("ERR Error compiling function: %v", err)
+	}
+
+	lib := &functionLib{name: name, code: code, proto: proto}
+
+	ls := s.get()
+	defer s.put(ls)
+
+	ctx, cancel := context.WithTimeout(context.Background(), functionLoadTimeout)
+	ls.l.SetContext(ctx)
+	defer func() {
+		ls.l.RemoveContext()
+		cancel()
+	}()
+
+	env := ls.l.NewTable()
+	ls.l.SetMetatable(env, ls.envMeta)
+
+	load, err := ls.loadLibrary(lib, env)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.New("ERR FUNCTION LOAD timeout")
+		} else if e, ok := err.(*lua.ApiError); ok {
+			return nil, fmt.Errorf("ERR Error registering functions: %s", e.Object.String())
+		}
+		return nil, err
+	} else if len(load.funcs) == 0 {
+		return nil, errFunctionNoFuncs
+	}
+
+	lib.funcs = load.funcs
+	sort.Slice(lib.funcs, func(i, j int) bool { return lib.funcs[i].name < lib.funcs[j].name })
+
+	return lib, nil
+}
+
+// loadLibrary runs the top level code of the library in env, and returns
+// the registered functions.
+func (ls *luaState) loadLibrary(lib *functionLib, env *lua.LTable) (*functionLoad, error) {
+	load := &functionLoad{lib: lib, callbacks: make(map[string]*lua.LFunction)}
+
+	ls.loading = load
+	defer func() {
+		ls.loading = nil
+	}()
+
+	l := ls.l
+	l.Push(&lua.LFunction{Env: env, Proto: lib.proto, Upvalues: make([]*lua.Upvalue, 0)})
+	if err := l.PCall(0, 0, nil); err != nil {
+		return nil, err
+	}
+
+	return load, nil
+}
+
+// redis.register_function(name, callback) or
+// redis.register_function{function_name=name, callback=callback, flags={...}, description=text}
+func luaRegisterFunction(l *lua.LState) int {
+	ls := getMapState(l)
+	if ls == nil || ls.loading == nil {
+		panic("redis.register_function can only be called on FUNCTION LOAD command")
+	}
+
+	load := ls.loading
+	f := &function{lib: load.lib}
+	var callback *lua.LFunction
+
+	switch l.GetTop() {
+	case 1:
+		t, ok := l.Get(1).(*lua.LTable)
+		if !ok {
+			panic("calling redis.register_function with a single argument is only applicable to Lua table")
+		}
+
+		t.ForEach(func(k lua.LValue, v lua.LValue) {
+			switch lua.LVAsString(k) {
+			case "function_name":
+				f.name = lua.LVAsString(v)
+			case "callback":
+				callback, _ = v.(*lua.LFunction)
+			case "description":
+				f.desc = lua.LVAsString(v)
+			case "flags":
+				flags, ok := v.(*lua.LTable)
+				if !ok {
+					panic("flags argument to redis.register_function must be a table representing function flags")
+				}
+				flags.ForEach(func(_ lua.LValue, flag lua.LValue) {
+					name := lua.LVAsString(flag)
+					if !functionFlags[name] {
+						panic("unknown flag given")
+					}
+					f.flags = append(f.flags, name)
+					if name == "no-writes" {
+						f.noWrites = true
+					}
+				})
+			default:
+				panic("unknown argument given to redis.register_function")
+			}
+		})
+	case 2:
+		f.name = lua.LVAsString(l.Get(1))
+		callback, _ = l.Get(2).(*lua.LFunction)
+	default:
+		panic("wrong number of arguments to redis.register_function")
+	}
+
+	if !validFunctionName(f.name) {
+		panic("Function names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	} else if callback == nil {
+		panic("callback argument given to redis.register_function must be a function")
+	} else if _, ok := load.callbacks[f.name]; ok {
+		panic("Function already exists in the library")
+	}
+
+	load.callbacks[f.name] = callback
+	load.funcs = append(load.funcs, f)
+
+	return 0
+}
+
+// fcall calls the function in a state of the pool.
+func (s *script) fcall(c *client, f *function, keys [][]byte, argv [][]byte, readonly bool) (interface{}, error) {
+	if readonly && !f.noWrites {
+		return nil, errFunctionWrite
+	}
+
+	return s.exec(c, f.noWrites, func(ls *luaState, env *lua.LTable) error {
+		return ls.callFunction(f, keys, argv)
+	})
+}
+
+// library returns the callbacks of the library, it is run once in every
+// state for each version of the library, in its own globals.
+func (ls *luaState) library(lib *functionLib) (*functionLoad, error) {
+	if load, ok := ls.loaded[lib.name]; ok && load.lib == lib {
+		return load, nil
+	}
+
+	// forget the replaced and deleted libraries
+	s := ls.c.app.script
+	for name, load := range ls.loaded {
+		if s.lookupLibrary(name) != load.lib {
+			delete(ls.loaded, name)
+		}
+	}
+
+	env := ls.l.NewTable()
+	ls.l.SetMetatable(env, ls.envMeta)
+
+	load, err := ls.loadLibrary(lib, env)
+	if err != nil {
+		return nil, err
+	}
+
+	ls.loaded[lib.name] = load
+	return load, nil
+}
+
+// callFunction calls the function with the callbacks of its library.
+func (ls *luaState) callFunction(f *function, keys [][]byte, argv [][]byte) error {
+	load, err := ls.library(f.lib)
+	if err != nil {
+		return err
+	}
+
+	callback, ok := load.callbacks[f.name]
+	if !ok {
+		return errFunctionNotFound
+	}
+
+	l := ls.l
+	l.Push(callback)
+	l.Push(luaNewArray(l, keys))
+	l.Push(luaNewArray(l, argv))
+	return l.PCall(2, lua.MultRet, nil)
+}
+
+// syncFunctions reloads the libraries if they were changed in the meta
+// space, by another server through the replication or before a restart.
+func (s *script) syncFunctions() error {
+	version, items, ok, err := s.funcReg.changed()
+	if err != nil || !ok {
+		return err
+	}
+
+	libs := make(map[string]*functionLib, len(items))
+	for _, item := range items {
+		lib, err := s.compileLibrary(item.Value)
+		if err != nil {
+			log.Errorf("load function library %s error %s", s.funcReg.name(item.Key), err.Error())
+			continue
+		}
+		libs[lib.name] = lib
+	}
+
+	s.setLibraries(version, libs)
+	return nil
+}
+
+func (s *script) setLibraries(version []byte, libs map[string]*functionLib) {
+	funcs := make(map[string]*function)
+	for _, lib := range libs {
+		for _, f := range lib.funcs {
+			funcs[f.name] = f
+		}
+	}
+
+	s.funcLock.Lock()
+	s.libs = libs
+	s.funcs = funcs
+	s.funcLock.Unlock()
+
+	s.funcReg.use(version)
+}
+
+// libraries returns a copy of the libraries, to be changed and saved.
+func (s *script) libraries() map[string]*functionLib {
+	s.funcLock.RLock()
+	defer s.funcLock.RUnlock()
+
+	libs := make(map[string]*functionLib, len(s.libs))
+	for name, lib := range s.libs {
+		libs[name] = lib
+	}
+	return libs
+}
+
+func (s *script) lookupLibrary(name string) *functionLib {
+	s.funcLock.RLock()
+	defer s.funcLock.RUnlock()
+
+	return s.libs[name]
+}
+
+func (s *script) lookupFunction(name string) *function {
+	s.funcLock.RLock()
+	defer s.funcLock.RUnlock()
+
+	return s.funcs[name]
+}
+
+// checkFunctionNames checks that no function is in two libraries.
+func checkFunctionNames(libs map[string]*functionLib) error {
+	names := make(map[string]bool)
+	for _, lib := range libs {
+		for _, f := range lib.funcs {
+			if names[f.name] {
+				return fmt.Errorf("ERR Function %s already exists", f.name)
+			}
+			names[f.name] = true
+		}
+	}
+	return nil
+}
+
+// saveLibraries replaces the libraries by libs in the meta space, in one batch.
+func (s *script) saveLibraries(libs map[string]*functionLib) error {
+	if err := checkFunctionNames(libs); err != nil {
+		return err
+	}
+
+	var items []ledis.MetaItem
+
+	s.funcLock.RLock()
+	for name := range s.libs {
+		if _, ok := libs[name]; !ok {
+			items = append(items, ledis.MetaItem{Key: s.funcReg.key(name)})
+		}
+	}
+	for name, lib := range libs {
+		if s.libs[name] != lib {
+			items = append(items, ledis.MetaItem{Key: s.funcReg.key(name), Value: lib.code})
+		}
+	}
+	s.funcLock.RUnlock()
+
+	version, err := s.funcReg.update(items...)
+	if err != nil {
+		return err
+	}
+
+	s.setLibraries(version, libs)
+	return nil
+}
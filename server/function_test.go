@@ -0,0 +1,240 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+const testFunctionLib = `#!lua name=mylib
+local function set(keys, args)
+	return redis.call('set', keys[1], args[1])
+end
+
+redis.register_function('myset', set)
+redis.register_function{
+	function_name = 'myget',
+	callback = function(keys, args) return redis.call('get', keys[1]) end,
+	flags = {'no-writes'},
+	description = 'get a key'
+}
+redis.register_function{
+	function_name = 'badget',
+	callback = function(keys, args) return redis.call('set', keys[1], 'x') end,
+	flags = {'no-writes'}
+}
+`
+
+func TestFunction(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_function"
+	cfg.Addr = "127.0.0.1:11204"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+
+	c := goredis.NewClient(cfg.Addr, "")
+
+	if v, err := goredis.String(c.Do("function", "load", testFunctionLib)); err != nil {
+		t.Fatal(err)
+	} else if v != "mylib" {
+		t.Fatal(v)
+	}
+
+	if _, err := c.Do("function", "load", testFunctionLib); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatal(err)
+	} else if _, err := c.Do("function", "load", "replace", testFunctionLib); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("function", "load", "return 1"); err == nil {
+		t.Fatal("must error")
+	} else if _, err := c.Do("function", "load", "#!lua name=other\nredis.register_function('myset', function() end)"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatal(err)
+	} else if _, err := c.Do("function", "load", "#!lua name=other\nredis.call('set', 'a', '1')"); err == nil {
+		t.Fatal("must error")
+	} else if _, err := c.Do("function", "load", "#!lua name=other\nwhile true do end"); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.String(c.Do("fcall", "myset", 1, "fa", "1")); err != nil {
+		t.Fatal(err)
+	} else if v != OK {
+		t.Fatal(v)
+	} else if v, err := goredis.String(c.Do("fcall_ro", "myget", 1, "fa")); err != nil {
+		t.Fatal(err)
+	} else if v != "1" {
+		t.Fatal(v)
+	}
+
+	if _, err := c.Do("fcall_ro", "myset", 1, "fa", "2"); err == nil || !strings.Contains(err.Error(), "write flag") {
+		t.Fatal(err)
+	} else if _, err := c.Do("fcall", "badget", 1, "fa"); err == nil || !strings.Contains(err.Error(), "read-only scripts") {
+		t.Fatal(err)
+	} else if _, err := c.Do("fcall", "nofunc", 0); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatal(err)
+	}
+
+	ay, err := goredis.MultiBulk(c.Do("function", "list", "withcode"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 1 {
+		t.Fatal(len(ay))
+	}
+	lib := ay[0].([]interface{})
+	if string(lib[1].([]byte)) != "mylib" {
+		t.Fatal(lib)
+	} else if funcs := lib[5].([]interface{}); len(funcs) != 3 {
+		t.Fatal(funcs)
+	} else if f := funcs[1].([]interface{}); string(f[1].([]byte)) != "myget" || string(f[3].([]byte)) != "get a key" {
+		t.Fatal(f)
+	} else if string(lib[7].([]byte)) != testFunctionLib {
+		t.Fatal(lib[7])
+	}
+
+	if ay, err := goredis.MultiBulk(c.Do("function", "list", "libraryname", "no*")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 0 {
+		t.Fatal(ay)
+	}
+
+	dump, err := goredis.Bytes(c.Do("function", "dump"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("function", "delete", "mylib"); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Do("function", "delete", "mylib"); err == nil {
+		t.Fatal("must error")
+	} else if _, err := c.Do("fcall", "myset", 1, "fa", "1"); err == nil {
+		t.Fatal("must error")
+	}
+
+	if _, err := c.Do("function", "restore", dump); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Do("function", "restore", dump); err == nil {
+		t.Fatal("must error")
+	} else if _, err := c.Do("function", "restore", dump, "replace"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a library runs once in a state, not for every call
+	counter := "#!lua name=counter\nlocal n = 0\nredis.register_function('countn', function() n = n + 1 return n end)"
+	if _, err := c.Do("function", "load", counter); err != nil {
+		t.Fatal(err)
+	} else if n, err := goredis.Int(c.Do("fcall", "countn", 0)); err != nil || n != 1 {
+		t.Fatal(n, err)
+	} else if n, err := goredis.Int(c.Do("fcall", "countn", 0)); err != nil || n != 2 {
+		t.Fatal(n, err)
+	} else if _, err := c.Do("function", "load", "replace", counter); err != nil {
+		t.Fatal(err)
+	} else if n, err := goredis.Int(c.Do("fcall", "countn", 0)); err != nil || n != 1 {
+		t.Fatal(n, err)
+	} else if _, err := c.Do("function", "delete", "counter"); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the subcommands which change the libraries are writes
+	cfg.SetReadonly(true)
+	if _, err := goredis.MultiBulk(c.Do("function", "list")); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Do("function", "flush"); err == nil {
+		t.Fatal("must error")
+	}
+	cfg.SetReadonly(false)
+
+	// the libraries survive a restart
+	c.Close()
+	s.Close()
+
+	if s, err = NewApp(cfg, ""); err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+
+	c = goredis.NewClient(cfg.Addr, "")
+
+	if v, err := goredis.String(c.Do("fcall", "myget", 1, "fa")); err != nil {
+		t.Fatal(err)
+	} else if v != "1" {
+		t.Fatal(v)
+	}
+
+	if _, err := c.Do("function", "flush"); err != nil {
+		t.Fatal(err)
+	} else if ay, err := goredis.MultiBulk(c.Do("function", "list")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 0 {
+		t.Fatal(ay)
+	}
+
+	c.Close()
+	s.Close()
+}
+
+func TestFunctionReplication(t *testing.T) {
+	dataDir := "/tmp/test_function_replication"
+	os.RemoveAll(dataDir)
+
+	masterCfg := config.NewConfigDefault()
+	masterCfg.DataDir = fmt.Sprintf("%s/master", dataDir)
+	masterCfg.Addr = "127.0.0.1:11205"
+	masterCfg.UseReplication = true
+
+	master, err := NewApp(masterCfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	slaveCfg := config.NewConfigDefault()
+	slaveCfg.DataDir = fmt.Sprintf("%s/slave", dataDir)
+	slaveCfg.Addr = "127.0.0.1:11206"
+	slaveCfg.SlaveOf = masterCfg.Addr
+	slaveCfg.UseReplication = true
+	slaveCfg.Readonly = true
+
+	slave, err := NewApp(slaveCfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	go master.Run()
+	time.Sleep(1 * time.Second)
+	go slave.Run()
+
+	mc := goredis.NewClient(masterCfg.Addr, "")
+	defer mc.Close()
+
+	if _, err := mc.Do("function", "load", testFunctionLib); err != nil {
+		t.Fatal(err)
+	} else if _, err := mc.Do("fcall", "myset", 1, "fa", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1 * time.Second)
+	slave.ldb.WaitReplication()
+
+	sc := goredis.NewClient(slaveCfg.Addr, "")
+	defer sc.Close()
+
+	if v, err := goredis.String(sc.Do("fcall_ro", "myget", 1, "fa")); err != nil {
+		t.Fatal(err)
+	} else if v != "1" {
+		t.Fatal(v)
+	} else if _, err := sc.Do("function", "flush"); err == nil {
+		t.Fatal("must error")
+	}
+}
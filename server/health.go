@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/r0123r/vredis/rpl"
+)
+
+type healthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+
+	// only the liveness checks decide whether the node is alive
+	live bool
+}
+
+type healthReport struct {
+	Live   bool          `json:"live"`
+	Ready  bool          `json:"ready"`
+	Role   string        `json:"role"`
+	Checks []healthCheck `json:"checks"`
+}
+
+func (r *healthReport) add(name string, live bool, err error) {
+	h := healthCheck{Name: name, OK: err == nil, live: live}
+	if err != nil {
+		h.Detail = err.Error()
+		r.Ready = false
+		if live {
+			r.Live = false
+		}
+	}
+	r.Checks = append(r.Checks, h)
+}
+
+// listenerFailed records that l stopped accepting, which fails the liveness.
+func (app *App) listenerFailed(l net.Listener, err error) {
+	app.listenerErrs.Store(l, err)
+}
+
+// checkListeners checks that the RESP, HTTP and metrics listeners still
+// accept. It doesn't connect to them, the probe would be counted in
+// total_connections_received and listed by CLIENT LIST.
+func (app *App) checkListeners() error {
+	for _, l := range []net.Listener{app.listener, app.httpListener, app.metricsListener} {
+		if l == nil {
+			continue
+		}
+
+		if err, ok := app.listenerErrs.Load(l); ok {
+			return fmt.Errorf("listener %s: %v", l.Addr(), err)
+		}
+	}
+	return nil
+}
+
+// health checks whether the node is alive, the store and the listeners are
+// up, and whether it is ready to serve, connected to its master, not in a
+// full sync and not lagging too far behind it as a slave, writable as a
+// master.
+func (app *App) health() *healthReport {
+	r := &healthReport{Live: true, Ready: true, Role: "master"}
+
+	// liveness
+	var err error
+	select {
+	case <-app.quit:
+		err = fmt.Errorf("server is closing")
+	default:
+		err = app.checkListeners()
+	}
+	r.add("listener", true, err)
+
+	err = nil
+	if db, e := app.ldb.Select(0); e != nil {
+		err = e
+	} else if _, e := db.Exists([]byte("health")); e != nil {
+		err = fmt.Errorf("store: %v", e)
+	}
+	r.add("store", true, err)
+
+	// readiness
+	app.m.Lock()
+	slave := len(app.cfg.SlaveOf) > 0
+	app.m.Unlock()
+
+	var rs *rpl.Stat
+	var rerr error
+	if app.ldb.ReplicationUsed() {
+		rs, rerr = app.ldb.ReplicationStat()
+	}
+
+	if slave {
+		r.Role = "slave"
+
+		err = nil
+		if state := app.m.state.Get(); state == replConnectState || state == replConnectingState {
+			err = fmt.Errorf("master link is down")
+		}
+		r.add("link", false, err)
+
+		err = nil
+		if app.m.fullSyncing.Get() {
+			err = fmt.Errorf("full sync from the master in progress")
+		}
+		r.add("sync", false, err)
+
+		err = rerr
+		if rs != nil {
+			masterLast := app.info.Replication.MasterLastLogID.Get()
+			if masterLast > rs.CommitID && masterLast-rs.CommitID > uint64(app.cfg.Replication.ReadyMaxLag) {
+				err = fmt.Errorf("%d logs behind the master, more than %d", masterLast-rs.CommitID, app.cfg.Replication.ReadyMaxLag)
+			}
+		}
+		r.add("lag", false, err)
+	} else {
+		err = nil
+		if app.cfg.GetReadonly() {
+			err = fmt.Errorf("master is read only")
+		}
+		r.add("writable", false, err)
+	}
+
+	return r
+}
+
+func (app *App) writeHealth(w http.ResponseWriter, ok bool, r *healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(r)
+}
+
+// /healthz, only the liveness checks
+func (app *App) healthzHandler(w http.ResponseWriter, req *http.Request) {
+	r := app.health()
+
+	checks := r.Checks[:0]
+	for _, h := range r.Checks {
+		if h.live {
+			checks = append(checks, h)
+		}
+	}
+	r.Checks = checks
+
+	app.writeHealth(w, r.Live, r)
+}
+
+// /readyz
+func (app *App) readyzHandler(w http.ResponseWriter, req *http.Request) {
+	r := app.health()
+	app.writeHealth(w, r.Ready, r)
+}
+
+// HEALTH
+func healthCommand(c *client) error {
+	r := c.app.health()
+
+	checks := make([]interface{}, len(r.Checks))
+	for i, h := range r.Checks {
+		status := "ok"
+		if !h.OK {
+			status = "fail"
+		}
+		checks[i] = []interface{}{[]byte(h.Name), []byte(status), []byte(h.Detail)}
+	}
+
+	c.resp.writeArray([]interface{}{
+		[]byte("live"), int64(boolGauge(r.Live)),
+		[]byte("ready"), int64(boolGauge(r.Ready)),
+		[]byte("role"), []byte(r.Role),
+		[]byte("checks"), checks,
+	})
+	return nil
+}
+
+func init() {
+	register("health", healthCommand)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func getHealth(t *testing.T, url string) (int, *healthReport) {
+	code, body := httpGetBody(t, url)
+
+	r := new(healthReport)
+	if err := json.Unmarshal([]byte(body), r); err != nil {
+		t.Fatal(err, body)
+	}
+	return code, r
+}
+
+func TestHealth(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_health"
+	cfg.Addr = "127.0.0.1:11200"
+	cfg.HttpAddr = "127.0.0.1:11201"
+	cfg.UseReplication = true
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	if code, r := getHealth(t, "http://"+cfg.HttpAddr+"/healthz"); code != http.StatusOK || !r.Live || len(r.Checks) != 2 {
+		t.Fatal(code, r)
+	}
+	if code, r := getHealth(t, "http://"+cfg.HttpAddr+"/readyz"); code != http.StatusOK || !r.Ready || r.Role != "master" {
+		t.Fatal(code, r)
+	}
+
+	c, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if v, err := goredis.Values(c.Do("health")); err != nil {
+		t.Fatal(err)
+	} else if len(v) != 8 {
+		t.Fatal(v)
+	} else if ready, _ := goredis.Int(v[3], nil); ready != 1 {
+		t.Fatal(v)
+	} else if checks, _ := goredis.Values(v[7], nil); len(checks) != 3 {
+		t.Fatal(checks)
+	}
+
+	// a read only master is alive but not ready
+	cfg.SetReadonly(true)
+
+	if code, _ := getHealth(t, "http://"+cfg.HttpAddr+"/healthz"); code != http.StatusOK {
+		t.Fatal(code)
+	}
+	if code, r := getHealth(t, "http://"+cfg.HttpAddr+"/readyz"); code != http.StatusServiceUnavailable || r.Ready {
+		t.Fatal(code, r)
+	}
+
+	if v, err := goredis.Values(c.Do("health")); err != nil {
+		t.Fatal(err)
+	} else if ready, _ := goredis.Int(v[3], nil); ready != 0 {
+		t.Fatal(v)
+	}
+
+	cfg.SetReadonly(false)
+
+	// a slave far behind its master
+	s.m.Lock()
+	cfg.SlaveOf = "127.0.0.1:1"
+	s.m.Unlock()
+	s.info.Replication.MasterLastLogID.Set(5000)
+
+	// the master link is down
+	if r := s.health(); r.Ready {
+		t.Fatal(r)
+	}
+	s.m.state.Set(replConnectedState)
+
+	r := s.health()
+	if r.Ready || !r.Live || r.Role != "slave" {
+		t.Fatal(r)
+	}
+	for _, h := range r.Checks {
+		if h.Name == "lag" && (h.OK || !strings.Contains(h.Detail, "5000 logs behind")) {
+			t.Fatal(h)
+		}
+	}
+
+	s.info.Replication.MasterLastLogID.Set(10)
+	if r := s.health(); !r.Ready {
+		t.Fatal(r)
+	}
+
+	// streaming the logs is not a full sync
+	s.m.state.Set(replSyncState)
+	if r := s.health(); !r.Ready {
+		t.Fatal(r)
+	}
+	s.m.fullSyncing.Set(true)
+	if r := s.health(); r.Ready {
+		t.Fatal(r)
+	}
+	s.m.fullSyncing.Set(false)
+	s.m.state.Set(replConnectState)
+
+	// the check doesn't connect to the listeners
+	conns := s.info.Stats.TotalConnections.Get()
+	if r := s.health(); !r.Live {
+		t.Fatal(r)
+	} else if n := s.info.Stats.TotalConnections.Get(); n != conns {
+		t.Fatal(n, conns)
+	}
+
+	// a listener which doesn't accept
+	s.httpListener.Close()
+	for i := 0; ; i++ {
+		if r := s.health(); !r.Live && !r.Ready {
+			break
+		} else if i == 50 {
+			t.Fatal(r)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.m.Lock()
+	cfg.SlaveOf = ""
+	s.m.Unlock()
+}
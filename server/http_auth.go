@@ -0,0 +1,171 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/r0123r/vredis/config"
+)
+
+// The HTTP endpoints, with their own command rules.
+const (
+	httpEndpointCommand   = "command"
+	httpEndpointBatch     = "batch"
+	httpEndpointKV        = "kv"
+	httpEndpointSubscribe = "subscribe"
+)
+
+var httpEndpoints = []string{httpEndpointCommand, httpEndpointBatch, httpEndpointKV, httpEndpointSubscribe}
+
+var (
+	errHTTPNoAuth      = errors.New("authentication required")
+	errHTTPAuthScheme  = errors.New("unsupported authorization scheme, only Basic and Bearer are supported")
+	errHTTPInvalidAuth = errors.New("invalid credentials")
+)
+
+// httpAuth authenticates the HTTP requests, and checks the commands of
+// the endpoints.
+type httpAuth struct {
+	// the user names by token
+	tokens map[string]string
+
+	// the command rules of each endpoint, as the rules of a user
+	endpoints map[string]*aclUser
+}
+
+// newHTTPAuth loads the tokens and the endpoint rules of the http config
+// section, each token is "user token", and the commands of each endpoint
+// are "endpoint rule ...", the rules of "*" apply to all the endpoints.
+func newHTTPAuth(cfg *config.HTTPConfig) (*httpAuth, error) {
+	h := new(httpAuth)
+
+	h.tokens = make(map[string]string, len(cfg.Tokens))
+	for _, line := range cfg.Tokens {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		} else if len(fields) != 2 {
+			return nil, fmt.Errorf("http token must be \"user token\": %q", line)
+		}
+		h.tokens[fields[1]] = fields[0]
+	}
+
+	h.endpoints = make(map[string]*aclUser, len(httpEndpoints))
+	for _, name := range httpEndpoints {
+		u := newACLUser(name)
+		u.applyRule("allcommands")
+		h.endpoints[name] = u
+	}
+
+	// the rules of all the endpoints first
+	for _, all := range []bool{true, false} {
+		for _, line := range cfg.Commands {
+			fields := strings.Fields(line)
+			if len(fields) == 0 || (fields[0] == "*") != all {
+				continue
+			}
+
+			var users []*aclUser
+			if all {
+				for _, name := range httpEndpoints {
+					users = append(users, h.endpoints[name])
+				}
+			} else if u, ok := h.endpoints[fields[0]]; ok {
+				users = append(users, u)
+			} else {
+				return nil, fmt.Errorf("unknown http endpoint '%s'", fields[0])
+			}
+
+			for _, rule := range fields[1:] {
+				if err := checkHTTPRule(rule); err != nil {
+					return nil, err
+				}
+				for _, u := range users {
+					if err := u.applyRule(rule); err != nil {
+						return nil, fmt.Errorf("http endpoint %s: %v", fields[0], err)
+					}
+				}
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// checkHTTPRule accepts the command rules only.
+func checkHTTPRule(rule string) error {
+	switch strings.ToLower(rule) {
+	case "allcommands", "nocommands":
+		return nil
+	}
+
+	if len(rule) > 0 && (rule[0] == '+' || rule[0] == '-') {
+		return nil
+	}
+	return fmt.Errorf("invalid http command rule '%s'", rule)
+}
+
+// permit checks whether the command can be called on the endpoint, the
+// unknown commands are reported by perform.
+func (h *httpAuth) permit(endpoint string, name string, args [][]byte) error {
+	cmd, ok := regCmds[name]
+	if !ok {
+		return nil
+	}
+
+	if !h.endpoints[endpoint].canRun(cmd, args) {
+		return fmt.Errorf("unsupported command: '%s'", name)
+	}
+	return nil
+}
+
+// httpUser returns the user of the request: by the Authorization header, or
+// by the common name of the client certificate, or the default user if it
+// needs no password.
+func (app *App) httpUser(r *http.Request) (*aclUser, error) {
+	var name string
+	var u *aclUser
+
+	if auth := r.Header.Get("Authorization"); len(auth) > 0 {
+		scheme := auth
+		if i := strings.IndexByte(auth, ' '); i >= 0 {
+			scheme = auth[:i]
+		}
+
+		switch strings.ToLower(scheme) {
+		case "basic":
+			var pass string
+			var ok bool
+			if name, pass, ok = r.BasicAuth(); !ok {
+				return nil, errHTTPInvalidAuth
+			}
+			u = app.authenticate(name, pass)
+		case "bearer":
+			name = app.httpAuth.tokens[strings.TrimSpace(auth[len(scheme):])]
+			if len(name) > 0 {
+				u = app.acl.user(name)
+			}
+		default:
+			return nil, errHTTPAuthScheme
+		}
+	} else if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		name = r.TLS.VerifiedChains[0][0].Subject.CommonName
+		u = app.acl.user(name)
+	} else if u = app.acl.defaultUser(); u == nil {
+		return nil, errHTTPNoAuth
+	}
+
+	if u == nil {
+		app.acl.addLog(aclDenyAuth, "http", "AUTH", name, r.RemoteAddr)
+		return nil, errHTTPInvalidAuth
+	}
+	return u, nil
+}
+
+// writeHTTPAuthError replies 401 to the requests failing authentication.
+func writeHTTPAuthError(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="vredis"`)
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
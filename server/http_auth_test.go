@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+)
+
+// newTestCert creates a certificate signed by parent, self signed if
+// parent is nil, and writes it and its key as PEM files.
+func newTestCert(t *testing.T, dir string, name string, tmpl *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := tmpl, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(path.Join(dir, name+".crt"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(path.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert.Leaf, _ = x509.ParseCertificate(der)
+	return cert
+}
+
+func TestHttpAuth(t *testing.T) {
+	dir := "/tmp/test_http_auth"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+
+	ca := newTestCert(t, dir, "ca", &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	newTestCert(t, dir, "server", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	client := newTestCert(t, dir, "client", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "certuser"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = path.Join(dir, "data")
+	cfg.Addr = "127.0.0.1:11209"
+	cfg.HttpAddr = "127.0.0.1:11210"
+	cfg.AuthPassword = "secret"
+	cfg.ACL.Users = []string{
+		"reader on >rpass ~* +@read alldbs",
+		"certuser on ~* +@all alldbs",
+	}
+	cfg.HTTP.Tokens = []string{"reader tok1"}
+	cfg.HTTP.Commands = []string{"* -slaveof -fullsync -sync", "batch -@write"}
+	cfg.TLS = config.TLS{
+		Enabled:     true,
+		Certificate: path.Join(dir, "server.crt"),
+		Key:         path.Join(dir, "server.key"),
+		ClientCA:    path.Join(dir, "ca.crt"),
+	}
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	go s.Run()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	do := func(cert *tls.Certificate, method string, uri string, auth string, body string) (int, string) {
+		tlsCfg := &tls.Config{RootCAs: roots}
+		if cert != nil {
+			tlsCfg.Certificates = []tls.Certificate{*cert}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+
+		req, err := http.NewRequest(method, "https://"+cfg.HttpAddr+uri, bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatal(err)
+		} else if len(auth) > 0 {
+			req.Header.Set("Authorization", auth)
+		}
+
+		r, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+
+		b, _ := ioutil.ReadAll(r.Body)
+		return r.StatusCode, strings.TrimSpace(string(b))
+	}
+
+	basic := func(user, pass string) string {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(user, pass)
+		return req.Header.Get("Authorization")
+	}
+
+	if code, _ := do(nil, "GET", "/get/a", "", ""); code != http.StatusUnauthorized {
+		t.Fatal(code)
+	} else if code, _ := do(nil, "GET", "/get/a", basic("default", "wrong"), ""); code != http.StatusUnauthorized {
+		t.Fatal(code)
+	} else if code, _ := do(nil, "GET", "/get/a", "Digest x", ""); code != http.StatusUnauthorized {
+		t.Fatal(code)
+	} else if code, _ := do(nil, "GET", "/get/a", "Bearer nope", ""); code != http.StatusUnauthorized {
+		t.Fatal(code)
+	}
+
+	if _, b := do(nil, "GET", "/set/a/1", basic("default", "secret"), ""); b != `{"set":[true,"OK"]}` {
+		t.Fatal(b)
+	} else if _, b := do(nil, "GET", "/get/a", basic("reader", "rpass"), ""); b != `{"get":"1"}` {
+		t.Fatal(b)
+	} else if _, b := do(nil, "GET", "/get/a", "Bearer tok1", ""); b != `{"get":"1"}` {
+		t.Fatal(b)
+	} else if _, b := do(nil, "GET", "/set/a/2", "Bearer tok1", ""); !strings.Contains(b, "NOPERM") {
+		t.Fatal(b)
+	}
+
+	// the client certificate authenticates its common name
+	if _, b := do(&client, "GET", "/set/a/3", "", ""); b != `{"set":[true,"OK"]}` {
+		t.Fatal(b)
+	} else if code, _ := do(&ca, "GET", "/get/a", "", ""); code != http.StatusUnauthorized {
+		t.Fatal(code)
+	}
+
+	if _, b := do(&client, "GET", "/slaveof/no/one", "", ""); !strings.Contains(b, "unsupported command") {
+		t.Fatal(b)
+	} else if _, b := do(&client, "POST", "/batch", "", `[{"cmd":"get","args":["a"]},{"cmd":"set","args":["a","4"]}]`); b != `[{"get":"3"},{"set":[false,"ERR unsupported command: 'set'"]}]` {
+		t.Fatal(b)
+	} else if _, b := do(&client, "POST", "/", "", `{"cmd":"set","args":["a","4"]}`); b != `{"set":[true,"OK"]}` {
+		t.Fatal(b)
+	}
+
+	if code, _ := do(nil, "GET", "/metrics", "", ""); code != http.StatusUnauthorized {
+		t.Fatal(code)
+	} else if code, b := do(nil, "GET", "/metrics", "Bearer tok1", ""); code != http.StatusOK || !strings.Contains(b, "vredis_uptime_seconds") {
+		t.Fatal(code, b)
+	}
+
+	// only the HTTP listener asks for a client certificate
+	for _, v := range []struct {
+		addr  string
+		asked bool
+	}{{cfg.Addr, false}, {cfg.HttpAddr, true}} {
+		asked := false
+		conn, err := tls.Dial("tcp", v.addr, &tls.Config{RootCAs: roots, GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			asked = true
+			return &client, nil
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+
+		if asked != v.asked {
+			t.Fatal(v.addr, asked)
+		}
+	}
+}
+
+func TestHttpAuthConfig(t *testing.T) {
+	for _, cfg := range []config.HTTPConfig{
+		{Tokens: []string{"user"}},
+		{Commands: []string{"nope -get"}},
+		{Commands: []string{"batch ~*"}},
+		{Commands: []string{"* -nocmd"}},
+	} {
+		if _, err := newHTTPAuth(&cfg); err == nil {
+			t.Fatal(cfg, "must error")
+		}
+	}
+}
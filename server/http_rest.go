@@ -0,0 +1,506 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r0123r/vredis/ledis"
+	"github.com/r0123r/vredis/store"
+)
+
+// The objects of /db/{n}/kv/{key} are the KV values, their ETag is the one
+// of the value, and the rest of their metadata is a field of the hash of the
+// same key, deleted with the value by DEL, FLUSHDB and the expiration. The
+// metadata is ignored when its ETag is not the one of the value, after
+// the value is written by the commands.
+const (
+	restPrefix = "/db/"
+
+	// the hash field of the metadata
+	restMetaField = "rest:meta"
+
+	// the header of the TTL in seconds
+	restTTLHeader = "X-TTL"
+
+	restDefaultContentType = "application/octet-stream"
+)
+
+var (
+	errRESTPath         = errors.New("invalid path, must be /db/{n}/kv/{key}")
+	errRESTPrecondition = errors.New("precondition failed")
+	errRESTRange        = errors.New("invalid range")
+	errRESTBodySize     = errors.New("http: request body too large")
+)
+
+// restMeta is the metadata of an object written by a PUT.
+type restMeta struct {
+	ETag         string `json:"etag"`
+	ContentType  string `json:"content_type"`
+	LastModified int64  `json:"last_modified"`
+}
+
+// restObject is the state of an object before a request, read once.
+type restObject struct {
+	value store.Slice
+	size  int64
+	meta  restMeta
+}
+
+// restHandler serves GET, HEAD, PUT and DELETE /db/{n}/kv/{key}, the key
+// is the rest of the path.
+func (app *App) restHandler(w http.ResponseWriter, r *http.Request) {
+	app.connWait.Add(1)
+	defer app.connWait.Done()
+
+	index, key, err := parseRESTPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	u, err := app.httpUser(r)
+	if err != nil {
+		writeHTTPAuthError(w, err)
+		return
+	}
+
+	cmd := map[string]string{
+		"GET":    "get",
+		"HEAD":   "get",
+		"PUT":    "set",
+		"DELETE": "del",
+	}[r.Method]
+	if len(cmd) == 0 {
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the object is checked like the command of the method
+	args := [][]byte{key}
+	if err := app.httpAuth.permit(httpEndpointKV, cmd, args); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err := checkHTTPCrossSite(httpCrossSite(r), cmd); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err := app.acl.permit(u, regCmds[cmd], args, index, "http", r.RemoteAddr); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	c := newClient(app)
+	defer c.close()
+
+	c.remoteAddr = r.RemoteAddr
+	c.user = u
+	c.cmd = cmd
+	c.args = args
+	if c.db, err = app.ldb.Select(index); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	err = c.performFunc(regCmds[cmd], func() error {
+		switch r.Method {
+		case "GET", "HEAD":
+			return app.restGet(w, r, index, key)
+		case "PUT":
+			return app.restPut(w, r, index, key)
+		default:
+			return app.restDelete(w, r, index, key)
+		}
+	})
+
+	if err != nil {
+		writeRESTError(w, err)
+	}
+}
+
+func parseRESTPath(p string) (int, []byte, error) {
+	parts := strings.SplitN(strings.TrimPrefix(p, restPrefix), "/", 3)
+	if len(parts) != 3 || parts[1] != "kv" || len(parts[2]) == 0 || len(parts[2]) > ledis.MaxKeySize {
+		return 0, nil, errRESTPath
+	}
+
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, nil, errRESTPath
+	}
+	return index, []byte(parts[2]), nil
+}
+
+func writeRESTError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch err {
+	case errRESTPrecondition:
+		code = http.StatusPreconditionFailed
+	case ledis.ErrWriteInROnly, ErrReadOnlyReplica:
+		code = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// valueETag returns the ETag of a value.
+func valueETag(value []byte) string {
+	h := sha1.Sum(value)
+	return `"` + hex.EncodeToString(h[:]) + `"`
+}
+
+// etagMatch reports whether the If-Match or If-None-Match header matches
+// the ETag of the object, "*" matches any existing object.
+func etagMatch(header string, o *restObject) bool {
+	if !o.exists() {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == o.meta.ETag {
+			return true
+		}
+	}
+	return false
+}
+
+// restLoad reads the value of the object and its metadata, the object must
+// be freed.
+func (app *App) restLoad(db *ledis.DB, key []byte) (*restObject, error) {
+	o := new(restObject)
+
+	var err error
+	if o.value, err = db.GetSlice(key); err != nil {
+		return nil, err
+	} else if o.value == nil {
+		return o, nil
+	}
+
+	o.size = int64(o.value.Size())
+	o.meta.ETag = valueETag(o.value.Data())
+
+	data, err := db.HGet(key, []byte(restMetaField))
+	if err != nil {
+		o.free()
+		return nil, err
+	}
+
+	var meta restMeta
+	if data != nil && json.Unmarshal(data, &meta) == nil && meta.ETag == o.meta.ETag {
+		o.meta = meta
+	}
+	return o, nil
+}
+
+func (o *restObject) exists() bool {
+	return o.value != nil
+}
+
+func (o *restObject) free() {
+	if o.value != nil {
+		o.value.Free()
+	}
+}
+
+// checkPreconditions checks If-Match and If-None-Match, notModified is
+// true if a GET can reply 304.
+func (o *restObject) checkPreconditions(r *http.Request) (notModified bool, err error) {
+	if h := r.Header.Get("If-Match"); len(h) > 0 && !etagMatch(h, o) {
+		return false, errRESTPrecondition
+	}
+
+	if h := r.Header.Get("If-None-Match"); len(h) > 0 && etagMatch(h, o) {
+		if r.Method == "GET" || r.Method == "HEAD" {
+			return true, nil
+		}
+		return false, errRESTPrecondition
+	}
+	return false, nil
+}
+
+func (o *restObject) writeHeaders(w http.ResponseWriter) {
+	h := w.Header()
+
+	contentType := o.meta.ContentType
+	if len(contentType) == 0 {
+		contentType = restDefaultContentType
+	}
+	h.Set("Content-Type", contentType)
+	h.Set("ETag", o.meta.ETag)
+	h.Set("Accept-Ranges", "bytes")
+
+	if o.meta.LastModified > 0 {
+		h.Set("Last-Modified", time.Unix(o.meta.LastModified, 0).UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseRange returns the range of a "bytes=start-end" header, ok is false
+// for the other ranges, which are ignored.
+func parseRange(header string, size int64) (start int64, end int64, ok bool, err error) {
+	if !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, 0, false, nil
+	}
+
+	spec := strings.TrimSpace(header[len("bytes="):])
+	i := strings.IndexByte(spec, '-')
+	if i < 0 {
+		return 0, 0, false, errRESTRange
+	}
+
+	first, last := spec[:i], spec[i+1:]
+	if len(first) == 0 {
+		// the last bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false, errRESTRange
+		} else if n > size {
+			n = size
+		}
+		start, end = size-n, size-1
+	} else {
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil || start < 0 {
+			return 0, 0, false, errRESTRange
+		}
+
+		end = size - 1
+		if len(last) > 0 {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return 0, 0, false, errRESTRange
+			} else if end >= size {
+				end = size - 1
+			}
+		}
+	}
+
+	if start >= size {
+		return 0, 0, false, errRESTRange
+	}
+	return start, end, true, nil
+}
+
+func (app *App) restGet(w http.ResponseWriter, r *http.Request, index int, key []byte) error {
+	db, err := app.ldb.Select(index)
+	if err != nil {
+		return err
+	}
+
+	// the headers and the body are of the same read
+	o, err := app.restLoad(db, key)
+	if err != nil {
+		return err
+	}
+	defer o.free()
+
+	if !o.exists() {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil
+	}
+
+	notModified, err := o.checkPreconditions(r)
+	if err != nil {
+		return err
+	}
+
+	o.writeHeaders(w)
+	if ttl, err := db.TTL(key); err == nil && ttl >= 0 {
+		w.Header().Set(restTTLHeader, strconv.FormatInt(ttl, 10))
+	}
+
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	if h := r.Header.Get("If-Range"); len(h) > 0 && h != o.meta.ETag {
+		rangeHeader = ""
+	}
+
+	start, end, ranged, err := parseRange(rangeHeader, o.size)
+	if err == errRESTRange {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", o.size))
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+
+	if !ranged {
+		if r.Method == "HEAD" {
+			w.Header().Set("Content-Length", strconv.FormatInt(o.size, 10))
+			return nil
+		}
+
+		// streamed from the value like the bulk replies of the commands
+		(&httpWriter{cmd: "get", raw: w}).writeBulkFrom(o.size, bytes.NewReader(o.value.Data()))
+		return nil
+	}
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, o.size))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method == "HEAD" {
+		return nil
+	}
+
+	(&httpWriter{cmd: "get", raw: w}).writeBulkFrom(end-start+1, bytes.NewReader(o.value.Data()[start:end+1]))
+	return nil
+}
+
+// restPut writes the body, and its metadata, with the TTL of the X-TTL
+// header if any.
+func (app *App) restPut(w http.ResponseWriter, r *http.Request, index int, key []byte) error {
+	var ttl int64
+	if h := r.Header.Get(restTTLHeader); len(h) > 0 {
+		var err error
+		if ttl, err = strconv.ParseInt(h, 10, 64); err != nil || ttl <= 0 {
+			http.Error(w, fmt.Sprintf("invalid %s header", restTTLHeader), http.StatusBadRequest)
+			return nil
+		}
+	}
+
+	value, err := readRESTBody(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return nil
+	}
+
+	meta := restMeta{
+		ETag:         valueETag(value),
+		ContentType:  r.Header.Get("Content-Type"),
+		LastModified: time.Now().Unix(),
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	var created bool
+	err = app.restUpdate(r, index, key, data, func(db *ledis.DB, o *restObject) error {
+		created = !o.exists()
+
+		if err := db.Set(key, value); err != nil {
+			return err
+		} else if ttl > 0 {
+			_, err := db.Expire(key, ttl)
+			return err
+		}
+
+		_, err := db.Persist(key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", meta.ETag)
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return nil
+}
+
+func (app *App) restDelete(w http.ResponseWriter, r *http.Request, index int, key []byte) error {
+	var found bool
+	err := app.restUpdate(r, index, key, nil, func(db *ledis.DB, o *restObject) error {
+		if found = o.exists(); !found {
+			return nil
+		}
+
+		_, err := db.Del(key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		http.Error(w, "not found", http.StatusNotFound)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return nil
+}
+
+// restUpdate calls f in a Tx after the preconditions, the other writers
+// wait for it, writes the metadata, nil deletes it, and fires the triggers
+// before the commit.
+func (app *App) restUpdate(r *http.Request, index int, key []byte, meta []byte, f func(db *ledis.DB, o *restObject) error) error {
+	if app.cfg.GetReadonly() {
+		return ErrReadOnlyReplica
+	}
+
+	return app.Update(index, func(db *ledis.DB) error {
+		o, err := app.restLoad(db, key)
+		if err != nil {
+			return err
+		}
+		defer o.free()
+
+		if _, err := o.checkPreconditions(r); err != nil {
+			return err
+		} else if err := f(db, o); err != nil {
+			return err
+		}
+
+		if meta != nil {
+			_, err = db.HSet(key, []byte(restMetaField), meta)
+			return err
+		}
+		return deleteRESTMeta(db, key)
+	})
+}
+
+// readRESTBody reads the body of a PUT, at once when its length is known,
+// the value is written by one SET.
+func readRESTBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body := http.MaxBytesReader(w, r.Body, httpMaxBodySize)
+	if r.ContentLength < 0 {
+		return ioutil.ReadAll(body)
+	} else if r.ContentLength > httpMaxBodySize {
+		return nil, errRESTBodySize
+	}
+
+	value := make([]byte, r.ContentLength)
+	if _, err := io.ReadFull(body, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// restExpired deletes the metadata of the expired KV values.
+func restExpired(tx *ledis.Tx, events []ledis.KeyEvent) error {
+	for _, e := range events {
+		if e.Event != ledis.KeyExpired || e.Type != ledis.KV {
+			continue
+		}
+
+		db, err := tx.Select(e.Index)
+		if err != nil {
+			return err
+		} else if err := deleteRESTMeta(db, e.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRESTMeta deletes the metadata of the key if any, HDEL of a missing
+// hash would be a key event for the triggers.
+func deleteRESTMeta(db *ledis.DB, key []byte) error {
+	if data, err := db.HGet(key, []byte(restMetaField)); err != nil || data == nil {
+		return err
+	}
+
+	_, err := db.HDel(key, []byte(restMetaField))
+	return err
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+)
+
+// startTestHTTPApp starts an app whose HTTP endpoints run all the commands.
+func startTestHTTPApp(t *testing.T, name string, addr string, httpAddr string) *App {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/" + name
+	cfg.Addr = addr
+	cfg.HttpAddr = httpAddr
+	cfg.HTTP.Commands = nil
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	return s
+}
+
+func httpDo(t *testing.T, s *App, method string, path string, header map[string]string, body []byte) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", s.cfg.HttpAddr, path), bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, b
+}
+
+func TestHttpREST(t *testing.T) {
+	s := startTestHTTPApp(t, "test_http_rest", "127.0.0.1:11211", "127.0.0.1:11212")
+	defer s.Close()
+
+	path := "/db/0/kv/rest/a.txt"
+	body := []byte("hello world")
+
+	r, _ := httpDo(t, s, "PUT", path, map[string]string{"Content-Type": "text/plain", "X-TTL": "100"}, body)
+	if r.StatusCode != http.StatusCreated {
+		t.Fatal(r.StatusCode)
+	}
+	etag := r.Header.Get("ETag")
+	if etag != valueETag(body) {
+		t.Fatal(etag)
+	}
+
+	if r, b := httpDo(t, s, "GET", path, nil, nil); r.StatusCode != http.StatusOK || !bytes.Equal(b, body) {
+		t.Fatal(r.StatusCode, string(b))
+	} else if r.Header.Get("Content-Type") != "text/plain" || r.Header.Get("ETag") != etag || r.Header.Get("X-TTL") == "" {
+		t.Fatal(r.Header)
+	} else if r, b := httpDo(t, s, "HEAD", path, nil, nil); r.StatusCode != http.StatusOK || len(b) != 0 || r.ContentLength != int64(len(body)) {
+		t.Fatal(r.StatusCode, r.ContentLength)
+	}
+
+	// the value is the KV value
+	if _, b := httpDo(t, s, "POST", "/", nil, []byte(`{"cmd":"get","args":["rest/a.txt"]}`)); string(b) != `{"get":"hello world"}` {
+		t.Fatal(string(b))
+	}
+
+	// conditional requests
+	if r, _ := httpDo(t, s, "GET", path, map[string]string{"If-None-Match": etag}, nil); r.StatusCode != http.StatusNotModified {
+		t.Fatal(r.StatusCode)
+	} else if r, _ := httpDo(t, s, "GET", path, map[string]string{"If-Match": `"nope"`}, nil); r.StatusCode != http.StatusPreconditionFailed {
+		t.Fatal(r.StatusCode)
+	} else if r, _ := httpDo(t, s, "PUT", path, map[string]string{"If-None-Match": "*"}, []byte("x")); r.StatusCode != http.StatusPreconditionFailed {
+		t.Fatal(r.StatusCode)
+	} else if r, _ := httpDo(t, s, "PUT", path, map[string]string{"If-Match": `"nope"`}, []byte("x")); r.StatusCode != http.StatusPreconditionFailed {
+		t.Fatal(r.StatusCode)
+	} else if r, _ := httpDo(t, s, "PUT", "/db/0/kv/rest/new", map[string]string{"If-Match": "*"}, []byte("x")); r.StatusCode != http.StatusPreconditionFailed {
+		t.Fatal(r.StatusCode)
+	}
+
+	// range reads
+	if r, b := httpDo(t, s, "GET", path, map[string]string{"Range": "bytes=6-"}, nil); r.StatusCode != http.StatusPartialContent || string(b) != "world" {
+		t.Fatal(r.StatusCode, string(b))
+	} else if r.Header.Get("Content-Range") != "bytes 6-10/11" {
+		t.Fatal(r.Header)
+	} else if r, b := httpDo(t, s, "GET", path, map[string]string{"Range": "bytes=-3"}, nil); r.StatusCode != http.StatusPartialContent || string(b) != "rld" {
+		t.Fatal(r.StatusCode, string(b))
+	} else if r, b := httpDo(t, s, "GET", path, map[string]string{"Range": "bytes=0-4", "If-Range": `"old"`}, nil); r.StatusCode != http.StatusOK || !bytes.Equal(b, body) {
+		t.Fatal(r.StatusCode, string(b))
+	} else if r, _ := httpDo(t, s, "GET", path, map[string]string{"Range": "bytes=20-"}, nil); r.StatusCode != http.StatusRequestedRangeNotSatisfiable || r.Header.Get("Content-Range") != "bytes */11" {
+		t.Fatal(r.StatusCode, r.Header)
+	}
+
+	// replaced without a TTL
+	if r, _ := httpDo(t, s, "PUT", path, map[string]string{"If-Match": etag}, []byte("bye")); r.StatusCode != http.StatusNoContent {
+		t.Fatal(r.StatusCode)
+	} else if r, b := httpDo(t, s, "GET", path, nil, nil); string(b) != "bye" || r.Header.Get("Content-Type") != "application/octet-stream" || r.Header.Get("X-TTL") != "" {
+		t.Fatal(string(b), r.Header)
+	}
+
+	// overwritten by SET, the metadata of the old value is dropped
+	if r, _ := httpDo(t, s, "PUT", path, map[string]string{"Content-Type": "text/plain"}, body); r.StatusCode != http.StatusNoContent {
+		t.Fatal(r.StatusCode)
+	} else if _, b := httpDo(t, s, "POST", "/", nil, []byte(`{"cmd":"set","args":["rest/a.txt","bye"]}`)); string(b) != `{"set":[true,"OK"]}` {
+		t.Fatal(string(b))
+	} else if r, _ := httpDo(t, s, "GET", path, map[string]string{"If-None-Match": etag}, nil); r.StatusCode != http.StatusOK {
+		t.Fatal(r.StatusCode)
+	} else if r.Header.Get("ETag") != valueETag([]byte("bye")) || r.Header.Get("Content-Type") != "application/octet-stream" || r.Header.Get("Last-Modified") != "" {
+		t.Fatal(r.Header)
+	} else if r, _ := httpDo(t, s, "PUT", path, map[string]string{"If-Match": etag}, []byte("x")); r.StatusCode != http.StatusPreconditionFailed {
+		t.Fatal(r.StatusCode)
+	}
+
+	// a hash of the same key is not the metadata
+	if _, b := httpDo(t, s, "POST", "/", nil, []byte(`{"cmd":"hset","args":["rest/a.txt","etag","mine"]}`)); string(b) != `{"hset":1}` {
+		t.Fatal(string(b))
+	} else if r, _ := httpDo(t, s, "PUT", path, nil, []byte("bye")); r.StatusCode != http.StatusNoContent {
+		t.Fatal(r.StatusCode)
+	} else if _, b := httpDo(t, s, "POST", "/", nil, []byte(`{"cmd":"hget","args":["rest/a.txt","etag"]}`)); string(b) != `{"hget":"mine"}` {
+		t.Fatal(string(b))
+	}
+
+	// written by SET, the ETag is the one of the value
+	if _, b := httpDo(t, s, "POST", "/", nil, []byte(`{"cmd":"set","args":["rest/b","v"]}`)); string(b) != `{"set":[true,"OK"]}` {
+		t.Fatal(string(b))
+	} else if r, b := httpDo(t, s, "GET", "/db/0/kv/rest/b", nil, nil); string(b) != "v" || r.Header.Get("ETag") != valueETag([]byte("v")) {
+		t.Fatal(string(b), r.Header)
+	}
+
+	if r, _ := httpDo(t, s, "PUT", path, map[string]string{"X-TTL": "0"}, body); r.StatusCode != http.StatusBadRequest {
+		t.Fatal(r.StatusCode)
+	} else if r, _ := httpDo(t, s, "POST", path, nil, body); r.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatal(r.StatusCode)
+	} else if r, _ := httpDo(t, s, "GET", "/db/x/kv/a", nil, nil); r.StatusCode != http.StatusNotFound {
+		t.Fatal(r.StatusCode)
+	}
+
+	if r, _ := httpDo(t, s, "DELETE", path, nil, nil); r.StatusCode != http.StatusNoContent {
+		t.Fatal(r.StatusCode)
+	} else if _, b := httpDo(t, s, "POST", "/", nil, []byte(`{"cmd":"hget","args":["rest/a.txt","etag"]}`)); string(b) != `{"hget":"mine"}` {
+		t.Fatal(string(b))
+	} else if r, _ := httpDo(t, s, "DELETE", path, nil, nil); r.StatusCode != http.StatusNotFound {
+		t.Fatal(r.StatusCode)
+	} else if r, _ := httpDo(t, s, "GET", path, nil, nil); r.StatusCode != http.StatusNotFound {
+		t.Fatal(r.StatusCode)
+	}
+
+	// the metadata is deleted with the value by DEL and the expiration
+	metaExists := func(key string) string {
+		_, b := httpDo(t, s, "POST", "/", nil, []byte(`{"cmd":"hexists","args":["`+key+`","`+restMetaField+`"]}`))
+		return string(b)
+	}
+
+	if r, _ := httpDo(t, s, "PUT", "/db/0/kv/rest/c", nil, body); r.StatusCode != http.StatusCreated {
+		t.Fatal(r.StatusCode)
+	} else if b := metaExists("rest/c"); b != `{"hexists":1}` {
+		t.Fatal(b)
+	} else if _, b := httpDo(t, s, "POST", "/", nil, []byte(`{"cmd":"del","args":["rest/c"]}`)); !bytes.HasPrefix(b, []byte(`{"del":`)) {
+		t.Fatal(string(b))
+	} else if b := metaExists("rest/c"); b != `{"hexists":0}` {
+		t.Fatal(b)
+	}
+
+	if r, _ := httpDo(t, s, "PUT", "/db/0/kv/rest/d", map[string]string{"X-TTL": "1"}, body); r.StatusCode != http.StatusCreated {
+		t.Fatal(r.StatusCode)
+	}
+	for i := 0; metaExists("rest/d") != `{"hexists":0}`; i++ {
+		if i == 40 {
+			t.Fatal("the metadata has not expired")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// the requests are paused and counted like the commands
+	calls := s.info.commandStat("get").calls.Get()
+	s.pause.pause(100*time.Millisecond, false)
+
+	start := time.Now()
+	if r, _ := httpDo(t, s, "PUT", path, nil, body); r.StatusCode != http.StatusCreated {
+		t.Fatal(r.StatusCode)
+	} else if time.Since(start) < 80*time.Millisecond {
+		t.Fatal("PUT is not paused")
+	} else if r, _ := httpDo(t, s, "GET", path, nil, nil); r.StatusCode != http.StatusOK {
+		t.Fatal(r.StatusCode)
+	} else if n := s.info.commandStat("get").calls.Get(); n != calls+1 {
+		t.Fatal(n, calls)
+	}
+}
+
+func TestHttpStream(t *testing.T) {
+	s := startTestHTTPApp(t, "test_http_stream", "127.0.0.1:11213", "127.0.0.1:11214")
+	defer s.Close()
+
+	// the snapshot is the body
+	if r, b := httpDo(t, s, "GET", "/fullsync", nil, nil); r.StatusCode != http.StatusOK || r.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Fatal(r.StatusCode, string(b))
+	} else if int64(len(b)) != r.ContentLength || len(b) == 0 {
+		t.Fatal(len(b), r.ContentLength)
+	}
+
+	// a batch keeps it as its other replies
+	if _, b := httpDo(t, s, "POST", "/batch", nil, []byte(`[{"cmd":"fullsync"}]`)); !bytes.HasPrefix(b, []byte(`[{"fullsync":"`)) {
+		t.Fatal(string(b))
+	}
+}
@@ -0,0 +1,580 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r0123r/vredis/ledis"
+)
+
+const (
+	subscribePath = "/subscribe"
+
+	// the GUID of the Sec-WebSocket-Accept header, RFC 6455
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xa
+
+	// the frames of the clients are only read for the control ones
+	wsMaxFrameSize = 64 * 1024
+
+	wsWriteTimeout = 10 * time.Second
+
+	wsCloseNormal = 1000
+	wsClosePolicy = 1008
+)
+
+var (
+	errSubscribeContext  = errors.New("the subscriptions are only supported by RESP connections and the /subscribe HTTP endpoint")
+	errSubscribeNoTarget = errors.New("subscribe needs a channel or a pattern parameter")
+	errSubscribeOverflow = errors.New("subscribe buffer limit reached")
+	errWSHandshake       = errors.New("invalid WebSocket handshake")
+	errWSFrame           = errors.New("invalid WebSocket frame")
+)
+
+// subEvent is an event of a /subscribe connection, as JSON.
+type subEvent struct {
+	Type    string      `json:"type"`
+	Pattern string      `json:"pattern,omitempty"`
+	Channel string      `json:"channel"`
+	Data    interface{} `json:"data,omitempty"`
+	Count   int         `json:"count,omitempty"`
+}
+
+// subTransport writes the events of a /subscribe connection, as SSE or
+// WebSocket messages.
+type subTransport interface {
+	writeEvent(e *subEvent) error
+	heartbeat() error
+	// fail ends the connection with the error, the connection is closed
+	// after anyway
+	fail(err error)
+	// done is closed when the client is gone
+	done() <-chan struct{}
+}
+
+// httpSubscriber receives the messages published to its channels and
+// patterns. The messages are queued by Publish, which never waits, and
+// written by serve, the subscriber is closed past the buffer limit.
+type httpSubscriber struct {
+	channels map[string]struct{}
+	patterns []*ledis.Glob
+
+	base64 bool
+	limit  int
+
+	mu       sync.Mutex
+	queue    []*subEvent
+	pending  int
+	overflow bool
+
+	notify    chan struct{}
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+func newHTTPSubscriber(channels []string, patterns []string, limit int) *httpSubscriber {
+	s := &httpSubscriber{
+		channels: make(map[string]struct{}, len(channels)),
+		limit:    limit,
+		notify:   make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+
+	for _, ch := range channels {
+		s.channels[ch] = struct{}{}
+	}
+	for _, p := range patterns {
+		s.patterns = append(s.patterns, ledis.CompileGlob(p))
+	}
+	return s
+}
+
+// publish queues the messages of the channel, and returns their number,
+// the rcm lock must be held.
+func (s *httpSubscriber) publish(channel []byte, value []byte) int64 {
+	var n int64
+
+	if _, ok := s.channels[string(channel)]; ok {
+		s.push(&subEvent{Type: "message", Channel: string(channel), Data: s.data(value)}, len(channel)+len(value))
+		n++
+	}
+
+	for _, g := range s.patterns {
+		if g.Match(channel) {
+			s.push(&subEvent{Type: "pmessage", Pattern: g.String(), Channel: string(channel), Data: s.data(value)}, len(channel)+len(value))
+			n++
+		}
+	}
+	return n
+}
+
+func (s *httpSubscriber) data(value []byte) interface{} {
+	if s.base64 {
+		return base64.StdEncoding.EncodeToString(value)
+	}
+	return string(value)
+}
+
+func (s *httpSubscriber) push(e *subEvent, size int) {
+	s.mu.Lock()
+	if s.overflow {
+		s.mu.Unlock()
+		return
+	} else if s.pending+size > s.limit {
+		s.overflow = true
+		s.mu.Unlock()
+		s.close()
+		return
+	}
+
+	s.queue = append(s.queue, e)
+	s.pending += size
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *httpSubscriber) take() []*subEvent {
+	s.mu.Lock()
+	q := s.queue
+	s.queue = nil
+	s.pending = 0
+	s.mu.Unlock()
+	return q
+}
+
+func (s *httpSubscriber) close() {
+	s.closeOnce.Do(func() {
+		close(s.quit)
+	})
+}
+
+func (s *httpSubscriber) overflowed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.overflow
+}
+
+// serve writes the events until the client is gone, or the subscriber is
+// closed.
+func (s *httpSubscriber) serve(t subTransport, heartbeat time.Duration) {
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.notify:
+			for _, e := range s.take() {
+				if err := t.writeEvent(e); err != nil {
+					return
+				}
+			}
+		case <-ticker.C:
+			if err := t.heartbeat(); err != nil {
+				return
+			}
+		case <-s.quit:
+			if s.overflowed() {
+				t.fail(errSubscribeOverflow)
+			} else {
+				t.fail(nil)
+			}
+			return
+		case <-t.done():
+			return
+		}
+	}
+}
+
+func (app *App) addHTTPSubscriber(s *httpSubscriber) {
+	app.rcm.Lock()
+	app.hss[s] = struct{}{}
+	app.rcm.Unlock()
+}
+
+func (app *App) delHTTPSubscriber(s *httpSubscriber) {
+	app.rcm.Lock()
+	delete(app.hss, s)
+	app.rcm.Unlock()
+}
+
+func (app *App) closeAllHTTPSubscribers() {
+	app.rcm.Lock()
+	for s := range app.hss {
+		s.close()
+	}
+	app.rcm.Unlock()
+}
+
+// subscribeHandler serves GET /subscribe?channel=...&pattern=..., as
+// Server-Sent Events, or as WebSocket messages after an upgrade. Each event
+// is a JSON object, the messages of the channels and the patterns as
+// PUBLISH sends them to the RESP subscribers.
+func (app *App) subscribeHandler(w http.ResponseWriter, r *http.Request) {
+	app.connWait.Add(1)
+	defer app.connWait.Done()
+
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u, err := app.httpUser(r)
+	if err != nil {
+		writeHTTPAuthError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	channels, patterns := query["channel"], query["pattern"]
+	if len(channels) == 0 && len(patterns) == 0 {
+		http.Error(w, errSubscribeNoTarget.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, v := range []struct {
+		cmd     string
+		targets []string
+	}{
+		{"subscribe", channels},
+		{"psubscribe", patterns},
+	} {
+		if len(v.targets) == 0 {
+			continue
+		}
+
+		args := make([][]byte, len(v.targets))
+		for i, t := range v.targets {
+			args[i] = []byte(t)
+		}
+
+		if err := app.httpAuth.permit(httpEndpointSubscribe, v.cmd, args); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		} else if err := app.acl.permit(u, regCmds[v.cmd], args, 0, "http", r.RemoteAddr); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	var t subTransport
+	if isWebSocketUpgrade(r) {
+		ws, err := upgradeWebSocket(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer ws.conn.Close()
+		t = ws
+	} else {
+		sse, err := newSSETransport(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		t = sse
+	}
+
+	s := newHTTPSubscriber(channels, patterns, app.cfg.HTTP.SubscribeBufferSize)
+	s.base64 = query.Get("encoding") == "base64"
+
+	// the confirmations first, as for SUBSCRIBE and PSUBSCRIBE
+	count := 0
+	for _, ch := range channels {
+		count++
+		s.push(&subEvent{Type: "subscribe", Channel: ch, Count: count}, 0)
+	}
+	for _, p := range patterns {
+		count++
+		s.push(&subEvent{Type: "psubscribe", Pattern: p, Count: count}, 0)
+	}
+
+	app.addHTTPSubscriber(s)
+	defer app.delHTTPSubscriber(s)
+
+	select {
+	case <-app.quit:
+		return
+	default:
+	}
+
+	s.serve(t, time.Duration(app.cfg.HTTP.SubscribeHeartbeat)*time.Second)
+}
+
+// Server-Sent Events
+
+type sseTransport struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ctx     <-chan struct{}
+}
+
+func newSSETransport(w http.ResponseWriter, r *http.Request) (*sseTransport, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming unsupported")
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &sseTransport{w: w, flusher: flusher, ctx: r.Context().Done()}, nil
+}
+
+func (t *sseTransport) write(s string) error {
+	if _, err := io.WriteString(t.w, s); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+// writeEvent writes the event with its type as the event name, the JSON
+// has no newline.
+func (t *sseTransport) writeEvent(e *subEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return t.write(fmt.Sprintf("event: %s\ndata: %s\n\n", e.Type, b))
+}
+
+func (t *sseTransport) heartbeat() error {
+	return t.write(": heartbeat\n\n")
+}
+
+func (t *sseTransport) fail(err error) {
+	if err != nil {
+		t.writeEvent(&subEvent{Type: "error", Data: err.Error()})
+	}
+}
+
+func (t *sseTransport) done() <-chan struct{} {
+	return t.ctx
+}
+
+// WebSocket
+
+type wsTransport struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	// the pongs of the reader and the writes of serve
+	mu sync.Mutex
+
+	closed chan struct{}
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		headerHasToken(r.Header.Get("Connection"), "upgrade")
+}
+
+func headerHasToken(header string, token string) bool {
+	for _, v := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// upgradeWebSocket replies 101 and takes the connection, the client frames
+// are read until it is closed.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsTransport, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if len(key) == 0 || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errWSHandshake
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("websocket unsupported")
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &wsTransport{conn: conn, br: rw.Reader, closed: make(chan struct{})}
+
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+wsAccept(key)+"\r\n\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go t.read()
+	return t, nil
+}
+
+// read answers the pings and the close of the client, the data frames are
+// ignored.
+func (t *wsTransport) read() {
+	defer close(t.closed)
+
+	for {
+		op, payload, err := readWSFrame(t.br)
+		if err != nil {
+			return
+		}
+
+		switch op {
+		case wsOpPing:
+			if err := t.writeFrame(wsOpPong, payload); err != nil {
+				return
+			}
+		case wsOpClose:
+			t.writeFrame(wsOpClose, payload)
+			return
+		}
+	}
+}
+
+// readWSFrame reads a frame of the client, which must be masked.
+func readWSFrame(r *bufio.Reader) (byte, []byte, error) {
+	var h [2]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return 0, nil, err
+	}
+
+	op := h[0] & 0x0f
+	if h[1]&0x80 == 0 {
+		return 0, nil, errWSFrame
+	}
+
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+
+	if n > wsMaxFrameSize || (op >= wsOpClose && n > 125) {
+		return 0, nil, errWSFrame
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
+
+// writeFrame writes an unmasked final frame.
+func (t *wsTransport) writeFrame(op byte, payload []byte) error {
+	buf := make([]byte, 0, len(payload)+10)
+	buf = append(buf, 0x80|op)
+
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, byte(n))
+	case n <= 0xffff:
+		buf = append(buf, 126, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 127)
+		buf = append(buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(buf[len(buf)-8:], uint64(n))
+	}
+	buf = append(buf, payload...)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := t.conn.Write(buf)
+	return err
+}
+
+func (t *wsTransport) writeEvent(e *subEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return t.writeFrame(wsOpText, b)
+}
+
+func (t *wsTransport) heartbeat() error {
+	return t.writeFrame(wsOpPing, nil)
+}
+
+func (t *wsTransport) fail(err error) {
+	code, reason := wsCloseNormal, ""
+	if err != nil {
+		code, reason = wsClosePolicy, err.Error()
+	}
+
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	t.writeFrame(wsOpClose, payload)
+}
+
+func (t *wsTransport) done() <-chan struct{} {
+	return t.closed
+}
+
+// SUBSCRIBE and PSUBSCRIBE are served by the RESP clients, the /subscribe
+// endpoint checks them with the ACL and the HTTP endpoint rules.
+func subscribeCommand(c *client) error {
+	if c.subscriber == nil {
+		return errSubscribeContext
+	}
+
+	c.subscriber.subscribe(c.cmd == "psubscribe", c.args)
+	return nil
+}
+
+func init() {
+	register("subscribe", subscribeCommand)
+	register("psubscribe", subscribeCommand)
+}
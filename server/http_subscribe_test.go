@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+// readSSE reads the next event, or the next comment.
+func readSSE(t *testing.T, br *bufio.Reader) (string, map[string]interface{}) {
+	var event string
+	var data map[string]interface{}
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case len(line) == 0:
+			return event, data
+		case strings.HasPrefix(line, ":"):
+			event = line
+		case strings.HasPrefix(line, "event: "):
+			event = line[len("event: "):]
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(line[len("data: "):]), &data); err != nil {
+				t.Fatal(line, err)
+			}
+		}
+	}
+}
+
+// readWS reads a frame of the server, which is not masked.
+func readWS(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	var h [2]byte
+	if _, err := io.ReadFull(br, h[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	n := int(h[1] & 0x7f)
+	if n == 126 {
+		var b [2]byte
+		io.ReadFull(br, b[:])
+		n = int(binary.BigEndian.Uint16(b[:]))
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+	return h[0] & 0x0f, payload
+}
+
+// writeWS writes a masked frame of the client.
+func writeWS(t *testing.T, conn net.Conn, op byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	buf := []byte{0x80 | op, 0x80 | byte(len(payload))}
+	buf = append(buf, mask...)
+	for i, b := range payload {
+		buf = append(buf, b^mask[i%4])
+	}
+	if _, err := conn.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHttpSubscribe(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_http_subscribe"
+	cfg.Addr = "127.0.0.1:11215"
+	cfg.HttpAddr = "127.0.0.1:11216"
+	cfg.HTTP.SubscribeHeartbeat = 1
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	go s.Run()
+
+	c := goredis.NewClient(cfg.Addr, "")
+	defer c.Close()
+
+	r, err := http.Get(fmt.Sprintf("http://%s/subscribe?channel=news&pattern=__keyspace@0__:*", cfg.HttpAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	if r.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal(r.Header)
+	}
+	br := bufio.NewReader(r.Body)
+
+	if e, d := readSSE(t, br); e != "subscribe" || d["channel"] != "news" || d["count"] != 1.0 {
+		t.Fatal(e, d)
+	} else if e, d := readSSE(t, br); e != "psubscribe" || d["pattern"] != "__keyspace@0__:*" || d["count"] != 2.0 {
+		t.Fatal(e, d)
+	}
+
+	// the messages of PUBLISH, and the keyspace events
+	if n, err := goredis.Int(c.Do("publish", "news", "hello")); err != nil || n != 1 {
+		t.Fatal(n, err)
+	} else if e, d := readSSE(t, br); e != "message" || d["channel"] != "news" || d["data"] != "hello" {
+		t.Fatal(e, d)
+	}
+
+	if _, err := c.Do("set", "a", "1"); err != nil {
+		t.Fatal(err)
+	} else if e, d := readSSE(t, br); e != "pmessage" || d["channel"] != "__keyspace@0__:a" || d["data"] != "set" {
+		t.Fatal(e, d)
+	}
+
+	if e, _ := readSSE(t, br); e != ": heartbeat" {
+		t.Fatal(e)
+	}
+
+	// WebSocket
+	conn, err := net.Dial("tcp", cfg.HttpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET /subscribe?channel=news HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", cfg.HttpAddr)
+
+	wbr := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(wbr, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal(resp.StatusCode, resp.Header)
+	}
+
+	if op, b := readWS(t, wbr); op != wsOpText || string(b) != `{"type":"subscribe","channel":"news","count":1}` {
+		t.Fatal(op, string(b))
+	}
+
+	if n, err := goredis.Int(c.Do("publish", "news", "hi")); err != nil || n != 2 {
+		t.Fatal(n, err)
+	} else if op, b := readWS(t, wbr); op != wsOpText || string(b) != `{"type":"message","channel":"news","data":"hi"}` {
+		t.Fatal(op, string(b))
+	}
+
+	writeWS(t, conn, wsOpPing, []byte("x"))
+	for {
+		// a heartbeat may come first
+		if op, b := readWS(t, wbr); op == wsOpPong {
+			if string(b) != "x" {
+				t.Fatal(string(b))
+			}
+			break
+		} else if op != wsOpPing {
+			t.Fatal(op)
+		}
+	}
+
+	writeWS(t, conn, wsOpClose, []byte{0x03, 0xe8})
+	if op, _ := readWS(t, wbr); op != wsOpClose {
+		t.Fatal(op)
+	}
+
+	// the subscriber is gone after the close
+	time.Sleep(100 * time.Millisecond)
+	if n, err := goredis.Int(c.Do("publish", "news", "bye")); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+
+	// errors
+	if r, err := http.Get(fmt.Sprintf("http://%s/subscribe", cfg.HttpAddr)); err != nil {
+		t.Fatal(err)
+	} else if r.Body.Close(); r.StatusCode != http.StatusBadRequest {
+		t.Fatal(r.StatusCode)
+	}
+
+	// RESP
+	sc, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	if v, err := goredis.MultiBulk(sc.Do("subscribe", "news")); err != nil || fmt.Sprintf("%s", v) != "[subscribe news %!s(int64=1)]" {
+		t.Fatal(v, err)
+	} else if v, err := goredis.MultiBulk(sc.Do("psubscribe", "n*")); err != nil || fmt.Sprintf("%s", v) != "[psubscribe n* %!s(int64=2)]" {
+		t.Fatal(v, err)
+	}
+
+	if n, err := goredis.Int(c.Do("publish", "news", "resp")); err != nil || n != 3 {
+		t.Fatal(n, err)
+	} else if v, err := goredis.MultiBulk(sc.Receive()); err != nil || fmt.Sprintf("%s", v) != "[message news resp]" {
+		t.Fatal(v, err)
+	} else if v, err := goredis.MultiBulk(sc.Receive()); err != nil || fmt.Sprintf("%s", v) != "[pmessage n* news resp]" {
+		t.Fatal(v, err)
+	}
+
+	// the ACL is checked
+	if _, err := c.Do("acl", "setuser", "nosub", "on", "nopass", "allcommands", "-@pubsub"); err != nil {
+		t.Fatal(err)
+	}
+	ac, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ac.Close()
+
+	if _, err := ac.Do("auth", "nosub", "x"); err != nil {
+		t.Fatal(err)
+	} else if _, err := ac.Do("subscribe", "news"); err == nil || !strings.Contains(err.Error(), "NOPERM") {
+		t.Fatal(err)
+	} else if _, err := ac.Do("psubscribe", "n*"); err == nil || !strings.Contains(err.Error(), "NOPERM") {
+		t.Fatal(err)
+	}
+}
+
+func TestHttpSubscribeLimit(t *testing.T) {
+	s := newHTTPSubscriber([]string{"c"}, []string{"c*"}, 10)
+
+	if n := s.publish([]byte("c"), []byte("1234")); n != 2 {
+		t.Fatal(n)
+	} else if s.overflowed() {
+		t.Fatal("must not overflow")
+	} else if q := s.take(); len(q) != 2 || q[0].Type != "message" || q[1].Type != "pmessage" || q[1].Pattern != "c*" {
+		t.Fatal(q)
+	}
+
+	s.publish([]byte("c"), []byte("12345678"))
+	if !s.overflowed() {
+		t.Fatal("must overflow")
+	}
+
+	select {
+	case <-s.quit:
+	default:
+		t.Fatal("must be closed")
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The admin console is served under the reserved /ui path, it runs the
+// commands with the JSON API of the command endpoint.
+const uiPath = "/ui/"
+
+var errHTTPCrossOrigin = errors.New("the commands which are not read only can't be sent by the pages of other origins")
+
+var uiETag = func() string {
+	h := sha1.Sum([]byte(uiIndexHTML))
+	return `"` + hex.EncodeToString(h[:]) + `"`
+}()
+
+// uiHandler serves the page of the admin console, after the authentication
+// for the browsers to send the credentials with the commands of the page.
+func (app *App) uiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == strings.TrimSuffix(uiPath, "/") {
+		http.Redirect(w, r, uiPath, http.StatusMovedPermanently)
+		return
+	} else if r.URL.Path != uiPath && r.URL.Path != uiPath+"index.html" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := app.httpUser(r); err != nil {
+		writeHTTPAuthError(w, err)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("ETag", uiETag)
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'; frame-ancestors 'none'")
+
+	if r.Header.Get("If-None-Match") == uiETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	} else if r.Method == "HEAD" {
+		return
+	}
+
+	io.WriteString(w, uiIndexHTML)
+}
+
+// httpCrossSite reports whether a browser sends the request for a page of
+// another origin, with the credentials it keeps for the console, or with
+// none for a default user without password. The Bearer tokens are not
+// sent by the browsers on their own, and the clients which are not
+// browsers send none of the Sec-Fetch-Site, Origin and Referer headers.
+func httpCrossSite(r *http.Request) bool {
+	if strings.HasPrefix(strings.ToLower(r.Header.Get("Authorization")), "bearer ") {
+		return false
+	}
+
+	if site := r.Header.Get("Sec-Fetch-Site"); len(site) > 0 {
+		return site != "same-origin" && site != "none"
+	}
+
+	for _, h := range []string{"Origin", "Referer"} {
+		if v := r.Header.Get(h); len(v) > 0 {
+			u, err := url.Parse(v)
+			if err != nil || !strings.EqualFold(u.Host, r.Host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkHTTPCrossSite rejects the commands which are not read only, sent by
+// the pages of other origins.
+func checkHTTPCrossSite(crossSite bool, cmd string) error {
+	if c, ok := regCmds[cmd]; ok && c.flags&cmdReadOnly != 0 {
+		return nil
+	} else if crossSite {
+		return errHTTPCrossOrigin
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/r0123r/vredis/config"
+)
+
+func TestHttpUI(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_http_ui"
+	cfg.Addr = "127.0.0.1:11217"
+	cfg.HttpAddr = "127.0.0.1:11218"
+	cfg.AuthPassword = "secret"
+	cfg.HTTP.Tokens = []string{"default tok"}
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	go s.Run()
+
+	// the redirects are checked
+	c := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	do := func(method string, path string, header map[string]string, body string) (*http.Response, string) {
+		req, err := http.NewRequest(method, "http://"+cfg.HttpAddr+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		if len(req.Header.Get("Authorization")) == 0 {
+			req.SetBasicAuth("default", "secret")
+		}
+
+		r, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+
+		b, _ := ioutil.ReadAll(r.Body)
+		return r, string(b)
+	}
+
+	if r, _ := do("GET", "/ui", nil, ""); r.StatusCode != http.StatusMovedPermanently || r.Header.Get("Location") != "/ui/" {
+		t.Fatal(r.StatusCode, r.Header)
+	} else if r, _ := do("GET", "/ui/", map[string]string{"Authorization": "Basic eDp5"}, ""); r.StatusCode != http.StatusUnauthorized || r.Header.Get("WWW-Authenticate") == "" {
+		t.Fatal(r.StatusCode, r.Header)
+	} else if r, _ := do("GET", "/ui/nope.js", nil, ""); r.StatusCode != http.StatusNotFound {
+		t.Fatal(r.StatusCode)
+	} else if r, _ := do("POST", "/ui/", nil, ""); r.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatal(r.StatusCode)
+	}
+
+	r, b := do("GET", "/ui/", nil, "")
+	if r.StatusCode != http.StatusOK || !strings.HasPrefix(r.Header.Get("Content-Type"), "text/html") || b != uiIndexHTML {
+		t.Fatal(r.StatusCode, r.Header)
+	} else if r, b := do("GET", "/ui/", map[string]string{"If-None-Match": r.Header.Get("ETag")}, ""); r.StatusCode != http.StatusNotModified || len(b) != 0 {
+		t.Fatal(r.StatusCode)
+	}
+
+	// the commands of the page are sent with its origin
+	if r, b := do("POST", "/0", map[string]string{"Origin": "http://" + cfg.HttpAddr, "Sec-Fetch-Site": "same-origin"}, `{"cmd":"set","args":["a","1"]}`); r.StatusCode != http.StatusOK || b != `{"set":[true,"OK"]}` {
+		t.Fatal(r.StatusCode, b)
+	}
+
+	// the pages of other origins can't write with the credentials of the
+	// browser, with or without the Origin header
+	for _, h := range []map[string]string{
+		{"Origin": "http://evil.example"},
+		{"Sec-Fetch-Site": "cross-site"},
+		{"Sec-Fetch-Site": "same-site"},
+		{"Referer": "http://evil.example/page"},
+	} {
+		if _, b := do("POST", "/0", h, `{"cmd":"set","args":["a","2"]}`); !strings.Contains(b, errHTTPCrossOrigin.Error()) {
+			t.Fatal(h, b)
+		} else if r, _ := do("GET", "/0/set/a/2", h, ""); r.StatusCode != http.StatusForbidden {
+			t.Fatal(h, r.StatusCode)
+		} else if r, _ := do("GET", "/0/flushall", h, ""); r.StatusCode != http.StatusForbidden {
+			t.Fatal(h, r.StatusCode)
+		} else if r, _ := do("PUT", "/db/0/kv/a", h, "2"); r.StatusCode != http.StatusForbidden {
+			t.Fatal(h, r.StatusCode)
+		}
+
+		// but they can read
+		if r, b := do("GET", "/get/a", h, ""); r.StatusCode != http.StatusOK || b != `{"get":"1"}` {
+			t.Fatal(h, r.StatusCode, b)
+		}
+	}
+
+	// the tokens are not sent by the browsers on their own
+	if r, b := do("POST", "/0", map[string]string{"Origin": "http://dashboard.example", "Authorization": "Bearer tok"}, `{"cmd":"set","args":["a","3"]}`); r.StatusCode != http.StatusOK || b != `{"set":[true,"OK"]}` {
+		t.Fatal(r.StatusCode, b)
+	}
+
+	// the page is generated from server/ui/index.html
+	if src, err := ioutil.ReadFile("ui/index.html"); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(src, []byte(uiIndexHTML)) {
+		t.Fatal("server/ui_assets.go is not generated from server/ui/index.html, run tools/generate_ui.py")
+	}
+}
+
+func TestHttpUIDisabled(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_http_ui_disabled"
+	cfg.Addr = "127.0.0.1:11220"
+	cfg.HttpAddr = "127.0.0.1:11221"
+	cfg.HTTP.UI = false
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	go s.Run()
+
+	r, err := http.Get("http://" + cfg.HttpAddr + "/ui/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	// the path is a command
+	if b, _ := ioutil.ReadAll(r.Body); strings.Contains(string(b), "<html") {
+		t.Fatal(string(b))
+	}
+}
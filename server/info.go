@@ -6,6 +6,7 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -14,16 +15,75 @@ import (
 	"github.com/siddontang/go/sync2"
 )
 
+// instantaneous_ops_per_sec is the average of the samples, taken
+// every opsSampleInterval, like redis.
+const (
+	opsSampleInterval = 100 * time.Millisecond
+	opsSamples        = 16
+)
+
+// the upper bounds of the command duration histogram buckets, in seconds
+var commandDurationBuckets = [...]float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005,
+	0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type commandStat struct {
+	calls sync2.AtomicInt64
+	usec  sync2.AtomicInt64
+	// rejected before the execution, like for the arity or ACL errors
+	rejected sync2.AtomicInt64
+	// executed with an error
+	failed sync2.AtomicInt64
+
+	// calls by duration, buckets[i] counts the calls in
+	// (commandDurationBuckets[i-1], commandDurationBuckets[i]]
+	buckets [len(commandDurationBuckets)]sync2.AtomicInt64
+}
+
+func (s *commandStat) observe(d time.Duration) {
+	s.calls.Add(1)
+	s.usec.Add(int64(d / time.Microsecond))
+
+	sec := d.Seconds()
+	for i, le := range commandDurationBuckets {
+		if sec <= le {
+			s.buckets[i].Add(1)
+			return
+		}
+	}
+}
+
 type info struct {
 	sync.Mutex
 
 	app *App
 
+	quit chan struct{}
+
 	Server struct {
 		OS         string
 		ProceessId int
+		StartTime  time.Time
 	}
 
+	Stats struct {
+		TotalConnections    sync2.AtomicInt64
+		RejectedConnections sync2.AtomicInt64
+		TotalCommands       sync2.AtomicInt64
+		TotalErrors         sync2.AtomicInt64
+		BlockedClients      sync2.AtomicInt64
+	}
+
+	// ops per second samples, protected by the mutex
+	ops          [opsSamples]int64
+	opsIndex     int
+	lastCommands int64
+
+	cmdLock  sync.RWMutex
+	commands map[string]*commandStat
+
+	// error reply counts by the error prefix, protected by the mutex
+	errors map[string]int64
+
 	Replication struct {
 		PubLogNum          sync2.AtomicInt64
 		PubLogAckNum       sync2.AtomicInt64
@@ -40,12 +100,136 @@ func newInfo(app *App) (i *info, err error) {
 
 	i.Server.OS = runtime.GOOS
 	i.Server.ProceessId = os.Getpid()
+	i.Server.StartTime = time.Now()
+
+	i.commands = make(map[string]*commandStat)
+	i.errors = make(map[string]int64)
+
+	i.quit = make(chan struct{})
+	go i.sampleOps()
 
 	return i, nil
 }
 
 func (i *info) Close() {
+	close(i.quit)
+}
 
+func (i *info) sampleOps() {
+	t := time.NewTicker(opsSampleInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			n := i.Stats.TotalCommands.Get()
+
+			i.Lock()
+			i.ops[i.opsIndex] = (n - i.lastCommands) * int64(time.Second/opsSampleInterval)
+			i.opsIndex = (i.opsIndex + 1) % opsSamples
+			i.lastCommands = n
+			i.Unlock()
+		case <-i.quit:
+			return
+		}
+	}
+}
+
+func (i *info) opsPerSec() int64 {
+	i.Lock()
+	defer i.Unlock()
+
+	var sum int64
+	for _, n := range i.ops {
+		sum += n
+	}
+	return sum / opsSamples
+}
+
+func (i *info) commandStat(name string) *commandStat {
+	i.cmdLock.RLock()
+	s, ok := i.commands[name]
+	i.cmdLock.RUnlock()
+	if ok {
+		return s
+	}
+
+	i.cmdLock.Lock()
+	defer i.cmdLock.Unlock()
+
+	if s, ok = i.commands[name]; !ok {
+		s = new(commandStat)
+		i.commands[name] = s
+	}
+	return s
+}
+
+// recordCommand adds a command to the stats, cmd is nil for an unknown
+// command and executed is false if it was rejected before the execution.
+func (i *info) recordCommand(cmd *command, executed bool, d time.Duration, err error) {
+	if err != nil {
+		i.recordError(err)
+	}
+
+	if cmd == nil {
+		return
+	}
+
+	s := i.commandStat(cmd.name)
+	if !executed {
+		s.rejected.Add(1)
+		return
+	}
+
+	i.Stats.TotalCommands.Add(1)
+	s.observe(d)
+	if err != nil {
+		s.failed.Add(1)
+	}
+}
+
+// errorPrefix returns the error code of the reply, the first word if it is
+// upper case like NOPERM or WRONGTYPE, otherwise ERR.
+func errorPrefix(err error) string {
+	msg := err.Error()
+	if n := strings.IndexByte(msg, ' '); n > 0 {
+		msg = msg[:n]
+	}
+
+	for _, c := range msg {
+		if (c < 'A' || c > 'Z') && c != '_' && c != '-' {
+			return "ERR"
+		}
+	}
+	return msg
+}
+
+func (i *info) recordError(err error) {
+	i.Stats.TotalErrors.Add(1)
+
+	prefix := errorPrefix(err)
+
+	i.Lock()
+	i.errors[prefix]++
+	i.Unlock()
+}
+
+// resetStats resets the stats, commandstats and errorstats, for CONFIG RESETSTAT.
+func (i *info) resetStats() {
+	i.Stats.TotalConnections.Set(0)
+	i.Stats.RejectedConnections.Set(0)
+	i.Stats.TotalCommands.Set(0)
+	i.Stats.TotalErrors.Set(0)
+
+	i.cmdLock.Lock()
+	i.commands = make(map[string]*commandStat)
+	i.cmdLock.Unlock()
+
+	i.Lock()
+	i.errors = make(map[string]int64)
+	i.ops = [opsSamples]int64{}
+	i.lastCommands = 0
+	i.Unlock()
 }
 
 func getMemoryHuman(m uint64) string {
@@ -63,8 +247,12 @@ func getMemoryHuman(m uint64) string {
 func (i *info) Dump(section string) []byte {
 	buf := &bytes.Buffer{}
 	switch strings.ToLower(section) {
-	case "":
+	case "", "default":
+		i.dumpAll(buf)
+	case "all", "everything":
 		i.dumpAll(buf)
+		buf.Write(Delims)
+		i.dumpCommandStats(buf)
 	case "server":
 		i.dumpServer(buf)
 	case "mem":
@@ -77,6 +265,18 @@ func (i *info) Dump(section string) []byte {
 		i.dumpStore(buf)
 	case "replication":
 		i.dumpReplication(buf)
+	case "clients":
+		i.dumpClients(buf)
+	case "stats":
+		i.dumpStats(buf)
+	case "persistence":
+		i.dumpPersistence(buf)
+	case "commandstats":
+		i.dumpCommandStats(buf)
+	case "errorstats":
+		i.dumpErrorStats(buf)
+	case "keyspace":
+		i.dumpKeyspace(buf)
 	default:
 		buf.WriteString(fmt.Sprintf("# %s\r\n", section))
 	}
@@ -92,6 +292,8 @@ type infoPair struct {
 func (i *info) dumpAll(buf *bytes.Buffer) {
 	i.dumpServer(buf)
 	buf.Write(Delims)
+	i.dumpClients(buf)
+	buf.Write(Delims)
 	i.dumpStore(buf)
 	buf.Write(Delims)
 	i.dumpMem(buf)
@@ -100,12 +302,20 @@ func (i *info) dumpAll(buf *bytes.Buffer) {
 	buf.Write(Delims)
 	i.dumpGC(buf)
 	buf.Write(Delims)
+	i.dumpPersistence(buf)
+	buf.Write(Delims)
+	i.dumpStats(buf)
+	buf.Write(Delims)
 	i.dumpReplication(buf)
+	buf.Write(Delims)
+	i.dumpErrorStats(buf)
 }
 
 func (i *info) dumpServer(buf *bytes.Buffer) {
 	buf.WriteString("# Server\r\n")
 
+	uptime := time.Since(i.Server.StartTime)
+
 	i.dumpPairs(buf, infoPair{"os", i.Server.OS},
 		infoPair{"process_id", i.Server.ProceessId},
 		infoPair{"addr", i.app.cfg.Addr},
@@ -116,9 +326,153 @@ func (i *info) dumpServer(buf *bytes.Buffer) {
 		infoPair{"resp_client_num", i.app.respClientNum()},
 		infoPair{"ledisdb_version", ledis.Version},
 		infoPair{"redis_version", "vredis " + i.app.build},
+		infoPair{"uptime_in_seconds", int64(uptime.Seconds())},
+		infoPair{"uptime_in_days", int64(uptime.Hours() / 24)},
+	)
+}
+
+func (i *info) dumpClients(buf *bytes.Buffer) {
+	buf.WriteString("# Clients\r\n")
+
+	app := i.app
+
+	var pubsub int
+	var maxQbuf int64
+
+	app.rcm.Lock()
+	connected := len(app.rcs)
+	for rc := range app.rcs {
+		if len(rc.channels)+len(rc.patterns) > 0 {
+			pubsub++
+		}
+		if qbuf := rc.stat.qbuf.Get(); qbuf > maxQbuf {
+			maxQbuf = qbuf
+		}
+	}
+	app.rcm.Unlock()
+
+	i.dumpPairs(buf, infoPair{"connected_clients", connected},
+		infoPair{"client_recent_max_input_buffer", maxQbuf},
+		infoPair{"client_recent_max_output_buffer", 0},
+		infoPair{"blocked_clients", i.Stats.BlockedClients.Get()},
+		infoPair{"pubsub_clients", pubsub},
+		infoPair{"monitor_clients", app.monitors.n.Get()},
 	)
 }
 
+func (i *info) dumpStats(buf *bytes.Buffer) {
+	buf.WriteString("# Stats\r\n")
+
+	// the store gets include the internal meta lookups, so the keyspace
+	// hits and misses are approximate
+	s := i.app.ldb.StoreStat()
+	gets := s.GetNum.Get()
+	misses := s.GetMissingNum.Get()
+
+	i.dumpPairs(buf, infoPair{"total_connections_received", i.Stats.TotalConnections.Get()},
+		infoPair{"total_commands_processed", i.Stats.TotalCommands.Get()},
+		infoPair{"instantaneous_ops_per_sec", i.opsPerSec()},
+		infoPair{"rejected_connections", i.Stats.RejectedConnections.Get()},
+		infoPair{"expired_keys", i.app.ldb.ExpiredKeys()},
+		infoPair{"evicted_keys", 0},
+		infoPair{"keyspace_hits", gets - misses},
+		infoPair{"keyspace_misses", misses},
+		infoPair{"total_error_replies", i.Stats.TotalErrors.Get()},
+	)
+}
+
+func (i *info) dumpPersistence(buf *bytes.Buffer) {
+	buf.WriteString("# Persistence\r\n")
+
+	snap := i.app.snap
+
+	status := "ok"
+	if !snap.lastOK.Get() {
+		status = "err"
+	}
+
+	inProgress := 0
+	if snap.dumping.Get() {
+		inProgress = 1
+	}
+
+	lastTime := int64(-1)
+	if d := snap.lastDuration.Get(); d > 0 {
+		lastTime = int64(d.Seconds())
+	}
+
+	i.dumpPairs(buf, infoPair{"loading", 0},
+		infoPair{"rdb_bgsave_in_progress", inProgress},
+		infoPair{"rdb_last_save_time", snap.lastSave.Get()},
+		infoPair{"rdb_last_bgsave_status", status},
+		infoPair{"rdb_last_bgsave_time_sec", lastTime},
+		infoPair{"aof_enabled", 0},
+		infoPair{"snapshot_path", i.app.cfg.Snapshot.Path},
+	)
+}
+
+func (i *info) dumpCommandStats(buf *bytes.Buffer) {
+	buf.WriteString("# Commandstats\r\n")
+
+	i.cmdLock.RLock()
+	names := make([]string, 0, len(i.commands))
+	for name := range i.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		s := i.commands[name]
+
+		calls := s.calls.Get()
+		usec := s.usec.Get()
+		perCall := float64(0)
+		if calls > 0 {
+			perCall = float64(usec) / float64(calls)
+		}
+
+		fmt.Fprintf(buf, "cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d\r\n",
+			name, calls, usec, perCall, s.rejected.Get(), s.failed.Get())
+	}
+	i.cmdLock.RUnlock()
+}
+
+func (i *info) dumpErrorStats(buf *bytes.Buffer) {
+	buf.WriteString("# Errorstats\r\n")
+
+	i.Lock()
+	prefixes := make([]string, 0, len(i.errors))
+	for prefix := range i.errors {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		fmt.Fprintf(buf, "errorstat_%s:count=%d\r\n", prefix, i.errors[prefix])
+	}
+	i.Unlock()
+}
+
+// dumpKeyspace iterates over the keys of every database, see KeyspaceStat,
+// it is only dumped by INFO keyspace.
+func (i *info) dumpKeyspace(buf *bytes.Buffer) {
+	buf.WriteString("# Keyspace\r\n")
+
+	for index := 0; index < i.app.cfg.Databases; index++ {
+		db, err := i.app.ldb.Select(index)
+		if err != nil {
+			continue
+		}
+
+		keys, expires, avgTTL, err := db.KeyspaceStat()
+		if err != nil || keys == 0 {
+			continue
+		}
+
+		fmt.Fprintf(buf, "db%d:keys=%d,expires=%d,avg_ttl=%d\r\n", index, keys, expires, avgTTL)
+	}
+}
+
 func (i *info) dumpMemory(buf *bytes.Buffer) {
 	buf.WriteString("# Memory\r\n")
 
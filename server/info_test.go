@@ -0,0 +1,171 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func TestInfoErrorPrefix(t *testing.T) {
+	tests := map[string]string{
+		"NOPERM this user has no permissions": "NOPERM",
+		"WRONGTYPE Operation against a key":   "WRONGTYPE",
+		"invalid command param":               "ERR",
+		"ERR":                                 "ERR",
+		"Not authenticated":                   "ERR",
+	}
+
+	for msg, prefix := range tests {
+		if v := errorPrefix(errors.New(msg)); v != prefix {
+			t.Fatalf("%q: %s != %s", msg, v, prefix)
+		}
+	}
+}
+
+func parseInfo(s string) map[string]string {
+	m := make(map[string]string)
+	for _, line := range strings.Split(s, "\r\n") {
+		if n := strings.IndexByte(line, ':'); n > 0 && !strings.HasPrefix(line, "#") {
+			m[line[:n]] = line[n+1:]
+		}
+	}
+	return m
+}
+
+func TestInfoSections(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_info"
+	cfg.Addr = "127.0.0.1:11194"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	c, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Do("set", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("get", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("get"); err == nil {
+		t.Fatal("must error")
+	}
+	if _, err := c.Do("incrby", "a", "b"); err == nil {
+		t.Fatal("must error")
+	}
+	if _, err := c.Do("nosuchcommand"); err == nil {
+		t.Fatal("must error")
+	}
+	if _, err := c.Do("set", "b", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("expire", "b", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("set", "c", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("expire", "c", 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("select", 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("hset", "h", "f", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := goredis.String(c.Do("info", "all"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, section := range []string{"Server", "Clients", "Persistence", "Stats", "Commandstats", "Errorstats"} {
+		if !strings.Contains(v, "# "+section+"\r\n") {
+			t.Fatalf("no %s section", section)
+		}
+	}
+
+	// the keyspace iterates over the keys, only on demand
+	if strings.Contains(v, "# Keyspace") {
+		t.Fatal(v)
+	}
+	k, err := goredis.String(c.Do("info", "keyspace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := parseInfo(v + k)
+	if m["connected_clients"] != "1" {
+		t.Fatal(m["connected_clients"])
+	} else if m["total_connections_received"] != "1" {
+		t.Fatal(m["total_connections_received"])
+	} else if m["rdb_last_bgsave_status"] != "ok" {
+		t.Fatal(m["rdb_last_bgsave_status"])
+	} else if m["db3"] != "keys=1,expires=0,avg_ttl=0" {
+		t.Fatal(m["db3"])
+	} else if !strings.HasPrefix(m["db0"], "keys=3,expires=2,avg_ttl=") {
+		t.Fatal(m["db0"])
+	} else if !strings.HasPrefix(m["cmdstat_set"], "calls=3,usec=") {
+		t.Fatal(m["cmdstat_set"])
+	} else if !strings.HasPrefix(m["cmdstat_get"], "calls=1,") || !strings.HasSuffix(m["cmdstat_get"], ",rejected_calls=1,failed_calls=0") {
+		t.Fatal(m["cmdstat_get"])
+	} else if !strings.HasSuffix(m["cmdstat_incrby"], ",rejected_calls=0,failed_calls=1") {
+		t.Fatal(m["cmdstat_incrby"])
+	} else if m["errorstat_ERR"] != "count=3" {
+		t.Fatal(m["errorstat_ERR"])
+	} else if m["total_error_replies"] != "3" {
+		t.Fatal(m["total_error_replies"])
+	}
+
+	// the default sections have no commandstats
+	if v, err := goredis.String(c.Do("info")); err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(v, "# Commandstats") || strings.Contains(v, "# Keyspace") {
+		t.Fatal(v)
+	}
+
+	for i := 0; ; i++ {
+		v, err := goredis.String(c.Do("info", "stats"))
+		if err != nil {
+			t.Fatal(err)
+		} else if parseInfo(v)["expired_keys"] == "1" {
+			break
+		} else if i == 50 {
+			t.Fatal(v)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if _, err := c.Do("config", "resetstat"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.String(c.Do("info", "commandstats")); err != nil {
+		t.Fatal(err)
+	} else if strings.Contains(v, "cmdstat_get") {
+		t.Fatal(v)
+	}
+
+	if v, err := goredis.String(c.Do("info", "errorstats")); err != nil {
+		t.Fatal(err)
+	} else if v != "# Errorstats\r\n" {
+		t.Fatal(v)
+	}
+}
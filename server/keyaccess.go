@@ -0,0 +1,134 @@
+package server
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// approximated access frequency, same as the redis LFU counter
+const (
+	lfuInitVal   = 5
+	lfuLogFactor = 10
+	lfuDecayTime = 60 * 1000 // ms to decrement the counter by one
+)
+
+type keyAccessKey struct {
+	db  int
+	key string
+}
+
+type keyAccess struct {
+	// last access time in ms
+	atime int64
+	freq  uint8
+}
+
+type keyAccessTracker struct {
+	sync.Mutex
+
+	start   int64
+	maxKeys int
+
+	keys map[keyAccessKey]*keyAccess
+}
+
+func newKeyAccessTracker(maxKeys int) *keyAccessTracker {
+	t := new(keyAccessTracker)
+	t.start = nowMs()
+	t.maxKeys = maxKeys
+	t.keys = make(map[keyAccessKey]*keyAccess)
+	return t
+}
+
+func nowMs() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func (t *keyAccessTracker) touchCommand(db int, cmd *command, args [][]byte) {
+	for _, key := range cmd.keys(args) {
+		t.touch(db, key)
+	}
+}
+
+func (t *keyAccessTracker) touch(db int, key []byte) {
+	now := nowMs()
+	k := keyAccessKey{db, string(key)}
+
+	t.Lock()
+	a, ok := t.keys[k]
+	if !ok {
+		if len(t.keys) >= t.maxKeys {
+			t.evict()
+		}
+		a = &keyAccess{atime: now, freq: lfuInitVal}
+		t.keys[k] = a
+	} else {
+		a.freq = lfuLogIncr(lfuDecr(a, now))
+		a.atime = now
+	}
+	t.Unlock()
+}
+
+// evict drops some records, map iteration order is random enough.
+func (t *keyAccessTracker) evict() {
+	n := t.maxKeys / 100
+	if n == 0 {
+		n = 1
+	}
+
+	for k := range t.keys {
+		delete(t.keys, k)
+		if n--; n == 0 {
+			return
+		}
+	}
+}
+
+// idleTime returns the idle seconds of the key, or the time since
+// tracking started if the key was never accessed.
+func (t *keyAccessTracker) idleTime(db int, key []byte) int64 {
+	now := nowMs()
+
+	t.Lock()
+	defer t.Unlock()
+
+	if a, ok := t.keys[keyAccessKey{db, string(key)}]; ok {
+		return (now - a.atime) / 1000
+	}
+	return (now - t.start) / 1000
+}
+
+func (t *keyAccessTracker) frequency(db int, key []byte) int64 {
+	t.Lock()
+	defer t.Unlock()
+
+	if a, ok := t.keys[keyAccessKey{db, string(key)}]; ok {
+		return int64(lfuDecr(a, nowMs()))
+	}
+	return 0
+}
+
+func lfuDecr(a *keyAccess, now int64) uint8 {
+	periods := (now - a.atime) / lfuDecayTime
+	if periods >= int64(a.freq) {
+		return 0
+	}
+	return a.freq - uint8(periods)
+}
+
+func lfuLogIncr(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+
+	base := float64(counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+
+	if rand.Float64() < 1.0/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/hack"
+	"github.com/siddontang/go/sync2"
+)
+
+// the command execution event, the others are reported by ledis
+const latencyEventCommand = "command"
+
+// samples kept for each event, one per second at most
+const latencyHistoryLen = 160
+
+type latencySample struct {
+	time int64 // unix seconds
+	ms   int64
+}
+
+type latencyEvent struct {
+	// ring buffer of the samples, the newest is at samples[(head-1) % len]
+	samples [latencyHistoryLen]latencySample
+	head    int
+	n       int
+
+	max int64
+}
+
+func (e *latencyEvent) latest() latencySample {
+	return e.samples[(e.head-1+latencyHistoryLen)%latencyHistoryLen]
+}
+
+// history returns the samples, oldest first.
+func (e *latencyEvent) history() []latencySample {
+	h := make([]latencySample, e.n)
+	for i := range h {
+		h[i] = e.samples[(e.head-e.n+i+latencyHistoryLen)%latencyHistoryLen]
+	}
+	return h
+}
+
+// latencyMonitor records the events slower than the threshold, like the
+// redis latency monitor.
+type latencyMonitor struct {
+	// milliseconds, 0 disables it
+	threshold sync2.AtomicInt64
+
+	sync.Mutex
+	events map[string]*latencyEvent
+}
+
+func newLatencyMonitor(threshold int64) *latencyMonitor {
+	m := new(latencyMonitor)
+	m.threshold.Set(threshold)
+	m.events = make(map[string]*latencyEvent)
+	return m
+}
+
+// observe is the ledis.LatencyObserver of the app.
+func (m *latencyMonitor) observe(event string, d time.Duration) {
+	threshold := m.threshold.Get()
+	ms := int64(d / time.Millisecond)
+	if threshold <= 0 || ms < threshold {
+		return
+	}
+
+	now := time.Now().Unix()
+
+	m.Lock()
+	defer m.Unlock()
+
+	e, ok := m.events[event]
+	if !ok {
+		e = new(latencyEvent)
+		m.events[event] = e
+	}
+
+	if ms > e.max {
+		e.max = ms
+	}
+
+	// one sample per second, keep the max
+	if e.n > 0 {
+		if last := &e.samples[(e.head-1+latencyHistoryLen)%latencyHistoryLen]; last.time == now {
+			if ms > last.ms {
+				last.ms = ms
+			}
+			return
+		}
+	}
+
+	e.samples[e.head] = latencySample{now, ms}
+	e.head = (e.head + 1) % latencyHistoryLen
+	if e.n < latencyHistoryLen {
+		e.n++
+	}
+}
+
+func (m *latencyMonitor) eventNames() []string {
+	names := make([]string, 0, len(m.events))
+	for name := range m.events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// doctor returns a human readable report of the events.
+func (m *latencyMonitor) doctor() string {
+	m.Lock()
+	defer m.Unlock()
+
+	var buf bytes.Buffer
+
+	if len(m.events) == 0 {
+		if m.threshold.Get() <= 0 {
+			buf.WriteString("The latency monitor is disabled, set latency_monitor_threshold in the config or with CONFIG SET latency-monitor-threshold <milliseconds> to enable it.\n")
+		} else {
+			buf.WriteString("No latency spike was observed during the lifetime of this instance.\n")
+		}
+		return buf.String()
+	}
+
+	buf.WriteString("Latency spikes were observed in this instance.\n\n")
+
+	advices := make([]string, 0, len(m.events))
+	for i, name := range m.eventNames() {
+		e := m.events[name]
+		h := e.history()
+
+		var sum int64
+		for _, s := range h {
+			sum += s.ms
+		}
+		avg := sum / int64(len(h))
+
+		var dev int64
+		for _, s := range h {
+			if s.ms > avg {
+				dev += s.ms - avg
+			} else {
+				dev += avg - s.ms
+			}
+		}
+		dev /= int64(len(h))
+
+		period := float64(h[len(h)-1].time-h[0].time) / float64(len(h))
+
+		fmt.Fprintf(&buf, "%d. %s: %d latency spikes (average %dms, mean deviation %dms, period %.2f sec). Worst all time event %dms.\n",
+			i+1, name, len(h), avg, dev, period, e.max)
+
+		switch name {
+		case latencyEventCommand:
+			advices = append(advices, "- Check SLOWLOG GET for the slow commands, avoid the commands on big keys like HGETALL, SMEMBERS or LRANGE 0 -1, and use the SCAN family to iterate.")
+		case ledis.LatencyBatchCommit:
+			advices = append(advices, "- The batch commits are slow, check the disk and the write_buffer_size of the store, and avoid big writes in one command.")
+		case ledis.LatencyFsync:
+			advices = append(advices, "- The replication log fsyncs are slow, sync_log = 2 syncs every write, sync_log = 1 syncs once per second, or use a faster disk.")
+		case ledis.LatencyTTLCheck:
+			advices = append(advices, "- The TTL check cycles are slow, too many keys expire at the same time, spread the expire times or raise ttl_check_interval.")
+		}
+	}
+
+	buf.WriteString("\nI have a few advices for you:\n\n")
+	for _, a := range advices {
+		buf.WriteString(a)
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+// LATENCY LATEST | HISTORY event | RESET [event ...] | DOCTOR | HELP
+func latencyCommand(c *client) error {
+	m := c.app.latency
+	args := c.args[1:]
+
+	switch strings.ToLower(hack.String(c.args[0])) {
+	case "latest":
+		m.Lock()
+		names := m.eventNames()
+		ay := make([]interface{}, len(names))
+		for i, name := range names {
+			e := m.events[name]
+			s := e.latest()
+			ay[i] = []interface{}{[]byte(name), s.time, s.ms, e.max}
+		}
+		m.Unlock()
+
+		c.resp.writeArray(ay)
+	case "history":
+		if len(args) != 1 {
+			return ErrCmdParams
+		}
+
+		m.Lock()
+		var h []latencySample
+		if e, ok := m.events[strings.ToLower(hack.String(args[0]))]; ok {
+			h = e.history()
+		}
+		m.Unlock()
+
+		ay := make([]interface{}, len(h))
+		for i, s := range h {
+			ay[i] = []interface{}{s.time, s.ms}
+		}
+		c.resp.writeArray(ay)
+	case "reset":
+		m.Lock()
+		var n int64
+		if len(args) == 0 {
+			n = int64(len(m.events))
+			m.events = make(map[string]*latencyEvent)
+		} else {
+			for _, name := range args {
+				if _, ok := m.events[strings.ToLower(hack.String(name))]; ok {
+					delete(m.events, strings.ToLower(hack.String(name)))
+					n++
+				}
+			}
+		}
+		m.Unlock()
+
+		c.resp.writeInteger(n)
+	case "doctor":
+		c.resp.writeBulk([]byte(m.doctor()))
+	case "help":
+		c.resp.writeSliceArray([][]byte{
+			[]byte("LATENCY LATEST"),
+			[]byte("LATENCY HISTORY <event>"),
+			[]byte("LATENCY RESET [<event> ...]"),
+			[]byte("LATENCY DOCTOR"),
+		})
+	default:
+		return ErrSyntax
+	}
+
+	return nil
+}
+
+func init() {
+	register("latency", latencyCommand)
+}
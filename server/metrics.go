@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metricsWriter writes the Prometheus text exposition format.
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+func (m *metricsWriter) header(name string, typ string, help string) {
+	fmt.Fprintf(&m.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample, labels are name and value pairs.
+func (m *metricsWriter) sample(name string, v interface{}, labels ...string) {
+	m.buf.WriteString(name)
+	if len(labels) > 0 {
+		m.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.buf.WriteByte(',')
+			}
+			m.buf.WriteString(labels[i])
+			m.buf.WriteString(`="`)
+			m.buf.WriteString(escapeLabelValue(labels[i+1]))
+			m.buf.WriteByte('"')
+		}
+		m.buf.WriteByte('}')
+	}
+
+	switch v := v.(type) {
+	case float64:
+		fmt.Fprintf(&m.buf, " %s\n", strconv.FormatFloat(v, 'g', -1, 64))
+	default:
+		fmt.Fprintf(&m.buf, " %v\n", v)
+	}
+}
+
+func (m *metricsWriter) metric(name string, typ string, help string, v interface{}) {
+	m.header(name, typ, help)
+	m.sample(name, v)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func boolGauge(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (app *App) writeMetrics(m *metricsWriter) {
+	i := app.info
+
+	// commands
+	i.cmdLock.RLock()
+	names := make([]string, 0, len(i.commands))
+	for name := range i.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stats := make([]*commandStat, len(names))
+	for n, name := range names {
+		stats[n] = i.commands[name]
+	}
+	i.cmdLock.RUnlock()
+
+	m.header("vredis_commands_total", "counter", "Executed commands.")
+	for n, s := range stats {
+		m.sample("vredis_commands_total", s.calls.Get(), "cmd", names[n])
+	}
+	m.header("vredis_commands_rejected_total", "counter", "Commands rejected before the execution.")
+	for n, s := range stats {
+		m.sample("vredis_commands_rejected_total", s.rejected.Get(), "cmd", names[n])
+	}
+	m.header("vredis_commands_failed_total", "counter", "Commands executed with an error.")
+	for n, s := range stats {
+		m.sample("vredis_commands_failed_total", s.failed.Get(), "cmd", names[n])
+	}
+
+	m.header("vredis_command_duration_seconds", "histogram", "Command execution time.")
+	for n, s := range stats {
+		var count int64
+		for b, le := range commandDurationBuckets {
+			count += s.buckets[b].Get()
+			m.sample("vredis_command_duration_seconds_bucket", count,
+				"cmd", names[n], "le", strconv.FormatFloat(le, 'g', -1, 64))
+		}
+		calls := s.calls.Get()
+		m.sample("vredis_command_duration_seconds_bucket", calls, "cmd", names[n], "le", "+Inf")
+		m.sample("vredis_command_duration_seconds_sum", float64(s.usec.Get())/1e6, "cmd", names[n])
+		m.sample("vredis_command_duration_seconds_count", calls, "cmd", names[n])
+	}
+
+	i.Lock()
+	prefixes := make([]string, 0, len(i.errors))
+	for prefix := range i.errors {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	errCounts := make([]int64, len(prefixes))
+	for n, prefix := range prefixes {
+		errCounts[n] = i.errors[prefix]
+	}
+	i.Unlock()
+
+	m.header("vredis_errors_total", "counter", "Error replies by error prefix.")
+	for n, prefix := range prefixes {
+		m.sample("vredis_errors_total", errCounts[n], "prefix", prefix)
+	}
+
+	// connections
+	m.metric("vredis_connected_clients", "gauge", "Connected RESP clients.", app.respClientNum())
+	m.metric("vredis_blocked_clients", "gauge", "Clients blocked in a blocking command.", i.Stats.BlockedClients.Get())
+	m.metric("vredis_monitor_clients", "gauge", "Connected MONITOR clients.", app.monitors.n.Get())
+	m.metric("vredis_connections_received_total", "counter", "Accepted RESP connections.", i.Stats.TotalConnections.Get())
+	m.metric("vredis_rejected_connections_total", "counter", "Rejected connections.", i.Stats.RejectedConnections.Get())
+
+	// store
+	st := app.ldb.StoreStat()
+	m.metric("vredis_store_get_total", "counter", "Store gets.", st.GetNum.Get())
+	m.metric("vredis_store_get_missing_total", "counter", "Store gets of missing keys.", st.GetMissingNum.Get())
+	m.metric("vredis_store_get_seconds_total", "counter", "Time spent in the store gets.", st.GetTotalTime.Get().Seconds())
+	m.metric("vredis_store_put_total", "counter", "Store puts.", st.PutNum.Get())
+	m.metric("vredis_store_delete_total", "counter", "Store deletes.", st.DeleteNum.Get())
+	m.metric("vredis_store_iter_total", "counter", "Store iterators.", st.IterNum.Get())
+	m.metric("vredis_store_iter_seek_total", "counter", "Store iterator seeks.", st.IterSeekNum.Get())
+	m.metric("vredis_store_iter_close_total", "counter", "Closed store iterators.", st.IterCloseNum.Get())
+	m.metric("vredis_store_snapshot_total", "counter", "Store snapshots.", st.SnapshotNum.Get())
+	m.metric("vredis_store_batch_total", "counter", "Store write batches.", st.BatchNum.Get())
+	m.metric("vredis_store_batch_commit_total", "counter", "Store write batch commits.", st.BatchCommitNum.Get())
+	m.metric("vredis_store_batch_commit_seconds_total", "counter", "Time spent in the batch commits.", st.BatchCommitTotalTime.Get().Seconds())
+	m.metric("vredis_store_tx_total", "counter", "Store transactions.", st.TxNum.Get())
+	m.metric("vredis_store_tx_commit_total", "counter", "Store transaction commits.", st.TxCommitNum.Get())
+	m.metric("vredis_store_compact_total", "counter", "Store compactions.", st.CompactNum.Get())
+	m.metric("vredis_store_compact_seconds_total", "counter", "Time spent in the compactions.", st.CompactTotalTime.Get().Seconds())
+
+	// TTL checker
+	cycles, cycleTime := app.ldb.TTLCheckStat()
+	m.metric("vredis_expired_keys_total", "counter", "Keys deleted by the TTL checker.", app.ldb.ExpiredKeys())
+	m.metric("vredis_ttl_check_cycles_total", "counter", "TTL check cycles.", cycles)
+	m.metric("vredis_ttl_check_seconds_total", "counter", "Time spent in the TTL check cycles.", cycleTime.Seconds())
+
+	// replication
+	app.m.Lock()
+	slave := len(app.cfg.SlaveOf) > 0
+	app.m.Unlock()
+
+	m.metric("vredis_replication_slave", "gauge", "1 if this node is a slave.", boolGauge(slave))
+
+	app.slock.Lock()
+	slaves := len(app.slaves)
+	app.slock.Unlock()
+	m.metric("vredis_replication_connected_slaves", "gauge", "Connected slaves.", slaves)
+
+	if rs, _ := app.ldb.ReplicationStat(); rs != nil {
+		m.metric("vredis_replication_first_log_id", "gauge", "First replication log ID.", rs.FirstID)
+		m.metric("vredis_replication_last_log_id", "gauge", "Last replication log ID.", rs.LastID)
+		m.metric("vredis_replication_commit_log_id", "gauge", "Committed replication log ID.", rs.CommitID)
+
+		if slave {
+			masterLast := i.Replication.MasterLastLogID.Get()
+			var lag uint64
+			if masterLast > rs.CommitID {
+				lag = masterLast - rs.CommitID
+			}
+
+			state := app.m.state.Get()
+			m.metric("vredis_replication_master_last_log_id", "gauge", "Last log ID of the master.", masterLast)
+			m.metric("vredis_replication_lag_logs", "gauge", "Logs behind the master.", lag)
+			m.metric("vredis_replication_master_link_up", "gauge", "1 if the link to the master is up.",
+				boolGauge(state == replSyncState || state == replConnectedState))
+		}
+	}
+
+	// snapshots
+	snap := app.snap
+	m.metric("vredis_snapshot_in_progress", "gauge", "1 if a snapshot is being created.", boolGauge(snap.dumping.Get()))
+	m.metric("vredis_snapshot_last_status", "gauge", "1 if the last snapshot succeeded.", boolGauge(snap.lastOK.Get()))
+	m.metric("vredis_snapshot_last_timestamp_seconds", "gauge", "Time of the last snapshot.", snap.lastSave.Get())
+	m.metric("vredis_snapshot_last_duration_seconds", "gauge", "Duration of the last snapshot.", snap.lastDuration.Get().Seconds())
+
+	m.metric("vredis_uptime_seconds", "gauge", "Seconds since the server started.", int64(time.Since(i.Server.StartTime).Seconds()))
+}
+
+func (app *App) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	m := new(metricsWriter)
+	app.writeMetrics(m)
+
+	w.Header().Set("Content-Type", metricsContentType)
+	w.Write(m.buf.Bytes())
+}
+
+// httpMetricsHandler serves /metrics on http_addr to the authenticated users,
+// metrics_addr is meant for a private network.
+func (app *App) httpMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := app.httpUser(r); err != nil {
+		writeHTTPAuthError(w, err)
+		return
+	}
+
+	app.metricsHandler(w, r)
+}
+
+// metricsServe serves /metrics, /healthz and /readyz on the metrics_addr listener.
+func (app *App) metricsServe() {
+	if app.metricsListener == nil {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", app.metricsHandler)
+	mux.HandleFunc("/healthz", app.healthzHandler)
+	mux.HandleFunc("/readyz", app.readyzHandler)
+
+	svr := http.Server{Handler: mux}
+	app.listenerFailed(app.metricsListener, svr.Serve(app.metricsListener))
+}
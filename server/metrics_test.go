@@ -0,0 +1,116 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func httpGetBody(t *testing.T, url string) (int, string) {
+	r, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.StatusCode, string(b)
+}
+
+func TestMetricsLabelEscape(t *testing.T) {
+	if v := escapeLabelValue("a\"b\\c\nd"); v != `a\"b\\c\nd` {
+		t.Fatal(v)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_metrics"
+	cfg.Addr = "127.0.0.1:11195"
+	cfg.HttpAddr = "127.0.0.1:11196"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	c, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Do("set", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("get"); err == nil {
+		t.Fatal("must error")
+	}
+
+	code, body := httpGetBody(t, "http://"+cfg.HttpAddr+"/metrics")
+	if code != http.StatusOK {
+		t.Fatal(code, body)
+	}
+
+	for _, line := range []string{
+		"# TYPE vredis_commands_total counter",
+		`vredis_commands_total{cmd="set"} 1`,
+		`vredis_commands_rejected_total{cmd="get"} 1`,
+		"# TYPE vredis_command_duration_seconds histogram",
+		`vredis_command_duration_seconds_bucket{cmd="set",le="+Inf"} 1`,
+		`vredis_command_duration_seconds_count{cmd="set"} 1`,
+		`vredis_errors_total{prefix="ERR"} 1`,
+		"vredis_connected_clients 1",
+		"vredis_connections_received_total 1",
+		"vredis_replication_slave 0",
+		"vredis_snapshot_last_status 1",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("no %q in\n%s", line, body)
+		}
+	}
+
+	if !strings.Contains(body, "\nvredis_store_put_total ") || !strings.Contains(body, "\nvredis_ttl_check_cycles_total ") {
+		t.Fatal(body)
+	}
+}
+
+func TestMetricsAddr(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_metrics_addr"
+	cfg.Addr = "127.0.0.1:11197"
+	cfg.HttpAddr = "127.0.0.1:11198"
+	cfg.MetricsAddr = "127.0.0.1:11199"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	if code, body := httpGetBody(t, "http://"+cfg.MetricsAddr+"/metrics"); code != http.StatusOK {
+		t.Fatal(code, body)
+	} else if !strings.Contains(body, "vredis_uptime_seconds ") {
+		t.Fatal(body)
+	}
+
+	// the http listener treats it as a command again
+	if _, body := httpGetBody(t, "http://"+cfg.HttpAddr+"/metrics"); strings.Contains(body, "vredis_uptime_seconds") {
+		t.Fatal(body)
+	}
+}
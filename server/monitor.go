@@ -0,0 +1,172 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/siddontang/go/log"
+	"github.com/siddontang/go/sync2"
+)
+
+// lines buffered for each monitor, a slower monitor is disconnected
+const monitorBufferSize = 4096
+
+var errMonitorRESP = errors.New("MONITOR is only supported on RESP connections")
+
+type monitor struct {
+	rc *respClient
+	ch chan []byte
+}
+
+func (m *monitor) run() {
+	for line := range m.ch {
+		m.rc.resp.writeStatus(string(line))
+		if len(m.ch) == 0 {
+			m.rc.resp.flush()
+		}
+	}
+}
+
+// monitorSet fans out the executed commands to the MONITOR clients.
+type monitorSet struct {
+	// the number of monitors, to skip formatting without any
+	n sync2.AtomicInt32
+
+	sync.Mutex
+	ms map[*respClient]*monitor
+}
+
+func newMonitorSet() *monitorSet {
+	s := new(monitorSet)
+	s.ms = make(map[*respClient]*monitor)
+	return s
+}
+
+func (s *monitorSet) add(rc *respClient) {
+	m := &monitor{rc: rc, ch: make(chan []byte, monitorBufferSize)}
+
+	s.Lock()
+	s.ms[rc] = m
+	s.n.Set(int32(len(s.ms)))
+	s.Unlock()
+
+	go m.run()
+}
+
+func (s *monitorSet) remove(rc *respClient) {
+	s.Lock()
+	if m, ok := s.ms[rc]; ok {
+		delete(s.ms, rc)
+		close(m.ch)
+		s.n.Set(int32(len(s.ms)))
+	}
+	s.Unlock()
+}
+
+// feed sends the command to all monitors without blocking.
+func (s *monitorSet) feed(db int, addr string, cmd string, args [][]byte) {
+	if s.n.Get() == 0 {
+		return
+	}
+
+	now := time.Now()
+
+	line := make([]byte, 0, 64)
+	line = strconv.AppendInt(line, now.Unix(), 10)
+	line = append(line, '.')
+	us := strconv.Itoa(now.Nanosecond() / 1000)
+	for i := len(us); i < 6; i++ {
+		line = append(line, '0')
+	}
+	line = append(line, us...)
+	line = append(line, " ["...)
+	line = strconv.AppendInt(line, int64(db), 10)
+	line = append(line, ' ')
+	line = append(line, addr...)
+	line = append(line, ']')
+
+	line = append(line, ' ')
+	line = appendRepr(line, []byte(cmd))
+	for _, arg := range args {
+		line = append(line, ' ')
+		line = appendRepr(line, arg)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for rc, m := range s.ms {
+		select {
+		case m.ch <- line:
+		default:
+			log.Infof("disconnect slow monitor %s", rc.remoteAddr)
+			delete(s.ms, rc)
+			close(m.ch)
+			rc.conn.Close()
+		}
+	}
+	s.n.Set(int32(len(s.ms)))
+}
+
+// appendRepr appends b quoted and escaped, like the redis sdscatrepr.
+func appendRepr(dst []byte, b []byte) []byte {
+	const hex = "0123456789abcdef"
+
+	dst = append(dst, '"')
+	for _, c := range b {
+		switch c {
+		case '\\', '"':
+			dst = append(dst, '\\', c)
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		case '\r':
+			dst = append(dst, '\\', 'r')
+		case '\t':
+			dst = append(dst, '\\', 't')
+		case '\a':
+			dst = append(dst, '\\', 'a')
+		case '\b':
+			dst = append(dst, '\\', 'b')
+		default:
+			if c < ' ' || c > '~' {
+				dst = append(dst, '\\', 'x', hex[c>>4], hex[c&0xf])
+			} else {
+				dst = append(dst, c)
+			}
+		}
+	}
+	return append(dst, '"')
+}
+
+// feedMonitors sends the command of c to the monitors, except the admin
+// commands and AUTH, which may have passwords.
+func (c *client) feedMonitors(cmd *command) {
+	if cmd.admin(c.args) || cmd.name == "auth" {
+		return
+	}
+
+	addr := c.remoteAddr
+	if _, ok := c.resp.(*luaWriter); ok {
+		addr = "lua"
+	}
+
+	c.app.monitors.feed(c.db.Index(), addr, c.cmd, c.args)
+}
+
+// MONITOR
+func monitorCommand(c *client) error {
+	if _, ok := c.resp.(*respWriter); !ok {
+		return errMonitorRESP
+	}
+
+	// the connection switches to the monitor after the reply
+	c.monitor = true
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+func init() {
+	register("monitor", monitorCommand)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func TestMonitorRepr(t *testing.T) {
+	if v := string(appendRepr(nil, []byte("a \"b\"\\\n\x01\xff"))); v != `"a \"b\"\\\n\x01\xff"` {
+		t.Fatal(v)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_monitor"
+	cfg.Addr = "127.0.0.1:11192"
+	cfg.HttpAddr = "127.0.0.1:11193"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	m, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if v, err := m.Do("monitor"); err != nil {
+		t.Fatal(err)
+	} else if v != "OK" {
+		t.Fatal(v)
+	}
+
+	c, err := goredis.Connect(cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Do("select", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("set", "a", "hello world"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("eval", "return redis.call('get', KEYS[1])", 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// admin commands are not fed
+	if _, err := c.Do("config", "get", "databases"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.Get("http://" + cfg.HttpAddr + "/GET/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+
+	addr := c.LocalAddr().String()
+	expects := []string{
+		" [0 " + addr + `] "select" "2"`,
+		" [2 " + addr + `] "set" "a" "hello world"`,
+		" [2 " + addr + `] "eval" "return redis.call('get', KEYS[1])" "1" "a"`,
+		` [2 lua] "get" "a"`,
+		`] "get" "a"`,
+	}
+
+	m.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, expect := range expects {
+		v, err := goredis.String(m.Receive())
+		if err != nil {
+			t.Fatal(err)
+		} else if !strings.HasSuffix(v, expect) {
+			t.Fatalf("%q must end with %q", v, expect)
+		}
+	}
+
+	if _, err := m.Do("quit"); err == nil {
+		t.Fatal("must be closed")
+	}
+}
+
+func TestMonitorSlow(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+
+	rc := &respClient{client: new(client), conn: conn}
+
+	s := newMonitorSet()
+	m := &monitor{rc: rc, ch: make(chan []byte, 1)}
+	s.ms[rc] = m
+	s.n.Set(1)
+
+	s.feed(0, "127.0.0.1:1", "get", [][]byte{[]byte("a")})
+	if len(s.ms) != 1 {
+		t.Fatal(len(s.ms))
+	}
+
+	// the buffer is full, the monitor is disconnected instead of blocking
+	s.feed(0, "127.0.0.1:1", "get", [][]byte{[]byte("a")})
+	if len(s.ms) != 0 || s.n.Get() != 0 {
+		t.Fatal(len(s.ms))
+	}
+
+	if _, err := conn.Write([]byte("x")); err == nil {
+		t.Fatal("must be closed")
+	}
+}
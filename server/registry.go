@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/r0123r/vredis/ledis"
+)
+
+// metaRegistry keeps the named definitions of a kind, like the function
+// libraries, the triggers or the jobs, in the meta space, so they survive
+// the restarts and are replicated. The version key changes with every
+// change, the servers reload the definitions when it is not the one they
+// loaded.
+type metaRegistry struct {
+	ldb *ledis.Ledis
+
+	// the definition of name is at prefix + name
+	prefix     string
+	versionKey string
+
+	sync.Mutex
+	// the version of the definitions in use
+	version []byte
+}
+
+func newMetaRegistry(ldb *ledis.Ledis, prefix string, versionKey string) *metaRegistry {
+	return &metaRegistry{ldb: ldb, prefix: prefix, versionKey: versionKey}
+}
+
+func (r *metaRegistry) key(name string) []byte {
+	return []byte(r.prefix + name)
+}
+
+func (r *metaRegistry) name(key []byte) string {
+	return string(key[len(r.prefix):])
+}
+
+// changed returns the definitions and their version, ok is false if the
+// version is the one in use.
+func (r *metaRegistry) changed() (version []byte, items []ledis.MetaItem, ok bool, err error) {
+	if version, err = r.ldb.MetaGet([]byte(r.versionKey)); err != nil {
+		return nil, nil, false, err
+	}
+
+	r.Lock()
+	same := bytes.Equal(version, r.version)
+	r.Unlock()
+
+	if same {
+		return nil, nil, false, nil
+	}
+
+	if items, err = r.ldb.MetaScan([]byte(r.prefix)); err != nil {
+		return nil, nil, false, err
+	}
+	return version, items, true, nil
+}
+
+// update writes the definitions, a nil value deletes one, with a new
+// version in the same batch, and returns the version.
+func (r *metaRegistry) update(items ...ledis.MetaItem) ([]byte, error) {
+	version := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+	items = append(items, ledis.MetaItem{Key: []byte(r.versionKey), Value: version})
+
+	if err := r.ldb.MetaUpdate(items...); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// use sets the version of the definitions in use, after they are set.
+func (r *metaRegistry) use(version []byte) {
+	r.Lock()
+	r.version = version
+	r.Unlock()
+}
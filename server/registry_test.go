@@ -0,0 +1,49 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/r0123r/vredis/ledis"
+)
+
+func TestMetaRegistry(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_meta_registry"
+
+	os.RemoveAll(cfg.DataDir)
+	defer os.RemoveAll(cfg.DataDir)
+
+	ldb, err := ledis.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ldb.Close()
+
+	r := newMetaRegistry(ldb, "test:def:", "test:version")
+	other := newMetaRegistry(ldb, "test:def:", "test:version")
+
+	version, err := r.update(ledis.MetaItem{Key: r.key("a"), Value: []byte("1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.use(version)
+
+	if _, _, ok, err := r.changed(); err != nil || ok {
+		t.Fatal(ok, err)
+	}
+
+	// another server loads the definitions of the new version
+	if v, items, ok, err := other.changed(); err != nil || !ok || string(v) != string(version) {
+		t.Fatal(ok, err)
+	} else if len(items) != 1 || other.name(items[0].Key) != "a" || string(items[0].Value) != "1" {
+		t.Fatal(items)
+	}
+
+	if _, err := r.update(ledis.MetaItem{Key: r.key("a")}); err != nil {
+		t.Fatal(err)
+	} else if _, items, ok, err := r.changed(); err != nil || !ok || len(items) != 0 {
+		t.Fatal(items, ok, err)
+	}
+}
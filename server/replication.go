@@ -63,6 +63,9 @@ type master struct {
 	syncBuf syncBuffer
 
 	state sync2.AtomicInt32
+
+	// the state is also replSyncState while streaming the logs
+	fullSyncing sync2.AtomicBool
 }
 
 func newMaster(app *App) *master {
@@ -268,6 +271,8 @@ func (m *master) fullSync() error {
 	}
 
 	m.state.Set(replSyncState)
+	m.fullSyncing.Set(true)
+	defer m.fullSyncing.Set(false)
 
 	dumpPath := path.Join(m.app.cfg.DataDir, "master.dump")
 	f, err := os.OpenFile(dumpPath, os.O_CREATE|os.O_WRONLY, 0644)
@@ -378,6 +383,9 @@ func (app *App) slaveof(masterAddr string, restart bool, readonly bool) error {
 		}
 
 		app.cfg.SetReadonly(readonly)
+
+		// the triggers were replicated, but not loaded
+		return app.triggers.sync()
 	} else {
 		return app.m.startReplication(masterAddr, restart)
 	}
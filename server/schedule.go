@@ -0,0 +1,328 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/log"
+	"github.com/yuin/gopher-lua"
+)
+
+// The jobs are kept in the meta space like the triggers, the version key
+// changes with every change.
+const (
+	schedulePrefix     = "schedule:def:"
+	scheduleVersionKey = "schedule:version"
+
+	scheduleInterval = time.Second
+
+	// the latest runs kept for SCHEDULE HISTORY
+	scheduleHistoryLen = 128
+)
+
+var errScheduleNotFound = errors.New("ERR Schedule not found")
+
+// job runs a script periodically. The script is saved with the job, it is
+// loaded again if the script cache was flushed, or after a restart.
+type job struct {
+	name string
+
+	Cron   string   `json:"cron"`
+	Sha    string   `json:"sha"`
+	Script []byte   `json:"script"`
+	DB     int      `json:"db"`
+	Keys   [][]byte `json:"keys"`
+	Args   [][]byte `json:"args"`
+
+	spec cronSpec
+
+	// guarded by the scheduler lock
+	next time.Time
+}
+
+type jobRun struct {
+	id       int64
+	name     string
+	time     int64
+	duration int64 // microseconds
+	err      error
+}
+
+type scheduler struct {
+	app *App
+	reg *metaRegistry
+
+	sync.Mutex
+	jobs map[string]*job
+
+	// serializes the changes of the jobs
+	writeLock sync.Mutex
+
+	// the jobs run one at a time, by the scheduler or SCHEDULE RUN
+	runLock sync.Mutex
+
+	historyLock sync.Mutex
+	lastRunID   int64
+	// the oldest run first
+	history []*jobRun
+
+	wg sync.WaitGroup
+}
+
+func (app *App) openScheduler() error {
+	sc := new(scheduler)
+	sc.app = app
+	sc.reg = newMetaRegistry(app.ldb, schedulePrefix, scheduleVersionKey)
+	sc.jobs = make(map[string]*job)
+
+	app.sched = sc
+
+	return sc.sync()
+}
+
+// sync reloads the jobs if they were changed in the meta space.
+func (sc *scheduler) sync() error {
+	version, items, ok, err := sc.reg.changed()
+	if err != nil || !ok {
+		return err
+	}
+
+	jobs := make(map[string]*job, len(items))
+	for _, item := range items {
+		name := sc.reg.name(item.Key)
+
+		j := new(job)
+		if err := json.Unmarshal(item.Value, j); err != nil {
+			log.Errorf("load schedule %s error %s", name, err.Error())
+			continue
+		} else if j.spec, err = parseCron(j.Cron); err != nil {
+			log.Errorf("load schedule %s error %s", name, err.Error())
+			continue
+		}
+
+		j.name = name
+		jobs[name] = j
+	}
+
+	sc.set(version, jobs)
+	return nil
+}
+
+// set replaces the jobs, the unchanged jobs keep their next run.
+func (sc *scheduler) set(version []byte, jobs map[string]*job) {
+	now := time.Now()
+
+	sc.Lock()
+	for name, j := range jobs {
+		if old, ok := sc.jobs[name]; ok && old.Cron == j.Cron {
+			j.next = old.next
+		} else {
+			j.next = j.spec.next(now)
+		}
+	}
+	sc.jobs = jobs
+	sc.Unlock()
+
+	sc.reg.use(version)
+}
+
+// list returns the jobs sorted by name, and their next runs.
+func (sc *scheduler) list() ([]*job, []time.Time) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	jobs := make([]*job, 0, len(sc.jobs))
+	for _, j := range sc.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].name < jobs[j].name })
+
+	next := make([]time.Time, len(jobs))
+	for i, j := range jobs {
+		next[i] = j.next
+	}
+	return jobs, next
+}
+
+func (sc *scheduler) get(name string) *job {
+	sc.Lock()
+	defer sc.Unlock()
+
+	return sc.jobs[name]
+}
+
+// save writes the job, or deletes it if j is nil, in the meta space.
+func (sc *scheduler) save(name string, j *job) error {
+	sc.writeLock.Lock()
+	defer sc.writeLock.Unlock()
+
+	sc.Lock()
+	jobs := make(map[string]*job, len(sc.jobs)+1)
+	for n, j := range sc.jobs {
+		jobs[n] = j
+	}
+	sc.Unlock()
+
+	item := ledis.MetaItem{Key: sc.reg.key(name)}
+	if j == nil {
+		if _, ok := jobs[name]; !ok {
+			return errScheduleNotFound
+		}
+		delete(jobs, name)
+	} else {
+		value, err := json.Marshal(j)
+		if err != nil {
+			return err
+		}
+		item.Value = value
+		jobs[name] = j
+	}
+
+	version, err := sc.reg.update(item)
+	if err != nil {
+		return err
+	}
+
+	sc.set(version, jobs)
+	return nil
+}
+
+// isMaster reports whether the jobs can run, never on the slaves.
+func (sc *scheduler) isMaster() bool {
+	// SLAVEOF changes the role under the lock of the master
+	sc.app.m.Lock()
+	slave := len(sc.app.cfg.SlaveOf) > 0
+	sc.app.m.Unlock()
+
+	return !slave && !sc.app.cfg.GetReadonly()
+}
+
+func (sc *scheduler) start() {
+	sc.wg.Add(1)
+	go sc.serve()
+}
+
+func (sc *scheduler) close() {
+	sc.wg.Wait()
+}
+
+func (sc *scheduler) serve() {
+	defer sc.wg.Done()
+
+	t := time.NewTicker(scheduleInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case now := <-t.C:
+			sc.tick(now)
+		case <-sc.app.quit:
+			return
+		}
+	}
+}
+
+// tick runs the jobs due at now, one at a time.
+func (sc *scheduler) tick(now time.Time) {
+	if !sc.isMaster() {
+		return
+	}
+
+	// the jobs may be changed by the replication, before a SLAVEOF NO ONE
+	if err := sc.sync(); err != nil {
+		log.Errorf("load schedules error %s", err.Error())
+		return
+	}
+
+	for _, j := range sc.due(now) {
+		select {
+		case <-sc.app.quit:
+			return
+		default:
+		}
+
+		sc.run(j)
+	}
+}
+
+// due returns the jobs due at now, and schedules their next runs.
+func (sc *scheduler) due(now time.Time) []*job {
+	sc.Lock()
+	defer sc.Unlock()
+
+	var jobs []*job
+	for _, j := range sc.jobs {
+		if !j.next.IsZero() && !now.Before(j.next) {
+			jobs = append(jobs, j)
+			j.next = j.spec.next(now)
+		}
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].name < jobs[k].name })
+	return jobs
+}
+
+// run runs the script of the job like EVALSHA, and adds the run to the
+// history.
+func (sc *scheduler) run(j *job) (interface{}, error) {
+	sc.runLock.Lock()
+	defer sc.runLock.Unlock()
+
+	start := time.Now()
+	reply, err := sc.exec(j)
+	sc.addRun(j.name, start, time.Since(start), err)
+
+	if err != nil {
+		log.Warnf("schedule %s error %s", j.name, err.Error())
+	}
+	return reply, err
+}
+
+func (sc *scheduler) exec(j *job) (interface{}, error) {
+	s := sc.app.script
+
+	_, proto, err := s.load(j.Script)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.execAs(j.DB, internalUser, "", false, func(ls *luaState, env *lua.LTable) error {
+		return ls.callScript(proto, env, j.Keys, j.Args)
+	})
+}
+
+func (sc *scheduler) addRun(name string, start time.Time, d time.Duration, err error) {
+	sc.historyLock.Lock()
+	defer sc.historyLock.Unlock()
+
+	sc.lastRunID++
+	sc.history = append(sc.history, &jobRun{
+		id:       sc.lastRunID,
+		name:     name,
+		time:     start.Unix(),
+		duration: int64(d / time.Microsecond),
+		err:      err,
+	})
+
+	if n := len(sc.history) - scheduleHistoryLen; n > 0 {
+		sc.history = append(sc.history[:0], sc.history[n:]...)
+	}
+}
+
+// runs returns the latest runs of the job, of all the jobs if name is
+// empty, the newest first.
+func (sc *scheduler) runs(name string) []*jobRun {
+	sc.historyLock.Lock()
+	defer sc.historyLock.Unlock()
+
+	var runs []*jobRun
+	for i := len(sc.history) - 1; i >= 0; i-- {
+		if r := sc.history[i]; len(name) == 0 || r.name == name {
+			runs = append(runs, r)
+		}
+	}
+	return runs
+}
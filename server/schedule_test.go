@@ -0,0 +1,149 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2024, time.January, 31, 10, 20, 30, 0, time.Local)
+
+	for _, test := range []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.January, 31, 10, 21, 0, 0, time.Local)},
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 10, 30, 0, 0, time.Local)},
+		{"5 8-9,11 * * *", time.Date(2024, time.January, 31, 11, 5, 0, 0, time.Local)},
+		{"0 0 29 feb *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.Local)},
+		{"0 12 * * sun", time.Date(2024, time.February, 4, 12, 0, 0, 0, time.Local)},
+		{"0 12 * * 7", time.Date(2024, time.February, 4, 12, 0, 0, 0, time.Local)},
+		// either day field matches
+		{"0 0 15 * mon", time.Date(2024, time.February, 5, 0, 0, 0, 0, time.Local)},
+		{"@daily", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.Local)},
+		{"@every 90s", time.Date(2024, time.January, 31, 10, 22, 0, 0, time.Local)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		spec, err := parseCron(test.expr)
+		if err != nil {
+			t.Fatal(test.expr, err)
+		} else if next := spec.next(base); !next.Equal(test.next) {
+			t.Fatal(test.expr, next)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *", "@every 1ms"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Fatal(expr, "must error")
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_schedule"
+	cfg.Addr = "127.0.0.1:11208"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+
+	c := goredis.NewClient(cfg.Addr, "")
+
+	sha, err := goredis.String(c.Do("script", "load", "redis.call('incr', KEYS[1]) return ARGV[1]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failSha, err := goredis.String(c.Do("script", "load", "error('bad job')"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("schedule", "add", "j", "* * *", sha, 0); err == nil {
+		t.Fatal("must error")
+	} else if _, err := c.Do("schedule", "add", "j", "@hourly", strings.Repeat("0", 40), 0); err == nil || !strings.Contains(err.Error(), "NOSCRIPT") {
+		t.Fatal(err)
+	} else if _, err := c.Do("schedule", "add", "j", "@hourly", sha, 2, "a"); err == nil {
+		t.Fatal("must error")
+	}
+
+	if _, err := c.Do("schedule", "add", "counter", "@every 1s", sha, 1, "sched:n", "hello"); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Do("schedule", "add", "fail", "@hourly", failSha, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the job keeps its script
+	if _, err := c.Do("script", "flush"); err != nil {
+		t.Fatal(err)
+	} else if v, err := goredis.String(c.Do("schedule", "run", "counter")); err != nil || v != "hello" {
+		t.Fatal(v, err)
+	} else if _, err := c.Do("schedule", "run", "fail"); err == nil || !strings.Contains(err.Error(), "bad job") {
+		t.Fatal(err)
+	} else if _, err := c.Do("schedule", "run", "nojob"); err == nil {
+		t.Fatal("must error")
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+
+	if n, err := goredis.Int(c.Do("get", "sched:n")); err != nil || n < 3 {
+		t.Fatal(n, err)
+	}
+
+	if ay, err := goredis.MultiBulk(c.Do("schedule", "history", "fail")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 1 {
+		t.Fatal(ay)
+	} else if v := ay[0].([]interface{}); string(v[3].([]byte)) != "fail" || !strings.Contains(string(v[9].([]byte)), "bad job") {
+		t.Fatal(v)
+	} else if ay, err := goredis.MultiBulk(c.Do("schedule", "history")); err != nil {
+		t.Fatal(err)
+	} else if v := ay[0].([]interface{}); string(v[3].([]byte)) != "counter" || v[9] != nil {
+		t.Fatal(v)
+	}
+
+	if ay, err := goredis.MultiBulk(c.Do("schedule", "list")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 2 {
+		t.Fatal(ay)
+	} else if v := ay[0].([]interface{}); string(v[1].([]byte)) != "counter" || string(v[3].([]byte)) != "@every 1s" || v[13].(int64) <= time.Now().Unix()-1 {
+		t.Fatal(v)
+	}
+
+	if _, err := c.Do("schedule", "del", "counter"); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Do("schedule", "del", "counter"); err == nil {
+		t.Fatal("must error")
+	}
+
+	// the jobs survive a restart
+	c.Close()
+	s.Close()
+
+	if s, err = NewApp(cfg, ""); err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+
+	c = goredis.NewClient(cfg.Addr, "")
+
+	if ay, err := goredis.MultiBulk(c.Do("schedule", "list")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 1 {
+		t.Fatal(ay)
+	} else if _, err := c.Do("schedule", "run", "fail"); err == nil || !strings.Contains(err.Error(), "bad job") {
+		t.Fatal(err)
+	}
+
+	c.Close()
+	s.Close()
+}
@@ -1,17 +1,24 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha1"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/r0123r/vredis/ledis"
 	"github.com/siddontang/go/hack"
+	"github.com/siddontang/go/log"
 	"github.com/siddontang/go/num"
-	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/sync2"
 	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
 
 	luajson "github.com/glendc/gopher-json"
 )
@@ -20,6 +27,9 @@ import (
 
 type luaWriter struct {
 	l *lua.LState
+
+	// set by redis.setresp(3), the null replies are nil instead of false
+	resp3 bool
 }
 
 func (w *luaWriter) writeError(err error) {
@@ -53,7 +63,7 @@ func (w *luaWriter) writeSliceArray(lst [][]byte) {
 
 func (w *luaWriter) writeFVPairArray(lst []ledis.FVPair) {
 	if lst == nil {
-		w.l.Push(lua.LFalse)
+		w.l.Push(w.toLuaNull())
 		return
 	}
 
@@ -69,7 +79,7 @@ func (w *luaWriter) writeFVPairArray(lst []ledis.FVPair) {
 
 func (w *luaWriter) writeScorePairArray(lst []ledis.ScorePair, withScores bool) {
 	if lst == nil {
-		w.l.Push(lua.LFalse)
+		w.l.Push(w.toLuaNull())
 		return
 	}
 
@@ -100,13 +110,20 @@ func (w *luaWriter) writeBulkFrom(n int64, rb io.Reader) {
 func (w *luaWriter) flush() {
 }
 
+func (w *luaWriter) toLuaNull() lua.LValue {
+	if w.resp3 {
+		return lua.LNil
+	}
+	return lua.LFalse
+}
+
 func (w *luaWriter) toLuaInteger(n int64) lua.LValue {
 	return lua.LNumber(n)
 }
 
 func (w *luaWriter) toLuaBulk(b []byte) lua.LValue {
 	if b == nil {
-		return lua.LFalse
+		return w.toLuaNull()
 	}
 
 	return lua.LString(hack.String(b))
@@ -114,14 +131,14 @@ func (w *luaWriter) toLuaBulk(b []byte) lua.LValue {
 
 func (w *luaWriter) toLuaSliceArray(lst [][]byte) lua.LValue {
 	if lst == nil {
-		return lua.LFalse
+		return w.toLuaNull()
 	}
 
 	table := w.l.CreateTable(len(lst), 0)
 
 	for _, v := range lst {
 		if v == nil {
-			table.Append(lua.LFalse)
+			table.Append(w.toLuaNull())
 		} else {
 			table.Append(lua.LString((hack.String(v))))
 		}
@@ -132,7 +149,7 @@ func (w *luaWriter) toLuaSliceArray(lst [][]byte) lua.LValue {
 
 func (w *luaWriter) toLuaArray(lst []interface{}) lua.LValue {
 	if lst == nil {
-		return lua.LFalse
+		return w.toLuaNull()
 	}
 
 	table := w.l.CreateTable(len(lst), 0)
@@ -157,68 +174,428 @@ func (w *luaWriter) toLuaArray(lst []interface{}) lua.LValue {
 	return table
 }
 
-type script struct {
-	sync.Mutex
+// idle Lua states kept in the pool, more are created on demand
+const luaPoolMaxIdle = 16
+
+var (
+	errScriptBusy       = errors.New("BUSY Redis is busy running a script. You can only call SCRIPT KILL.")
+	errScriptNotBusy    = errors.New("NOTBUSY No scripts in execution right now.")
+	errScriptUnkillable = errors.New("UNKILLABLE Sorry the script already executed write commands against the dataset. You can either wait the script termination or kill the server in a hard way.")
+	errScriptKilled     = errors.New("ERR Script killed by user with SCRIPT KILL.")
+	errScriptNotAllowed = errors.New("This command is not allowed from scripts")
+	errScriptReadonly   = errors.New("ERR Write commands are not allowed from read-only scripts.")
+)
 
+// scriptRun is a running script.
+type scriptRun struct {
+	start  time.Time
+	cancel context.CancelFunc
+
+	killed sync2.AtomicBool
+	// a write command was called, the script can't be killed
+	wrote sync2.AtomicBool
+
+	// write commands are refused, for FCALL_RO and the no-writes functions
+	readonly bool
+}
+
+// luaState is a Lua state of the pool with its own client.
+type luaState struct {
+	l *lua.LState
+	c *client
+	w *luaWriter
+
+	// the metatable of the per call globals, reading from the shared ones
+	envMeta *lua.LTable
+
+	run *scriptRun
+
+	// the library being loaded, for redis.register_function
+	loading *functionLoad
+
+	// the libraries loaded by callFunction, by name
+	loaded map[string]*functionLoad
+}
+
+type script struct {
 	app *App
-	l   *lua.LState
-	c   *client
 
-	chunks map[string]struct{}
+	// milliseconds, a longer script makes the server BUSY, 0 disables it
+	timeLimit sync2.AtomicInt64
+
+	// the compiled scripts by sha1, shared by all the states, and their
+	// sources for the scheduled jobs
+	chunkLock sync.RWMutex
+	chunks    map[string]*lua.FunctionProto
+	sources   map[string][]byte
+
+	poolLock sync.Mutex
+	pool     []*luaState
+	closed   bool
+
+	runLock sync.Mutex
+	runs    map[*scriptRun]struct{}
+	running sync2.AtomicInt32
+
+	// the function libraries, loaded from the meta space
+	funcReg  *metaRegistry
+	funcLock sync.RWMutex
+	libs     map[string]*functionLib
+	funcs    map[string]*function
+
+	// serializes the changes of the libraries
+	funcWriteLock sync.Mutex
 }
 
 func (app *App) openScript() {
 	s := new(script)
 	s.app = app
 
-	s.chunks = make(map[string]struct{})
+	s.timeLimit.Set(app.cfg.LuaTimeLimit)
+	s.chunks = make(map[string]*lua.FunctionProto)
+	s.sources = make(map[string][]byte)
+	s.runs = make(map[*scriptRun]struct{})
+	s.funcReg = newMetaRegistry(app.ldb, functionLibPrefix, functionVersionKey)
+	s.libs = make(map[string]*functionLib)
+	s.funcs = make(map[string]*function)
 
 	app.script = s
+}
 
-	l := lua.NewState()
+func (app *App) closeScript() {
+	s := app.script
+
+	s.poolLock.Lock()
+	for _, ls := range s.pool {
+		ls.close()
+	}
+	s.pool = nil
+	s.closed = true
+	s.poolLock.Unlock()
+}
+
+func (s *script) newState() *luaState {
+	// no io, os, package, debug and coroutine libraries
+	l := lua.NewState(lua.Options{SkipOpenLibs: true})
 
 	for _, pair := range []struct {
 		n string
 		f lua.LGFunction
 	}{
-		{lua.LoadLibName, lua.OpenPackage}, // Must be first
 		{lua.BaseLibName, lua.OpenBase},
 		{lua.MathLibName, lua.OpenMath},
 		{lua.StringLibName, lua.OpenString},
 		{lua.TabLibName, lua.OpenTable},
 		{luajson.CJsonLibName, luajson.OpenCJSON},
-		// TODO (gopher-lua): support libs:
-		// + CMsgpackLib?! (which funcs?)
-		// + StructLib?! (which funcs?)
+		{cmsgpackLibName, openCMsgpack},
+		{structLibName, openStruct},
+		{bitLibName, openBit},
 	} {
 		l.Push(l.NewFunction(pair.f))
 		l.Push(lua.LString(pair.n))
 		l.Call(1, 0)
 	}
 
+	// no access to the file system, and no way around the read only globals
+	for _, name := range []string{"dofile", "loadfile", "loadstring", "rawset", "setfenv"} {
+		l.SetGlobal(name, lua.LNil)
+	}
+
 	l.Register("error", luaErrorHandler)
 
-	s.l = l
-	s.c = newClient(app)
-	s.c.db = nil
+	ls := new(luaState)
+	ls.l = l
+	ls.loaded = make(map[string]*functionLoad)
+	ls.c = newClient(s.app)
+	ls.c.db = nil
 
 	w := new(luaWriter)
 	w.l = l
-	s.c.resp = w
+	ls.c.resp = w
+	ls.w = w
 
 	setLuaDBGlobalVar(l, "ledis")
 	setLuaDBGlobalVar(l, "redis")
 
-	setMapState(l, s)
+	// the scripts can't change the shared globals, their globals go to
+	// the per call table, which reads the shared one
+	protectLuaGlobals(l)
+
+	ls.envMeta = l.NewTable()
+	l.SetField(ls.envMeta, "__index", l.G.Global)
+
+	setMapState(l, ls)
+	return ls
 }
 
-func (app *App) closeScript() {
-	app.script.l.Close()
-	delMapState(app.script.l)
-	app.script = nil
+func (ls *luaState) close() {
+	delMapState(ls.l)
+	ls.l.Close()
+}
+
+// get returns an idle state of the pool, or a new one.
+func (s *script) get() *luaState {
+	s.poolLock.Lock()
+	if n := len(s.pool); n > 0 {
+		ls := s.pool[n-1]
+		s.pool = s.pool[:n-1]
+		s.poolLock.Unlock()
+		return ls
+	}
+	s.poolLock.Unlock()
+
+	return s.newState()
+}
+
+func (s *script) put(ls *luaState) {
+	ls.l.SetTop(0)
+	ls.loading = nil
+	ls.w.resp3 = false
+	ls.c.db = nil
+	ls.c.tx = nil
+	ls.c.user = nil
+
+	s.poolLock.Lock()
+	if !s.closed && len(s.pool) < luaPoolMaxIdle {
+		s.pool = append(s.pool, ls)
+		ls = nil
+	}
+	s.poolLock.Unlock()
+
+	if ls != nil {
+		ls.close()
+	}
+}
+
+// load compiles the script and caches it, returns its sha1.
+func (s *script) load(body []byte) (string, *lua.FunctionProto, error) {
+	h := sha1.Sum(body)
+	key := hex.EncodeToString(h[0:20])
+
+	if proto := s.lookup(key); proto != nil {
+		return key, proto, nil
+	}
+
+	chunk, err := parse.Parse(bytes.NewReader(body), "<string>")
+	if err != nil {
+		return "", nil, err
+	}
+
+	proto, err := lua.Compile(chunk, "<string>")
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.chunkLock.Lock()
+	s.chunks[key] = proto
+	s.sources[key] = append([]byte(nil), body...)
+	s.chunkLock.Unlock()
+
+	return key, proto, nil
 }
 
-var mapState = map[*lua.LState]*script{}
+func (s *script) lookup(key string) *lua.FunctionProto {
+	s.chunkLock.RLock()
+	defer s.chunkLock.RUnlock()
+
+	return s.chunks[key]
+}
+
+// source returns the body of a loaded script, nil if it is not loaded.
+func (s *script) source(key string) []byte {
+	s.chunkLock.RLock()
+	defer s.chunkLock.RUnlock()
+
+	return s.sources[key]
+}
+
+func (s *script) flush() {
+	s.chunkLock.Lock()
+	s.chunks = make(map[string]*lua.FunctionProto)
+	s.sources = make(map[string][]byte)
+	s.chunkLock.Unlock()
+}
+
+func (s *script) addRun(r *scriptRun) {
+	s.runLock.Lock()
+	s.runs[r] = struct{}{}
+	s.running.Set(int32(len(s.runs)))
+	s.runLock.Unlock()
+}
+
+func (s *script) removeRun(r *scriptRun) {
+	s.runLock.Lock()
+	delete(s.runs, r)
+	s.running.Set(int32(len(s.runs)))
+	s.runLock.Unlock()
+}
+
+// busy returns whether a script has run longer than the time limit.
+func (s *script) busy() bool {
+	limit := s.timeLimit.Get()
+	if limit <= 0 || s.running.Get() == 0 {
+		return false
+	}
+
+	s.runLock.Lock()
+	defer s.runLock.Unlock()
+
+	for r := range s.runs {
+		if time.Since(r.start) > time.Duration(limit)*time.Millisecond {
+			return true
+		}
+	}
+	return false
+}
+
+// kill aborts the running scripts which have not written yet.
+func (s *script) kill() error {
+	s.runLock.Lock()
+	defer s.runLock.Unlock()
+
+	if len(s.runs) == 0 {
+		return errScriptNotBusy
+	}
+
+	n := 0
+	for r := range s.runs {
+		if r.wrote.Get() {
+			continue
+		}
+		r.killed.Set(true)
+		r.cancel()
+		n++
+	}
+
+	if n == 0 {
+		return errScriptUnkillable
+	}
+	return nil
+}
+
+// checkBusy returns BUSY for the commands of the other clients while a
+// script runs longer than the time limit, except AUTH and SCRIPT KILL.
+func (c *client) checkBusy(cmd *command) error {
+	if !c.app.script.busy() {
+		return nil
+	} else if _, ok := c.resp.(*luaWriter); ok {
+		return nil
+	}
+
+	switch cmd.name {
+	case "auth":
+		return nil
+	case "script":
+		if len(c.args) > 0 && strings.ToLower(hack.String(c.args[0])) == "kill" {
+			return nil
+		}
+	}
+	return errScriptBusy
+}
+
+// run runs the compiled script in a state of the pool, with the db and
+// the user of c, and its own globals.
+func (s *script) run(c *client, proto *lua.FunctionProto, keys [][]byte, argv [][]byte) (interface{}, error) {
+	return s.exec(c, false, func(ls *luaState, env *lua.LTable) error {
+		return ls.callScript(proto, env, keys, argv)
+	})
+}
+
+// callScript calls the compiled script with the KEYS and ARGV globals.
+func (ls *luaState) callScript(proto *lua.FunctionProto, env *lua.LTable, keys [][]byte, argv [][]byte) error {
+	l := ls.l
+
+	luaSetArray(l, env, "KEYS", keys)
+	luaSetArray(l, env, "ARGV", argv)
+
+	l.Push(&lua.LFunction{Env: env, Proto: proto, Upvalues: make([]*lua.Upvalue, 0)})
+	return l.PCall(0, lua.MultRet, nil)
+}
+
+// exec calls f in a state of the pool, with the db and the user of c, and
+// a new table of globals, the reply is the top of the stack.
+func (s *script) exec(c *client, readonly bool, f func(ls *luaState, env *lua.LTable) error) (interface{}, error) {
+	// scripts run with the permissions of the caller
+	return s.execAs(c.db.Index(), c.user, c.remoteAddr, readonly, f)
+}
+
+// internalUser runs the triggers and the scheduled jobs, registering them
+// needs the admin permission.
+var internalUser = &aclUser{
+	name:     "internal",
+	enabled:  true,
+	cmdRules: []aclCmdRule{{allow: true, category: "@all"}},
+	allKeys:  true,
+	allDBs:   true,
+}
+
+// execAs calls f like exec, in the db index with the user.
+func (s *script) execAs(index int, user *aclUser, remoteAddr string, readonly bool, f func(ls *luaState, env *lua.LTable) error) (interface{}, error) {
+	// the script is atomic, the other writers wait for it, and its
+	// writes are committed at once if it doesn't raise an error
+	tx := s.app.ldb.Begin()
+	defer tx.Rollback()
+
+	reply, err := s.execTx(tx, index, user, remoteAddr, readonly, f)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.app.triggers.fire(tx); err != nil {
+		return nil, err
+	} else if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if v, ok := reply.(error); ok {
+		return nil, v
+	}
+	return reply, nil
+}
+
+// execTx calls f like exec, in the Tx, which is not committed.
+func (s *script) execTx(tx *ledis.Tx, index int, user *aclUser, remoteAddr string, readonly bool, f func(ls *luaState, env *lua.LTable) error) (interface{}, error) {
+	ls := s.get()
+	defer s.put(ls)
+
+	l := ls.l
+
+	luaClient := ls.c
+	luaClient.tx = tx
+	luaClient.db, _ = tx.Select(index)
+	luaClient.remoteAddr = remoteAddr
+	luaClient.user = user
+
+	env := l.NewTable()
+	l.SetMetatable(env, ls.envMeta)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &scriptRun{start: time.Now(), cancel: cancel, readonly: readonly}
+
+	ls.run = r
+	s.addRun(r)
+	l.SetContext(ctx)
+
+	defer func() {
+		l.RemoveContext()
+		cancel()
+		s.removeRun(r)
+		ls.run = nil
+	}()
+
+	if err := f(ls, env); err != nil {
+		if r.killed.Get() {
+			return nil, errScriptKilled
+		} else if e, ok := err.(*lua.ApiError); ok {
+			return nil, fmt.Errorf("panic: %s", e.Object.String())
+		}
+		return nil, err
+	}
+
+	return luaReplyToLedisReply(l), nil
+}
+
+var mapState = map[*lua.LState]*luaState{}
 var stateLock sync.Mutex
 
 func setLuaDBGlobalVar(l *lua.LState, name string) {
@@ -230,16 +607,31 @@ func setLuaDBGlobalVar(l *lua.LState, name string) {
 	l.SetField(mt, "sha1hex", l.NewFunction(luaSha1Hex))
 	l.SetField(mt, "error_reply", l.NewFunction(luaErrorReply))
 	l.SetField(mt, "status_reply", l.NewFunction(luaStatusReply))
+	l.SetField(mt, "register_function", l.NewFunction(luaRegisterFunction))
+	l.SetField(mt, "log", l.NewFunction(luaLog))
+	l.SetField(mt, "breakpoint", l.NewFunction(luaBreakpoint))
+	l.SetField(mt, "set_repl", l.NewFunction(luaSetRepl))
+	l.SetField(mt, "setresp", l.NewFunction(luaSetResp))
+
+	for i, level := range []string{"LOG_DEBUG", "LOG_VERBOSE", "LOG_NOTICE", "LOG_WARNING"} {
+		l.SetField(mt, level, lua.LNumber(i))
+	}
+
+	l.SetField(mt, "REPL_NONE", lua.LNumber(luaReplNone))
+	l.SetField(mt, "REPL_AOF", lua.LNumber(luaReplAOF))
+	l.SetField(mt, "REPL_SLAVE", lua.LNumber(luaReplReplica))
+	l.SetField(mt, "REPL_REPLICA", lua.LNumber(luaReplReplica))
+	l.SetField(mt, "REPL_ALL", lua.LNumber(luaReplAll))
 }
 
-func setMapState(l *lua.LState, s *script) {
+func setMapState(l *lua.LState, s *luaState) {
 	stateLock.Lock()
 	defer stateLock.Unlock()
 
 	mapState[l] = s
 }
 
-func getMapState(l *lua.LState) *script {
+func getMapState(l *lua.LState) *luaState {
 	stateLock.Lock()
 	defer stateLock.Unlock()
 
@@ -253,6 +645,56 @@ func delMapState(l *lua.LState) {
 	delete(mapState, l)
 }
 
+// readonlyLuaMeta returns the metatable of a table which reads t, and
+// can't be written.
+func readonlyLuaMeta(l *lua.LState, t lua.LValue) *lua.LTable {
+	mt := l.NewTable()
+	l.SetField(mt, "__index", t)
+	l.SetField(mt, "__newindex", l.NewFunction(luaReadonlyTable))
+	l.SetField(mt, "__metatable", lua.LFalse)
+	return mt
+}
+
+// readonlyLuaTable returns an empty table which reads t, and can't be written.
+func readonlyLuaTable(l *lua.LState, t lua.LValue) *lua.LTable {
+	p := l.NewTable()
+	l.SetMetatable(p, readonlyLuaMeta(l, t))
+	return p
+}
+
+// protectLuaGlobals moves the globals to a shared table read by the empty
+// global table, and replaces the libraries with read only tables, so
+// the fields which exist can't be changed either.
+func protectLuaGlobals(l *lua.LState) {
+	g := l.G.Global
+
+	var keys []lua.LValue
+	shared := l.NewTable()
+	g.ForEach(func(k lua.LValue, v lua.LValue) {
+		keys = append(keys, k)
+		if t, ok := v.(*lua.LTable); ok && t != g {
+			v = readonlyLuaTable(l, t)
+		}
+		shared.RawSet(k, v)
+	})
+	for _, k := range keys {
+		g.RawSet(k, lua.LNil)
+	}
+	shared.RawSetString("_G", g)
+
+	// the methods of the strings
+	if mt, ok := l.GetMetatable(lua.LString("")).(*lua.LTable); ok {
+		mt.RawSetString("__index", shared.RawGetString(lua.StringLibName))
+		mt.RawSetString("__metatable", lua.LFalse)
+	}
+
+	l.SetMetatable(g, readonlyLuaMeta(l, shared))
+}
+
+func luaReadonlyTable(l *lua.LState) int {
+	panic(fmt.Errorf("Attempt to modify a readonly table: %s", l.ToString(2)))
+}
+
 func luaErrorHandler(l *lua.LState) int {
 	msg := l.ToString(1)
 	panic(errors.New(msg))
@@ -293,6 +735,81 @@ func luaReturnSingleFieldTable(l *lua.LState, filed string) int {
 	return 1
 }
 
+// the flags of redis.set_repl
+const (
+	luaReplNone    = 0
+	luaReplAOF     = 1
+	luaReplReplica = 2
+	luaReplAll     = luaReplAOF | luaReplReplica
+)
+
+// redis.log(level, message, ...) writes to the server log.
+func luaLog(l *lua.LState) int {
+	argc := l.GetTop()
+	if argc < 2 {
+		panic("redis.log() requires two arguments or more.")
+	}
+
+	level, ok := l.Get(1).(lua.LNumber)
+	if !ok || level < 0 || level > 3 {
+		panic("Invalid debug level.")
+	}
+
+	parts := make([]string, 0, argc-1)
+	for i := 2; i <= argc; i++ {
+		parts = append(parts, l.ToString(i))
+	}
+	msg := strings.Join(parts, " ")
+
+	switch level {
+	case 0, 1:
+		log.Debug(msg)
+	case 2:
+		log.Info(msg)
+	default:
+		log.Warn(msg)
+	}
+	return 0
+}
+
+// redis.breakpoint() does nothing, there is no script debugger.
+func luaBreakpoint(l *lua.LState) int {
+	l.Push(lua.LFalse)
+	return 1
+}
+
+// redis.set_repl(flags) is accepted, the writes of a script are always
+// committed and replicated together when it ends.
+func luaSetRepl(l *lua.LState) int {
+	if l.GetTop() != 1 {
+		panic("redis.set_repl() requires one argument.")
+	}
+
+	flags, ok := l.Get(1).(lua.LNumber)
+	if !ok || flags < luaReplNone || flags > luaReplAll {
+		panic("Invalid replication flags. Use REPL_AOF, REPL_REPLICA, REPL_ALL or REPL_NONE.")
+	}
+	return 0
+}
+
+// redis.setresp(2|3) chooses the conversion of the replies, the null
+// replies are false with 2 and nil with 3.
+func luaSetResp(l *lua.LState) int {
+	if l.GetTop() != 1 {
+		panic("redis.setresp() requires one argument.")
+	}
+
+	resp, ok := l.Get(1).(lua.LNumber)
+	if !ok || (resp != 2 && resp != 3) {
+		panic("RESP version must be 2 or 3.")
+	}
+
+	if ls := getMapState(l); ls != nil {
+		ls.w.resp3 = resp == 3
+	}
+	return 0
+}
+
 func luaSha1Hex(l *lua.LState) int {
 	if argc := l.GetTop(); argc != 1 {
 		luaPushError(l, "wrong number of arguments")
@@ -314,14 +831,16 @@ func luaPushError(l *lua.LState, msg string) {
 }
 
 func luaCallGenericCommand(l *lua.LState) int {
-	s := getMapState(l)
-	if s == nil {
+	ls := getMapState(l)
+	if ls == nil {
 		panic("Invalid lua call")
-	} else if s.c.db == nil {
+	} else if ls.loading != nil {
+		panic("redis.call can't be called when loading a library")
+	} else if ls.c.db == nil {
 		panic("Invalid lua call, not prepared")
 	}
 
-	c := s.c
+	c := ls.c
 
 	argc := l.GetTop()
 	if argc < 1 {
@@ -343,19 +862,30 @@ func luaCallGenericCommand(l *lua.LState) int {
 		}
 	}
 
+	if cmd, ok := regCmds[strings.ToLower(c.cmd)]; ok && cmd.flags&cmdWrite != 0 && ls.run != nil {
+		if ls.run.readonly {
+			panic(errScriptReadonly)
+		}
+		ls.run.wrote.Set(true)
+	}
+
 	c.perform()
 
 	return 1
 }
 
-func luaSetGlobalArray(l *lua.LState, name string, ay [][]byte) {
-	table := l.NewTable()
+func luaSetArray(l *lua.LState, t *lua.LTable, name string, ay [][]byte) {
+	l.RawSet(t, lua.LString(name), luaNewArray(l, ay))
+}
+
+func luaNewArray(l *lua.LState, ay [][]byte) *lua.LTable {
+	table := l.CreateTable(len(ay), 0)
 
 	for i := 0; i < len(ay); i++ {
 		table.Append(lua.LString(hack.String(ay[i])))
 	}
 
-	l.SetGlobal(name, table)
+	return table
 }
 
 func luaReplyToLedisReply(l *lua.LState) interface{} {
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// bit of the Redis scripts, http://bitop.luajit.org/, the operations are
+// on 32-bit signed integers.
+const bitLibName = "bit"
+
+func openBit(l *lua.LState) int {
+	mod := l.RegisterModule(bitLibName, map[string]lua.LGFunction{
+		"tobit":   bitToBit,
+		"tohex":   bitToHex,
+		"bnot":    bitNot,
+		"band":    bitAnd,
+		"bor":     bitOr,
+		"bxor":    bitXor,
+		"lshift":  bitLShift,
+		"rshift":  bitRShift,
+		"arshift": bitARShift,
+		"rol":     bitRol,
+		"ror":     bitRor,
+		"bswap":   bitSwap,
+	}).(*lua.LTable)
+	l.Push(mod)
+	return 1
+}
+
+// bitArg returns the argument modulo 2^32.
+func bitArg(l *lua.LState, n int) uint32 {
+	f := math.Mod(float64(l.CheckNumber(n)), 4294967296)
+	return uint32(int64(f))
+}
+
+func bitPush(l *lua.LState, v uint32) int {
+	l.Push(lua.LNumber(int32(v)))
+	return 1
+}
+
+func bitToBit(l *lua.LState) int {
+	return bitPush(l, bitArg(l, 1))
+}
+
+func bitToHex(l *lua.LState) int {
+	v := bitArg(l, 1)
+	n := l.OptInt(2, 8)
+
+	format := "%08x"
+	if n < 0 {
+		n = -n
+		format = "%08X"
+	}
+	if n > 8 {
+		n = 8
+	}
+
+	s := fmt.Sprintf(format, v)
+	l.Push(lua.LString(s[8-n:]))
+	return 1
+}
+
+func bitNot(l *lua.LState) int {
+	return bitPush(l, ^bitArg(l, 1))
+}
+
+func bitFold(l *lua.LState, op func(a uint32, b uint32) uint32) int {
+	v := bitArg(l, 1)
+	for i := 2; i <= l.GetTop(); i++ {
+		v = op(v, bitArg(l, i))
+	}
+	return bitPush(l, v)
+}
+
+func bitAnd(l *lua.LState) int {
+	return bitFold(l, func(a uint32, b uint32) uint32 { return a & b })
+}
+
+func bitOr(l *lua.LState) int {
+	return bitFold(l, func(a uint32, b uint32) uint32 { return a | b })
+}
+
+func bitXor(l *lua.LState) int {
+	return bitFold(l, func(a uint32, b uint32) uint32 { return a ^ b })
+}
+
+func bitLShift(l *lua.LState) int {
+	return bitPush(l, bitArg(l, 1)<<(bitArg(l, 2)&31))
+}
+
+func bitRShift(l *lua.LState) int {
+	return bitPush(l, bitArg(l, 1)>>(bitArg(l, 2)&31))
+}
+
+func bitARShift(l *lua.LState) int {
+	return bitPush(l, uint32(int32(bitArg(l, 1))>>(bitArg(l, 2)&31)))
+}
+
+func bitRol(l *lua.LState) int {
+	v, n := bitArg(l, 1), bitArg(l, 2)&31
+	return bitPush(l, v<<n|v>>((32-n)&31))
+}
+
+func bitRor(l *lua.LState) int {
+	v, n := bitArg(l, 1), bitArg(l, 2)&31
+	return bitPush(l, v>>n|v<<((32-n)&31))
+}
+
+func bitSwap(l *lua.LState) int {
+	v := bitArg(l, 1)
+	return bitPush(l, v>>24|(v>>8)&0xff00|(v&0xff00)<<8|v<<24)
+}
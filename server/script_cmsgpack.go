@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/ugorji/go/codec"
+	"github.com/yuin/gopher-lua"
+)
+
+// cmsgpack of the Redis scripts, https://github.com/antirez/lua-cmsgpack
+const cmsgpackLibName = "cmsgpack"
+
+// the deeper tables are packed as nil, like lua-cmsgpack
+const cmsgpackMaxNesting = 16
+
+var cmsgpackHandle = &codec.MsgpackHandle{RawToString: true}
+
+// msgpackMap is packed as a map of its key and value pairs, in order.
+type msgpackMap []interface{}
+
+func (msgpackMap) MapBySlice() {}
+
+func openCMsgpack(l *lua.LState) int {
+	mod := l.RegisterModule(cmsgpackLibName, map[string]lua.LGFunction{
+		"pack":   cmsgpackPack,
+		"unpack": cmsgpackUnpack,
+	}).(*lua.LTable)
+	mod.RawSetString("_NAME", lua.LString(cmsgpackLibName))
+	l.Push(mod)
+	return 1
+}
+
+// cmsgpack.pack(v1, v2, ...) packs all the values one after the other.
+func cmsgpackPack(l *lua.LState) int {
+	n := l.GetTop()
+	if n == 0 {
+		l.ArgError(1, "MessagePack pack needs input.")
+	}
+
+	var buf bytes.Buffer
+	enc := codec.NewEncoder(&buf, cmsgpackHandle)
+	for i := 1; i <= n; i++ {
+		if err := enc.Encode(luaToMsgpack(l.Get(i), 0)); err != nil {
+			l.RaiseError("%s", err.Error())
+		}
+	}
+
+	l.Push(lua.LString(buf.String()))
+	return 1
+}
+
+// cmsgpack.unpack(s) returns all the values packed in s.
+func cmsgpackUnpack(l *lua.LState) int {
+	r := bytes.NewReader([]byte(l.CheckString(1)))
+	dec := codec.NewDecoder(r, cmsgpackHandle)
+
+	n := 0
+	for r.Len() > 0 {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			l.RaiseError("Bad data format in input.")
+		}
+		l.Push(msgpackToLua(l, v))
+		n++
+	}
+
+	return n
+}
+
+func luaToMsgpack(v lua.LValue, level int) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LString:
+		return string(v)
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && f >= math.MinInt64 && f <= math.MaxInt64 {
+			return int64(f)
+		} else if float64(float32(f)) == f {
+			return float32(f)
+		}
+		return f
+	case *lua.LTable:
+		if level >= cmsgpackMaxNesting {
+			return nil
+		}
+		return luaTableToMsgpack(v, level+1)
+	default:
+		return nil
+	}
+}
+
+// luaTableToMsgpack packs the tables with the keys 1 to n as arrays,
+// and the others as maps.
+func luaTableToMsgpack(t *lua.LTable, level int) interface{} {
+	count, max := 0, 0
+	array := true
+	t.ForEach(func(k lua.LValue, _ lua.LValue) {
+		count++
+		if n, ok := k.(lua.LNumber); ok && n >= 1 && float64(n) == math.Trunc(float64(n)) {
+			if int(n) > max {
+				max = int(n)
+			}
+		} else {
+			array = false
+		}
+	})
+
+	if array && count == max {
+		ay := make([]interface{}, max)
+		for i := 0; i < max; i++ {
+			ay[i] = luaToMsgpack(t.RawGetInt(i+1), level)
+		}
+		return ay
+	}
+
+	m := make(msgpackMap, 0, count*2)
+	t.ForEach(func(k lua.LValue, v lua.LValue) {
+		m = append(m, luaToMsgpack(k, level), luaToMsgpack(v, level))
+	})
+	return m
+}
+
+func msgpackToLua(l *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case []byte:
+		return lua.LString(v)
+	case int64:
+		return lua.LNumber(v)
+	case uint64:
+		return lua.LNumber(v)
+	case float32:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case []interface{}:
+		t := l.CreateTable(len(v), 0)
+		for _, e := range v {
+			t.Append(msgpackToLua(l, e))
+		}
+		return t
+	case map[interface{}]interface{}:
+		t := l.CreateTable(0, len(v))
+		for k, e := range v {
+			if key := msgpackToLua(l, k); key != lua.LNil {
+				t.RawSet(key, msgpackToLua(l, e))
+			}
+		}
+		return t
+	default:
+		return lua.LNil
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func TestScriptIsolation(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_script_pool"
+	cfg.Addr = "127.0.0.1:11202"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	c := goredis.NewClient(cfg.Addr, "")
+	defer c.Close()
+
+	// the globals of a call are not seen by the next ones
+	for i := 0; i < 3; i++ {
+		if n, err := goredis.Int(c.Do("eval", "x = (x or 0) + 1 return x", 0)); err != nil {
+			t.Fatal(err)
+		} else if n != 1 {
+			t.Fatal(n)
+		}
+	}
+
+	if _, err := c.Do("eval", "_G.y = 1", 0); err == nil || !strings.Contains(err.Error(), "readonly table") {
+		t.Fatal(err)
+	}
+
+	// no file system, commands or ways around the read only globals
+	for _, script := range []string{
+		"return dofile('/etc/passwd')",
+		"return io.open('/etc/passwd')",
+		"return os.execute('true')",
+		"return os.getenv('HOME')",
+		"return require('os')",
+		"return loadstring('return 1')()",
+		"rawset(_G, 'y', 1)",
+		"setfenv(1, {})",
+		"_G.redis = nil",
+		"string.rep = nil",
+		"redis.call = nil",
+		"getmetatable('').__index.rep = nil",
+	} {
+		if _, err := c.Do("eval", script, 0); err == nil {
+			t.Fatal(script)
+		}
+	}
+
+	if v, err := goredis.String(c.Do("eval", "return string.rep('a', 2) .. ('b'):rep(2) .. cjson.encode({1})", 0)); err != nil || v != "aabb[1]" {
+		t.Fatal(v, err)
+	}
+
+	// concurrent scripts run in different states
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := goredis.String(c.Do("eval", "local i = 0 while i < 100000 do i = i + 1 end return ARGV[1]", 0, i))
+			if err != nil {
+				errs <- err
+			} else if v != fmt.Sprint(i) {
+				errs <- fmt.Errorf("%s != %d", v, i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	sha1, err := goredis.String(c.Do("script", "load", "return 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every state of the pool sees the loaded script, and none after a flush
+	for i := 0; i < 3; i++ {
+		if n, err := goredis.Int(c.Do("evalsha", sha1, 0)); err != nil || n != 1 {
+			t.Fatal(n, err)
+		}
+	}
+
+	if _, err := c.Do("script", "flush"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("evalsha", sha1, 0); err == nil || !strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		t.Fatal(err)
+	}
+}
+
+func TestScriptKill(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_script_kill"
+	cfg.Addr = "127.0.0.1:11203"
+	cfg.LuaTimeLimit = 50
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	c := goredis.NewClient(cfg.Addr, "")
+	defer c.Close()
+
+	if _, err := c.Do("script", "kill"); err == nil || !strings.HasPrefix(err.Error(), "NOTBUSY") {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Do("eval", "while true do end", 0)
+		done <- err
+	}()
+
+	waitBusy := func() {
+		for i := 0; ; i++ {
+			_, err := c.Do("get", "a")
+			if err != nil && strings.HasPrefix(err.Error(), "BUSY") {
+				return
+			} else if i == 100 {
+				t.Fatal("not busy", err)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	waitBusy()
+
+	if v, err := goredis.String(c.Do("script", "kill")); err != nil {
+		t.Fatal(err)
+	} else if v != "OK" {
+		t.Fatal(v)
+	}
+
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "killed by user") {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("get", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a script which has written can't be killed
+	go func() {
+		_, err := c.Do("eval", "redis.call('set', KEYS[1], '1') local i = 0 while i < 20000000 do i = i + 1 end return i", 1, "a")
+		done <- err
+	}()
+
+	waitBusy()
+
+	if _, err := c.Do("script", "kill"); err == nil || !strings.HasPrefix(err.Error(), "UNKILLABLE") {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
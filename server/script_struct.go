@@ -0,0 +1,323 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// struct of the Redis scripts, http://www.inf.puc-rio.br/~roberto/struct/
+const structLibName = "struct"
+
+const (
+	// the alignment of "!" without a size
+	structMaxAlign   = 8
+	structMaxIntSize = 32
+)
+
+func openStruct(l *lua.LState) int {
+	mod := l.RegisterModule(structLibName, map[string]lua.LGFunction{
+		"pack":   structPack,
+		"unpack": structUnpack,
+		"size":   structSize,
+	}).(*lua.LTable)
+	l.Push(mod)
+	return 1
+}
+
+// structFormat reads a format, one option at a time.
+type structFormat struct {
+	l   *lua.LState
+	fmt string
+	pos int
+
+	order binary.ByteOrder
+	align int
+}
+
+func newStructFormat(l *lua.LState, fmt string) *structFormat {
+	return &structFormat{l: l, fmt: fmt, order: binary.LittleEndian, align: 1}
+}
+
+func (f *structFormat) number(def int) int {
+	if f.pos >= len(f.fmt) || f.fmt[f.pos] < '0' || f.fmt[f.pos] > '9' {
+		return def
+	}
+
+	n := 0
+	for f.pos < len(f.fmt) && f.fmt[f.pos] >= '0' && f.fmt[f.pos] <= '9' {
+		n = n*10 + int(f.fmt[f.pos]-'0')
+		f.pos++
+	}
+	return n
+}
+
+// next returns the next data option and its size, the endianness and the
+// alignment options are applied on the way. ok is false at the end.
+func (f *structFormat) next() (opt byte, size int, ok bool) {
+	for f.pos < len(f.fmt) {
+		opt = f.fmt[f.pos]
+		f.pos++
+
+		switch opt {
+		case ' ':
+		case '>':
+			f.order = binary.BigEndian
+		case '<', '=':
+			f.order = binary.LittleEndian
+		case '!':
+			a := f.number(structMaxAlign)
+			if a&(a-1) != 0 {
+				f.l.RaiseError("alignment %d is not a power of 2", a)
+			}
+			f.align = a
+		case 'x', 'b', 'B':
+			return opt, 1, true
+		case 'h', 'H':
+			return opt, 2, true
+		case 'l', 'L', 'T':
+			return opt, 8, true
+		case 'i', 'I':
+			size = f.number(4)
+			if size > structMaxIntSize {
+				f.l.RaiseError("integral size %d is larger than limit of %d", size, structMaxIntSize)
+			}
+			return opt, size, true
+		case 'f':
+			return opt, 4, true
+		case 'd':
+			return opt, 8, true
+		case 'c':
+			return opt, f.number(1), true
+		case 's':
+			return opt, 0, true
+		default:
+			f.l.RaiseError("invalid format option '%c'", opt)
+		}
+	}
+	return 0, 0, false
+}
+
+// padding returns the bytes to add at n for the alignment of the option.
+func (f *structFormat) padding(n int, opt byte, size int) int {
+	if size == 0 || opt == 'c' {
+		return 0
+	}
+	if size > f.align {
+		size = f.align
+	}
+	if size&(size-1) != 0 {
+		f.l.ArgError(1, "alignment must be power of 2")
+	}
+	return (size - (n & (size - 1))) & (size - 1)
+}
+
+func structIsSigned(opt byte) bool {
+	return opt == 'b' || opt == 'h' || opt == 'l' || opt == 'i'
+}
+
+// struct.pack(fmt, v1, v2, ...)
+func structPack(l *lua.LState) int {
+	f := newStructFormat(l, l.CheckString(1))
+	arg := 2
+
+	var b bytes.Buffer
+	for {
+		opt, size, ok := f.next()
+		if !ok {
+			break
+		}
+
+		b.Write(make([]byte, f.padding(b.Len(), opt, size)))
+
+		switch opt {
+		case 'x':
+			b.WriteByte(0)
+		case 'b', 'B', 'h', 'H', 'l', 'L', 'T', 'i', 'I':
+			n := float64(l.CheckNumber(arg))
+			arg++
+
+			var v uint64
+			if n < 0 {
+				v = uint64(int64(n))
+			} else {
+				v = uint64(n)
+			}
+			b.Write(structPutInt(f.order, v, size, n < 0))
+		case 'f':
+			buf := make([]byte, 4)
+			f.order.PutUint32(buf, math.Float32bits(float32(l.CheckNumber(arg))))
+			arg++
+			b.Write(buf)
+		case 'd':
+			buf := make([]byte, 8)
+			f.order.PutUint64(buf, math.Float64bits(float64(l.CheckNumber(arg))))
+			arg++
+			b.Write(buf)
+		case 'c', 's':
+			s := l.CheckString(arg)
+			if opt == 'c' {
+				if size == 0 {
+					size = len(s)
+				}
+				if len(s) < size {
+					l.ArgError(arg, "string too short")
+				}
+				b.WriteString(s[:size])
+			} else {
+				if bytes.IndexByte([]byte(s), 0) >= 0 {
+					l.ArgError(arg, "string contains zeros")
+				}
+				b.WriteString(s)
+				b.WriteByte(0)
+			}
+			arg++
+		}
+	}
+
+	l.Push(lua.LString(b.String()))
+	return 1
+}
+
+func structPutInt(order binary.ByteOrder, v uint64, size int, negative bool) []byte {
+	buf := make([]byte, size)
+	for i := 0; i < size; i++ {
+		var c byte
+		if i < 8 {
+			c = byte(v >> uint(8*i))
+		} else if negative {
+			c = 0xff
+		}
+
+		if order == binary.BigEndian {
+			buf[size-1-i] = c
+		} else {
+			buf[i] = c
+		}
+	}
+	return buf
+}
+
+func structGetInt(l *lua.LState, order binary.ByteOrder, data []byte, signed bool) lua.LNumber {
+	size := len(data)
+
+	var v uint64
+	for i := 0; i < size; i++ {
+		c := data[i]
+		if order == binary.BigEndian {
+			c = data[size-1-i]
+		}
+
+		if i < 8 {
+			v |= uint64(c) << uint(8*i)
+		} else {
+			mask := byte(0)
+			if signed && int64(v) < 0 {
+				mask = 0xff
+			}
+			if c != mask {
+				l.RaiseError("%d-byte integer does not fit into Lua Integer", size)
+			}
+		}
+	}
+
+	if !signed {
+		return lua.LNumber(v)
+	}
+
+	if size < 8 {
+		shift := uint(64 - 8*size)
+		return lua.LNumber(int64(v<<shift) >> shift)
+	}
+	return lua.LNumber(int64(v))
+}
+
+// struct.unpack(fmt, s [, init]) returns the values, and the position
+// after them.
+func structUnpack(l *lua.LState) int {
+	f := newStructFormat(l, l.CheckString(1))
+	data := l.CheckString(2)
+	pos := l.OptInt(3, 1) - 1
+	if pos < 0 {
+		l.ArgError(3, "offset must be 1 or greater")
+	}
+
+	n := 0
+	for {
+		opt, size, ok := f.next()
+		if !ok {
+			break
+		}
+
+		pos += f.padding(pos, opt, size)
+		if pos > len(data) || size > len(data)-pos {
+			l.ArgError(2, "data string too short")
+		}
+
+		switch opt {
+		case 'x':
+		case 'b', 'B', 'h', 'H', 'l', 'L', 'T', 'i', 'I':
+			l.Push(structGetInt(l, f.order, []byte(data[pos:pos+size]), structIsSigned(opt)))
+			n++
+		case 'f':
+			l.Push(lua.LNumber(math.Float32frombits(f.order.Uint32([]byte(data[pos : pos+4])))))
+			n++
+		case 'd':
+			l.Push(lua.LNumber(math.Float64frombits(f.order.Uint64([]byte(data[pos : pos+8])))))
+			n++
+		case 'c':
+			if size == 0 {
+				// the size is the previous value
+				prev, isNum := l.Get(-1).(lua.LNumber)
+				if n == 0 || !isNum {
+					l.RaiseError("format 'c0' needs a previous size")
+				}
+				l.Pop(1)
+				n--
+
+				size = int(prev)
+				if size < 0 || size > len(data)-pos {
+					l.ArgError(2, "data string too short")
+				}
+			}
+			l.Push(lua.LString(data[pos : pos+size]))
+			n++
+		case 's':
+			end := bytes.IndexByte([]byte(data[pos:]), 0)
+			if end < 0 {
+				l.RaiseError("unfinished string in data")
+			}
+			l.Push(lua.LString(data[pos : pos+end]))
+			n++
+			size = end + 1
+		}
+
+		pos += size
+	}
+
+	l.Push(lua.LNumber(pos + 1))
+	return n + 1
+}
+
+// struct.size(fmt) returns the size of the packed data.
+func structSize(l *lua.LState) int {
+	f := newStructFormat(l, l.CheckString(1))
+
+	pos := 0
+	for {
+		opt, size, ok := f.next()
+		if !ok {
+			break
+		}
+
+		if opt == 's' || (opt == 'c' && size == 0) {
+			l.ArgError(1, "options 'c0' - 's' have undefined sizes")
+		}
+		pos += f.padding(pos, opt, size) + size
+	}
+
+	l.Push(lua.LNumber(pos))
+	return 1
+}
@@ -174,7 +174,7 @@ func TestLuaCall(t *testing.T) {
 	cfg.DataDir = "/tmp/testscript"
 	cfg.DBName = "memory"
 
-	app, e := NewApp(cfg)
+	app, e := NewApp(cfg, "")
 	if e != nil {
 		t.Fatal(e)
 	}
@@ -184,12 +184,15 @@ func TestLuaCall(t *testing.T) {
 
 	db, _ := app.ldb.Select(0)
 
-	luaClient := app.script.c
+	ls := app.script.get()
+	defer app.script.put(ls)
+
+	luaClient := ls.c
 	luaClient.db = db
 
-	l := app.script.l
+	l := ls.l
 
-	err := app.script.l.DoString(testScript1)
+	err := l.DoString(testScript1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -203,7 +206,7 @@ func TestLuaCall(t *testing.T) {
 		t.Fatal(fmt.Sprintf("%v %T", v, v))
 	}
 
-	err = app.script.l.DoString(testScript2)
+	err = l.DoString(testScript2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -213,7 +216,7 @@ func TestLuaCall(t *testing.T) {
 		t.Fatal(fmt.Sprintf("%v %T", v, v))
 	}
 
-	err = app.script.l.DoString(testScript3)
+	err = l.DoString(testScript3)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -224,7 +227,7 @@ func TestLuaCall(t *testing.T) {
 		t.Fatal(string(v))
 	}
 
-	err = app.script.l.DoString(testScript4)
+	err = l.DoString(testScript4)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -240,7 +243,7 @@ func TestLuaCall(t *testing.T) {
 		t.Fatal(string(v))
 	}
 
-	err = app.script.l.DoString(testScript5)
+	err = l.DoString(testScript5)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -250,7 +253,7 @@ func TestLuaCall(t *testing.T) {
 		t.Fatal(fmt.Sprintf("%v %T", v, v))
 	}
 
-	err = app.script.l.DoString(testScript6)
+	err = l.DoString(testScript6)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -277,7 +280,7 @@ func TestLuaCall(t *testing.T) {
 		}
 	}
 
-	err = app.script.l.DoString(testScript7)
+	err = l.DoString(testScript7)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -287,7 +290,7 @@ func TestLuaCall(t *testing.T) {
 		t.Fatal(fmt.Sprintf("%v %T", v, v))
 	}
 
-	err = app.script.l.DoString(testScript8)
+	err = l.DoString(testScript8)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siddontang/go/hack"
+	"github.com/siddontang/go/sync2"
+)
+
+const (
+	// at most these arguments and bytes of each argument are logged
+	slowlogMaxArgc   = 32
+	slowlogMaxArgLen = 128
+)
+
+type slowlogEntry struct {
+	id       int64
+	time     int64
+	duration int64 // microseconds
+	args     [][]byte
+	addr     string
+	name     string
+}
+
+// slowlog keeps the latest slow commands in a ring buffer.
+type slowlog struct {
+	// microseconds, negative disables it
+	slowerThan sync2.AtomicInt64
+
+	sync.Mutex
+
+	lastID int64
+	// the newest entry is at buf[(head-1) % len(buf)]
+	buf  []*slowlogEntry
+	head int
+	n    int
+}
+
+func newSlowlog(slowerThan int64, maxLen int) *slowlog {
+	s := new(slowlog)
+	s.slowerThan.Set(slowerThan)
+	s.buf = make([]*slowlogEntry, maxLen)
+	return s
+}
+
+func (s *slowlog) add(c *client, d time.Duration) {
+	slowerThan := s.slowerThan.Get()
+	us := int64(d / time.Microsecond)
+	if slowerThan < 0 || us < slowerThan {
+		return
+	}
+
+	e := &slowlogEntry{
+		time:     time.Now().Unix(),
+		duration: us,
+		addr:     c.remoteAddr,
+		name:     c.stat.name.Get(),
+	}
+
+	argc := len(c.args) + 1
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+
+	e.args = make([][]byte, 0, argc)
+	e.args = append(e.args, []byte(c.cmd))
+	for i, arg := range c.args {
+		if len(e.args) == slowlogMaxArgc-1 && len(c.args) > i+1 {
+			e.args = append(e.args, []byte(fmt.Sprintf("... (%d more arguments)", len(c.args)-i)))
+			break
+		}
+
+		if len(arg) > slowlogMaxArgLen {
+			b := make([]byte, slowlogMaxArgLen, slowlogMaxArgLen+32)
+			copy(b, arg)
+			e.args = append(e.args, append(b, fmt.Sprintf("... (%d more bytes)", len(arg)-slowlogMaxArgLen)...))
+		} else {
+			e.args = append(e.args, append([]byte(nil), arg...))
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastID++
+	e.id = s.lastID
+
+	if len(s.buf) == 0 {
+		return
+	}
+
+	s.buf[s.head] = e
+	s.head = (s.head + 1) % len(s.buf)
+	if s.n < len(s.buf) {
+		s.n++
+	}
+}
+
+// entries returns the latest count entries, newest first, all if count < 0.
+func (s *slowlog) entries(count int) []*slowlogEntry {
+	s.Lock()
+	defer s.Unlock()
+
+	if count < 0 || count > s.n {
+		count = s.n
+	}
+
+	es := make([]*slowlogEntry, count)
+	for i := range es {
+		es[i] = s.buf[(s.head-1-i+2*len(s.buf))%len(s.buf)]
+	}
+	return es
+}
+
+func (s *slowlog) len() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.n
+}
+
+func (s *slowlog) reset() {
+	s.Lock()
+	defer s.Unlock()
+
+	for i := range s.buf {
+		s.buf[i] = nil
+	}
+	s.head = 0
+	s.n = 0
+}
+
+// setMaxLen resizes the ring buffer, keeping the newest entries.
+func (s *slowlog) setMaxLen(maxLen int) {
+	es := s.entries(maxLen)
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.buf = make([]*slowlogEntry, maxLen)
+	s.n = len(es)
+	s.head = s.n % maxLen
+	for i, e := range es {
+		s.buf[s.n-1-i] = e
+	}
+}
+
+// SLOWLOG GET [count] | LEN | RESET | HELP
+func slowlogCommand(c *client) error {
+	s := c.app.slowlog
+
+	switch strings.ToLower(hack.String(c.args[0])) {
+	case "get":
+		count := 10
+		if len(c.args) == 2 {
+			n, err := strconv.Atoi(hack.String(c.args[1]))
+			if err != nil || n < -1 {
+				return ErrValue
+			}
+			count = n
+		} else if len(c.args) > 2 {
+			return ErrCmdParams
+		}
+
+		es := s.entries(count)
+		ay := make([]interface{}, len(es))
+		for i, e := range es {
+			ay[i] = []interface{}{
+				e.id,
+				e.time,
+				e.duration,
+				e.args,
+				[]byte(e.addr),
+				[]byte(e.name),
+			}
+		}
+		c.resp.writeArray(ay)
+	case "len":
+		c.resp.writeInteger(int64(s.len()))
+	case "reset":
+		s.reset()
+		c.resp.writeStatus(OK)
+	case "help":
+		c.resp.writeSliceArray([][]byte{
+			[]byte("SLOWLOG GET [<count>]"),
+			[]byte("SLOWLOG LEN"),
+			[]byte("SLOWLOG RESET"),
+		})
+	default:
+		return ErrSyntax
+	}
+
+	return nil
+}
+
+func init() {
+	register("slowlog", slowlogCommand)
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/siddontang/goredis"
+)
+
+func TestSlowlogRing(t *testing.T) {
+	s := newSlowlog(0, 3)
+
+	c := new(client)
+	c.cmd = "set"
+	for i := 0; i < 40; i++ {
+		c.args = append(c.args, []byte(strings.Repeat("a", 200)))
+	}
+
+	for i := 0; i < 5; i++ {
+		s.add(c, time.Millisecond)
+	}
+
+	es := s.entries(-1)
+	if len(es) != 3 || es[0].id != 5 || es[2].id != 3 {
+		t.Fatal(es)
+	}
+
+	args := es[0].args
+	if len(args) != slowlogMaxArgc {
+		t.Fatal(len(args))
+	} else if string(args[len(args)-1]) != "... (10 more arguments)" {
+		t.Fatal(string(args[len(args)-1]))
+	} else if !strings.HasSuffix(string(args[1]), "... (72 more bytes)") {
+		t.Fatal(string(args[1]))
+	}
+
+	s.setMaxLen(2)
+	if es = s.entries(-1); len(es) != 2 || es[0].id != 5 || es[1].id != 4 {
+		t.Fatal(es)
+	}
+
+	s.add(c, time.Millisecond)
+	if es = s.entries(10); len(es) != 2 || es[0].id != 6 || es[1].id != 5 {
+		t.Fatal(es)
+	}
+
+	s.slowerThan.Set(-1)
+	s.add(c, time.Second)
+	if s.len() != 2 {
+		t.Fatal(s.len())
+	}
+}
+
+func TestSlowlogLatency(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_slowlog"
+	cfg.Addr = "127.0.0.1:11191"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	c := goredis.NewClient(cfg.Addr, "")
+	c.SetMaxIdleConns(1)
+	defer c.Close()
+
+	if _, err := c.Do("config", "set", "slowlog-log-slower-than", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.Strings(c.Do("config", "get", "slowlog-log-slower-than")); err != nil {
+		t.Fatal(err)
+	} else if v[1] != "0" {
+		t.Fatal(v)
+	}
+
+	if _, err := c.Do("client", "setname", "slow"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("set", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.Values(c.Do("slowlog", "get", 1)); err != nil {
+		t.Fatal(err)
+	} else if len(v) != 1 {
+		t.Fatal(v)
+	} else if e, err := goredis.Values(v[0], nil); err != nil {
+		t.Fatal(err)
+	} else if args, _ := goredis.Strings(e[3], nil); strings.Join(args, " ") != "set a 1" {
+		t.Fatal(args)
+	} else if name, _ := goredis.String(e[5], nil); name != "slow" {
+		t.Fatal(name)
+	}
+
+	if _, err := c.Do("slowlog", "reset"); err != nil {
+		t.Fatal(err)
+	} else if n, err := goredis.Int(c.Do("slowlog", "len")); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		// the reset itself
+		t.Fatal(n)
+	}
+
+	if v, err := goredis.String(c.Do("latency", "doctor")); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(v, "disabled") {
+		t.Fatal(v)
+	}
+
+	if _, err := c.Do("config", "set", "latency-monitor-threshold", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do("eval", "local i = 0 while i < 2000000 do i = i + 1 end return i", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.Values(c.Do("latency", "latest")); err != nil {
+		t.Fatal(err)
+	} else {
+		found := false
+		for _, e := range v {
+			if e, _ := goredis.Values(e, nil); len(e) == 4 {
+				if name, _ := goredis.String(e[0], nil); name == "command" {
+					found = true
+				}
+			}
+		}
+		if !found {
+			t.Fatal("no command latency event")
+		}
+	}
+
+	if v, err := goredis.Values(c.Do("latency", "history", "command")); err != nil {
+		t.Fatal(err)
+	} else if len(v) != 1 {
+		t.Fatal(v)
+	}
+
+	if v, err := goredis.String(c.Do("latency", "doctor")); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(v, ". command: 1 latency spikes") {
+		t.Fatal(v)
+	}
+
+	if n, err := goredis.Int(c.Do("latency", "reset")); err != nil {
+		t.Fatal(err)
+	} else if n < 1 {
+		t.Fatal(n)
+	}
+}
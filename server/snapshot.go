@@ -12,6 +12,7 @@ import (
 
 	"github.com/r0123r/vredis/config"
 	"github.com/siddontang/go/log"
+	"github.com/siddontang/go/sync2"
 )
 
 const (
@@ -26,6 +27,15 @@ type snapshotStore struct {
 	names []string
 
 	quit chan struct{}
+
+	// for INFO persistence, read without the lock
+	dumping      sync2.AtomicBool
+	lastOK       sync2.AtomicBool
+	lastSave     sync2.AtomicInt64 // unix seconds
+	lastDuration sync2.AtomicDuration
+
+	// 1 while a BGSAVE runs, set by compare and swap
+	bgsaving sync2.AtomicInt32
 }
 
 func snapshotName(t time.Time) string {
@@ -64,6 +74,14 @@ func newSnapshotStore(cfg *config.Config) (*snapshotStore, error) {
 		return nil, err
 	}
 
+	s.lastOK.Set(true)
+	s.lastSave.Set(time.Now().Unix())
+	if len(s.names) > 0 {
+		if t, err := parseSnapshotName(s.names[len(s.names)-1]); err == nil {
+			s.lastSave.Set(t.Unix())
+		}
+	}
+
 	go s.run()
 
 	return s, nil
@@ -181,6 +199,21 @@ func (s *snapshotStore) Create(d snapshotDumper) (*snapshot, time.Time, error) {
 	s.Lock()
 	defer s.Unlock()
 
+	s.dumping.Set(true)
+	defer s.dumping.Set(false)
+
+	st, now, err := s.create(d)
+
+	s.lastOK.Set(err == nil)
+	if err == nil {
+		s.lastSave.Set(now.Unix())
+		s.lastDuration.Set(time.Since(now))
+	}
+
+	return st, now, err
+}
+
+func (s *snapshotStore) create(d snapshotDumper) (*snapshot, time.Time, error) {
 	s.purge(true)
 
 	now := time.Now()
@@ -190,7 +223,7 @@ func (s *snapshotStore) Create(d snapshotDumper) (*snapshot, time.Time, error) {
 
 	if len(s.names) > 0 {
 		lastTime, _ := parseSnapshotName(s.names[len(s.names)-1])
-		if now.Nanosecond() <= lastTime.Nanosecond() {
+		if !now.After(lastTime) {
 			return nil, time.Time{}, fmt.Errorf("create snapshot file time %s is behind %s ",
 				now.Format(snapshotTimeFormat), lastTime.Format(snapshotTimeFormat))
 		}
@@ -0,0 +1,342 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/go/log"
+	"github.com/yuin/gopher-lua"
+)
+
+// The triggers are kept in the meta space like the function libraries,
+// the version key changes with every change.
+const (
+	triggerPrefix     = "trigger:def:"
+	triggerVersionKey = "trigger:version"
+
+	// the writes of the triggers call the triggers again, up to this depth
+	triggerMaxDepth = 8
+)
+
+var (
+	errTriggerNotFound = errors.New("ERR Trigger not found")
+	errTriggerEvent    = errors.New("ERR Invalid trigger event, must be write, del or expired")
+)
+
+var triggerEvents = []string{ledis.KeyWrite, ledis.KeyDel, ledis.KeyExpired}
+
+// trigger calls a function for the events of the keys matching a pattern.
+type trigger struct {
+	name string
+
+	Function string   `json:"function"`
+	Pattern  string   `json:"pattern"`
+	Events   []string `json:"events"`
+
+	glob *ledis.Glob
+}
+
+func (t *trigger) match(e ledis.KeyEvent) bool {
+	for _, event := range t.Events {
+		if event == e.Event {
+			return t.glob.Match(e.Key)
+		}
+	}
+	return false
+}
+
+type triggerSet struct {
+	app *App
+	reg *metaRegistry
+
+	sync.RWMutex
+	triggers map[string]*trigger
+
+	// serializes the changes of the triggers
+	writeLock sync.Mutex
+}
+
+func (app *App) openTriggers() error {
+	ts := new(triggerSet)
+	ts.app = app
+	ts.reg = newMetaRegistry(app.ldb, triggerPrefix, triggerVersionKey)
+	ts.triggers = make(map[string]*trigger)
+
+	app.triggers = ts
+
+	return ts.sync()
+}
+
+// sync reloads the triggers if they were changed in the meta space.
+func (ts *triggerSet) sync() error {
+	version, items, ok, err := ts.reg.changed()
+	if err != nil || !ok {
+		return err
+	}
+
+	triggers := make(map[string]*trigger, len(items))
+	for _, item := range items {
+		t := new(trigger)
+		if err := json.Unmarshal(item.Value, t); err != nil {
+			log.Errorf("load trigger %s error %s", ts.reg.name(item.Key), err.Error())
+			continue
+		}
+
+		t.name = ts.reg.name(item.Key)
+		t.glob = ledis.CompileGlob(t.Pattern)
+		triggers[t.name] = t
+	}
+
+	ts.set(version, triggers)
+	return nil
+}
+
+func (ts *triggerSet) set(version []byte, triggers map[string]*trigger) {
+	ts.Lock()
+	ts.triggers = triggers
+	ts.Unlock()
+
+	ts.reg.use(version)
+}
+
+func (ts *triggerSet) active() bool {
+	ts.RLock()
+	defer ts.RUnlock()
+
+	return len(ts.triggers) > 0
+}
+
+// list returns the triggers sorted by name.
+func (ts *triggerSet) list() []*trigger {
+	ts.RLock()
+	defer ts.RUnlock()
+
+	triggers := make([]*trigger, 0, len(ts.triggers))
+	for _, t := range ts.triggers {
+		triggers = append(triggers, t)
+	}
+	sort.Slice(triggers, func(i, j int) bool { return triggers[i].name < triggers[j].name })
+	return triggers
+}
+
+// save writes the trigger, or deletes it if t is nil, in the meta space.
+func (ts *triggerSet) save(name string, t *trigger) error {
+	ts.writeLock.Lock()
+	defer ts.writeLock.Unlock()
+
+	ts.RLock()
+	triggers := make(map[string]*trigger, len(ts.triggers)+1)
+	for n, t := range ts.triggers {
+		triggers[n] = t
+	}
+	ts.RUnlock()
+
+	item := ledis.MetaItem{Key: ts.reg.key(name)}
+	if t == nil {
+		if _, ok := triggers[name]; !ok {
+			return errTriggerNotFound
+		}
+		delete(triggers, name)
+	} else {
+		value, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		item.Value = value
+		triggers[name] = t
+	}
+
+	version, err := ts.reg.update(item)
+	if err != nil {
+		return err
+	}
+
+	ts.set(version, triggers)
+	return nil
+}
+
+type triggerCall struct {
+	t *trigger
+	e ledis.KeyEvent
+}
+
+func (ts *triggerSet) match(events []ledis.KeyEvent) []triggerCall {
+	triggers := ts.list()
+
+	var calls []triggerCall
+	for _, e := range events {
+		for _, t := range triggers {
+			if t.match(e) {
+				calls = append(calls, triggerCall{t, e})
+			}
+		}
+	}
+	return calls
+}
+
+// fire calls the triggers of the key events of the Tx, before its commit.
+// The events of the trigger writes call the triggers again, the calls
+// deeper than triggerMaxDepth are skipped.
+func (ts *triggerSet) fire(tx *ledis.Tx) error {
+	return ts.fireEvents(tx, tx.Events())
+}
+
+// fireEvents fires the triggers of the events taken from the Tx already.
+func (ts *triggerSet) fireEvents(tx *ledis.Tx, events []ledis.KeyEvent) error {
+	for depth := 0; ; depth++ {
+		if depth > 0 {
+			events = tx.Events()
+		}
+
+		calls := ts.match(events)
+		if len(calls) == 0 {
+			return nil
+		} else if depth == triggerMaxDepth {
+			log.Warnf("triggers nested deeper than %d, %d calls skipped", triggerMaxDepth, len(calls))
+			return nil
+		}
+
+		if err := ts.app.script.syncFunctions(); err != nil {
+			return err
+		}
+
+		for _, call := range calls {
+			if err := ts.call(tx, call.t, call.e); err != nil {
+				return fmt.Errorf("ERR Error running trigger %s: %s", call.t.name, err.Error())
+			}
+		}
+	}
+}
+
+// expired is the ExpireHandler of ledis, it deletes the REST metadata of
+// the expired values and fires the triggers.
+func (app *App) expired(tx *ledis.Tx) error {
+	events := tx.Events()
+	if err := restExpired(tx, events); err != nil {
+		return err
+	}
+	return app.triggers.fireEvents(tx, append(events, tx.Events()...))
+}
+
+// call calls the function of the trigger with the key as KEYS[1], and the
+// event, the database and the key type as ARGV.
+func (ts *triggerSet) call(tx *ledis.Tx, t *trigger, e ledis.KeyEvent) error {
+	s := ts.app.script
+
+	f := s.lookupFunction(t.Function)
+	if f == nil {
+		log.Warnf("trigger %s function %s not found", t.name, t.Function)
+		return nil
+	}
+
+	keys := [][]byte{e.Key}
+	argv := [][]byte{[]byte(e.Event), []byte(strconv.Itoa(e.Index)), []byte(strings.ToLower(e.Type.String()))}
+
+	_, err := s.execTx(tx, e.Index, internalUser, "", f.noWrites, func(ls *luaState, env *lua.LTable) error {
+		return ls.callFunction(f, keys, argv)
+	})
+	return err
+}
+
+// withTriggers reports whether the command runs in a Tx for the triggers.
+func (c *client) withTriggers(cmd *command) bool {
+	return cmd.flags&cmdWrite != 0 && cmd.flags&(cmdBlocking|cmdNoScript) == 0 &&
+		c.tx == nil && c.app.triggers.active()
+}
+
+// callWithTriggers runs the write command in a Tx, and fires the triggers
+// before the commit. The reply is sent after the commit, the triggers can
+// fail the command.
+func (c *client) callWithTriggers(cmd *command) error {
+	db := c.db
+	resp := c.resp
+
+	tx := c.app.ldb.Begin()
+	defer func() {
+		tx.Rollback()
+		c.tx = nil
+		c.db = db
+		c.resp = resp
+	}()
+
+	var err error
+	c.tx = tx
+	if c.db, err = tx.Select(db.Index()); err != nil {
+		return err
+	}
+
+	replies := new(replyRecorder)
+	c.resp = replies
+
+	if err = cmd.fn(c); err != nil {
+		return err
+	} else if err = c.app.triggers.fire(tx); err != nil {
+		return err
+	} else if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	replies.replay(resp)
+	return nil
+}
+
+// replyRecorder keeps the replies, to write them later.
+type replyRecorder struct {
+	replies []func(w responseWriter)
+}
+
+func (r *replyRecorder) add(f func(w responseWriter)) {
+	r.replies = append(r.replies, f)
+}
+
+func (r *replyRecorder) replay(w responseWriter) {
+	for _, f := range r.replies {
+		f(w)
+	}
+}
+
+func (r *replyRecorder) writeError(err error) {
+	r.add(func(w responseWriter) { w.writeError(err) })
+}
+
+func (r *replyRecorder) writeStatus(status string) {
+	r.add(func(w responseWriter) { w.writeStatus(status) })
+}
+
+func (r *replyRecorder) writeInteger(n int64) {
+	r.add(func(w responseWriter) { w.writeInteger(n) })
+}
+
+func (r *replyRecorder) writeBulk(b []byte) {
+	r.add(func(w responseWriter) { w.writeBulk(b) })
+}
+
+func (r *replyRecorder) writeArray(lst []interface{}) {
+	r.add(func(w responseWriter) { w.writeArray(lst) })
+}
+
+func (r *replyRecorder) writeSliceArray(lst [][]byte) {
+	r.add(func(w responseWriter) { w.writeSliceArray(lst) })
+}
+
+func (r *replyRecorder) writeFVPairArray(lst []ledis.FVPair) {
+	r.add(func(w responseWriter) { w.writeFVPairArray(lst) })
+}
+
+func (r *replyRecorder) writeScorePairArray(lst []ledis.ScorePair, withScores bool) {
+	r.add(func(w responseWriter) { w.writeScorePairArray(lst, withScores) })
+}
+
+func (r *replyRecorder) writeBulkFrom(n int64, rb io.Reader) {
+	r.add(func(w responseWriter) { w.writeBulkFrom(n, rb) })
+}
+
+func (r *replyRecorder) flush() {
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r0123r/vredis/config"
+	"github.com/r0123r/vredis/ledis"
+	"github.com/siddontang/goredis"
+)
+
+const testTriggerLib = `#!lua name=triggers
+redis.register_function('index', function(keys, args)
+	if args[1] == 'del' then
+		return redis.call('zrem', 'idx', keys[1])
+	end
+	return redis.call('zadd', 'idx', args[2], keys[1])
+end)
+
+redis.register_function('audit', function(keys, args)
+	return redis.call('hincrby', 'audit', args[1] .. ':' .. args[3], 1)
+end)
+
+redis.register_function('again', function(keys, args)
+	return redis.call('incr', keys[1])
+end)
+
+redis.register_function('fail', function(keys, args)
+	error('boom')
+end)
+`
+
+func TestTrigger(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_trigger"
+	cfg.Addr = "127.0.0.1:11207"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+
+	c := goredis.NewClient(cfg.Addr, "")
+
+	if _, err := c.Do("function", "load", testTriggerLib); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]interface{}{
+		{"register", "index", "index", "user:*", "events", "write", "del"},
+		{"register", "audit", "audit", "tmp:*"},
+		{"register", "again", "again", "again:*", "events", "write"},
+		{"register", "fail", "fail", "fail:*"},
+	} {
+		if _, err := c.Do("trigger", args...); err != nil {
+			t.Fatal(args, err)
+		}
+	}
+
+	if _, err := c.Do("trigger", "register", "x", "nofunc", "*"); err == nil {
+		t.Fatal("must error")
+	} else if _, err := c.Do("trigger", "register", "x", "index", "*", "events", "set"); err == nil {
+		t.Fatal("must error")
+	}
+
+	// the trigger writes are committed with the command
+	if _, err := c.Do("set", "user:1", "a"); err != nil {
+		t.Fatal(err)
+	} else if n, err := goredis.Int(c.Do("zscore", "idx", "user:1")); err != nil || n != 0 {
+		t.Fatal(n, err)
+	} else if _, err := c.Do("eval", "return redis.call('hset', 'user:2', 'f', 'v')", 0); err != nil {
+		t.Fatal(err)
+	} else if n, err := goredis.Int(c.Do("zcard", "idx")); err != nil || n != 2 {
+		t.Fatal(n, err)
+	} else if _, err := c.Do("del", "user:1"); err != nil {
+		t.Fatal(err)
+	} else if v, err := c.Do("zscore", "idx", "user:1"); err != nil || v != nil {
+		t.Fatal(v, err)
+	}
+
+	// the writes of FTP and the other protocols fire the triggers too
+	ldb, _ := s.ldb.Select(0)
+	ftp := &LedisClientDriver{db: ldb, user: s.acl.defaultUser(), app: s, remoteAddr: "test"}
+	if err := ftp.MakeDirectory(nil, "user:3"); err != nil {
+		t.Fatal(err)
+	} else if n, err := goredis.Int(c.Do("zscore", "idx", "user:3/")); err != nil || n != 0 {
+		t.Fatal(n, err)
+	} else if err := ftp.DeleteFile(nil, "user:3/"); err != nil {
+		t.Fatal(err)
+	} else if v, err := c.Do("zscore", "idx", "user:3/"); err != nil || v != nil {
+		t.Fatal(v, err)
+	}
+
+	// and are paused and counted like the commands
+	calls := s.info.commandStat("del").calls.Get()
+	s.pause.pause(100*time.Millisecond, false)
+
+	start := time.Now()
+	if err := ftp.DeleteFile(nil, "user:3"); err != nil {
+		t.Fatal(err)
+	} else if time.Since(start) < 80*time.Millisecond {
+		t.Fatal("DELE is not paused")
+	} else if n := s.info.commandStat("del").calls.Get(); n != calls+1 {
+		t.Fatal(n, calls)
+	}
+
+	if err := s.Update(0, func(db *ledis.DB) error {
+		return db.Set([]byte("user:4"), []byte("a"))
+	}); err != nil {
+		t.Fatal(err)
+	} else if n, err := goredis.Int(c.Do("zscore", "idx", "user:4")); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+
+	// a failing trigger fails the command
+	if _, err := c.Do("set", "fail:1", "a"); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatal(err)
+	} else if n, err := goredis.Int(c.Do("exists", "fail:1")); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+
+	// the triggers of the trigger writes stop at triggerMaxDepth
+	if _, err := c.Do("set", "again:1", "0"); err != nil {
+		t.Fatal(err)
+	} else if n, err := goredis.Int(c.Do("get", "again:1")); err != nil || n != triggerMaxDepth {
+		t.Fatal(n, err)
+	}
+
+	if _, err := c.Do("set", "tmp:1", "a"); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Do("expire", "tmp:1", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+
+	if v, err := goredis.Strings(c.Do("hgetall", "audit")); err != nil {
+		t.Fatal(err)
+	} else if strings.Join(v, " ") != "expired:kv 1 write:kv 1" {
+		t.Fatal(v)
+	}
+
+	if ay, err := goredis.MultiBulk(c.Do("trigger", "list")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 4 {
+		t.Fatal(ay)
+	} else if v := ay[3].([]interface{}); string(v[1].([]byte)) != "index" || len(v[7].([]interface{})) != 2 {
+		t.Fatal(v)
+	}
+
+	if _, err := c.Do("trigger", "unregister", "fail"); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Do("trigger", "unregister", "fail"); err == nil {
+		t.Fatal("must error")
+	} else if _, err := c.Do("set", "fail:1", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the triggers survive a restart
+	c.Close()
+	s.Close()
+
+	if s, err = NewApp(cfg, ""); err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+
+	c = goredis.NewClient(cfg.Addr, "")
+
+	if _, err := c.Do("set", "user:3", "a"); err != nil {
+		t.Fatal(err)
+	} else if n, err := goredis.Int(c.Do("zscore", "idx", "user:3")); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+
+	c.Close()
+	s.Close()
+}
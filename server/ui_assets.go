@@ -0,0 +1,650 @@
+// This file was generated by .tools/generate_ui.py on Mon Oct 19 2026 14:22:01 +0000
+package server
+
+// uiIndexHTML is the page of the admin console, server/ui/index.html.
+const uiIndexHTML = "" +
+	"<!DOCTYPE html>\n" +
+	"<html lang=\"en\">\n" +
+	"<head>\n" +
+	"<meta charset=\"utf-8\">\n" +
+	"<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n" +
+	"<title>vredis admin</title>\n" +
+	"<style>\n" +
+	"* { box-sizing: border-box; }\n" +
+	"body { margin: 0; font: 14px/1.4 -apple-system, \"Segoe UI\", Helvetica, Arial, sans-serif; color: #222; background: #f4f5f7; }\n" +
+	"header { display: flex; align-items: center; gap: 16px; padding: 8px 16px; background: #2b2f3a; color: #fff; }\n" +
+	"header h1 { margin: 0; font-size: 16px; font-weight: 600; }\n" +
+	"header label { font-size: 13px; }\n" +
+	"nav { display: flex; gap: 4px; }\n" +
+	"nav button { background: none; border: 0; color: #cfd3dc; padding: 6px 10px; cursor: pointer; border-radius: 3px; }\n" +
+	"nav button.active, nav button:hover { background: #454b5a; color: #fff; }\n" +
+	"main { padding: 16px; }\n" +
+	"section { display: none; }\n" +
+	"section.active { display: block; }\n" +
+	"button, input, select, textarea { font: inherit; }\n" +
+	"button { padding: 4px 10px; border: 1px solid #b8bdc7; background: #fff; border-radius: 3px; cursor: pointer; }\n" +
+	"button:hover { background: #eef0f3; }\n" +
+	"button.danger { color: #b00020; border-color: #e0a0a8; }\n" +
+	"input, select, textarea { padding: 4px 6px; border: 1px solid #b8bdc7; border-radius: 3px; background: #fff; }\n" +
+	"textarea { width: 100%; min-height: 160px; font-family: Menlo, Consolas, monospace; }\n" +
+	"pre, .mono { font-family: Menlo, Consolas, monospace; font-size: 13px; }\n" +
+	"pre { background: #fff; border: 1px solid #dde0e5; padding: 8px; overflow: auto; white-space: pre-wrap; word-break: break-all; }\n" +
+	"table { border-collapse: collapse; width: 100%; background: #fff; }\n" +
+	"th, td { border: 1px solid #dde0e5; padding: 4px 6px; text-align: left; vertical-align: top; word-break: break-all; }\n" +
+	"th { background: #eef0f3; font-weight: 600; }\n" +
+	".row { display: flex; gap: 8px; align-items: center; flex-wrap: wrap; margin-bottom: 8px; }\n" +
+	".split { display: flex; gap: 16px; align-items: flex-start; }\n" +
+	".keys { width: 320px; flex: none; }\n" +
+	".keys ul { list-style: none; margin: 0; padding: 0; max-height: 70vh; overflow: auto; background: #fff; border: 1px solid #dde0e5; }\n" +
+	".keys li { padding: 3px 6px; cursor: pointer; display: flex; justify-content: space-between; gap: 8px; }\n" +
+	".keys li:hover, .keys li.active { background: #e4ecfb; }\n" +
+	".type { font-size: 11px; color: #555; text-transform: uppercase; }\n" +
+	".viewer { flex: 1; min-width: 0; }\n" +
+	".error { color: #b00020; }\n" +
+	".muted { color: #777; }\n" +
+	"#console-out { min-height: 300px; max-height: 60vh; }\n" +
+	"</style>\n" +
+	"</head>\n" +
+	"<body>\n" +
+	"<header>\n" +
+	"  <h1>vredis</h1>\n" +
+	"  <label>DB <select id=\"db\"></select></label>\n" +
+	"  <nav id=\"tabs\">\n" +
+	"    <button data-tab=\"keys\" class=\"active\">Keys</button>\n" +
+	"    <button data-tab=\"console\">Console</button>\n" +
+	"    <button data-tab=\"info\">Info</button>\n" +
+	"    <button data-tab=\"slowlog\">Slowlog</button>\n" +
+	"    <button data-tab=\"replication\">Replication</button>\n" +
+	"  </nav>\n" +
+	"  <span id=\"status\" class=\"error\"></span>\n" +
+	"</header>\n" +
+	"<main>\n" +
+	"\n" +
+	"<section id=\"keys\" class=\"active\">\n" +
+	"  <div class=\"split\">\n" +
+	"    <div class=\"keys\">\n" +
+	"      <div class=\"row\">\n" +
+	"        <input id=\"pattern\" value=\"*\" placeholder=\"pattern\" size=\"14\">\n" +
+	"        <select id=\"scan-type\">\n" +
+	"          <option value=\"\">all types</option>\n" +
+	"          <option value=\"kv\">string</option>\n" +
+	"          <option value=\"hash\">hash</option>\n" +
+	"          <option value=\"list\">list</option>\n" +
+	"          <option value=\"set\">set</option>\n" +
+	"          <option value=\"zset\">zset</option>\n" +
+	"        </select>\n" +
+	"        <button id=\"scan\">Scan</button>\n" +
+	"      </div>\n" +
+	"      <ul id=\"key-list\"></ul>\n" +
+	"      <div class=\"row\"><button id=\"more\" disabled>More</button><span id=\"key-count\" class=\"muted\"></span></div>\n" +
+	"      <div class=\"row\">\n" +
+	"        <input id=\"new-key\" placeholder=\"new key\" size=\"14\">\n" +
+	"        <select id=\"new-type\">\n" +
+	"          <option value=\"kv\">string</option>\n" +
+	"          <option value=\"hash\">hash</option>\n" +
+	"          <option value=\"list\">list</option>\n" +
+	"          <option value=\"set\">set</option>\n" +
+	"          <option value=\"zset\">zset</option>\n" +
+	"        </select>\n" +
+	"        <button id=\"create\">New</button>\n" +
+	"      </div>\n" +
+	"    </div>\n" +
+	"    <div class=\"viewer\" id=\"viewer\"><p class=\"muted\">Select a key.</p></div>\n" +
+	"  </div>\n" +
+	"</section>\n" +
+	"\n" +
+	"<section id=\"console\">\n" +
+	"  <pre id=\"console-out\"></pre>\n" +
+	"  <div class=\"row\">\n" +
+	"    <input id=\"console-in\" class=\"mono\" style=\"flex: 1\" placeholder=\"command, e.g. HGETALL user:1 (Up and Down for the history)\" autocomplete=\"off\">\n" +
+	"    <button id=\"console-run\">Run</button>\n" +
+	"    <button id=\"console-clear\">Clear</button>\n" +
+	"  </div>\n" +
+	"</section>\n" +
+	"\n" +
+	"<section id=\"info\">\n" +
+	"  <div class=\"row\">\n" +
+	"    <select id=\"info-section\">\n" +
+	"      <option value=\"\">all</option>\n" +
+	"      <option>server</option>\n" +
+	"      <option>clients</option>\n" +
+	"      <option>memory</option>\n" +
+	"      <option>persistence</option>\n" +
+	"      <option>stats</option>\n" +
+	"      <option>replication</option>\n" +
+	"      <option>cpu</option>\n" +
+	"      <option>keyspace</option>\n" +
+	"    </select>\n" +
+	"    <button id=\"info-refresh\">Refresh</button>\n" +
+	"  </div>\n" +
+	"  <pre id=\"info-out\"></pre>\n" +
+	"</section>\n" +
+	"\n" +
+	"<section id=\"slowlog\">\n" +
+	"  <div class=\"row\">\n" +
+	"    <button id=\"slowlog-refresh\">Refresh</button>\n" +
+	"    <button id=\"slowlog-reset\" class=\"danger\">Reset</button>\n" +
+	"  </div>\n" +
+	"  <table>\n" +
+	"    <thead><tr><th>id</th><th>time</th><th>duration (us)</th><th>command</th><th>client</th><th>name</th></tr></thead>\n" +
+	"    <tbody id=\"slowlog-out\"></tbody>\n" +
+	"  </table>\n" +
+	"</section>\n" +
+	"\n" +
+	"<section id=\"replication\">\n" +
+	"  <div class=\"row\">\n" +
+	"    <button id=\"repl-refresh\">Refresh</button>\n" +
+	"    <button id=\"bgsave\">Snapshot (BGSAVE)</button>\n" +
+	"    <button id=\"save\">Snapshot now (SAVE)</button>\n" +
+	"    <span id=\"lastsave\" class=\"muted\"></span>\n" +
+	"  </div>\n" +
+	"  <h3>Role</h3>\n" +
+	"  <pre id=\"role-out\"></pre>\n" +
+	"  <h3>Replication</h3>\n" +
+	"  <pre id=\"repl-out\"></pre>\n" +
+	"  <h3>Persistence</h3>\n" +
+	"  <pre id=\"persist-out\"></pre>\n" +
+	"</section>\n" +
+	"\n" +
+	"</main>\n" +
+	"<script>\n" +
+	"(function () {\n" +
+	"  \"use strict\";\n" +
+	"\n" +
+	"  var $ = function (id) { return document.getElementById(id); };\n" +
+	"\n" +
+	"  function el(tag, text, cls) {\n" +
+	"    var e = document.createElement(tag);\n" +
+	"    if (text !== undefined && text !== null) e.textContent = text;\n" +
+	"    if (cls) e.className = cls;\n" +
+	"    return e;\n" +
+	"  }\n" +
+	"\n" +
+	"  function setStatus(msg) { $(\"status\").textContent = msg || \"\"; }\n" +
+	"\n" +
+	"  // call runs a command on the selected db with the JSON API of the\n" +
+	"  // command endpoint, and returns its reply, the error replies throw.\n" +
+	"  function call(args) {\n" +
+	"    var db = $(\"db\").value || \"0\";\n" +
+	"    return fetch(\"/\" + encodeURIComponent(db), {\n" +
+	"      method: \"POST\",\n" +
+	"      credentials: \"same-origin\",\n" +
+	"      headers: { \"Content-Type\": \"application/json\" },\n" +
+	"      body: JSON.stringify({ cmd: String(args[0]), args: args.slice(1).map(String) })\n" +
+	"    }).then(function (r) {\n" +
+	"      return r.text().then(function (text) {\n" +
+	"        if (!r.ok) throw new Error(text.trim() || r.statusText);\n" +
+	"        var body = JSON.parse(text);\n" +
+	"        var v = body[Object.keys(body)[0]];\n" +
+	"        if (isStatus(v)) {\n" +
+	"          if (v[0] === false && /^ERR /.test(v[1])) throw new Error(v[1]);\n" +
+	"          return v[1];\n" +
+	"        }\n" +
+	"        return v;\n" +
+	"      });\n" +
+	"    });\n" +
+	"  }\n" +
+	"\n" +
+	"  function isStatus(v) {\n" +
+	"    return Array.isArray(v) && v.length === 2 && typeof v[0] === \"boolean\";\n" +
+	"  }\n" +
+	"\n" +
+	"  function fail(err) { setStatus(err.message); }\n" +
+	"\n" +
+	"  // tabs\n" +
+	"\n" +
+	"  var loaders = {};\n" +
+	"\n" +
+	"  Array.prototype.forEach.call(document.querySelectorAll(\"#tabs button\"), function (b) {\n" +
+	"    b.addEventListener(\"click\", function () {\n" +
+	"      Array.prototype.forEach.call(document.querySelectorAll(\"#tabs button, section\"), function (e) {\n" +
+	"        e.classList.remove(\"active\");\n" +
+	"      });\n" +
+	"      b.classList.add(\"active\");\n" +
+	"      $(b.dataset.tab).classList.add(\"active\");\n" +
+	"      setStatus(\"\");\n" +
+	"      if (loaders[b.dataset.tab]) loaders[b.dataset.tab]();\n" +
+	"    });\n" +
+	"  });\n" +
+	"\n" +
+	"  // databases\n" +
+	"\n" +
+	"  call([\"config\", \"get\", \"databases\"]).then(function (v) {\n" +
+	"    var n = parseInt(v && v[1], 10) || 16;\n" +
+	"    for (var i = 0; i < n; i++) $(\"db\").appendChild(el(\"option\", String(i)));\n" +
+	"  }, function (err) {\n" +
+	"    $(\"db\").appendChild(el(\"option\", \"0\"));\n" +
+	"    fail(err);\n" +
+	"  });\n" +
+	"\n" +
+	"  $(\"db\").addEventListener(\"change\", function () {\n" +
+	"    $(\"viewer\").innerHTML = \"\";\n" +
+	"    scan(true);\n" +
+	"  });\n" +
+	"\n" +
+	"  // keys\n" +
+	"\n" +
+	"  var types = [\"kv\", \"hash\", \"list\", \"set\", \"zset\"];\n" +
+	"  var typeNames = { kv: \"string\", hash: \"hash\", list: \"list\", set: \"set\", zset: \"zset\" };\n" +
+	"  var scanState = null;\n" +
+	"\n" +
+	"  function scan(reset) {\n" +
+	"    if (reset || !scanState) {\n" +
+	"      var t = $(\"scan-type\").value;\n" +
+	"      scanState = { types: t ? [t] : types.slice(), cursor: \"\", count: 0 };\n" +
+	"      $(\"key-list\").innerHTML = \"\";\n" +
+	"    }\n" +
+	"    if (scanState.types.length === 0) return;\n" +
+	"\n" +
+	"    var t = scanState.types[0];\n" +
+	"    call([\"xscan\", t, scanState.cursor, \"MATCH\", $(\"pattern\").value || \"*\", \"COUNT\", 100]).then(function (v) {\n" +
+	"      var keys = v[1] || [];\n" +
+	"      keys.forEach(function (k) { addKey(k, t); });\n" +
+	"      scanState.count += keys.length;\n" +
+	"      if (keys.length < 100) {\n" +
+	"        scanState.types.shift();\n" +
+	"        scanState.cursor = \"\";\n" +
+	"      } else {\n" +
+	"        scanState.cursor = keys[keys.length - 1];\n" +
+	"      }\n" +
+	"      $(\"more\").disabled = scanState.types.length === 0;\n" +
+	"      $(\"key-count\").textContent = scanState.count + \" keys\";\n" +
+	"      // fill the page with the next types\n" +
+	"      if (scanState.types.length > 0 && keys.length < 100) scan(false);\n" +
+	"    }, fail);\n" +
+	"  }\n" +
+	"\n" +
+	"  function addKey(key, type) {\n" +
+	"    var li = el(\"li\");\n" +
+	"    li.appendChild(el(\"span\", key, \"mono\"));\n" +
+	"    li.appendChild(el(\"span\", typeNames[type], \"type\"));\n" +
+	"    li.addEventListener(\"click\", function () {\n" +
+	"      Array.prototype.forEach.call(document.querySelectorAll(\"#key-list li\"), function (e) {\n" +
+	"        e.classList.remove(\"active\");\n" +
+	"      });\n" +
+	"      li.classList.add(\"active\");\n" +
+	"      view(key, type);\n" +
+	"    });\n" +
+	"    $(\"key-list\").appendChild(li);\n" +
+	"  }\n" +
+	"\n" +
+	"  $(\"scan\").addEventListener(\"click\", function () { scan(true); });\n" +
+	"  $(\"pattern\").addEventListener(\"keydown\", function (e) { if (e.key === \"Enter\") scan(true); });\n" +
+	"  $(\"more\").addEventListener(\"click\", function () { scan(false); });\n" +
+	"  $(\"create\").addEventListener(\"click\", function () {\n" +
+	"    var key = $(\"new-key\").value;\n" +
+	"    if (key) view(key, $(\"new-type\").value, true);\n" +
+	"  });\n" +
+	"\n" +
+	"  // the commands of each type\n" +
+	"  var ops = {\n" +
+	"    kv: { ttl: \"ttl\", expire: \"expire\", persist: \"persist\", del: \"del\" },\n" +
+	"    hash: { ttl: \"httl\", expire: \"hexpire\", persist: \"hpersist\", del: \"hclear\" },\n" +
+	"    list: { ttl: \"lttl\", expire: \"lexpire\", persist: \"lpersist\", del: \"lclear\" },\n" +
+	"    set: { ttl: \"sttl\", expire: \"sexpire\", persist: \"spersist\", del: \"sclear\" },\n" +
+	"    zset: { ttl: \"zttl\", expire: \"zexpire\", persist: \"zpersist\", del: \"zclear\" }\n" +
+	"  };\n" +
+	"\n" +
+	"  // the max number of the elements shown\n" +
+	"  var maxItems = 500;\n" +
+	"\n" +
+	"  function view(key, type, isNew) {\n" +
+	"    var v = $(\"viewer\");\n" +
+	"    v.innerHTML = \"\";\n" +
+	"    setStatus(\"\");\n" +
+	"\n" +
+	"    var head = el(\"div\", null, \"row\");\n" +
+	"    head.appendChild(el(\"strong\", key, \"mono\"));\n" +
+	"    head.appendChild(el(\"span\", typeNames[type], \"type\"));\n" +
+	"    var ttl = el(\"span\", \"\", \"muted\");\n" +
+	"    head.appendChild(ttl);\n" +
+	"    v.appendChild(head);\n" +
+	"\n" +
+	"    var actions = el(\"div\", null, \"row\");\n" +
+	"    var ttlIn = el(\"input\");\n" +
+	"    ttlIn.placeholder = \"seconds\";\n" +
+	"    ttlIn.size = 8;\n" +
+	"    actions.appendChild(ttlIn);\n" +
+	"    actions.appendChild(button(\"Expire\", function () {\n" +
+	"      call([ops[type].expire, key, ttlIn.value]).then(refresh, fail);\n" +
+	"    }));\n" +
+	"    actions.appendChild(button(\"Persist\", function () {\n" +
+	"      call([ops[type].persist, key]).then(refresh, fail);\n" +
+	"    }));\n" +
+	"    actions.appendChild(button(\"Reload\", refresh));\n" +
+	"    actions.appendChild(button(\"Delete key\", function () {\n" +
+	"      if (!confirm(\"Delete \" + typeNames[type] + \" \" + key + \"?\")) return;\n" +
+	"      call([ops[type].del, key]).then(function () {\n" +
+	"        v.innerHTML = \"\";\n" +
+	"        v.appendChild(el(\"p\", \"Deleted \" + key, \"muted\"));\n" +
+	"      }, fail);\n" +
+	"    }, \"danger\"));\n" +
+	"    v.appendChild(actions);\n" +
+	"\n" +
+	"    var body = el(\"div\");\n" +
+	"    v.appendChild(body);\n" +
+	"\n" +
+	"    function refresh() {\n" +
+	"      setStatus(\"\");\n" +
+	"      call([ops[type].ttl, key]).then(function (n) {\n" +
+	"        ttl.textContent = n >= 0 ? \"TTL \" + n + \"s\" : (n === -1 ? \"no TTL\" : \"\");\n" +
+	"      }, fail);\n" +
+	"      body.innerHTML = \"\";\n" +
+	"      editors[type](key, body, refresh);\n" +
+	"    }\n" +
+	"\n" +
+	"    if (isNew) {\n" +
+	"      editors[type](key, body, refresh, true);\n" +
+	"    } else {\n" +
+	"      refresh();\n" +
+	"    }\n" +
+	"  }\n" +
+	"\n" +
+	"  function button(text, f, cls) {\n" +
+	"    var b = el(\"button\", text, cls);\n" +
+	"    b.addEventListener(\"click\", f);\n" +
+	"    return b;\n" +
+	"  }\n" +
+	"\n" +
+	"  function table(headers) {\n" +
+	"    var t = el(\"table\");\n" +
+	"    var tr = el(\"tr\");\n" +
+	"    headers.forEach(function (h) { tr.appendChild(el(\"th\", h)); });\n" +
+	"    var thead = el(\"thead\");\n" +
+	"    thead.appendChild(tr);\n" +
+	"    t.appendChild(thead);\n" +
+	"    t.appendChild(el(\"tbody\"));\n" +
+	"    return t;\n" +
+	"  }\n" +
+	"\n" +
+	"  function row(t, cells) {\n" +
+	"    var tr = el(\"tr\");\n" +
+	"    cells.forEach(function (c) {\n" +
+	"      var td = el(\"td\", null, \"mono\");\n" +
+	"      if (c instanceof Node) td.appendChild(c); else td.textContent = c;\n" +
+	"      tr.appendChild(td);\n" +
+	"    });\n" +
+	"    t.tBodies[0].appendChild(tr);\n" +
+	"  }\n" +
+	"\n" +
+	"  function adder(body, placeholders, f) {\n" +
+	"    var r = el(\"div\", null, \"row\");\n" +
+	"    var inputs = placeholders.map(function (p) {\n" +
+	"      var i = el(\"input\");\n" +
+	"      i.placeholder = p;\n" +
+	"      r.appendChild(i);\n" +
+	"      return i;\n" +
+	"    });\n" +
+	"    r.appendChild(button(\"Add\", function () {\n" +
+	"      f(inputs.map(function (i) { return i.value; }));\n" +
+	"    }));\n" +
+	"    body.appendChild(r);\n" +
+	"  }\n" +
+	"\n" +
+	"  var editors = {\n" +
+	"    kv: function (key, body, refresh, isNew) {\n" +
+	"      var ta = el(\"textarea\");\n" +
+	"      body.appendChild(ta);\n" +
+	"      body.appendChild(button(\"Save\", function () {\n" +
+	"        call([\"set\", key, ta.value]).then(refresh, fail);\n" +
+	"      }));\n" +
+	"      if (!isNew) {\n" +
+	"        call([\"get\", key]).then(function (v) { ta.value = v === null ? \"\" : v; }, fail);\n" +
+	"      }\n" +
+	"    },\n" +
+	"\n" +
+	"    hash: function (key, body, refresh, isNew) {\n" +
+	"      adder(body, [\"field\", \"value\"], function (v) {\n" +
+	"        call([\"hset\", key, v[0], v[1]]).then(refresh, fail);\n" +
+	"      });\n" +
+	"      if (isNew) return;\n" +
+	"\n" +
+	"      call([\"hgetall\", key]).then(function (m) {\n" +
+	"        var t = table([\"field\", \"value\", \"\"]);\n" +
+	"        Object.keys(m || {}).sort().forEach(function (f) {\n" +
+	"          var input = el(\"input\");\n" +
+	"          input.value = m[f];\n" +
+	"          input.style.width = \"100%\";\n" +
+	"          var acts = el(\"span\");\n" +
+	"          acts.appendChild(button(\"Save\", function () {\n" +
+	"            call([\"hset\", key, f, input.value]).then(refresh, fail);\n" +
+	"          }));\n" +
+	"          acts.appendChild(button(\"Delete\", function () {\n" +
+	"            call([\"hdel\", key, f]).then(refresh, fail);\n" +
+	"          }, \"danger\"));\n" +
+	"          row(t, [f, input, acts]);\n" +
+	"        });\n" +
+	"        body.appendChild(t);\n" +
+	"      }, fail);\n" +
+	"    },\n" +
+	"\n" +
+	"    list: function (key, body, refresh, isNew) {\n" +
+	"      adder(body, [\"value\"], function (v) {\n" +
+	"        call([\"rpush\", key, v[0]]).then(refresh, fail);\n" +
+	"      });\n" +
+	"      if (isNew) return;\n" +
+	"\n" +
+	"      call([\"llen\", key]).then(function (n) {\n" +
+	"        if (n > maxItems) body.appendChild(el(\"p\", \"The first \" + maxItems + \" of \" + n + \" elements.\", \"muted\"));\n" +
+	"      }, fail);\n" +
+	"      call([\"lrange\", key, 0, maxItems - 1]).then(function (items) {\n" +
+	"        var t = table([\"index\", \"value\", \"\"]);\n" +
+	"        (items || []).forEach(function (item, i) {\n" +
+	"          var input = el(\"input\");\n" +
+	"          input.value = item;\n" +
+	"          input.style.width = \"100%\";\n" +
+	"          var acts = el(\"span\");\n" +
+	"          acts.appendChild(button(\"Save\", function () {\n" +
+	"            call([\"lset\", key, i, input.value]).then(refresh, fail);\n" +
+	"          }));\n" +
+	"          acts.appendChild(button(\"Delete\", function () {\n" +
+	"            call([\"lrem\", key, 1, item]).then(refresh, fail);\n" +
+	"          }, \"danger\"));\n" +
+	"          row(t, [String(i), input, acts]);\n" +
+	"        });\n" +
+	"        body.appendChild(t);\n" +
+	"      }, fail);\n" +
+	"    },\n" +
+	"\n" +
+	"    set: function (key, body, refresh, isNew) {\n" +
+	"      adder(body, [\"member\"], function (v) {\n" +
+	"        call([\"sadd\", key, v[0]]).then(refresh, fail);\n" +
+	"      });\n" +
+	"      if (isNew) return;\n" +
+	"\n" +
+	"      call([\"smembers\", key]).then(function (members) {\n" +
+	"        members = (members || []).slice().sort();\n" +
+	"        if (members.length > maxItems) {\n" +
+	"          body.appendChild(el(\"p\", \"The first \" + maxItems + \" of \" + members.length + \" members.\", \"muted\"));\n" +
+	"          members = members.slice(0, maxItems);\n" +
+	"        }\n" +
+	"        var t = table([\"member\", \"\"]);\n" +
+	"        members.forEach(function (m) {\n" +
+	"          row(t, [m, button(\"Delete\", function () {\n" +
+	"            call([\"srem\", key, m]).then(refresh, fail);\n" +
+	"          }, \"danger\")]);\n" +
+	"        });\n" +
+	"        body.appendChild(t);\n" +
+	"      }, fail);\n" +
+	"    },\n" +
+	"\n" +
+	"    zset: function (key, body, refresh, isNew) {\n" +
+	"      adder(body, [\"score\", \"member\"], function (v) {\n" +
+	"        call([\"zadd\", key, v[0], v[1]]).then(refresh, fail);\n" +
+	"      });\n" +
+	"      if (isNew) return;\n" +
+	"\n" +
+	"      call([\"zcard\", key]).then(function (n) {\n" +
+	"        if (n > maxItems) body.appendChild(el(\"p\", \"The first \" + maxItems + \" of \" + n + \" members.\", \"muted\"));\n" +
+	"      }, fail);\n" +
+	"      call([\"zrange\", key, 0, maxItems - 1, \"WITHSCORES\"]).then(function (items) {\n" +
+	"        var t = table([\"member\", \"score\", \"\"]);\n" +
+	"        items = items || [];\n" +
+	"        for (var i = 0; i + 1 < items.length; i += 2) {\n" +
+	"          (function (member, score) {\n" +
+	"            var input = el(\"input\");\n" +
+	"            input.value = score;\n" +
+	"            input.size = 12;\n" +
+	"            var acts = el(\"span\");\n" +
+	"            acts.appendChild(button(\"Save\", function () {\n" +
+	"              call([\"zadd\", key, input.value, member]).then(refresh, fail);\n" +
+	"            }));\n" +
+	"            acts.appendChild(button(\"Delete\", function () {\n" +
+	"              call([\"zrem\", key, member]).then(refresh, fail);\n" +
+	"            }, \"danger\"));\n" +
+	"            row(t, [member, input, acts]);\n" +
+	"          })(items[i], items[i + 1]);\n" +
+	"        }\n" +
+	"        body.appendChild(t);\n" +
+	"      }, fail);\n" +
+	"    }\n" +
+	"  };\n" +
+	"\n" +
+	"  // console\n" +
+	"\n" +
+	"  var historyKey = \"vredis.console.history\";\n" +
+	"  var maxHistory = 100;\n" +
+	"  var history = [];\n" +
+	"  try { history = JSON.parse(localStorage.getItem(historyKey)) || []; } catch (e) {}\n" +
+	"  var historyPos = history.length;\n" +
+	"\n" +
+	"  // parseArgs splits the line as redis-cli does, with the quoted arguments.\n" +
+	"  function parseArgs(line) {\n" +
+	"    var args = [];\n" +
+	"    var re = /\"((?:[^\"\\\\]|\\\\.)*)\"|'([^']*)'|(\\S+)/g;\n" +
+	"    var m;\n" +
+	"    while ((m = re.exec(line)) !== null) {\n" +
+	"      if (m[1] !== undefined) {\n" +
+	"        args.push(m[1].replace(/\\\\(.)/g, function (_, c) {\n" +
+	"          return { n: \"\\n\", r: \"\\r\", t: \"\\t\" }[c] || c;\n" +
+	"        }));\n" +
+	"      } else if (m[2] !== undefined) {\n" +
+	"        args.push(m[2]);\n" +
+	"      } else {\n" +
+	"        args.push(m[3]);\n" +
+	"      }\n" +
+	"    }\n" +
+	"    return args;\n" +
+	"  }\n" +
+	"\n" +
+	"  // format renders a reply as redis-cli does.\n" +
+	"  function format(v, indent) {\n" +
+	"    indent = indent || \"\";\n" +
+	"    if (v === null || v === undefined) return \"(nil)\";\n" +
+	"    if (typeof v === \"number\") return \"(integer) \" + v;\n" +
+	"    if (typeof v === \"string\") return JSON.stringify(v);\n" +
+	"    if (Array.isArray(v)) {\n" +
+	"      if (v.length === 0) return \"(empty array)\";\n" +
+	"      var w = String(v.length).length;\n" +
+	"      return v.map(function (e, i) {\n" +
+	"        var n = String(i + 1);\n" +
+	"        var prefix = (i === 0 ? \"\" : indent) + new Array(w - n.length + 1).join(\" \") + n + \") \";\n" +
+	"        return prefix + format(e, indent + new Array(w + 3).join(\" \"));\n" +
+	"      }).join(\"\\n\");\n" +
+	"    }\n" +
+	"    return Object.keys(v).map(function (k, i) {\n" +
+	"      return (i === 0 ? \"\" : indent) + JSON.stringify(k) + \" => \" + format(v[k], indent);\n" +
+	"    }).join(\"\\n\");\n" +
+	"  }\n" +
+	"\n" +
+	"  function runConsole() {\n" +
+	"    var line = $(\"console-in\").value.trim();\n" +
+	"    if (!line) return;\n" +
+	"    $(\"console-in\").value = \"\";\n" +
+	"\n" +
+	"    if (history[history.length - 1] !== line) history.push(line);\n" +
+	"    if (history.length > maxHistory) history = history.slice(history.length - maxHistory);\n" +
+	"    historyPos = history.length;\n" +
+	"    try { localStorage.setItem(historyKey, JSON.stringify(history)); } catch (e) {}\n" +
+	"\n" +
+	"    var out = $(\"console-out\");\n" +
+	"    out.appendChild(el(\"span\", \"db\" + $(\"db\").value + \"> \" + line + \"\\n\"));\n" +
+	"    call(parseArgs(line)).then(function (v) {\n" +
+	"      out.appendChild(el(\"span\", format(v) + \"\\n\"));\n" +
+	"      out.scrollTop = out.scrollHeight;\n" +
+	"    }, function (err) {\n" +
+	"      out.appendChild(el(\"span\", \"(error) \" + err.message + \"\\n\", \"error\"));\n" +
+	"      out.scrollTop = out.scrollHeight;\n" +
+	"    });\n" +
+	"  }\n" +
+	"\n" +
+	"  $(\"console-run\").addEventListener(\"click\", runConsole);\n" +
+	"  $(\"console-clear\").addEventListener(\"click\", function () { $(\"console-out\").innerHTML = \"\"; });\n" +
+	"  $(\"console-in\").addEventListener(\"keydown\", function (e) {\n" +
+	"    if (e.key === \"Enter\") {\n" +
+	"      runConsole();\n" +
+	"    } else if (e.key === \"ArrowUp\" && historyPos > 0) {\n" +
+	"      $(\"console-in\").value = history[--historyPos];\n" +
+	"      e.preventDefault();\n" +
+	"    } else if (e.key === \"ArrowDown\") {\n" +
+	"      historyPos = Math.min(historyPos + 1, history.length);\n" +
+	"      $(\"console-in\").value = history[historyPos] || \"\";\n" +
+	"      e.preventDefault();\n" +
+	"    }\n" +
+	"  });\n" +
+	"\n" +
+	"  // info\n" +
+	"\n" +
+	"  loaders.info = function () {\n" +
+	"    var section = $(\"info-section\").value;\n" +
+	"    call(section ? [\"info\", section] : [\"info\"]).then(function (v) {\n" +
+	"      $(\"info-out\").textContent = v;\n" +
+	"    }, fail);\n" +
+	"  };\n" +
+	"  $(\"info-refresh\").addEventListener(\"click\", loaders.info);\n" +
+	"  $(\"info-section\").addEventListener(\"change\", loaders.info);\n" +
+	"\n" +
+	"  // slowlog\n" +
+	"\n" +
+	"  loaders.slowlog = function () {\n" +
+	"    call([\"slowlog\", \"get\", -1]).then(function (entries) {\n" +
+	"      var tbody = $(\"slowlog-out\");\n" +
+	"      tbody.innerHTML = \"\";\n" +
+	"      (entries || []).forEach(function (e) {\n" +
+	"        var tr = el(\"tr\");\n" +
+	"        [e[0], new Date(e[1] * 1000).toLocaleString(), e[2], (e[3] || []).join(\" \"), e[4], e[5]].forEach(function (c) {\n" +
+	"          tr.appendChild(el(\"td\", String(c === undefined ? \"\" : c), \"mono\"));\n" +
+	"        });\n" +
+	"        tbody.appendChild(tr);\n" +
+	"      });\n" +
+	"      if (!entries || entries.length === 0) {\n" +
+	"        var tr = el(\"tr\");\n" +
+	"        var td = el(\"td\", \"The slow log is empty.\", \"muted\");\n" +
+	"        td.colSpan = 6;\n" +
+	"        tr.appendChild(td);\n" +
+	"        tbody.appendChild(tr);\n" +
+	"      }\n" +
+	"    }, fail);\n" +
+	"  };\n" +
+	"  $(\"slowlog-refresh\").addEventListener(\"click\", loaders.slowlog);\n" +
+	"  $(\"slowlog-reset\").addEventListener(\"click\", function () {\n" +
+	"    call([\"slowlog\", \"reset\"]).then(loaders.slowlog, fail);\n" +
+	"  });\n" +
+	"\n" +
+	"  // replication and snapshots\n" +
+	"\n" +
+	"  loaders.replication = function () {\n" +
+	"    call([\"role\"]).then(function (v) { $(\"role-out\").textContent = format(v); }, fail);\n" +
+	"    call([\"info\", \"replication\"]).then(function (v) { $(\"repl-out\").textContent = v; }, fail);\n" +
+	"    call([\"info\", \"persistence\"]).then(function (v) { $(\"persist-out\").textContent = v; }, fail);\n" +
+	"    call([\"lastsave\"]).then(function (t) {\n" +
+	"      $(\"lastsave\").textContent = t > 0 ? \"last snapshot \" + new Date(t * 1000).toLocaleString() : \"no snapshot\";\n" +
+	"    }, fail);\n" +
+	"  };\n" +
+	"  $(\"repl-refresh\").addEventListener(\"click\", loaders.replication);\n" +
+	"  $(\"bgsave\").addEventListener(\"click\", function () {\n" +
+	"    call([\"bgsave\"]).then(function (v) {\n" +
+	"      setStatus(\"\");\n" +
+	"      $(\"lastsave\").textContent = v;\n" +
+	"      setTimeout(loaders.replication, 1000);\n" +
+	"    }, fail);\n" +
+	"  });\n" +
+	"  $(\"save\").addEventListener(\"click\", function () {\n" +
+	"    call([\"save\"]).then(loaders.replication, fail);\n" +
+	"  });\n" +
+	"\n" +
+	"  scan(true);\n" +
+	"})();\n" +
+	"</script>\n" +
+	"</body>\n" +
+	"</html>\n"
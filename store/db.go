@@ -167,3 +167,19 @@ func (db *DB) GetSlice(key []byte) (Slice, error) {
 		}
 	}
 }
+
+// ApproximateSize returns the approximate store size of the key range [start, limit),
+// ok is false if the driver can not estimate it.
+func (db *DB) ApproximateSize(start []byte, limit []byte) (size int64, ok bool, err error) {
+	d, ok := db.db.(driver.IApproximateSizer)
+	if !ok {
+		return 0, false, nil
+	}
+
+	sizes, err := d.ApproximateSizes([]driver.KeyRange{{Start: start, Limit: limit}})
+	if err != nil {
+		return 0, true, err
+	}
+
+	return sizes[0], true, nil
+}
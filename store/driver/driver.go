@@ -55,3 +55,14 @@ type IWriteBatch interface {
 type ISliceGeter interface {
 	GetSlice(key []byte) (ISlice, error)
 }
+
+type KeyRange struct {
+	Start []byte
+	Limit []byte
+}
+
+// IApproximateSizer is optional, drivers implement it when they can estimate
+// the store size of the key ranges [Start, Limit) cheaply.
+type IApproximateSizer interface {
+	ApproximateSizes(ranges []KeyRange) ([]int64, error)
+}
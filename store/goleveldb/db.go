@@ -49,8 +49,10 @@ type DB struct {
 }
 
 func (s Store) Open(path string, cfg *config.Config) (driver.IDB, error) {
-	if err := os.MkdirAll(path, 0755); err != nil {
-		return nil, err
+	if !cfg.DBReadOnly {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, err
+		}
 	}
 
 	db := new(DB)
@@ -58,6 +60,7 @@ func (s Store) Open(path string, cfg *config.Config) (driver.IDB, error) {
 	db.cfg = &cfg.LevelDB
 
 	db.initOpts()
+	db.opts.ReadOnly = cfg.DBReadOnly
 
 	var err error
 	db.db, err = leveldb.OpenFile(db.path, db.opts)
@@ -198,6 +201,20 @@ func (db *DB) Compact() error {
 	return db.db.CompactRange(util.Range{nil, nil})
 }
 
+func (db *DB) ApproximateSizes(ranges []driver.KeyRange) ([]int64, error) {
+	r := make([]util.Range, len(ranges))
+	for i, v := range ranges {
+		r[i] = util.Range{Start: v.Start, Limit: v.Limit}
+	}
+
+	sizes, err := db.db.SizeOf(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return []int64(sizes), nil
+}
+
 func init() {
 	driver.Register(Store{})
 	driver.Register(MemStore{})
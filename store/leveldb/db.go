@@ -6,11 +6,13 @@ package leveldb
 /*
 #cgo LDFLAGS: -lleveldb
 #include <leveldb/c.h>
+#include <stdlib.h>
 #include "leveldb_ext.h"
 */
 import "C"
 
 import (
+	"errors"
 	"os"
 	"runtime"
 	"unsafe"
@@ -29,6 +31,10 @@ func (s Store) String() string {
 }
 
 func (s Store) Open(path string, cfg *config.Config) (driver.IDB, error) {
+	if cfg.DBReadOnly {
+		return nil, errors.New("leveldb does not support read only open")
+	}
+
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
@@ -309,6 +315,43 @@ func (db *DB) GetSlice(key []byte) (driver.ISlice, error) {
 	return db.getSlice(db.readOpts, key)
 }
 
+func (db *DB) ApproximateSizes(ranges []driver.KeyRange) ([]int64, error) {
+	n := len(ranges)
+	if n == 0 {
+		return nil, nil
+	}
+
+	starts := make([]*C.char, n)
+	startLens := make([]C.size_t, n)
+	limits := make([]*C.char, n)
+	limitLens := make([]C.size_t, n)
+
+	for i, r := range ranges {
+		starts[i] = (*C.char)(C.CBytes(r.Start))
+		startLens[i] = C.size_t(len(r.Start))
+		limits[i] = (*C.char)(C.CBytes(r.Limit))
+		limitLens[i] = C.size_t(len(r.Limit))
+	}
+
+	defer func() {
+		for i := 0; i < n; i++ {
+			C.free(unsafe.Pointer(starts[i]))
+			C.free(unsafe.Pointer(limits[i]))
+		}
+	}()
+
+	sizes := make([]C.uint64_t, n)
+
+	C.leveldb_approximate_sizes(db.db, C.int(n),
+		&starts[0], &startLens[0], &limits[0], &limitLens[0], &sizes[0])
+
+	v := make([]int64, n)
+	for i := range sizes {
+		v[i] = int64(sizes[i])
+	}
+	return v, nil
+}
+
 func init() {
 	driver.Register(Store{})
 }
@@ -30,13 +30,16 @@ func (s Store) String() string {
 }
 
 func (s Store) Open(path string, cfg *config.Config) (driver.IDB, error) {
-	if err := os.MkdirAll(path, 0755); err != nil {
-		return nil, err
+	if !cfg.DBReadOnly {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, err
+		}
 	}
 
 	db := new(DB)
 	db.path = path
 	db.cfg = &cfg.RocksDB
+	db.readOnly = cfg.DBReadOnly
 
 	if err := db.open(); err != nil {
 		return nil, err
@@ -74,6 +77,8 @@ type DB struct {
 
 	cfg *config.RocksDBConfig
 
+	readOnly bool
+
 	db *C.rocksdb_t
 
 	env *Env
@@ -100,7 +105,11 @@ func (db *DB) open() error {
 	ldbname := C.CString(db.path)
 	defer C.free(unsafe.Pointer(ldbname))
 
-	db.db = C.rocksdb_open(db.opts.Opt, ldbname, &errStr)
+	if db.readOnly {
+		db.db = C.rocksdb_open_for_read_only(db.opts.Opt, ldbname, 0, &errStr)
+	} else {
+		db.db = C.rocksdb_open(db.opts.Opt, ldbname, &errStr)
+	}
 	if errStr != nil {
 		db.db = nil
 		return saveError(errStr)
@@ -337,6 +346,43 @@ func (db *DB) GetSlice(key []byte) (driver.ISlice, error) {
 	return db.getSlice(db.readOpts, key)
 }
 
+func (db *DB) ApproximateSizes(ranges []driver.KeyRange) ([]int64, error) {
+	n := len(ranges)
+	if n == 0 {
+		return nil, nil
+	}
+
+	starts := make([]*C.char, n)
+	startLens := make([]C.size_t, n)
+	limits := make([]*C.char, n)
+	limitLens := make([]C.size_t, n)
+
+	for i, r := range ranges {
+		starts[i] = (*C.char)(C.CBytes(r.Start))
+		startLens[i] = C.size_t(len(r.Start))
+		limits[i] = (*C.char)(C.CBytes(r.Limit))
+		limitLens[i] = C.size_t(len(r.Limit))
+	}
+
+	defer func() {
+		for i := 0; i < n; i++ {
+			C.free(unsafe.Pointer(starts[i]))
+			C.free(unsafe.Pointer(limits[i]))
+		}
+	}()
+
+	sizes := make([]C.uint64_t, n)
+
+	C.rocksdb_approximate_sizes(db.db, C.int(n),
+		&starts[0], &startLens[0], &limits[0], &limitLens[0], &sizes[0])
+
+	v := make([]int64, n)
+	for i := range sizes {
+		v[i] = int64(sizes[i])
+	}
+	return v, nil
+}
+
 func init() {
 	driver.Register(Store{})
 }
@@ -29,7 +29,11 @@ func Open(cfg *config.Config) (*DB, error) {
 
 	path := getStorePath(cfg)
 
-	if err := os.MkdirAll(path, 0755); err != nil {
+	if cfg.DBReadOnly {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
 
@@ -41,6 +41,7 @@ func testStore(db *DB, t *testing.T) {
 	testIterator(db, t)
 	testSnapshot(db, t)
 	testBatchData(db, t)
+	testTx(db, t)
 }
 
 func testClear(db *DB, t *testing.T) {
@@ -367,3 +368,94 @@ func testBatchData(db *DB, t *testing.T) {
 		t.Fatalf("%v != %v", kvs, expected)
 	}
 }
+
+func testTx(db *DB, t *testing.T) {
+	testClear(db, t)
+
+	for _, i := range []int{1, 3, 5, 7} {
+		db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte("value"))
+	}
+
+	tx := db.NewTx()
+
+	w := tx.NewWriteBatch()
+	w.Delete([]byte("key_3"))
+	w.Put([]byte("key_4"), []byte("value"))
+	w.Put([]byte("key_9"), []byte("value"))
+
+	// not committed yet
+	if v, err := tx.Get([]byte("key_4")); err != nil || v != nil {
+		t.Fatal(v, err)
+	}
+
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	w.Put([]byte("key_0"), []byte("value"))
+	w.Rollback()
+
+	if v, err := tx.Get([]byte("key_4")); err != nil || string(v) != "value" {
+		t.Fatal(v, err)
+	} else if v, err := tx.Get([]byte("key_3")); err != nil || v != nil {
+		t.Fatal(v, err)
+	} else if v, err := tx.Get([]byte("key_5")); err != nil || string(v) != "value" {
+		t.Fatal(v, err)
+	} else if v, err := db.Get([]byte("key_4")); err != nil || v != nil {
+		t.Fatal(v, err)
+	}
+
+	if err := checkIterator(tx.RangeIterator(nil, nil, RangeClose), 1, 4, 5, 7, 9); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkIterator(tx.RevRangeIterator(nil, nil, RangeClose), 9, 7, 5, 4, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkIterator(tx.RangeLimitIterator([]byte("key_2"), []byte("key_7"), RangeROpen, 1, 5), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkIterator(tx.RevRangeIterator([]byte("key_2"), []byte("key_8"), RangeClose), 7, 5, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// change the direction in the middle
+	it := tx.NewIterator()
+	it.Seek([]byte("key_4"))
+	keys := []string{}
+	for _, next := range []bool{true, true, false, false, false, true} {
+		keys = append(keys, string(it.Key()))
+		if next {
+			it.Next()
+		} else {
+			it.Prev()
+		}
+	}
+	keys = append(keys, string(it.Key()))
+	it.Close()
+
+	if s := fmt.Sprint(keys); s != "[key_4 key_5 key_7 key_5 key_4 key_1 key_4]" {
+		t.Fatal(s)
+	}
+
+	if err := checkIterator(db.RangeIterator(nil, nil, RangeClose), 1, 3, 5, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.WriteBatch().Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkIterator(db.RangeIterator(nil, nil, RangeClose), 1, 4, 5, 7, 9); err != nil {
+		t.Fatal(err)
+	}
+
+	tx.Rollback()
+	if tx.Len() != 0 {
+		t.Fatal(tx.Len())
+	}
+
+	testClear(db, t)
+}
@@ -0,0 +1,368 @@
+package store
+
+import (
+	"bytes"
+
+	"github.com/r0123r/vredis/store/driver"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+)
+
+const (
+	txDeleted byte = 0
+	txPut     byte = 1
+)
+
+// Tx buffers the writes of its batches in memory on top of the DB. The reads
+// of the Tx see the committed batches of the Tx, but nothing is written into
+// the DB before the caller commits the batch returned by WriteBatch.
+type Tx struct {
+	db *DB
+
+	// values are prefixed with txPut, or are a single txDeleted
+	mem *memdb.DB
+
+	// the batches of the Tx are not counted in the DB stat
+	st *Stat
+}
+
+func (db *DB) NewTx() *Tx {
+	tx := new(Tx)
+	tx.db = db
+	tx.mem = memdb.New(comparer.DefaultComparer, 0)
+	tx.st = new(Stat)
+	return tx
+}
+
+func (tx *Tx) Get(key []byte) ([]byte, error) {
+	v, err := tx.mem.Get(key)
+	if err == memdb.ErrNotFound {
+		return tx.db.Get(key)
+	} else if err != nil {
+		return nil, err
+	} else if v[0] == txDeleted {
+		return nil, nil
+	}
+
+	return append([]byte{}, v[1:]...), nil
+}
+
+func (tx *Tx) GetSlice(key []byte) (Slice, error) {
+	v, err := tx.Get(key)
+	if err != nil {
+		return nil, err
+	} else if v == nil {
+		return nil, nil
+	}
+
+	return driver.GoSlice(v), nil
+}
+
+func (tx *Tx) Put(key []byte, value []byte) error {
+	return tx.mem.Put(key, append([]byte{txPut}, value...))
+}
+
+func (tx *Tx) Delete(key []byte) error {
+	return tx.mem.Put(key, []byte{txDeleted})
+}
+
+// Len returns the number of the keys written by the Tx.
+func (tx *Tx) Len() int {
+	return tx.mem.Len()
+}
+
+func (tx *Tx) NewIterator() *Iterator {
+	tx.db.st.IterNum.Add(1)
+
+	it := new(Iterator)
+	it.it = &txIterator{base: tx.db.db.NewIterator(), mem: tx.mem.NewIterator(nil)}
+	it.st = tx.db.st
+
+	return it
+}
+
+// NewWriteBatch returns a batch which writes into the Tx when committed.
+func (tx *Tx) NewWriteBatch() *WriteBatch {
+	wb := new(WriteBatch)
+	wb.wb = &txWriteBatch{tx: tx}
+	wb.st = tx.st
+	return wb
+}
+
+// WriteBatch returns a DB batch with all the writes of the Tx.
+func (tx *Tx) WriteBatch() *WriteBatch {
+	wb := tx.db.NewWriteBatch()
+
+	it := tx.mem.NewIterator(nil)
+	for it.First(); it.Valid(); it.Next() {
+		if v := it.Value(); v[0] == txDeleted {
+			wb.Delete(it.Key())
+		} else {
+			wb.Put(it.Key(), v[1:])
+		}
+	}
+	it.Release()
+
+	return wb
+}
+
+// Rollback drops all the writes of the Tx.
+func (tx *Tx) Rollback() {
+	tx.mem.Reset()
+}
+
+func (tx *Tx) RangeIterator(min []byte, max []byte, rangeType uint8) *RangeLimitIterator {
+	return NewRangeLimitIterator(tx.NewIterator(), &Range{min, max, rangeType}, &Limit{0, -1})
+}
+
+func (tx *Tx) RevRangeIterator(min []byte, max []byte, rangeType uint8) *RangeLimitIterator {
+	return NewRevRangeLimitIterator(tx.NewIterator(), &Range{min, max, rangeType}, &Limit{0, -1})
+}
+
+func (tx *Tx) RangeLimitIterator(min []byte, max []byte, rangeType uint8, offset int, count int) *RangeLimitIterator {
+	return NewRangeLimitIterator(tx.NewIterator(), &Range{min, max, rangeType}, &Limit{offset, count})
+}
+
+func (tx *Tx) RevRangeLimitIterator(min []byte, max []byte, rangeType uint8, offset int, count int) *RangeLimitIterator {
+	return NewRevRangeLimitIterator(tx.NewIterator(), &Range{min, max, rangeType}, &Limit{offset, count})
+}
+
+type txItem struct {
+	key   []byte
+	value []byte
+	put   bool
+}
+
+// txWriteBatch keeps the writes until the commit, like a DB batch.
+type txWriteBatch struct {
+	tx    *Tx
+	items []txItem
+}
+
+func (wb *txWriteBatch) Put(key []byte, value []byte) {
+	wb.items = append(wb.items, txItem{append([]byte{}, key...), append([]byte{}, value...), true})
+}
+
+func (wb *txWriteBatch) Delete(key []byte) {
+	wb.items = append(wb.items, txItem{append([]byte{}, key...), nil, false})
+}
+
+func (wb *txWriteBatch) Commit() error {
+	var err error
+	for _, item := range wb.items {
+		if item.put {
+			err = wb.tx.Put(item.key, item.value)
+		} else {
+			err = wb.tx.Delete(item.key)
+		}
+		if err != nil {
+			break
+		}
+	}
+	wb.items = wb.items[0:0]
+	return err
+}
+
+func (wb *txWriteBatch) SyncCommit() error {
+	return wb.Commit()
+}
+
+func (wb *txWriteBatch) Rollback() error {
+	wb.items = wb.items[0:0]
+	return nil
+}
+
+func (wb *txWriteBatch) Data() []byte {
+	b := new(BatchData)
+	for _, item := range wb.items {
+		if item.put {
+			b.Put(item.key, item.value)
+		} else {
+			b.Delete(item.key)
+		}
+	}
+	return b.Dump()
+}
+
+func (wb *txWriteBatch) Close() {
+	wb.items = nil
+}
+
+// txIterator merges the writes of the Tx with a DB iterator, the Tx
+// writes hide the DB keys, and the deleted keys are skipped.
+type txIterator struct {
+	base driver.IIterator
+	mem  iterator.Iterator
+
+	backward bool
+
+	// the current key, and whether it comes from mem
+	key     []byte
+	fromMem bool
+	valid   bool
+}
+
+func (it *txIterator) Close() error {
+	it.base.Close()
+	it.mem.Release()
+	return nil
+}
+
+func (it *txIterator) First() {
+	it.base.First()
+	it.mem.First()
+	it.backward = false
+	it.findNext()
+}
+
+func (it *txIterator) Last() {
+	it.base.Last()
+	it.mem.Last()
+	it.backward = true
+	it.findPrev()
+}
+
+func (it *txIterator) Seek(key []byte) {
+	it.base.Seek(key)
+	it.mem.Seek(key)
+	it.backward = false
+	it.findNext()
+}
+
+func (it *txIterator) Next() {
+	if !it.valid {
+		return
+	}
+
+	key := it.key
+	if it.backward {
+		// both are before the key, move them after it
+		it.base.Seek(key)
+		if it.base.Valid() && bytes.Equal(it.base.Key(), key) {
+			it.base.Next()
+		}
+		it.mem.Seek(key)
+		if it.mem.Valid() && bytes.Equal(it.mem.Key(), key) {
+			it.mem.Next()
+		}
+		it.backward = false
+	} else {
+		if it.base.Valid() && bytes.Equal(it.base.Key(), key) {
+			it.base.Next()
+		}
+		if it.mem.Valid() && bytes.Equal(it.mem.Key(), key) {
+			it.mem.Next()
+		}
+	}
+
+	it.findNext()
+}
+
+func (it *txIterator) Prev() {
+	if !it.valid {
+		return
+	}
+
+	key := it.key
+	if !it.backward {
+		// both are at or after the key, move them before it
+		if it.base.Seek(key); it.base.Valid() {
+			it.base.Prev()
+		} else {
+			it.base.Last()
+		}
+		if it.mem.Seek(key); it.mem.Valid() {
+			it.mem.Prev()
+		} else {
+			it.mem.Last()
+		}
+		it.backward = true
+	} else {
+		if it.base.Valid() && bytes.Equal(it.base.Key(), key) {
+			it.base.Prev()
+		}
+		if it.mem.Valid() && bytes.Equal(it.mem.Key(), key) {
+			it.mem.Prev()
+		}
+	}
+
+	it.findPrev()
+}
+
+// findNext settles on the smallest key of both, skipping the deleted ones.
+func (it *txIterator) findNext() {
+	it.find(1)
+}
+
+// findPrev settles on the largest key of both, skipping the deleted ones.
+func (it *txIterator) findPrev() {
+	it.find(-1)
+}
+
+func (it *txIterator) find(dir int) {
+	for {
+		baseValid, memValid := it.base.Valid(), it.mem.Valid()
+		if !baseValid && !memValid {
+			it.valid = false
+			it.key = nil
+			return
+		}
+
+		c := 0
+		if !memValid {
+			c = -dir
+		} else if baseValid {
+			c = bytes.Compare(it.base.Key(), it.mem.Key())
+		} else {
+			c = dir
+		}
+
+		if c*dir < 0 {
+			it.key = append(it.key[0:0], it.base.Key()...)
+			it.fromMem = false
+			it.valid = true
+			return
+		}
+
+		if it.mem.Value()[0] != txDeleted {
+			it.key = append(it.key[0:0], it.mem.Key()...)
+			it.fromMem = true
+			it.valid = true
+			return
+		}
+
+		// skip the deleted key, hiding the same DB key
+		if dir > 0 {
+			if c == 0 {
+				it.base.Next()
+			}
+			it.mem.Next()
+		} else {
+			if c == 0 {
+				it.base.Prev()
+			}
+			it.mem.Prev()
+		}
+	}
+}
+
+func (it *txIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *txIterator) Key() []byte {
+	if !it.valid {
+		return nil
+	}
+	return it.key
+}
+
+func (it *txIterator) Value() []byte {
+	if !it.valid {
+		return nil
+	} else if it.fromMem {
+		return it.mem.Value()[1:]
+	}
+	return it.base.Value()
+}
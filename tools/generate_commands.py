@@ -1,6 +1,7 @@
 #!/usr/bin/env python
 
 import json
+import re
 import time
 import sys
 import os
@@ -29,12 +30,48 @@ def json_to_go_array(json_path, go_path):
         generate_time(g_fp)
         g_fp.write("package main\n\nvar helpCommands = [][]string{\n")
         _json_sorted = dict(sorted(_json.items(), key=lambda x: x[0]))
-        for k, v in _json_sorted.iteritems():
+        for k, v in _json_sorted.items():
             g_fp.write('\t{"%s", "%s", "%s"},\n' % (k, v["arguments"], v["group"]))
         g_fp.write("}\n")
     g_fp.close()
 
 
+def md_summaries(md_path):
+    """First sentence of every command section in `commands.md`"""
+    summaries = {}
+    name = None
+    with open(md_path) as fp:
+        for line in fp:
+            line = line.strip()
+            if line.startswith("### "):
+                name = line[4:].split(" ")[0]
+            elif name is not None and line:
+                if not line.startswith("**"):
+                    summaries[name] = re.split(r"\.( |$)", line)[0].replace('"', '\\"')
+                name = None
+    return summaries
+
+
+def json_to_go_docs(json_path, go_path):
+    """Convert `commands.json` and `commands.md` to server/command_docs.go"""
+    md_path = os.path.join(os.path.dirname(json_path), "commands.md")
+    summaries = md_summaries(md_path)
+
+    g_fp = open(go_path, "w")
+    with open(json_path) as fp:
+        _json = json.load(fp)
+        generate_time(g_fp)
+        g_fp.write("package server\n\nvar commandDocs = map[string]commandDoc{\n")
+        _json_sorted = dict(sorted(_json.items(), key=lambda x: x[0]))
+        for k, v in _json_sorted.items():
+            if " " in k:
+                continue
+            g_fp.write('\t"%s": {"%s", "%s", "%s"},\n' % (
+                k.lower(), v["arguments"].strip(), v["group"], summaries.get(k, "")))
+        g_fp.write("}\n")
+    g_fp.close()
+
+
 def generate_time(fp):
     fp.write("//This file was generated by .tools/generate_commands.py on %s \n" %
              time.strftime('%a %b %d %Y %H:%M:%S %z'))
@@ -52,6 +89,10 @@ if __name__ == "__main__":
         
         python generate.py /path/to/commands.json /path/to/const.go
 
+    3. for server/command_docs.go
+
+        python generate.py /path/to/commands.json /path/to/command_docs.go
+
     """
 
     if len(sys.argv) != 3:
@@ -66,5 +107,8 @@ if __name__ == "__main__":
     elif dst_path_base.startswith("const.go"):
         json_to_go_array(src_path, dst_path)
 
+    elif dst_path_base.startswith("command_docs.go"):
+        json_to_go_docs(src_path, dst_path)
+
     else:
-        print "Not support arguments"
+        print("Not support arguments")
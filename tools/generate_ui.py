@@ -0,0 +1,38 @@
+#!/usr/bin/env python
+
+import io
+import json
+import os
+import sys
+import time
+
+
+def html_to_go(html_path, go_path):
+    """Convert `server/ui/index.html` to server/ui_assets.go"""
+    with io.open(html_path, encoding="utf-8") as fp:
+        lines = fp.read().splitlines(True)
+
+    with io.open(go_path, "w", encoding="utf-8") as g_fp:
+        g_fp.write(u"// This file was generated by .tools/generate_ui.py on %s\n" %
+                   time.strftime('%a %b %d %Y %H:%M:%S %z'))
+        g_fp.write(u"package server\n\n")
+        g_fp.write(u"// uiIndexHTML is the page of the admin console, server/ui/index.html.\n")
+        g_fp.write(u"const uiIndexHTML = \"\" +\n")
+        for i, line in enumerate(lines):
+            # a JSON string is a Go string literal
+            g_fp.write(u"\t%s" % json.dumps(line))
+            g_fp.write(u" +\n" if i < len(lines) - 1 else u"\n")
+
+
+if __name__ == "__main__":
+    usage = """
+    Usage: python %s src_path dst_path
+
+        python generate_ui.py /path/to/server/ui/index.html /path/to/server/ui_assets.go
+
+    """
+
+    if len(sys.argv) != 3:
+        sys.exit(usage % os.path.basename(sys.argv[0]))
+
+    html_to_go(sys.argv[1], sys.argv[2])